@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"math"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/smtp"
+	"net/textproto"
 	"strconv"
 	"strings"
 	"time"
@@ -21,15 +25,22 @@ import (
 )
 
 const (
-	ChannelTypeSMTP   = "smtp"
-	ChannelTypeResend = "resend"
-	ChannelTypeBrevo  = "brevo"
+	ChannelTypeSMTP      = "smtp"
+	ChannelTypeResend    = "resend"
+	ChannelTypeBrevo     = "brevo"
+	ChannelTypeWebhook   = "webhook"
+	ChannelTypeSlack     = "slack"
+	ChannelTypeTeams     = "teams"
+	ChannelTypePagerDuty = "pagerduty"
 )
 
 const (
 	EventTypePolicyViolation = "policy.violation"
 	EventTypeScheduleFailed  = "schedule.failed"
 	EventTypeScheduleSlow    = "schedule.slow"
+
+	EventTypeScheduleDeliveryFailed = "schedule.delivery_failed"
+	EventTypeMetricThreshold        = "metric.threshold"
 )
 
 const (
@@ -110,9 +121,26 @@ func (d *Dispatcher) materializeEventJobs() {
 		return
 	}
 
-	routesByRule := make(map[string][]database.AlertRuleRouteView)
 	now := time.Now().UTC()
+	silences, err := d.db.ListActiveAlertSilences(now)
+	if err != nil {
+		slog.Error("Alert dispatcher failed to list silences", "error", err)
+		return
+	}
+	windows, err := d.db.ListEnabledAlertMaintenanceWindows()
+	if err != nil {
+		slog.Error("Alert dispatcher failed to list maintenance windows", "error", err)
+		return
+	}
+
+	routesByRule := make(map[string][]database.AlertRuleRouteView)
 	for _, event := range events {
+		if reason := d.suppressionFor(event, silences, windows); reason != "" {
+			if err := d.db.MarkAlertEventSuppressed(event.ID, reason); err != nil {
+				slog.Warn("Alert dispatcher failed to mark event suppressed", "event", event.ID, "error", err)
+			}
+			continue
+		}
 		for _, rule := range rules {
 			if !ruleMatchesEvent(rule, event) {
 				continue
@@ -127,7 +155,26 @@ func (d *Dispatcher) materializeEventJobs() {
 				routesByRule[rule.ID] = routes
 			}
 			for _, route := range routes {
-				if len(route.Recipients) == 0 {
+				if len(route.Recipients) == 0 && RequiresRecipients(route.ChannelType) {
+					continue
+				}
+				if event.Resolves {
+					// Resolutions skip digests and cooldowns and only go to
+					// routes that notified about the condition.
+					if !SupportsResolve(route.ChannelType) || event.Fingerprint == nil {
+						continue
+					}
+					open, err := d.db.HasOpenAlertDispatch(route.ID, *event.Fingerprint)
+					if err != nil {
+						slog.Warn("Alert dispatcher resolve check failed", "route", route.ID, "error", err)
+						continue
+					}
+					if !open {
+						continue
+					}
+					if _, err := d.db.CreateAlertDispatchJob(event.ID, rule.ID, route.ID, route.ChannelID, rule.MaxAttempts, now); err != nil {
+						slog.Error("Alert dispatcher failed to create resolve job", "event", event.ID, "rule", rule.ID, "route", route.ID, "error", err)
+					}
 					continue
 				}
 				deliveryMode := strings.ToLower(strings.TrimSpace(route.DeliveryMode))
@@ -169,13 +216,20 @@ func (d *Dispatcher) processDueJobs() {
 	}
 
 	for _, job := range jobs {
+		if job.EventAcknowledged && !job.EventResolves {
+			// Acknowledged alerts stop retrying and never escalate.
+			if err := d.db.MarkAlertDispatchJobCancelled(job.ID, "alert acknowledged"); err != nil {
+				slog.Warn("Alert dispatcher failed to cancel acknowledged job", "job", job.ID, "error", err)
+			}
+			continue
+		}
 		if err := d.db.MarkAlertDispatchJobSending(job.ID); err != nil {
 			slog.Warn("Alert dispatcher failed to mark job sending", "job", job.ID, "error", err)
 			continue
 		}
 
 		recipients := parseRecipients(job.RouteRecipientsJSON)
-		if len(recipients) == 0 {
+		if len(recipients) == 0 && RequiresRecipients(job.ChannelType) {
 			_ = d.db.MarkAlertDispatchJobFailed(job.ID, "route has no recipients")
 			continue
 		}
@@ -197,14 +251,15 @@ func (d *Dispatcher) processDueJobs() {
 			job,
 		)
 		body := renderTemplate(coalesce(job.RuleBodyTemplate, defaultBody(job)), job)
+		event := jobEvent(job, subject, body)
 
-		providerMessageID, err := d.sendByChannelType(context.Background(), job.ChannelType, channelConfig, recipients, subject, body)
+		providerMessageID, err := d.sendByChannelType(context.Background(), job.ChannelType, channelConfig, recipients, subject, body, event)
 
 		if err != nil {
 			nextAttempt := job.AttemptCount + 1
 			if nextAttempt >= job.MaxAttempts {
 				failureMessage := err.Error()
-				if escalationNote := d.tryEscalationForDispatchJob(job, subject, body, failureMessage, nextAttempt); escalationNote != "" {
+				if escalationNote := d.tryEscalationForDispatchJob(job, subject, body, event, failureMessage, nextAttempt); escalationNote != "" {
 					failureMessage = failureMessage + " | " + escalationNote
 				}
 				_ = d.db.MarkAlertDispatchJobFailed(job.ID, failureMessage)
@@ -238,7 +293,7 @@ func (d *Dispatcher) processDueDigests() {
 		}
 
 		recipients := parseRecipients(digest.RouteRecipientsJSON)
-		if len(recipients) == 0 {
+		if len(recipients) == 0 && RequiresRecipients(digest.ChannelType) {
 			_ = d.db.MarkAlertRouteDigestFailed(digest.ID, "digest route has no recipients")
 			continue
 		}
@@ -256,13 +311,21 @@ func (d *Dispatcher) processDueDigests() {
 
 		subject := fmt.Sprintf("[CH-UI Digest][%s][%s] %d events", strings.ToUpper(digest.Severity), digest.EventType, digest.EventCount)
 		body := renderDigestBody(digest)
+		event := &Event{
+			ID:        digest.ID,
+			Type:      digest.EventType,
+			Severity:  digest.Severity,
+			Title:     subject,
+			Message:   body,
+			CreatedAt: digest.BucketEnd,
+		}
 
-		_, err = d.sendByChannelType(context.Background(), digest.ChannelType, channelConfig, recipients, subject, body)
+		_, err = d.sendByChannelType(context.Background(), digest.ChannelType, channelConfig, recipients, subject, body, event)
 		if err != nil {
 			nextAttempt := digest.AttemptCount + 1
 			if nextAttempt >= digest.MaxAttempts {
 				failureMessage := err.Error()
-				if escalationNote := d.tryEscalationForDigest(digest, subject, body, failureMessage, nextAttempt); escalationNote != "" {
+				if escalationNote := d.tryEscalationForDigest(digest, subject, body, event, failureMessage, nextAttempt); escalationNote != "" {
 					failureMessage = failureMessage + " | " + escalationNote
 				}
 				_ = d.db.MarkAlertRouteDigestFailed(digest.ID, failureMessage)
@@ -279,22 +342,58 @@ func (d *Dispatcher) processDueDigests() {
 	}
 }
 
+// Attachment is a file sent along with an email notification.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
 // SendDirect sends a one-off notification without queueing.
 func SendDirect(ctx context.Context, channelType string, channelConfig map[string]interface{}, recipients []string, subject, body string) (string, error) {
+	return SendDirectWithAttachments(ctx, channelType, channelConfig, recipients, subject, body, nil)
+}
+
+// SendDirectWithAttachments sends a one-off notification with files attached.
+func SendDirectWithAttachments(ctx context.Context, channelType string, channelConfig map[string]interface{}, recipients []string, subject, body string, attachments []Attachment) (string, error) {
+	timeout := 15 * time.Second
+	if len(attachments) > 0 {
+		timeout = 2 * time.Minute
+	}
 	d := &Dispatcher{
-		http: &http.Client{Timeout: 15 * time.Second},
+		http: &http.Client{Timeout: timeout},
 	}
-	return d.sendByChannelType(ctx, channelType, channelConfig, recipients, subject, body)
+	return d.sendByChannelType(ctx, channelType, channelConfig, recipients, subject, body, nil, attachments...)
 }
 
-func (d *Dispatcher) sendByChannelType(ctx context.Context, channelType string, channelConfig map[string]interface{}, recipients []string, subject, body string) (string, error) {
-	switch strings.ToLower(channelType) {
+// sendByChannelType delivers a notification. Email channels send the
+// subject and body to the recipients; webhook-based channels post the event,
+// which is built from the subject and body when nil.
+func (d *Dispatcher) sendByChannelType(ctx context.Context, channelType string, channelConfig map[string]interface{}, recipients []string, subject, body string, event *Event, attachments ...Attachment) (string, error) {
+	channelType = strings.ToLower(channelType)
+	if !RequiresRecipients(channelType) {
+		if len(attachments) > 0 {
+			return "", fmt.Errorf("%s channels cannot send attachments", channelType)
+		}
+		if event == nil {
+			event = eventFromMessage(subject, body)
+		}
+	}
+	switch channelType {
 	case ChannelTypeSMTP:
-		return d.sendSMTP(ctx, channelConfig, recipients, subject, body)
+		return d.sendSMTP(ctx, channelConfig, recipients, subject, body, attachments)
 	case ChannelTypeResend:
-		return d.sendResend(ctx, channelConfig, recipients, subject, body)
+		return d.sendResend(ctx, channelConfig, recipients, subject, body, attachments)
 	case ChannelTypeBrevo:
-		return d.sendBrevo(ctx, channelConfig, recipients, subject, body)
+		return d.sendBrevo(ctx, channelConfig, recipients, subject, body, attachments)
+	case ChannelTypeWebhook:
+		return d.sendWebhook(ctx, channelConfig, subject, body, event)
+	case ChannelTypeSlack:
+		return d.sendSlack(ctx, channelConfig, subject, event)
+	case ChannelTypeTeams:
+		return d.sendTeams(ctx, channelConfig, event)
+	case ChannelTypePagerDuty:
+		return d.sendPagerDuty(ctx, channelConfig, event)
 	default:
 		return "", fmt.Errorf("unsupported channel type: %s", channelType)
 	}
@@ -375,6 +474,40 @@ func defaultBody(job database.AlertDispatchJobWithDetails) string {
 	return b.String()
 }
 
+// jobEvent builds the event webhook channels post for a dispatch job. Rule
+// subject and body templates replace the event title and message, as they
+// do in emails.
+func jobEvent(job database.AlertDispatchJobWithDetails, subject, body string) *Event {
+	title := job.EventTitle
+	if coalesce(job.RuleSubjectTemplate, "") != "" {
+		title = subject
+	}
+	message := job.EventMessage
+	if coalesce(job.RuleBodyTemplate, "") != "" {
+		message = body
+	}
+	return &Event{
+		ID:          job.EventID,
+		Type:        job.EventType,
+		Severity:    job.EventSeverity,
+		Title:       title,
+		Message:     message,
+		Fingerprint: coalesce(job.EventFingerprint, ""),
+		RuleName:    job.RuleName,
+		PayloadJSON: coalesce(job.EventPayloadJSON, ""),
+		CreatedAt:   job.CreatedAt,
+		Resolve:     job.EventResolves,
+	}
+}
+
+// escalatedEvent marks an event as escalated after its route failed.
+func escalatedEvent(event *Event, rootErr string) *Event {
+	escalated := *event
+	escalated.Title = "[ESCALATED] " + event.Title
+	escalated.Message = event.Message + "\n\nEscalation reason:\n" + rootErr
+	return &escalated
+}
+
 func renderTemplate(tpl string, job database.AlertDispatchJobWithDetails) string {
 	out := tpl
 	repl := map[string]string{
@@ -408,7 +541,7 @@ func retryBackoff(attempt int) time.Duration {
 	return d
 }
 
-func (d *Dispatcher) tryEscalationForDispatchJob(job database.AlertDispatchJobWithDetails, subject, body, rootErr string, failedAttempt int) string {
+func (d *Dispatcher) tryEscalationForDispatchJob(job database.AlertDispatchJobWithDetails, subject, body string, event *Event, rootErr string, failedAttempt int) string {
 	if job.RouteEscalationChannelID == nil || strings.TrimSpace(*job.RouteEscalationChannelID) == "" {
 		return ""
 	}
@@ -422,7 +555,7 @@ func (d *Dispatcher) tryEscalationForDispatchJob(job database.AlertDispatchJobWi
 	if len(recipients) == 0 {
 		recipients = parseRecipients(job.RouteRecipientsJSON)
 	}
-	if len(recipients) == 0 {
+	if len(recipients) == 0 && RequiresRecipients(*job.EscalationChannelType) {
 		return "escalation skipped: no escalation recipients"
 	}
 	decrypted, err := crypto.Decrypt(*job.EscalationChannelConfigEncrypted, d.cfg.AppSecretKey)
@@ -435,13 +568,13 @@ func (d *Dispatcher) tryEscalationForDispatchJob(job database.AlertDispatchJobWi
 	}
 	escalationSubject := "[ESCALATED] " + subject
 	escalationBody := body + "\n\nEscalation reason:\n" + rootErr
-	if _, err := d.sendByChannelType(context.Background(), *job.EscalationChannelType, cfg, recipients, escalationSubject, escalationBody); err != nil {
+	if _, err := d.sendByChannelType(context.Background(), *job.EscalationChannelType, cfg, recipients, escalationSubject, escalationBody, escalatedEvent(event, rootErr)); err != nil {
 		return "escalation send failed: " + err.Error()
 	}
 	return "escalated via " + coalesce(job.EscalationChannelName, "channel")
 }
 
-func (d *Dispatcher) tryEscalationForDigest(digest database.AlertRouteDigestWithDetails, subject, body, rootErr string, failedAttempt int) string {
+func (d *Dispatcher) tryEscalationForDigest(digest database.AlertRouteDigestWithDetails, subject, body string, event *Event, rootErr string, failedAttempt int) string {
 	if digest.EscalationChannelID == nil || strings.TrimSpace(*digest.EscalationChannelID) == "" {
 		return ""
 	}
@@ -455,7 +588,7 @@ func (d *Dispatcher) tryEscalationForDigest(digest database.AlertRouteDigestWith
 	if len(recipients) == 0 {
 		recipients = parseRecipients(digest.RouteRecipientsJSON)
 	}
-	if len(recipients) == 0 {
+	if len(recipients) == 0 && RequiresRecipients(*digest.EscalationChannelType) {
 		return "digest escalation skipped: no recipients"
 	}
 	decrypted, err := crypto.Decrypt(*digest.EscalationChannelConfigEncrypted, d.cfg.AppSecretKey)
@@ -468,7 +601,7 @@ func (d *Dispatcher) tryEscalationForDigest(digest database.AlertRouteDigestWith
 	}
 	escalationSubject := "[ESCALATED] " + subject
 	escalationBody := body + "\n\nEscalation reason:\n" + rootErr
-	if _, err := d.sendByChannelType(context.Background(), *digest.EscalationChannelType, cfg, recipients, escalationSubject, escalationBody); err != nil {
+	if _, err := d.sendByChannelType(context.Background(), *digest.EscalationChannelType, cfg, recipients, escalationSubject, escalationBody, escalatedEvent(event, rootErr)); err != nil {
 		return "digest escalation send failed: " + err.Error()
 	}
 	return "digest escalated via " + coalesce(digest.EscalationChannelName, "channel")
@@ -550,7 +683,7 @@ func intCfg(cfg map[string]interface{}, key string, defaultVal int) int {
 	return defaultVal
 }
 
-func (d *Dispatcher) sendSMTP(ctx context.Context, cfg map[string]interface{}, recipients []string, subject, body string) (string, error) {
+func (d *Dispatcher) sendSMTP(ctx context.Context, cfg map[string]interface{}, recipients []string, subject, body string, attachments []Attachment) (string, error) {
 	host := stringCfg(cfg, "host")
 	fromEmail := stringCfg(cfg, "from_email")
 	username := stringCfg(cfg, "username")
@@ -571,12 +704,7 @@ func (d *Dispatcher) sendSMTP(ctx context.Context, cfg map[string]interface{}, r
 		fromHeader = fmt.Sprintf("%s <%s>", fromName, fromEmail)
 	}
 
-	msg := []byte("From: " + fromHeader + "\r\n" +
-		"To: " + strings.Join(recipients, ",") + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"MIME-Version: 1.0\r\n" +
-		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
-		body)
+	msg := buildSMTPMessage(fromHeader, recipients, subject, body, attachments)
 
 	var auth smtp.Auth
 	if username != "" {
@@ -680,7 +808,48 @@ func (d *Dispatcher) sendSMTP(ctx context.Context, cfg map[string]interface{}, r
 	return "smtp", nil
 }
 
-func (d *Dispatcher) sendResend(ctx context.Context, cfg map[string]interface{}, recipients []string, subject, body string) (string, error) {
+// buildSMTPMessage renders a plain-text message, as multipart/mixed when it
+// carries attachments.
+func buildSMTPMessage(from string, recipients []string, subject, body string, attachments []Attachment) []byte {
+	var b bytes.Buffer
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(recipients, ",") + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	if len(attachments) == 0 {
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+		b.WriteString(body)
+		return b.Bytes()
+	}
+
+	mw := multipart.NewWriter(&b)
+	b.WriteString("Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n")
+
+	part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}})
+	part.Write([]byte(body))
+
+	for _, a := range attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+	mw.Close()
+	return b.Bytes()
+}
+
+func (d *Dispatcher) sendResend(ctx context.Context, cfg map[string]interface{}, recipients []string, subject, body string, attachments []Attachment) (string, error) {
 	apiKey := stringCfg(cfg, "api_key")
 	fromEmail := stringCfg(cfg, "from_email")
 	fromName := stringCfg(cfg, "from_name")
@@ -702,6 +871,16 @@ func (d *Dispatcher) sendResend(ctx context.Context, cfg map[string]interface{},
 		"subject": subject,
 		"text":    body,
 	}
+	if len(attachments) > 0 {
+		files := make([]map[string]string, 0, len(attachments))
+		for _, a := range attachments {
+			files = append(files, map[string]string{
+				"filename": a.Filename,
+				"content":  base64.StdEncoding.EncodeToString(a.Data),
+			})
+		}
+		payload["attachments"] = files
+	}
 	raw, _ := json.Marshal(payload)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/emails", bytes.NewReader(raw))
@@ -729,7 +908,7 @@ func (d *Dispatcher) sendResend(ctx context.Context, cfg map[string]interface{},
 	return out.ID, nil
 }
 
-func (d *Dispatcher) sendBrevo(ctx context.Context, cfg map[string]interface{}, recipients []string, subject, body string) (string, error) {
+func (d *Dispatcher) sendBrevo(ctx context.Context, cfg map[string]interface{}, recipients []string, subject, body string, attachments []Attachment) (string, error) {
 	apiKey := stringCfg(cfg, "api_key")
 	fromEmail := stringCfg(cfg, "from_email")
 	fromName := stringCfg(cfg, "from_name")
@@ -755,6 +934,16 @@ func (d *Dispatcher) sendBrevo(ctx context.Context, cfg map[string]interface{},
 		"subject":     subject,
 		"textContent": body,
 	}
+	if len(attachments) > 0 {
+		files := make([]map[string]string, 0, len(attachments))
+		for _, a := range attachments {
+			files = append(files, map[string]string{
+				"name":    a.Filename,
+				"content": base64.StdEncoding.EncodeToString(a.Data),
+			})
+		}
+		payload["attachment"] = files
+	}
 	raw, _ := json.Marshal(payload)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/v3/smtp/email", bytes.NewReader(raw))
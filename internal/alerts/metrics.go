@@ -0,0 +1,367 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/credentials"
+	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/tunnel"
+)
+
+// Metric rule conditions.
+const (
+	MetricConditionAbove     = "above"
+	MetricConditionBelow     = "below"
+	MetricConditionChangePct = "change_pct"
+	MetricConditionNoData    = "no_data"
+)
+
+const (
+	// MinMetricIntervalSeconds is the shortest evaluation interval a metric
+	// rule may use.
+	MinMetricIntervalSeconds = 30
+
+	metricTickInterval = 15 * time.Second
+	metricQueryTimeout = 30 * time.Second
+)
+
+// metricQuerySettings are sent with every metric query so it cannot write,
+// whatever the isReadOnlyQuery check lets through. readonly=2 rather than 1
+// so ClickHouse still accepts max_execution_time alongside it.
+var metricQuerySettings = map[string]string{
+	"readonly":           "2",
+	"max_execution_time": "30",
+}
+
+// IsMetricCondition reports whether c is a supported metric rule condition.
+func IsMetricCondition(c string) bool {
+	switch c {
+	case MetricConditionAbove, MetricConditionBelow, MetricConditionChangePct, MetricConditionNoData:
+		return true
+	default:
+		return false
+	}
+}
+
+// MetricRuleFingerprint is the alert fingerprint of a metric rule, shared by
+// its firing and resolution events.
+func MetricRuleFingerprint(ruleID string) string {
+	return "metric:" + ruleID
+}
+
+// MetricEvaluator runs the queries of metric alert rules on their intervals
+// and emits alert events when a rule starts or stops firing. Queries run as
+// the rule's service credential, or the connection default.
+type MetricEvaluator struct {
+	db      *database.DB
+	gateway *tunnel.Gateway
+	creds   *credentials.Resolver
+
+	mu      sync.Mutex
+	running bool
+	stopCh  chan struct{}
+}
+
+// NewMetricEvaluator creates a metric rule evaluator.
+func NewMetricEvaluator(db *database.DB, gw *tunnel.Gateway, secret string) *MetricEvaluator {
+	return &MetricEvaluator{
+		db:      db,
+		gateway: gw,
+		creds:   credentials.NewResolver(db, secret),
+	}
+}
+
+// StartBackground launches the evaluation goroutine. Idempotent.
+func (e *MetricEvaluator) StartBackground() {
+	e.mu.Lock()
+	if e.running {
+		e.mu.Unlock()
+		return
+	}
+	e.stopCh = make(chan struct{})
+	e.running = true
+	stopCh := e.stopCh
+	e.mu.Unlock()
+
+	go func() {
+		slog.Info("Metric alert evaluator started", "tick", metricTickInterval)
+		ticker := time.NewTicker(metricTickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				slog.Info("Metric alert evaluator stopped")
+				return
+			case <-ticker.C:
+				e.tick()
+			}
+		}
+	}()
+}
+
+// Stop signals the evaluation goroutine to stop. Safe when not running.
+func (e *MetricEvaluator) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.running {
+		return
+	}
+	close(e.stopCh)
+	e.running = false
+}
+
+func (e *MetricEvaluator) tick() {
+	now := time.Now().UTC()
+	rules, err := e.db.ListDueAlertMetricRules(now)
+	if err != nil {
+		slog.Error("Metric alert evaluator failed to list due rules", "error", err)
+		return
+	}
+	for _, rule := range rules {
+		e.evaluate(rule, now)
+	}
+}
+
+func (e *MetricEvaluator) evaluate(rule database.AlertMetricRule, now time.Time) {
+	interval := time.Duration(maxInt(rule.IntervalSeconds, MinMetricIntervalSeconds)) * time.Second
+	eval := database.AlertMetricRuleEvaluation{
+		State:        rule.State,
+		PendingSince: parseTime(rule.PendingSince),
+		Value:        rule.LastValue,
+		EvaluatedAt:  now,
+		NextAt:       now.Add(interval),
+	}
+
+	credentialID := ""
+	if rule.CredentialID != nil {
+		credentialID = *rule.CredentialID
+	}
+	value, err := e.QueryValue(rule.ConnectionID, credentialID, rule.Query)
+	if err != nil {
+		// Keep the state: a failing query neither fires nor resolves.
+		eval.Error = err.Error()
+		if recErr := e.db.RecordAlertMetricRuleEvaluation(rule.ID, eval); recErr != nil {
+			slog.Warn("Failed to record metric rule evaluation", "rule", rule.ID, "error", recErr)
+		}
+		return
+	}
+	eval.Value = value
+
+	breached := ConditionBreached(rule.Condition, rule.Threshold, value, rule.LastValue)
+	forDuration := time.Duration(rule.ForSeconds) * time.Second
+	var transition metricTransition
+	eval.State, eval.PendingSince, transition = nextMetricState(rule.State, eval.PendingSince, breached, forDuration, now)
+
+	switch transition {
+	case metricFire:
+		payload := map[string]interface{}{
+			"rule_id":        rule.ID,
+			"rule_name":      rule.Name,
+			"condition":      rule.Condition,
+			"threshold":      rule.Threshold,
+			"value":          value,
+			"previous_value": rule.LastValue,
+			"for_seconds":    rule.ForSeconds,
+			"query":          rule.Query,
+		}
+		connectionID := rule.ConnectionID
+		if _, err := e.db.CreateAlertEvent(
+			&connectionID,
+			EventTypeMetricThreshold,
+			rule.Severity,
+			fmt.Sprintf("Metric alert firing: %s", rule.Name),
+			describeBreach(rule.Condition, rule.Threshold, value, rule.LastValue),
+			payload,
+			MetricRuleFingerprint(rule.ID),
+			rule.ID,
+		); err != nil {
+			slog.Warn("Failed to create metric alert event", "rule", rule.ID, "error", err)
+		}
+	case metricResolve:
+		message := "Query returns data again"
+		if value != nil {
+			message = fmt.Sprintf("Value %s is back within the threshold", formatValue(*value))
+		}
+		if _, err := e.db.ResolveAlertEvent(MetricRuleFingerprint(rule.ID), message, rule.ID); err != nil {
+			slog.Warn("Failed to resolve metric alert", "rule", rule.ID, "error", err)
+		}
+	}
+
+	if err := e.db.RecordAlertMetricRuleEvaluation(rule.ID, eval); err != nil {
+		slog.Warn("Failed to record metric rule evaluation", "rule", rule.ID, "error", err)
+	}
+}
+
+// QueryValue runs a metric query and returns the first column of its first
+// row as a number, or nil when the query returns no rows or NULL.
+func (e *MetricEvaluator) QueryValue(connectionID, credentialID, query string) (*float64, error) {
+	if !e.gateway.IsTunnelOnline(connectionID) {
+		return nil, fmt.Errorf("tunnel not connected")
+	}
+	creds, err := e.creds.Resolve(connectionID, credentialID)
+	if err != nil {
+		return nil, fmt.Errorf("no credentials available: %w", err)
+	}
+	result, err := e.gateway.ExecuteQueryWithSettings(connectionID, query, creds.User, creds.Password, metricQuerySettings, metricQueryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, nil
+	}
+	return firstValue(result.Meta, result.Data)
+}
+
+// firstValue extracts the first column of the first row of a JSON result.
+func firstValue(meta, data json.RawMessage) (*float64, error) {
+	var columns []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(meta, &columns); err != nil || len(columns) == 0 {
+		return nil, fmt.Errorf("query returned no columns")
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var rows []map[string]interface{}
+	if err := dec.Decode(&rows); err != nil {
+		return nil, fmt.Errorf("parse query result: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	var f float64
+	switch v := rows[0][columns[0].Name].(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		parsed, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("column %s is not numeric: %s", columns[0].Name, v)
+		}
+		f = parsed
+	case string:
+		// ClickHouse quotes 64-bit integers in JSON output.
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("column %s is not numeric: %q", columns[0].Name, v)
+		}
+		f = parsed
+	case bool:
+		if v {
+			f = 1
+		}
+	default:
+		return nil, fmt.Errorf("column %s is not numeric", columns[0].Name)
+	}
+	return &f, nil
+}
+
+// ConditionBreached reports whether a value breaches a rule condition.
+// Change is measured against the previous evaluation's value; without one,
+// or when it was zero, it cannot breach. Only no_data breaches on a missing
+// value.
+func ConditionBreached(condition string, threshold float64, value, previous *float64) bool {
+	if condition == MetricConditionNoData {
+		return value == nil
+	}
+	if value == nil {
+		return false
+	}
+	switch condition {
+	case MetricConditionAbove:
+		return *value > threshold
+	case MetricConditionBelow:
+		return *value < threshold
+	case MetricConditionChangePct:
+		if previous == nil || *previous == 0 {
+			return false
+		}
+		return changePct(*value, *previous) >= math.Abs(threshold)
+	default:
+		return false
+	}
+}
+
+func changePct(value, previous float64) float64 {
+	return math.Abs(value-previous) / math.Abs(previous) * 100
+}
+
+type metricTransition int
+
+const (
+	metricNone metricTransition = iota
+	metricFire
+	metricResolve
+)
+
+// nextMetricState advances a rule for one evaluation. A breach moves an ok
+// rule to pending, and a rule fires once the breach has lasted forDuration.
+// A firing rule resolves on the first evaluation without a breach.
+func nextMetricState(state string, pendingSince *time.Time, breached bool, forDuration time.Duration, now time.Time) (string, *time.Time, metricTransition) {
+	if !breached {
+		if state == database.MetricRuleStateFiring {
+			return database.MetricRuleStateOK, nil, metricResolve
+		}
+		return database.MetricRuleStateOK, nil, metricNone
+	}
+	if state == database.MetricRuleStateFiring {
+		return state, pendingSince, metricNone
+	}
+	if state != database.MetricRuleStatePending || pendingSince == nil {
+		pendingSince = &now
+	}
+	if now.Sub(*pendingSince) >= forDuration {
+		return database.MetricRuleStateFiring, pendingSince, metricFire
+	}
+	return database.MetricRuleStatePending, pendingSince, metricNone
+}
+
+func describeBreach(condition string, threshold float64, value, previous *float64) string {
+	switch condition {
+	case MetricConditionNoData:
+		return "Query returned no value"
+	case MetricConditionAbove:
+		return fmt.Sprintf("Value %s is above %s", formatValue(*value), formatValue(threshold))
+	case MetricConditionBelow:
+		return fmt.Sprintf("Value %s is below %s", formatValue(*value), formatValue(threshold))
+	case MetricConditionChangePct:
+		return fmt.Sprintf("Value %s changed %.1f%% from %s (threshold %s%%)",
+			formatValue(*value), changePct(*value, *previous), formatValue(*previous), formatValue(math.Abs(threshold)))
+	default:
+		return ""
+	}
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func parseTime(v *string) *time.Time {
+	if v == nil {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, *v)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
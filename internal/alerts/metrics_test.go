@@ -0,0 +1,78 @@
+package alerts
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+func TestConditionBreached(t *testing.T) {
+	v := func(f float64) *float64 { return &f }
+	cases := []struct {
+		name      string
+		condition string
+		threshold float64
+		value     *float64
+		previous  *float64
+		want      bool
+	}{
+		{"above", MetricConditionAbove, 10, v(11), nil, true},
+		{"not above", MetricConditionAbove, 10, v(10), nil, false},
+		{"below", MetricConditionBelow, 10, v(9), nil, true},
+		{"missing value", MetricConditionAbove, 10, nil, nil, false},
+		{"change up", MetricConditionChangePct, 50, v(160), v(100), true},
+		{"change down", MetricConditionChangePct, 50, v(40), v(100), true},
+		{"small change", MetricConditionChangePct, 50, v(120), v(100), false},
+		{"change without previous", MetricConditionChangePct, 50, v(120), nil, false},
+		{"no data", MetricConditionNoData, 0, nil, nil, true},
+		{"has data", MetricConditionNoData, 0, v(0), nil, false},
+	}
+	for _, tc := range cases {
+		if got := ConditionBreached(tc.condition, tc.threshold, tc.value, tc.previous); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNextMetricStateWaitsForDuration(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	forDuration := 2 * time.Minute
+
+	state, since, tr := nextMetricState(database.MetricRuleStateOK, nil, true, forDuration, start)
+	if state != database.MetricRuleStatePending || since == nil || tr != metricNone {
+		t.Fatalf("first breach: state=%s transition=%v", state, tr)
+	}
+	state, since, tr = nextMetricState(state, since, true, forDuration, start.Add(time.Minute))
+	if state != database.MetricRuleStatePending || tr != metricNone {
+		t.Fatalf("before duration: state=%s transition=%v", state, tr)
+	}
+	state, since, tr = nextMetricState(state, since, true, forDuration, start.Add(2*time.Minute))
+	if state != database.MetricRuleStateFiring || tr != metricFire {
+		t.Fatalf("after duration: state=%s transition=%v", state, tr)
+	}
+	state, since, tr = nextMetricState(state, since, true, forDuration, start.Add(3*time.Minute))
+	if state != database.MetricRuleStateFiring || tr != metricNone {
+		t.Fatalf("still breached: state=%s transition=%v", state, tr)
+	}
+	state, since, tr = nextMetricState(state, since, false, forDuration, start.Add(4*time.Minute))
+	if state != database.MetricRuleStateOK || since != nil || tr != metricResolve {
+		t.Fatalf("cleared: state=%s transition=%v", state, tr)
+	}
+}
+
+func TestFirstValue(t *testing.T) {
+	meta := json.RawMessage(`[{"name":"c","type":"UInt64"}]`)
+	got, err := firstValue(meta, json.RawMessage(`[{"c":"18446744073709551615"}]`))
+	if err != nil || got == nil || *got != 18446744073709551615 {
+		t.Fatalf("quoted UInt64: %v, %v", got, err)
+	}
+	got, err = firstValue(meta, json.RawMessage(`[]`))
+	if err != nil || got != nil {
+		t.Fatalf("no rows: %v, %v", got, err)
+	}
+	if _, err := firstValue(meta, json.RawMessage(`[{"c":"abc"}]`)); err == nil {
+		t.Fatal("expected an error for a non-numeric value")
+	}
+}
@@ -0,0 +1,151 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+// MatchesEvent reports whether an event matches a silence or maintenance
+// window matcher.
+func MatchesEvent(m database.AlertEventMatcher, event database.AlertEvent) bool {
+	eventType := strings.ToLower(strings.TrimSpace(m.EventType))
+	if eventType != "" && eventType != "*" && eventType != "any" && eventType != strings.ToLower(event.EventType) {
+		return false
+	}
+	if m.ConnectionID != nil && *m.ConnectionID != "" {
+		if event.ConnectionID == nil || *event.ConnectionID != *m.ConnectionID {
+			return false
+		}
+	}
+	if len(m.Severities) > 0 {
+		found := false
+		for _, s := range m.Severities {
+			if strings.EqualFold(s, event.Severity) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(m.PayloadMatchers) == 0 {
+		return true
+	}
+	var payload map[string]interface{}
+	if event.PayloadJSON == nil || json.Unmarshal([]byte(*event.PayloadJSON), &payload) != nil {
+		return false
+	}
+	for path, want := range m.PayloadMatchers {
+		got, ok := payloadField(payload, path)
+		if !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// payloadField returns a payload field as a string, following dots into
+// nested objects.
+func payloadField(payload map[string]interface{}, path string) (string, bool) {
+	var cur interface{} = payload
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if cur, ok = obj[key]; !ok {
+			return "", false
+		}
+	}
+	switch v := cur.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case float64:
+		return formatValue(v), true
+	default:
+		raw, _ := json.Marshal(v)
+		return string(raw), true
+	}
+}
+
+// ParseClock parses an "HH:MM" time of day into minutes after midnight.
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// MaintenanceWindowActive reports whether a maintenance window covers t. A
+// window whose end is not after its start runs past midnight, into the day
+// after each of its days.
+func MaintenanceWindowActive(w database.AlertMaintenanceWindow, t time.Time) bool {
+	start, err := ParseClock(w.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(w.EndTime)
+	if err != nil {
+		return false
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	today := int(local.Weekday())
+	yesterday := (today + 6) % 7
+
+	if end > start {
+		return hasDay(w.Days, today) && minute >= start && minute < end
+	}
+	return (hasDay(w.Days, today) && minute >= start) || (hasDay(w.Days, yesterday) && minute < end)
+}
+
+func hasDay(days []int, day int) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// suppressionFor returns why an event should be recorded without being
+// dispatched, or "" when it should be dispatched. Resolutions are always
+// dispatched so they can close what an earlier notification opened.
+func (d *Dispatcher) suppressionFor(event database.AlertEvent, silences []database.AlertSilence, windows []database.AlertMaintenanceWindow) string {
+	if event.Resolves {
+		return ""
+	}
+	at, err := time.Parse(time.RFC3339, event.CreatedAt)
+	if err != nil {
+		at = time.Now().UTC()
+	}
+	for _, s := range silences {
+		if s.StartsAt <= event.CreatedAt && event.CreatedAt < s.EndsAt && MatchesEvent(s.AlertEventMatcher, event) {
+			return "silence: " + s.Comment
+		}
+	}
+	for _, w := range windows {
+		if MaintenanceWindowActive(w, at) && MatchesEvent(w.AlertEventMatcher, event) {
+			return "maintenance: " + w.Name
+		}
+	}
+	if event.Fingerprint != nil {
+		acked, err := d.db.IsAlertFingerprintAcknowledged(*event.Fingerprint)
+		if err == nil && acked {
+			return "acknowledged"
+		}
+	}
+	return ""
+}
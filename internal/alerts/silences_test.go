@@ -0,0 +1,66 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+func TestMatchesEvent(t *testing.T) {
+	conn := "c1"
+	payload := `{"schedule_id":"s1","run":{"attempt":2}}`
+	event := database.AlertEvent{EventType: "schedule.failed", Severity: "error", ConnectionID: &conn, PayloadJSON: &payload}
+
+	cases := []struct {
+		name    string
+		matcher database.AlertEventMatcher
+		want    bool
+	}{
+		{"empty matches all", database.AlertEventMatcher{}, true},
+		{"event type", database.AlertEventMatcher{EventType: "schedule.failed"}, true},
+		{"other event type", database.AlertEventMatcher{EventType: "schedule.slow"}, false},
+		{"severity list", database.AlertEventMatcher{Severities: []string{"warn", "error"}}, true},
+		{"other severity", database.AlertEventMatcher{Severities: []string{"critical"}}, false},
+		{"connection", database.AlertEventMatcher{ConnectionID: strPtr("c2")}, false},
+		{"payload field", database.AlertEventMatcher{PayloadMatchers: map[string]string{"schedule_id": "s1"}}, true},
+		{"nested payload field", database.AlertEventMatcher{PayloadMatchers: map[string]string{"run.attempt": "2"}}, true},
+		{"missing payload field", database.AlertEventMatcher{PayloadMatchers: map[string]string{"model_id": "m1"}}, false},
+	}
+	for _, tc := range cases {
+		if got := MatchesEvent(tc.matcher, event); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	// 2026-03-01 is a Sunday.
+	sunday := func(hh, mm int) time.Time { return time.Date(2026, 3, 1, hh, mm, 0, 0, time.UTC) }
+
+	w := database.AlertMaintenanceWindow{Days: []int{0}, StartTime: "02:00", EndTime: "04:00", Timezone: "UTC"}
+	if !MaintenanceWindowActive(w, sunday(2, 0)) || !MaintenanceWindowActive(w, sunday(3, 59)) {
+		t.Fatal("window should cover Sunday 02:00-04:00")
+	}
+	if MaintenanceWindowActive(w, sunday(4, 0)) || MaintenanceWindowActive(w, sunday(1, 59)) {
+		t.Fatal("window should end at 04:00 and start at 02:00")
+	}
+	if MaintenanceWindowActive(w, sunday(3, 0).AddDate(0, 0, 1)) {
+		t.Fatal("window should not cover Monday")
+	}
+
+	overnight := database.AlertMaintenanceWindow{Days: []int{6}, StartTime: "23:00", EndTime: "01:00", Timezone: "UTC"}
+	if !MaintenanceWindowActive(overnight, sunday(0, 30)) {
+		t.Fatal("overnight window should run into Sunday")
+	}
+	if MaintenanceWindowActive(overnight, sunday(23, 30)) {
+		t.Fatal("overnight window should only start on Saturday")
+	}
+
+	zoned := database.AlertMaintenanceWindow{Days: []int{0}, StartTime: "02:00", EndTime: "04:00", Timezone: "America/New_York"}
+	if !MaintenanceWindowActive(zoned, sunday(7, 30)) {
+		t.Fatal("window should follow its timezone")
+	}
+}
+
+func strPtr(s string) *string { return &s }
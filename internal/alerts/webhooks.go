@@ -0,0 +1,356 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is the alert behind a notification. Email channels only use the
+// rendered subject and body; webhook-based channels post these fields.
+type Event struct {
+	ID          string
+	Type        string
+	Severity    string
+	Title       string
+	Message     string
+	Fingerprint string
+	RuleName    string
+	PayloadJSON string
+	CreatedAt   string
+	// Resolve marks that the condition behind Fingerprint has cleared.
+	Resolve bool
+}
+
+// RequiresRecipients reports whether a channel type delivers to the email
+// recipients of a route. Webhook-based channels post to their configured
+// endpoint instead.
+func RequiresRecipients(channelType string) bool {
+	switch strings.ToLower(strings.TrimSpace(channelType)) {
+	case ChannelTypeSMTP, ChannelTypeResend, ChannelTypeBrevo:
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportsResolve reports whether a channel type is sent resolution events,
+// so it can close or follow up on what an earlier notification opened.
+// Email channels are not, to keep inboxes quiet.
+func SupportsResolve(channelType string) bool {
+	switch strings.ToLower(strings.TrimSpace(channelType)) {
+	case ChannelTypePagerDuty, ChannelTypeWebhook, ChannelTypeSlack, ChannelTypeTeams:
+		return true
+	default:
+		return false
+	}
+}
+
+// eventFromMessage wraps a one-off message, such as a channel test, for
+// channels that post events.
+func eventFromMessage(subject, body string) *Event {
+	return &Event{
+		Type:      "test",
+		Severity:  SeverityInfo,
+		Title:     subject,
+		Message:   body,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func (d *Dispatcher) postJSON(ctx context.Context, name, url string, payload []byte, headers map[string]string) ([]byte, error) {
+	if url == "" {
+		return nil, fmt.Errorf("%s config requires a webhook URL", name)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%s request: %w", name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s send: %w", name, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s error (%d): %s", name, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// sendWebhook posts the event as JSON. The body is the default event
+// document unless the channel has a body_template. With a secret, the
+// request is signed: X-CHUI-Signature-256 is "sha256=" followed by the hex
+// HMAC-SHA256 of "<X-CHUI-Timestamp>.<body>".
+func (d *Dispatcher) sendWebhook(ctx context.Context, cfg map[string]interface{}, subject, body string, ev *Event) (string, error) {
+	var raw []byte
+	if tpl := stringCfg(cfg, "body_template"); tpl != "" {
+		rendered, err := RenderWebhookBody(tpl, ev)
+		if err != nil {
+			return "", err
+		}
+		raw = []byte(rendered)
+	} else {
+		raw, _ = json.Marshal(map[string]interface{}{
+			"event_id":    ev.ID,
+			"event_type":  ev.Type,
+			"severity":    ev.Severity,
+			"title":       ev.Title,
+			"message":     ev.Message,
+			"fingerprint": ev.Fingerprint,
+			"rule_name":   ev.RuleName,
+			"created_at":  ev.CreatedAt,
+			"resolved":    ev.Resolve,
+			"subject":     subject,
+			"body":        body,
+			"payload":     payloadValue(ev.PayloadJSON),
+		})
+	}
+
+	headers := map[string]string{}
+	if extra, ok := cfg["headers"].(map[string]interface{}); ok {
+		for k, v := range extra {
+			headers[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	if secret := stringCfg(cfg, "secret"); secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		headers["X-CHUI-Timestamp"] = ts
+		headers["X-CHUI-Signature-256"] = "sha256=" + signWebhook(secret, ts, raw)
+	}
+
+	if _, err := d.postJSON(ctx, "webhook", stringCfg(cfg, "url"), raw, headers); err != nil {
+		return "", err
+	}
+	return "webhook", nil
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RenderWebhookBody fills a webhook body template. Placeholders are
+// JSON-escaped so they can sit inside string literals, except
+// {{payload_json}} and {{resolved}}, which are inserted as JSON values. The
+// result must be valid JSON.
+func RenderWebhookBody(tpl string, ev *Event) (string, error) {
+	payload, _ := json.Marshal(payloadValue(ev.PayloadJSON))
+	// A single pass keeps placeholders inside substituted values literal.
+	out := strings.NewReplacer(
+		"{{event_id}}", jsonEscape(ev.ID),
+		"{{event_type}}", jsonEscape(ev.Type),
+		"{{severity}}", jsonEscape(ev.Severity),
+		"{{title}}", jsonEscape(ev.Title),
+		"{{message}}", jsonEscape(ev.Message),
+		"{{fingerprint}}", jsonEscape(ev.Fingerprint),
+		"{{rule_name}}", jsonEscape(ev.RuleName),
+		"{{created_at}}", jsonEscape(ev.CreatedAt),
+		"{{payload_json}}", string(payload),
+		"{{resolved}}", strconv.FormatBool(ev.Resolve),
+	).Replace(tpl)
+	if !json.Valid([]byte(out)) {
+		return "", fmt.Errorf("webhook body_template does not render valid JSON")
+	}
+	return out, nil
+}
+
+// jsonEscape returns s encoded as a JSON string, without the quotes.
+func jsonEscape(s string) string {
+	raw, _ := json.Marshal(s)
+	return string(raw[1 : len(raw)-1])
+}
+
+// payloadValue returns an event payload as raw JSON, or nil when it is
+// missing or invalid.
+func payloadValue(payloadJSON string) interface{} {
+	if strings.TrimSpace(payloadJSON) == "" || !json.Valid([]byte(payloadJSON)) {
+		return nil
+	}
+	return json.RawMessage(payloadJSON)
+}
+
+// sendSlack posts to a Slack incoming webhook as Block Kit blocks, with the
+// subject as the notification fallback text.
+func (d *Dispatcher) sendSlack(ctx context.Context, cfg map[string]interface{}, subject string, ev *Event) (string, error) {
+	blocks := []interface{}{
+		map[string]interface{}{
+			"type": "header",
+			"text": map[string]interface{}{"type": "plain_text", "text": truncate(ev.Title, 150), "emoji": true},
+		},
+	}
+	if strings.TrimSpace(ev.Message) != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]interface{}{"type": "mrkdwn", "text": truncate(ev.Message, 3000)},
+		})
+	}
+	meta := fmt.Sprintf("*Severity:* %s  ·  *Type:* %s", strings.ToUpper(ev.Severity), ev.Type)
+	if ev.RuleName != "" {
+		meta += "  ·  *Rule:* " + ev.RuleName
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type":     "context",
+		"elements": []interface{}{map[string]interface{}{"type": "mrkdwn", "text": meta}},
+	})
+
+	raw, _ := json.Marshal(map[string]interface{}{
+		"text":   subject,
+		"blocks": blocks,
+	})
+	if _, err := d.postJSON(ctx, "slack", stringCfg(cfg, "webhook_url"), raw, nil); err != nil {
+		return "", err
+	}
+	return "slack", nil
+}
+
+// sendTeams posts an Adaptive Card to a Microsoft Teams incoming webhook or
+// Workflows webhook URL.
+func (d *Dispatcher) sendTeams(ctx context.Context, cfg map[string]interface{}, ev *Event) (string, error) {
+	color := "default"
+	switch {
+	case ev.Resolve:
+		color = "good"
+	case ev.Severity == SeverityError || ev.Severity == SeverityCritical:
+		color = "attention"
+	case ev.Severity == SeverityWarn:
+		color = "warning"
+	}
+	facts := []interface{}{
+		map[string]string{"title": "Severity", "value": strings.ToUpper(ev.Severity)},
+		map[string]string{"title": "Type", "value": ev.Type},
+	}
+	if ev.RuleName != "" {
+		facts = append(facts, map[string]string{"title": "Rule", "value": ev.RuleName})
+	}
+	if ev.CreatedAt != "" {
+		facts = append(facts, map[string]string{"title": "Time", "value": ev.CreatedAt})
+	}
+	body := []interface{}{
+		map[string]interface{}{"type": "TextBlock", "text": ev.Title, "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+	}
+	if strings.TrimSpace(ev.Message) != "" {
+		body = append(body, map[string]interface{}{"type": "TextBlock", "text": ev.Message, "wrap": true})
+	}
+	body = append(body, map[string]interface{}{"type": "FactSet", "facts": facts})
+
+	raw, _ := json.Marshal(map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{map[string]interface{}{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]interface{}{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	})
+	if _, err := d.postJSON(ctx, "teams", stringCfg(cfg, "webhook_url"), raw, nil); err != nil {
+		return "", err
+	}
+	return "teams", nil
+}
+
+// sendPagerDuty sends a PagerDuty Events API v2 event. The event
+// fingerprint is the dedup key, so repeated failures update one incident
+// and a resolution event closes it.
+func (d *Dispatcher) sendPagerDuty(ctx context.Context, cfg map[string]interface{}, ev *Event) (string, error) {
+	routingKey := stringCfg(cfg, "routing_key")
+	if routingKey == "" {
+		return "", fmt.Errorf("pagerduty config requires routing_key")
+	}
+	baseURL := stringCfg(cfg, "base_url")
+	if baseURL == "" {
+		baseURL = "https://events.pagerduty.com"
+	}
+	dedupKey := ev.Fingerprint
+	if dedupKey == "" {
+		dedupKey = ev.ID
+	}
+
+	msg := map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": "trigger",
+	}
+	if dedupKey != "" {
+		msg["dedup_key"] = truncate(dedupKey, 255)
+	}
+	if ev.Resolve {
+		if dedupKey == "" {
+			return "", fmt.Errorf("pagerduty resolve requires an event fingerprint")
+		}
+		msg["event_action"] = "resolve"
+	} else {
+		source := stringCfg(cfg, "source")
+		if source == "" {
+			source = "ch-ui"
+		}
+		details := map[string]interface{}{
+			"message":     ev.Message,
+			"event_type":  ev.Type,
+			"fingerprint": ev.Fingerprint,
+		}
+		if ev.RuleName != "" {
+			details["rule_name"] = ev.RuleName
+		}
+		if payload := payloadValue(ev.PayloadJSON); payload != nil {
+			details["payload"] = payload
+		}
+		msg["payload"] = map[string]interface{}{
+			"summary":        truncate(ev.Title, 1024),
+			"source":         source,
+			"severity":       pagerDutySeverity(ev.Severity),
+			"class":          ev.Type,
+			"custom_details": details,
+		}
+	}
+	raw, _ := json.Marshal(msg)
+
+	data, err := d.postJSON(ctx, "pagerduty", strings.TrimRight(baseURL, "/")+"/v2/enqueue", raw, nil)
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		DedupKey string `json:"dedup_key"`
+	}
+	_ = json.Unmarshal(data, &out)
+	return out.DedupKey, nil
+}
+
+func pagerDutySeverity(severity string) string {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case SeverityCritical:
+		return "critical"
+	case SeverityError:
+		return "error"
+	case SeverityWarn:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
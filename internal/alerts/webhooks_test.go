@@ -0,0 +1,109 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRenderWebhookBodyEscapesValues(t *testing.T) {
+	ev := &Event{Title: `Query "daily" failed`, Message: "line 1\nline 2", PayloadJSON: `{"run_id":"r1"}`, Resolve: true}
+	out, err := RenderWebhookBody(`{"text":"{{title}}: {{message}}","resolved":{{resolved}},"data":{{payload_json}}}`, ev)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	var got struct {
+		Text     string            `json:"text"`
+		Resolved bool              `json:"resolved"`
+		Data     map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("rendered body is not JSON: %v", err)
+	}
+	if got.Text != `Query "daily" failed: line 1`+"\nline 2" || !got.Resolved || got.Data["run_id"] != "r1" {
+		t.Fatalf("unexpected render: %s", out)
+	}
+
+	if _, err := RenderWebhookBody(`{"text": {{title}}}`, ev); err == nil {
+		t.Fatal("expected an error for a template that is not valid JSON")
+	}
+
+	// Placeholders inside substituted values stay literal.
+	ev = &Event{Title: "{{payload_json}}", Message: "{{title}}", PayloadJSON: `{"run_id":"r1"}`}
+	for i := 0; i < 20; i++ {
+		out, err := RenderWebhookBody(`{"text":"{{title}} {{message}}"}`, ev)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if out != `{"text":"{{payload_json}} {{title}}"}` {
+			t.Fatalf("placeholder in value was expanded: %s", out)
+		}
+	}
+}
+
+func TestSendWebhookSignsBody(t *testing.T) {
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer srv.Close()
+
+	d := &Dispatcher{http: srv.Client()}
+	cfg := map[string]interface{}{"url": srv.URL, "secret": "s3cret"}
+	if _, err := d.sendByChannelType(context.Background(), ChannelTypeWebhook, cfg, nil, "subject", "body", &Event{Title: "t"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	want := "sha256=" + signWebhook("s3cret", header.Get("X-CHUI-Timestamp"), body)
+	if got := header.Get("X-CHUI-Signature-256"); got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+}
+
+func TestSendPagerDutyTriggerAndResolve(t *testing.T) {
+	var events []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/enqueue" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var msg map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		events = append(events, msg)
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"status":"success","dedup_key":"schedule:1:error"}`))
+	}))
+	defer srv.Close()
+
+	d := &Dispatcher{http: srv.Client()}
+	cfg := map[string]interface{}{"routing_key": "key", "base_url": srv.URL}
+	ev := &Event{ID: "e1", Type: EventTypeScheduleFailed, Severity: SeverityWarn, Title: "failed", Fingerprint: "schedule:1:error"}
+	id, err := d.sendByChannelType(context.Background(), ChannelTypePagerDuty, cfg, nil, "", "", ev)
+	if err != nil {
+		t.Fatalf("trigger: %v", err)
+	}
+	if id != "schedule:1:error" {
+		t.Fatalf("message id = %q", id)
+	}
+	ev.Resolve = true
+	if _, err := d.sendByChannelType(context.Background(), ChannelTypePagerDuty, cfg, nil, "", "", ev); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	trigger, resolve := events[0], events[1]
+	if trigger["event_action"] != "trigger" || trigger["dedup_key"] != "schedule:1:error" {
+		t.Fatalf("unexpected trigger: %v", trigger)
+	}
+	if payload, _ := trigger["payload"].(map[string]interface{}); payload["severity"] != "warning" {
+		t.Fatalf("unexpected trigger payload: %v", trigger["payload"])
+	}
+	if resolve["event_action"] != "resolve" || resolve["dedup_key"] != "schedule:1:error" || resolve["payload"] != nil {
+		t.Fatalf("unexpected resolve: %v", resolve)
+	}
+}
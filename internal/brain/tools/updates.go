@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/models"
 )
 
 func RegisterUpdates(r *Registry) {
@@ -97,10 +98,12 @@ var updateModel = Tool{
 			"name":            map[string]any{"type": "string"},
 			"description":     map[string]any{"type": "string"},
 			"target_database": map[string]any{"type": "string"},
-			"materialization": map[string]any{"type": "string", "enum": []string{"view", "table", "incremental", "materialized_view"}},
+			"materialization": map[string]any{"type": "string", "enum": []string{"view", "table", "incremental", "materialized_view", "dictionary"}},
 			"sql_body":        map[string]any{"type": "string"},
 			"table_engine":    map[string]any{"type": "string"},
 			"order_by":        map[string]any{"type": "string"},
+			"partition_by":    map[string]any{"type": "string"},
+			"unique_key":      map[string]any{"type": "string"},
 		},
 	}),
 	Handler: func(tctx Context, args json.RawMessage) (any, error) {
@@ -113,6 +116,8 @@ var updateModel = Tool{
 			SQLBody         string `json:"sql_body"`
 			TableEngine     string `json:"table_engine"`
 			OrderBy         string `json:"order_by"`
+			PartitionBy     string `json:"partition_by"`
+			UniqueKey       string `json:"unique_key"`
 		}
 		if err := json.Unmarshal(args, &in); err != nil {
 			return nil, fmt.Errorf("invalid args: %w", err)
@@ -134,6 +139,12 @@ var updateModel = Tool{
 			}
 			return old
 		}
+		opts := current.ModelOptions
+		opts.PartitionBy = strings.TrimSpace(pick(in.PartitionBy, opts.PartitionBy))
+		opts.UniqueKey = strings.TrimSpace(pick(in.UniqueKey, opts.UniqueKey))
+		if err := models.ValidateMaterialization(pick(in.Materialization, current.Materialization), opts); err != nil {
+			return nil, err
+		}
 		err = tctx.DB.UpdateModel(
 			in.ID,
 			pick(in.Name, current.Name),
@@ -147,6 +158,11 @@ var updateModel = Tool{
 		if err != nil {
 			return nil, fmt.Errorf("update model: %w", err)
 		}
+		if opts != current.ModelOptions {
+			if err := tctx.DB.UpdateModelOptions(in.ID, opts); err != nil {
+				return nil, fmt.Errorf("save model options: %w", err)
+			}
+		}
 		return map[string]any{
 			"updated":  true,
 			"model_id": in.ID,
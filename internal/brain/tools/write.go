@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/models"
 )
 
 func RegisterWrite(r *Registry) {
@@ -64,34 +65,34 @@ var createSavedQuery = Tool{
 
 var createModel = Tool{
 	Name:             "create_model",
-	Description:      "Create a dbt-style data model (a SQL transformation that ClickHouse runs to produce a target table or view). Choose materialization based on the use case: 'view' (logical, recomputes on read), 'table' (full rebuild), 'incremental' (append new rows by watermark), or 'materialized_view' (CH materialized view triggered by inserts).",
+	Description:      "Create a dbt-style data model (a SQL transformation that ClickHouse runs to produce a target table or view). Choose materialization based on the use case: 'view' (logical, recomputes on read), 'table' (full rebuild), 'incremental' (adds only new rows; filter them with $if_incremental(WHERE ts > (SELECT max(ts) FROM $this())) in sql_body), 'materialized_view' (CH materialized view triggered by inserts), or 'dictionary' (a ClickHouse dictionary keyed by unique_key).",
 	RequiresApproval: true,
 	Parameters: mustJSON(map[string]any{
 		"type":     "object",
 		"required": []string{"name", "target_database", "materialization", "sql_body"},
 		"properties": map[string]any{
-			"name":               map[string]any{"type": "string"},
-			"description":        map[string]any{"type": "string"},
-			"target_database":    map[string]any{"type": "string", "description": "ClickHouse database the model writes to."},
-			"materialization":    map[string]any{"type": "string", "enum": []string{"view", "table", "incremental", "materialized_view"}},
-			"sql_body":           map[string]any{"type": "string", "description": "The SELECT body. Use ref('other_model') if you depend on another model."},
-			"table_engine":       map[string]any{"type": "string", "description": "ClickHouse engine for table/incremental/MV (e.g., MergeTree)."},
-			"order_by":           map[string]any{"type": "string", "description": "ORDER BY clause for table/incremental/MV."},
-			"incremental_column": map[string]any{"type": "string", "description": "Watermark column for incremental (required if materialization=incremental)."},
-			"unique_key":         map[string]any{"type": "string", "description": "Optional unique key for incremental dedupe."},
+			"name":            map[string]any{"type": "string"},
+			"description":     map[string]any{"type": "string"},
+			"target_database": map[string]any{"type": "string", "description": "ClickHouse database the model writes to."},
+			"materialization": map[string]any{"type": "string", "enum": []string{"view", "table", "incremental", "materialized_view", "dictionary"}},
+			"sql_body":        map[string]any{"type": "string", "description": "The SELECT body. Use $ref(other_model) if you depend on another model."},
+			"table_engine":    map[string]any{"type": "string", "description": "ClickHouse engine for table/incremental/MV (e.g., MergeTree)."},
+			"order_by":        map[string]any{"type": "string", "description": "ORDER BY clause for table/incremental/MV."},
+			"partition_by":    map[string]any{"type": "string", "description": "Optional PARTITION BY expression for table/incremental/MV. Incremental models without unique_key replace the partitions they load."},
+			"unique_key":      map[string]any{"type": "string", "description": "Key whose rows an incremental run replaces; the primary key of a dictionary (required for dictionary)."},
 		},
 	}),
 	Handler: func(tctx Context, args json.RawMessage) (any, error) {
 		var in struct {
-			Name              string `json:"name"`
-			Description       string `json:"description"`
-			TargetDatabase    string `json:"target_database"`
-			Materialization   string `json:"materialization"`
-			SQLBody           string `json:"sql_body"`
-			TableEngine       string `json:"table_engine"`
-			OrderBy           string `json:"order_by"`
-			IncrementalColumn string `json:"incremental_column"`
-			UniqueKey         string `json:"unique_key"`
+			Name            string `json:"name"`
+			Description     string `json:"description"`
+			TargetDatabase  string `json:"target_database"`
+			Materialization string `json:"materialization"`
+			SQLBody         string `json:"sql_body"`
+			TableEngine     string `json:"table_engine"`
+			OrderBy         string `json:"order_by"`
+			PartitionBy     string `json:"partition_by"`
+			UniqueKey       string `json:"unique_key"`
 		}
 		if err := json.Unmarshal(args, &in); err != nil {
 			return nil, fmt.Errorf("invalid args: %w", err)
@@ -103,14 +104,19 @@ var createModel = Tool{
 		if in.Name == "" || in.TargetDatabase == "" || in.Materialization == "" || in.SQLBody == "" {
 			return nil, errors.New("name, target_database, materialization, sql_body are required")
 		}
-		switch in.Materialization {
-		case "view", "table", "incremental", "materialized_view":
-		default:
-			return nil, fmt.Errorf("invalid materialization: %s", in.Materialization)
+		opts := database.ModelOptions{
+			PartitionBy: strings.TrimSpace(in.PartitionBy),
+			UniqueKey:   strings.TrimSpace(in.UniqueKey),
 		}
-		if (in.Materialization == "table" || in.Materialization == "incremental" || in.Materialization == "materialized_view") && in.TableEngine == "" {
+		if err := models.ValidateMaterialization(in.Materialization, opts); err != nil {
+			return nil, err
+		}
+		if models.UsesTableEngine(in.Materialization) && in.TableEngine == "" {
 			in.TableEngine = "MergeTree"
 		}
+		if models.UsesTableEngine(in.Materialization) && in.OrderBy == "" {
+			in.OrderBy = "tuple()"
+		}
 		id, err := tctx.DB.CreateModel(
 			tctx.ConnectionID, in.Name, in.Description, in.TargetDatabase, in.Materialization,
 			in.SQLBody, in.TableEngine, in.OrderBy,
@@ -119,6 +125,11 @@ var createModel = Tool{
 		if err != nil {
 			return nil, fmt.Errorf("create model: %w", err)
 		}
+		if opts != (database.ModelOptions{}) {
+			if err := tctx.DB.UpdateModelOptions(id, opts); err != nil {
+				return nil, fmt.Errorf("save model options: %w", err)
+			}
+		}
 		return map[string]any{
 			"created":  true,
 			"model_id": id,
@@ -7,7 +7,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/credentials"
 	"github.com/caioricciuti/ch-ui/internal/database"
 	"github.com/caioricciuti/ch-ui/internal/tunnel"
 )
@@ -24,12 +24,14 @@ const (
 
 // Harvester periodically polls each connected cluster for aggregated health
 // samples and stores them as time-series, pruning per the configured retention.
-// It mirrors the governance Syncer's lifecycle and credential-borrowing model.
+// It mirrors the governance Syncer's lifecycle and runs as the connection's
+// service credential, unless the settings assign a different one.
 type Harvester struct {
 	store   *Store
 	db      *database.DB
 	gateway *tunnel.Gateway
 	secret  string
+	creds   *credentials.Resolver
 
 	mu        sync.Mutex
 	running   bool
@@ -45,6 +47,7 @@ func NewHarvester(store *Store, db *database.DB, gw *tunnel.Gateway, secret stri
 		db:       db,
 		gateway:  gw,
 		secret:   secret,
+		creds:    credentials.NewResolver(db, secret),
 		lastPoll: make(map[string]time.Time),
 	}
 }
@@ -151,7 +154,7 @@ func (h *Harvester) markPolled(connID string, now time.Time) {
 }
 
 func (h *Harvester) pollConnection(connID string, settings Settings, now time.Time) {
-	creds, err := h.findCredentials(connID)
+	creds, err := h.findCredentials(connID, settings.CredentialID)
 	if err != nil {
 		slog.Debug("Cluster health: no credentials for connection", "connection", connID, "error", err)
 		return
@@ -207,20 +210,13 @@ func (h *Harvester) pruneRetention(connections []database.Connection) {
 	}
 }
 
-// findCredentials borrows credentials from an active session for the connection.
-func (h *Harvester) findCredentials(connectionID string) (CHCredentials, error) {
-	sessions, err := h.db.GetActiveSessionsByConnection(connectionID, 3)
+// findCredentials resolves the login monitoring queries run as.
+func (h *Harvester) findCredentials(connectionID, credentialID string) (CHCredentials, error) {
+	creds, err := h.creds.Resolve(connectionID, credentialID)
 	if err != nil {
-		return CHCredentials{}, fmt.Errorf("failed to load sessions: %w", err)
+		return CHCredentials{}, err
 	}
-	for _, sess := range sessions {
-		password, err := crypto.Decrypt(sess.EncryptedPassword, h.secret)
-		if err != nil {
-			continue
-		}
-		return CHCredentials{ConnectionID: connectionID, User: sess.ClickhouseUser, Password: password}, nil
-	}
-	return CHCredentials{}, fmt.Errorf("no active sessions with valid credentials for connection %s", connectionID)
+	return CHCredentials{ConnectionID: connectionID, User: creds.User, Password: creds.Password}, nil
 }
 
 // executeQuery runs a SQL statement through the tunnel and parses the JSON rows.
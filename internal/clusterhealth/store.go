@@ -27,13 +27,13 @@ func (s *Store) conn() *sql.DB {
 func (s *Store) GetSettings(connectionID string) (Settings, error) {
 	row := s.conn().QueryRow(
 		`SELECT connection_id, enabled, retention_days, poll_interval_seconds,
-		        long_query_threshold_seconds, COALESCE(updated_at, '')
+		        long_query_threshold_seconds, COALESCE(updated_at, ''), COALESCE(credential_id, '')
 		 FROM ch_health_settings WHERE connection_id = ?`, connectionID,
 	)
 	var st Settings
 	var enabled int
 	err := row.Scan(&st.ConnectionID, &enabled, &st.RetentionDays, &st.PollIntervalSeconds,
-		&st.LongQueryThresholdSecs, &st.UpdatedAt)
+		&st.LongQueryThresholdSecs, &st.UpdatedAt, &st.CredentialID)
 	if err == sql.ErrNoRows {
 		return DefaultSettings(connectionID), nil
 	}
@@ -52,17 +52,22 @@ func (s *Store) UpsertSettings(in Settings) (Settings, error) {
 	if out.Enabled {
 		enabled = 1
 	}
+	var credentialID interface{}
+	if out.CredentialID != "" {
+		credentialID = out.CredentialID
+	}
 	_, err := s.conn().Exec(
 		`INSERT INTO ch_health_settings
-		   (connection_id, enabled, retention_days, poll_interval_seconds, long_query_threshold_seconds, updated_at)
-		 VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		   (connection_id, enabled, retention_days, poll_interval_seconds, long_query_threshold_seconds, credential_id, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 		 ON CONFLICT(connection_id) DO UPDATE SET
 		   enabled = excluded.enabled,
 		   retention_days = excluded.retention_days,
 		   poll_interval_seconds = excluded.poll_interval_seconds,
 		   long_query_threshold_seconds = excluded.long_query_threshold_seconds,
+		   credential_id = excluded.credential_id,
 		   updated_at = CURRENT_TIMESTAMP`,
-		out.ConnectionID, enabled, out.RetentionDays, out.PollIntervalSeconds, out.LongQueryThresholdSecs,
+		out.ConnectionID, enabled, out.RetentionDays, out.PollIntervalSeconds, out.LongQueryThresholdSecs, credentialID,
 	)
 	if err != nil {
 		return out, fmt.Errorf("upsert cluster-health settings: %w", err)
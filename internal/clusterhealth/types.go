@@ -1,7 +1,7 @@
 package clusterhealth
 
-// CHCredentials carries the ClickHouse credentials the harvester borrows from an
-// active session to run monitoring queries through the tunnel gateway.
+// CHCredentials carries the ClickHouse credentials the harvester runs
+// monitoring queries with through the tunnel gateway.
 type CHCredentials struct {
 	ConnectionID string
 	User         string
@@ -16,7 +16,10 @@ type Settings struct {
 	RetentionDays          int    `json:"retention_days"`
 	PollIntervalSeconds    int    `json:"poll_interval_seconds"`
 	LongQueryThresholdSecs int    `json:"long_query_threshold_seconds"`
-	UpdatedAt              string `json:"updated_at"`
+	// CredentialID is the service credential monitoring queries run as;
+	// empty uses the connection's default.
+	CredentialID string `json:"credential_id"`
+	UpdatedAt    string `json:"updated_at"`
 }
 
 // DefaultSettings returns the baseline configuration applied when a connection
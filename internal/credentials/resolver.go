@@ -0,0 +1,113 @@
+// Package credentials resolves the ClickHouse login that background jobs
+// (schedules, model runs, pipelines, governance sync and cluster-health
+// monitoring) run as.
+package credentials
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+// Sources a resolved login can come from.
+const (
+	SourceServiceCredential = "service_credential"
+	SourceSession           = "session"
+)
+
+// Credentials is a resolved ClickHouse login.
+type Credentials struct {
+	ConnectionID string
+	User         string
+	Password     string
+	Source       string
+
+	// CredentialID is set when a service credential was used.
+	CredentialID string
+	// Session is set when the login was borrowed from a user session.
+	Session *database.Session
+}
+
+// Resolver picks the login for a background job. In order it uses the
+// service credential assigned to the job, the connection's default service
+// credential and, when the session fallback setting allows it, the password
+// of an active user session on the connection.
+type Resolver struct {
+	db     *database.DB
+	secret string
+}
+
+// NewResolver creates a resolver that decrypts passwords with secret.
+func NewResolver(db *database.DB, secret string) *Resolver {
+	return &Resolver{db: db, secret: secret}
+}
+
+// Resolve returns the login for a job on connectionID. credentialID is the
+// job's assigned service credential, or empty to use the connection default.
+// An assigned credential that cannot be used is an error rather than a
+// reason to fall back, so a job never silently runs as someone else.
+func (r *Resolver) Resolve(connectionID, credentialID string) (Credentials, error) {
+	if credentialID != "" {
+		cred, err := r.db.GetServiceCredentialByID(credentialID)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("load service credential: %w", err)
+		}
+		if cred == nil {
+			return Credentials{}, fmt.Errorf("service credential %s not found", credentialID)
+		}
+		if cred.ConnectionID != connectionID {
+			return Credentials{}, fmt.Errorf("service credential %q belongs to another connection", cred.Name)
+		}
+		return r.use(cred)
+	}
+
+	cred, err := r.db.GetDefaultServiceCredential(connectionID)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("load default service credential: %w", err)
+	}
+	if cred != nil {
+		return r.use(cred)
+	}
+
+	if !r.db.SessionCredentialFallbackEnabled() {
+		return Credentials{}, fmt.Errorf("no service credential configured for connection %s", connectionID)
+	}
+	sessions, err := r.db.GetActiveSessionsByConnection(connectionID, 3)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to load sessions: %w", err)
+	}
+	for i := range sessions {
+		sess := &sessions[i]
+		password, err := crypto.Decrypt(sess.EncryptedPassword, r.secret)
+		if err != nil {
+			continue
+		}
+		return Credentials{
+			ConnectionID: connectionID,
+			User:         sess.ClickhouseUser,
+			Password:     password,
+			Source:       SourceSession,
+			Session:      sess,
+		}, nil
+	}
+	return Credentials{}, fmt.Errorf("no service credential configured and no active sessions with valid credentials for connection %s", connectionID)
+}
+
+func (r *Resolver) use(cred *database.ServiceCredential) (Credentials, error) {
+	password, err := crypto.Decrypt(cred.EncryptedPassword, r.secret)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("decrypt service credential %q: %w", cred.Name, err)
+	}
+	if err := r.db.TouchServiceCredential(cred.ID); err != nil {
+		slog.Debug("Failed to record service credential use", "credential", cred.ID, "error", err)
+	}
+	return Credentials{
+		ConnectionID: cred.ConnectionID,
+		User:         cred.ClickhouseUser,
+		Password:     password,
+		Source:       SourceServiceCredential,
+		CredentialID: cred.ID,
+	}, nil
+}
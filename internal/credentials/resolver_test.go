@@ -0,0 +1,124 @@
+package credentials
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+const testSecret = "test-secret-key"
+
+func openTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func encrypt(t *testing.T, s string) string {
+	t.Helper()
+	enc, err := crypto.Encrypt(s, testSecret)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	return enc
+}
+
+func TestResolve(t *testing.T) {
+	db := openTestDB(t)
+	r := NewResolver(db, testSecret)
+
+	conn, err := db.CreateConnection("local", "tok", true)
+	if err != nil {
+		t.Fatalf("CreateConnection: %v", err)
+	}
+	other, err := db.CreateConnection("other", "tok2", false)
+	if err != nil {
+		t.Fatalf("CreateConnection: %v", err)
+	}
+
+	// No credential and no session.
+	if _, err := r.Resolve(conn, ""); err == nil {
+		t.Fatal("expected error without credentials")
+	}
+
+	// A user session is borrowed while the fallback is enabled.
+	if _, err := db.CreateSession(database.CreateSessionParams{
+		ConnectionID:      conn,
+		ClickhouseUser:    "alice",
+		EncryptedPassword: encrypt(t, "alice-pw"),
+		Token:             "session-token",
+		ExpiresAt:         time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	creds, err := r.Resolve(conn, "")
+	if err != nil {
+		t.Fatalf("Resolve with session: %v", err)
+	}
+	if creds.Source != SourceSession || creds.User != "alice" || creds.Session == nil {
+		t.Fatalf("expected borrowed session, got %+v", creds)
+	}
+
+	// A default service credential wins over sessions.
+	defaultID, err := db.CreateServiceCredential(conn, "etl", "etl_user", encrypt(t, "etl-pw"), true, "admin")
+	if err != nil {
+		t.Fatalf("CreateServiceCredential: %v", err)
+	}
+	creds, err = r.Resolve(conn, "")
+	if err != nil {
+		t.Fatalf("Resolve default: %v", err)
+	}
+	if creds.Source != SourceServiceCredential || creds.User != "etl_user" || creds.Password != "etl-pw" || creds.CredentialID != defaultID {
+		t.Fatalf("expected default service credential, got %+v", creds)
+	}
+
+	// An assigned credential wins over the default.
+	reportingID, err := db.CreateServiceCredential(conn, "reporting", "reporter", encrypt(t, "rep-pw"), false, "admin")
+	if err != nil {
+		t.Fatalf("CreateServiceCredential: %v", err)
+	}
+	creds, err = r.Resolve(conn, reportingID)
+	if err != nil {
+		t.Fatalf("Resolve assigned: %v", err)
+	}
+	if creds.User != "reporter" || creds.Password != "rep-pw" {
+		t.Fatalf("expected assigned credential, got %+v", creds)
+	}
+
+	// An assigned credential of another connection is rejected.
+	if _, err := r.Resolve(other, reportingID); err == nil || !strings.Contains(err.Error(), "another connection") {
+		t.Fatalf("expected cross-connection error, got %v", err)
+	}
+
+	// Making another credential default clears the previous default.
+	if err := db.UpdateServiceCredential(reportingID, "reporting", "reporter", "", true); err != nil {
+		t.Fatalf("UpdateServiceCredential: %v", err)
+	}
+	creds, err = r.Resolve(conn, "")
+	if err != nil || creds.User != "reporter" {
+		t.Fatalf("expected new default, got %+v, %v", creds, err)
+	}
+
+	// Without service credentials and with the fallback disabled, sessions
+	// are no longer borrowed.
+	if err := db.DeleteServiceCredential(defaultID); err != nil {
+		t.Fatalf("DeleteServiceCredential: %v", err)
+	}
+	if err := db.DeleteServiceCredential(reportingID); err != nil {
+		t.Fatalf("DeleteServiceCredential: %v", err)
+	}
+	if err := db.SetSessionCredentialFallbackEnabled(false); err != nil {
+		t.Fatalf("SetSessionCredentialFallbackEnabled: %v", err)
+	}
+	if _, err := r.Resolve(conn, ""); err == nil {
+		t.Fatal("expected error with session fallback disabled")
+	}
+}
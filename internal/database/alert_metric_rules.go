@@ -0,0 +1,219 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Metric alert rule states.
+const (
+	MetricRuleStateOK      = "ok"
+	MetricRuleStatePending = "pending"
+	MetricRuleStateFiring  = "firing"
+)
+
+// AlertMetricRule is a user-defined alert on the value of a ClickHouse query.
+// The server runs the query every IntervalSeconds; once the condition has
+// held for ForSeconds the rule fires, and it resolves when the condition
+// clears.
+type AlertMetricRule struct {
+	ID               string   `json:"id"`
+	Name             string   `json:"name"`
+	ConnectionID     string   `json:"connection_id"`
+	CredentialID     *string  `json:"credential_id"`
+	Query            string   `json:"query"`
+	Condition        string   `json:"condition"`
+	Threshold        float64  `json:"threshold"`
+	IntervalSeconds  int      `json:"interval_seconds"`
+	ForSeconds       int      `json:"for_seconds"`
+	Severity         string   `json:"severity"`
+	Enabled          bool     `json:"enabled"`
+	State            string   `json:"state"`
+	PendingSince     *string  `json:"pending_since"`
+	LastValue        *float64 `json:"last_value"`
+	LastError        *string  `json:"last_error"`
+	LastEvaluatedAt  *string  `json:"last_evaluated_at"`
+	NextEvaluationAt *string  `json:"next_evaluation_at"`
+	CreatedBy        *string  `json:"created_by"`
+	CreatedAt        string   `json:"created_at"`
+	UpdatedAt        string   `json:"updated_at"`
+}
+
+// AlertMetricRuleEvaluation is the outcome of one evaluation of a rule.
+type AlertMetricRuleEvaluation struct {
+	State        string
+	PendingSince *time.Time
+	// Value is nil when the query returned no value.
+	Value       *float64
+	Error       string
+	EvaluatedAt time.Time
+	NextAt      time.Time
+}
+
+const alertMetricRuleColumns = `id, name, connection_id, credential_id, query, condition, threshold,
+	interval_seconds, for_seconds, severity, enabled, state, pending_since, last_value, last_error,
+	last_evaluated_at, next_evaluation_at, created_by, created_at, updated_at`
+
+// ListAlertMetricRules returns all metric alert rules.
+func (db *DB) ListAlertMetricRules() ([]AlertMetricRule, error) {
+	rows, err := db.conn.Query(`SELECT ` + alertMetricRuleColumns + ` FROM alert_metric_rules ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list alert metric rules: %w", err)
+	}
+	defer rows.Close()
+	return scanAlertMetricRules(rows)
+}
+
+// ListDueAlertMetricRules returns the enabled rules whose next evaluation is
+// due.
+func (db *DB) ListDueAlertMetricRules(now time.Time) ([]AlertMetricRule, error) {
+	rows, err := db.conn.Query(
+		`SELECT `+alertMetricRuleColumns+` FROM alert_metric_rules
+		 WHERE enabled = 1 AND (next_evaluation_at IS NULL OR next_evaluation_at <= ?)
+		 ORDER BY next_evaluation_at`,
+		now.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list due alert metric rules: %w", err)
+	}
+	defer rows.Close()
+	return scanAlertMetricRules(rows)
+}
+
+// GetAlertMetricRuleByID returns a metric alert rule, or nil if not found.
+func (db *DB) GetAlertMetricRuleByID(id string) (*AlertMetricRule, error) {
+	row := db.conn.QueryRow(`SELECT `+alertMetricRuleColumns+` FROM alert_metric_rules WHERE id = ?`, id)
+	rule, err := scanAlertMetricRule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get alert metric rule: %w", err)
+	}
+	return &rule, nil
+}
+
+// CreateAlertMetricRule stores a new metric alert rule in the ok state and
+// returns its ID. It is evaluated on the next evaluator tick.
+func (db *DB) CreateAlertMetricRule(rule AlertMetricRule, createdBy string) (string, error) {
+	id := uuid.NewString()
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.conn.Exec(
+		`INSERT INTO alert_metric_rules (id, name, connection_id, credential_id, query, condition, threshold,
+			interval_seconds, for_seconds, severity, enabled, state, created_by, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'ok', ?, ?, ?)`,
+		id, rule.Name, rule.ConnectionID, credentialValue(rule.CredentialID), rule.Query, rule.Condition, rule.Threshold,
+		rule.IntervalSeconds, rule.ForSeconds, rule.Severity, boolToInt(rule.Enabled), nullableString(createdBy), now, now,
+	); err != nil {
+		return "", fmt.Errorf("create alert metric rule: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateAlertMetricRule updates a rule's definition and schedules it for
+// evaluation on the next tick. An enabled rule keeps its state, so a firing
+// rule resolves through the evaluator; disabling a rule resets it to ok.
+func (db *DB) UpdateAlertMetricRule(rule AlertMetricRule) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	enabled := boolToInt(rule.Enabled)
+	if _, err := db.conn.Exec(
+		`UPDATE alert_metric_rules
+		 SET name = ?, connection_id = ?, credential_id = ?, query = ?, condition = ?, threshold = ?,
+			interval_seconds = ?, for_seconds = ?, severity = ?, enabled = ?,
+			state = CASE WHEN ? = 1 THEN state ELSE 'ok' END,
+			pending_since = CASE WHEN ? = 1 THEN pending_since ELSE NULL END,
+			next_evaluation_at = NULL, updated_at = ?
+		 WHERE id = ?`,
+		rule.Name, rule.ConnectionID, credentialValue(rule.CredentialID), rule.Query, rule.Condition, rule.Threshold,
+		rule.IntervalSeconds, rule.ForSeconds, rule.Severity, enabled, enabled, enabled, now, rule.ID,
+	); err != nil {
+		return fmt.Errorf("update alert metric rule: %w", err)
+	}
+	return nil
+}
+
+// DeleteAlertMetricRule deletes a metric alert rule.
+func (db *DB) DeleteAlertMetricRule(id string) error {
+	if _, err := db.conn.Exec(`DELETE FROM alert_metric_rules WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete alert metric rule: %w", err)
+	}
+	return nil
+}
+
+// RecordAlertMetricRuleEvaluation stores the outcome of an evaluation.
+func (db *DB) RecordAlertMetricRuleEvaluation(id string, eval AlertMetricRuleEvaluation) error {
+	var pendingSince, value, lastError interface{}
+	if eval.PendingSince != nil {
+		pendingSince = eval.PendingSince.UTC().Format(time.RFC3339)
+	}
+	if eval.Value != nil {
+		value = *eval.Value
+	}
+	if eval.Error != "" {
+		lastError = eval.Error
+	}
+	if _, err := db.conn.Exec(
+		`UPDATE alert_metric_rules
+		 SET state = ?, pending_since = ?, last_value = ?, last_error = ?, last_evaluated_at = ?, next_evaluation_at = ?
+		 WHERE id = ?`,
+		eval.State, pendingSince, value, lastError,
+		eval.EvaluatedAt.UTC().Format(time.RFC3339), eval.NextAt.UTC().Format(time.RFC3339), id,
+	); err != nil {
+		return fmt.Errorf("record alert metric rule evaluation: %w", err)
+	}
+	return nil
+}
+
+func credentialValue(id *string) interface{} {
+	if id == nil {
+		return nil
+	}
+	return nullableString(*id)
+}
+
+func scanAlertMetricRules(rows *sql.Rows) ([]AlertMetricRule, error) {
+	out := make([]AlertMetricRule, 0)
+	for rows.Next() {
+		rule, err := scanAlertMetricRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan alert metric rule: %w", err)
+		}
+		out = append(out, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate alert metric rules: %w", err)
+	}
+	return out, nil
+}
+
+func scanAlertMetricRule(scanner interface {
+	Scan(dest ...interface{}) error
+}) (AlertMetricRule, error) {
+	var rule AlertMetricRule
+	var enabled int
+	var credentialID, pendingSince, lastError, lastEvaluatedAt, nextEvaluationAt, createdBy sql.NullString
+	var lastValue sql.NullFloat64
+	err := scanner.Scan(
+		&rule.ID, &rule.Name, &rule.ConnectionID, &credentialID, &rule.Query, &rule.Condition, &rule.Threshold,
+		&rule.IntervalSeconds, &rule.ForSeconds, &rule.Severity, &enabled, &rule.State, &pendingSince, &lastValue, &lastError,
+		&lastEvaluatedAt, &nextEvaluationAt, &createdBy, &rule.CreatedAt, &rule.UpdatedAt,
+	)
+	if err != nil {
+		return rule, err
+	}
+	rule.Enabled = enabled == 1
+	rule.CredentialID = nullStringToPtr(credentialID)
+	rule.PendingSince = nullStringToPtr(pendingSince)
+	rule.LastError = nullStringToPtr(lastError)
+	rule.LastEvaluatedAt = nullStringToPtr(lastEvaluatedAt)
+	rule.NextEvaluationAt = nullStringToPtr(nextEvaluationAt)
+	rule.CreatedBy = nullStringToPtr(createdBy)
+	if lastValue.Valid {
+		v := lastValue.Float64
+		rule.LastValue = &v
+	}
+	return rule, nil
+}
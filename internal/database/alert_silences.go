@@ -0,0 +1,272 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AlertEventMatcher selects the alert events a silence or maintenance window
+// applies to. Empty fields match any event.
+type AlertEventMatcher struct {
+	EventType    string   `json:"event_type"`
+	ConnectionID *string  `json:"connection_id"`
+	Severities   []string `json:"severities"`
+	// PayloadMatchers maps payload fields, with dots for nested fields, to
+	// the value they must equal.
+	PayloadMatchers map[string]string `json:"payload_matchers"`
+}
+
+// AlertSilence suppresses dispatch of matching events between StartsAt and
+// EndsAt.
+type AlertSilence struct {
+	ID string `json:"id"`
+	AlertEventMatcher
+	Comment   string  `json:"comment"`
+	StartsAt  string  `json:"starts_at"`
+	EndsAt    string  `json:"ends_at"`
+	CreatedBy *string `json:"created_by"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// AlertMaintenanceWindow suppresses dispatch of matching events every week
+// on Days (0 is Sunday) from StartTime to EndTime ("HH:MM") in Timezone. A
+// window whose end is not after its start runs past midnight.
+type AlertMaintenanceWindow struct {
+	ID string `json:"id"`
+	AlertEventMatcher
+	Name      string  `json:"name"`
+	Days      []int   `json:"days"`
+	StartTime string  `json:"start_time"`
+	EndTime   string  `json:"end_time"`
+	Timezone  string  `json:"timezone"`
+	Enabled   bool    `json:"enabled"`
+	CreatedBy *string `json:"created_by"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+// ListAlertSilences returns silences that have not ended, plus those that
+// ended within the last week, newest first.
+func (db *DB) ListAlertSilences() ([]AlertSilence, error) {
+	since := time.Now().UTC().Add(-7 * 24 * time.Hour).Format(time.RFC3339)
+	return db.queryAlertSilences(`WHERE ends_at >= ? ORDER BY starts_at DESC`, since)
+}
+
+// ListActiveAlertSilences returns the silences in effect at now.
+func (db *DB) ListActiveAlertSilences(now time.Time) ([]AlertSilence, error) {
+	ts := now.UTC().Format(time.RFC3339)
+	return db.queryAlertSilences(`WHERE starts_at <= ? AND ends_at > ?`, ts, ts)
+}
+
+// GetAlertSilenceByID returns a silence, or nil if not found.
+func (db *DB) GetAlertSilenceByID(id string) (*AlertSilence, error) {
+	silences, err := db.queryAlertSilences(`WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(silences) == 0 {
+		return nil, nil
+	}
+	return &silences[0], nil
+}
+
+// CreateAlertSilence stores a silence and returns its ID.
+func (db *DB) CreateAlertSilence(silence AlertSilence, createdBy string) (string, error) {
+	id := uuid.NewString()
+	severities, payloadMatchers := matcherJSON(silence.AlertEventMatcher)
+	if _, err := db.conn.Exec(
+		`INSERT INTO alert_silences (id, comment, event_type, connection_id, severities_json, payload_matchers_json, starts_at, ends_at, created_by, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, silence.Comment, matcherEventType(silence.EventType), credentialValue(silence.ConnectionID), severities, payloadMatchers,
+		silence.StartsAt, silence.EndsAt, nullableString(createdBy), time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		return "", fmt.Errorf("create alert silence: %w", err)
+	}
+	return id, nil
+}
+
+// ExpireAlertSilence ends a silence now. Silences that have not started yet
+// end at their start.
+func (db *DB) ExpireAlertSilence(id string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.conn.Exec(
+		`UPDATE alert_silences
+		 SET ends_at = CASE WHEN starts_at > ? THEN starts_at ELSE ? END
+		 WHERE id = ? AND ends_at > ?`,
+		now, now, id, now,
+	); err != nil {
+		return fmt.Errorf("expire alert silence: %w", err)
+	}
+	return nil
+}
+
+// ListAlertMaintenanceWindows returns all maintenance windows.
+func (db *DB) ListAlertMaintenanceWindows() ([]AlertMaintenanceWindow, error) {
+	return db.queryAlertMaintenanceWindows(`ORDER BY name`)
+}
+
+// ListEnabledAlertMaintenanceWindows returns the enabled maintenance windows.
+func (db *DB) ListEnabledAlertMaintenanceWindows() ([]AlertMaintenanceWindow, error) {
+	return db.queryAlertMaintenanceWindows(`WHERE enabled = 1`)
+}
+
+// GetAlertMaintenanceWindowByID returns a maintenance window, or nil if not
+// found.
+func (db *DB) GetAlertMaintenanceWindowByID(id string) (*AlertMaintenanceWindow, error) {
+	windows, err := db.queryAlertMaintenanceWindows(`WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(windows) == 0 {
+		return nil, nil
+	}
+	return &windows[0], nil
+}
+
+// CreateAlertMaintenanceWindow stores a maintenance window and returns its ID.
+func (db *DB) CreateAlertMaintenanceWindow(w AlertMaintenanceWindow, createdBy string) (string, error) {
+	id := uuid.NewString()
+	now := time.Now().UTC().Format(time.RFC3339)
+	severities, payloadMatchers := matcherJSON(w.AlertEventMatcher)
+	days, _ := json.Marshal(w.Days)
+	if _, err := db.conn.Exec(
+		`INSERT INTO alert_maintenance_windows (id, name, event_type, connection_id, severities_json, payload_matchers_json,
+			days_json, start_time, end_time, timezone, enabled, created_by, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, w.Name, matcherEventType(w.EventType), credentialValue(w.ConnectionID), severities, payloadMatchers,
+		string(days), w.StartTime, w.EndTime, w.Timezone, boolToInt(w.Enabled), nullableString(createdBy), now, now,
+	); err != nil {
+		return "", fmt.Errorf("create alert maintenance window: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateAlertMaintenanceWindow updates a maintenance window.
+func (db *DB) UpdateAlertMaintenanceWindow(w AlertMaintenanceWindow) error {
+	severities, payloadMatchers := matcherJSON(w.AlertEventMatcher)
+	days, _ := json.Marshal(w.Days)
+	if _, err := db.conn.Exec(
+		`UPDATE alert_maintenance_windows
+		 SET name = ?, event_type = ?, connection_id = ?, severities_json = ?, payload_matchers_json = ?,
+			days_json = ?, start_time = ?, end_time = ?, timezone = ?, enabled = ?, updated_at = ?
+		 WHERE id = ?`,
+		w.Name, matcherEventType(w.EventType), credentialValue(w.ConnectionID), severities, payloadMatchers,
+		string(days), w.StartTime, w.EndTime, w.Timezone, boolToInt(w.Enabled), time.Now().UTC().Format(time.RFC3339), w.ID,
+	); err != nil {
+		return fmt.Errorf("update alert maintenance window: %w", err)
+	}
+	return nil
+}
+
+// DeleteAlertMaintenanceWindow deletes a maintenance window.
+func (db *DB) DeleteAlertMaintenanceWindow(id string) error {
+	if _, err := db.conn.Exec(`DELETE FROM alert_maintenance_windows WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete alert maintenance window: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) queryAlertSilences(clause string, args ...interface{}) ([]AlertSilence, error) {
+	rows, err := db.conn.Query(
+		`SELECT id, comment, event_type, connection_id, severities_json, payload_matchers_json, starts_at, ends_at, created_by, created_at
+		 FROM alert_silences `+clause,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list alert silences: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]AlertSilence, 0)
+	for rows.Next() {
+		var item AlertSilence
+		var connectionID, createdBy sql.NullString
+		var severities, payloadMatchers string
+		if err := rows.Scan(
+			&item.ID, &item.Comment, &item.EventType, &connectionID, &severities, &payloadMatchers,
+			&item.StartsAt, &item.EndsAt, &createdBy, &item.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan alert silence: %w", err)
+		}
+		item.ConnectionID = nullStringToPtr(connectionID)
+		item.CreatedBy = nullStringToPtr(createdBy)
+		item.Severities, item.PayloadMatchers = parseMatcherJSON(severities, payloadMatchers)
+		out = append(out, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate alert silences: %w", err)
+	}
+	return out, nil
+}
+
+func (db *DB) queryAlertMaintenanceWindows(clause string, args ...interface{}) ([]AlertMaintenanceWindow, error) {
+	rows, err := db.conn.Query(
+		`SELECT id, name, event_type, connection_id, severities_json, payload_matchers_json,
+			days_json, start_time, end_time, timezone, enabled, created_by, created_at, updated_at
+		 FROM alert_maintenance_windows `+clause,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list alert maintenance windows: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]AlertMaintenanceWindow, 0)
+	for rows.Next() {
+		var item AlertMaintenanceWindow
+		var connectionID, createdBy sql.NullString
+		var severities, payloadMatchers, days string
+		var enabled int
+		if err := rows.Scan(
+			&item.ID, &item.Name, &item.EventType, &connectionID, &severities, &payloadMatchers,
+			&days, &item.StartTime, &item.EndTime, &item.Timezone, &enabled, &createdBy, &item.CreatedAt, &item.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan alert maintenance window: %w", err)
+		}
+		item.ConnectionID = nullStringToPtr(connectionID)
+		item.CreatedBy = nullStringToPtr(createdBy)
+		item.Enabled = enabled == 1
+		item.Severities, item.PayloadMatchers = parseMatcherJSON(severities, payloadMatchers)
+		item.Days = []int{}
+		_ = json.Unmarshal([]byte(days), &item.Days)
+		out = append(out, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate alert maintenance windows: %w", err)
+	}
+	return out, nil
+}
+
+func matcherEventType(eventType string) string {
+	if strings.TrimSpace(eventType) == "" {
+		return "*"
+	}
+	return strings.TrimSpace(eventType)
+}
+
+func matcherJSON(m AlertEventMatcher) (string, string) {
+	severities := m.Severities
+	if severities == nil {
+		severities = []string{}
+	}
+	payloadMatchers := m.PayloadMatchers
+	if payloadMatchers == nil {
+		payloadMatchers = map[string]string{}
+	}
+	s, _ := json.Marshal(severities)
+	p, _ := json.Marshal(payloadMatchers)
+	return string(s), string(p)
+}
+
+func parseMatcherJSON(severitiesJSON, payloadMatchersJSON string) ([]string, map[string]string) {
+	severities := []string{}
+	payloadMatchers := map[string]string{}
+	_ = json.Unmarshal([]byte(severitiesJSON), &severities)
+	_ = json.Unmarshal([]byte(payloadMatchersJSON), &payloadMatchers)
+	return severities, payloadMatchers
+}
@@ -72,8 +72,14 @@ type AlertEvent struct {
 	Fingerprint  *string `json:"fingerprint"`
 	SourceRef    *string `json:"source_ref"`
 	Status       string  `json:"status"`
+	Resolves     bool    `json:"resolves"`
 	CreatedAt    string  `json:"created_at"`
 	ProcessedAt  *string `json:"processed_at"`
+	// SuppressedBy names the silence or maintenance window that kept a
+	// suppressed event from being dispatched.
+	SuppressedBy   *string `json:"suppressed_by"`
+	AcknowledgedBy *string `json:"acknowledged_by"`
+	AcknowledgedAt *string `json:"acknowledged_at"`
 }
 
 type AlertDispatchJob struct {
@@ -101,6 +107,8 @@ type AlertDispatchJobWithDetails struct {
 	EventMessage                     string  `json:"event_message"`
 	EventPayloadJSON                 *string `json:"event_payload_json"`
 	EventFingerprint                 *string `json:"event_fingerprint"`
+	EventResolves                    bool    `json:"event_resolves"`
+	EventAcknowledged                bool    `json:"event_acknowledged"`
 	RuleName                         string  `json:"rule_name"`
 	RuleCooldownSeconds              int     `json:"rule_cooldown_seconds"`
 	RuleSubjectTemplate              *string `json:"rule_subject_template"`
@@ -518,6 +526,47 @@ func (db *DB) CreateAlertEvent(connectionID *string, eventType, severity, title,
 	return id, nil
 }
 
+// ResolveAlertEvent records that the condition behind a fingerprint has
+// cleared. A resolution event is only created when the latest event for the
+// fingerprint is an unresolved one; it copies that event's connection, type
+// and severity so the same rules match it. Returns an empty id when there
+// was nothing to resolve.
+func (db *DB) ResolveAlertEvent(fingerprint, message, sourceRef string) (string, error) {
+	fingerprint = strings.TrimSpace(fingerprint)
+	if fingerprint == "" {
+		return "", nil
+	}
+	var connectionID sql.NullString
+	var eventType, severity, title string
+	var resolves bool
+	err := db.conn.QueryRow(
+		`SELECT connection_id, event_type, severity, title, resolves
+		 FROM alert_events
+		 WHERE fingerprint = ?
+		 ORDER BY created_at DESC, resolves DESC
+		 LIMIT 1`,
+		fingerprint,
+	).Scan(&connectionID, &eventType, &severity, &title, &resolves)
+	if err == sql.ErrNoRows || (err == nil && resolves) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("load alert event to resolve: %w", err)
+	}
+
+	id := uuid.NewString()
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.conn.Exec(
+		`INSERT INTO alert_events (id, connection_id, event_type, severity, title, message, fingerprint, source_ref, status, resolves, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'new', 1, ?)`,
+		id, connectionID, eventType, severity, "Resolved: "+title,
+		strings.TrimSpace(message), fingerprint, nullableString(sourceRef), now,
+	); err != nil {
+		return "", fmt.Errorf("create alert resolution: %w", err)
+	}
+	return id, nil
+}
+
 func (db *DB) ListAlertEvents(limit int, eventType, status string) ([]AlertEvent, error) {
 	if limit <= 0 {
 		limit = 100
@@ -539,7 +588,8 @@ func (db *DB) ListAlertEvents(limit int, eventType, status string) ([]AlertEvent
 	args = append(args, limit)
 
 	query := fmt.Sprintf(
-		`SELECT id, connection_id, event_type, severity, title, message, payload_json, fingerprint, source_ref, status, created_at, processed_at
+		`SELECT id, connection_id, event_type, severity, title, message, payload_json, fingerprint, source_ref, status, resolves, created_at, processed_at,
+			suppressed_by, acknowledged_by, acknowledged_at
 		 FROM alert_events
 		 WHERE %s
 		 ORDER BY created_at DESC
@@ -556,9 +606,11 @@ func (db *DB) ListAlertEvents(limit int, eventType, status string) ([]AlertEvent
 	for rows.Next() {
 		var item AlertEvent
 		var connectionID, payloadJSON, fingerprint, sourceRef, processedAt sql.NullString
+		var suppressedBy, acknowledgedBy, acknowledgedAt sql.NullString
 		if err := rows.Scan(
 			&item.ID, &connectionID, &item.EventType, &item.Severity, &item.Title, &item.Message,
-			&payloadJSON, &fingerprint, &sourceRef, &item.Status, &item.CreatedAt, &processedAt,
+			&payloadJSON, &fingerprint, &sourceRef, &item.Status, &item.Resolves, &item.CreatedAt, &processedAt,
+			&suppressedBy, &acknowledgedBy, &acknowledgedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan alert event: %w", err)
 		}
@@ -567,6 +619,9 @@ func (db *DB) ListAlertEvents(limit int, eventType, status string) ([]AlertEvent
 		item.Fingerprint = nullStringToPtr(fingerprint)
 		item.SourceRef = nullStringToPtr(sourceRef)
 		item.ProcessedAt = nullStringToPtr(processedAt)
+		item.SuppressedBy = nullStringToPtr(suppressedBy)
+		item.AcknowledgedBy = nullStringToPtr(acknowledgedBy)
+		item.AcknowledgedAt = nullStringToPtr(acknowledgedAt)
 		out = append(out, item)
 	}
 	if err := rows.Err(); err != nil {
@@ -581,7 +636,8 @@ func (db *DB) ListNewAlertEvents(limit int) ([]AlertEvent, error) {
 	}
 
 	rows, err := db.conn.Query(
-		`SELECT id, connection_id, event_type, severity, title, message, payload_json, fingerprint, source_ref, status, created_at, processed_at
+		`SELECT id, connection_id, event_type, severity, title, message, payload_json, fingerprint, source_ref, status, resolves, created_at, processed_at,
+			suppressed_by, acknowledged_by, acknowledged_at
 		 FROM alert_events
 		 WHERE status = 'new'
 		 ORDER BY created_at ASC
@@ -597,9 +653,11 @@ func (db *DB) ListNewAlertEvents(limit int) ([]AlertEvent, error) {
 	for rows.Next() {
 		var item AlertEvent
 		var connectionID, payloadJSON, fingerprint, sourceRef, processedAt sql.NullString
+		var suppressedBy, acknowledgedBy, acknowledgedAt sql.NullString
 		if err := rows.Scan(
 			&item.ID, &connectionID, &item.EventType, &item.Severity, &item.Title, &item.Message,
-			&payloadJSON, &fingerprint, &sourceRef, &item.Status, &item.CreatedAt, &processedAt,
+			&payloadJSON, &fingerprint, &sourceRef, &item.Status, &item.Resolves, &item.CreatedAt, &processedAt,
+			&suppressedBy, &acknowledgedBy, &acknowledgedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan new alert event: %w", err)
 		}
@@ -608,6 +666,9 @@ func (db *DB) ListNewAlertEvents(limit int) ([]AlertEvent, error) {
 		item.Fingerprint = nullStringToPtr(fingerprint)
 		item.SourceRef = nullStringToPtr(sourceRef)
 		item.ProcessedAt = nullStringToPtr(processedAt)
+		item.SuppressedBy = nullStringToPtr(suppressedBy)
+		item.AcknowledgedBy = nullStringToPtr(acknowledgedBy)
+		item.AcknowledgedAt = nullStringToPtr(acknowledgedAt)
 		out = append(out, item)
 	}
 	if err := rows.Err(); err != nil {
@@ -627,6 +688,72 @@ func (db *DB) MarkAlertEventProcessed(id string) error {
 	return nil
 }
 
+// MarkAlertEventSuppressed records that an event was not dispatched because
+// a silence, maintenance window or acknowledgement covered it.
+func (db *DB) MarkAlertEventSuppressed(id, suppressedBy string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.conn.Exec(
+		`UPDATE alert_events SET status = 'suppressed', suppressed_by = ?, processed_at = ? WHERE id = ?`,
+		nullableString(suppressedBy), now, id,
+	); err != nil {
+		return fmt.Errorf("mark alert event suppressed: %w", err)
+	}
+	return nil
+}
+
+// acknowledgedEventSQL matches an alert_events row e that was acknowledged,
+// or whose fingerprint has an acknowledged event that has not been resolved
+// since.
+const acknowledgedEventSQL = `(e.acknowledged_at IS NOT NULL OR (e.fingerprint IS NOT NULL AND EXISTS (
+	SELECT 1 FROM alert_events a
+	WHERE a.fingerprint = e.fingerprint AND a.acknowledged_at IS NOT NULL AND a.resolves = 0
+	  AND NOT EXISTS (
+		SELECT 1 FROM alert_events r
+		WHERE r.fingerprint = a.fingerprint AND r.resolves = 1 AND r.created_at >= a.created_at
+	  )
+)))`
+
+// AcknowledgeAlertEvent marks an event as acknowledged by a user. Pending
+// dispatches of the event, and of later events with its fingerprint until
+// the condition resolves, are cancelled instead of retried or escalated.
+// Returns false when the event does not exist.
+func (db *DB) AcknowledgeAlertEvent(id, username string) (bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := db.conn.Exec(
+		`UPDATE alert_events
+		 SET acknowledged_by = COALESCE(acknowledged_by, ?), acknowledged_at = COALESCE(acknowledged_at, ?)
+		 WHERE id = ? AND resolves = 0`,
+		nullableString(username), now, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("acknowledge alert event: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// IsAlertFingerprintAcknowledged reports whether an unresolved event with
+// the fingerprint has been acknowledged.
+func (db *DB) IsAlertFingerprintAcknowledged(fingerprint string) (bool, error) {
+	if strings.TrimSpace(fingerprint) == "" {
+		return false, nil
+	}
+	var count int
+	if err := db.conn.QueryRow(
+		`SELECT COUNT(*)
+		 FROM alert_events a
+		 WHERE a.fingerprint = ? AND a.acknowledged_at IS NOT NULL AND a.resolves = 0
+		   AND NOT EXISTS (
+			SELECT 1 FROM alert_events r
+			WHERE r.fingerprint = a.fingerprint AND r.resolves = 1 AND r.created_at >= a.created_at
+		   )`,
+		fingerprint,
+	).Scan(&count); err != nil {
+		return false, fmt.Errorf("check alert acknowledgement: %w", err)
+	}
+	return count > 0, nil
+}
+
 func (db *DB) HasRecentAlertDispatch(routeID, fingerprint string, since time.Time) (bool, error) {
 	if strings.TrimSpace(fingerprint) == "" {
 		return false, nil
@@ -639,7 +766,12 @@ func (db *DB) HasRecentAlertDispatch(routeID, fingerprint string, since time.Tim
 		 WHERE j.route_id = ?
 		   AND e.fingerprint = ?
 		   AND e.created_at >= ?
-		   AND j.status IN ('queued', 'retrying', 'sending', 'sent')`,
+		   AND e.resolves = 0
+		   AND j.status IN ('queued', 'retrying', 'sending', 'sent')
+		   AND NOT EXISTS (
+			SELECT 1 FROM alert_events r
+			WHERE r.fingerprint = e.fingerprint AND r.resolves = 1 AND r.created_at >= e.created_at
+		   )`,
 		routeID, fingerprint, since.UTC().Format(time.RFC3339),
 	).Scan(&count); err != nil {
 		return false, fmt.Errorf("check recent alert dispatch: %w", err)
@@ -647,6 +779,34 @@ func (db *DB) HasRecentAlertDispatch(routeID, fingerprint string, since time.Tim
 	return count > 0, nil
 }
 
+// HasOpenAlertDispatch reports whether the latest notification a route
+// delivered (or has queued) for a fingerprint was a trigger rather than a
+// resolution, i.e. the receiving system still considers it open.
+func (db *DB) HasOpenAlertDispatch(routeID, fingerprint string) (bool, error) {
+	if strings.TrimSpace(fingerprint) == "" {
+		return false, nil
+	}
+	var resolves bool
+	err := db.conn.QueryRow(
+		`SELECT e.resolves
+		 FROM alert_dispatch_jobs j
+		 JOIN alert_events e ON e.id = j.event_id
+		 WHERE j.route_id = ?
+		   AND e.fingerprint = ?
+		   AND j.status IN ('queued', 'retrying', 'sending', 'sent')
+		 ORDER BY e.created_at DESC, e.resolves DESC
+		 LIMIT 1`,
+		routeID, fingerprint,
+	).Scan(&resolves)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("check open alert dispatch: %w", err)
+	}
+	return !resolves, nil
+}
+
 func (db *DB) CreateAlertDispatchJob(eventID, ruleID, routeID, channelID string, maxAttempts int, nextAttemptAt time.Time) (string, error) {
 	id := uuid.NewString()
 	now := time.Now().UTC().Format(time.RFC3339)
@@ -671,7 +831,8 @@ func (db *DB) ListDueAlertDispatchJobs(limit int) ([]AlertDispatchJobWithDetails
 	rows, err := db.conn.Query(
 		`SELECT
 			j.id, j.event_id, j.rule_id, j.route_id, j.channel_id, j.status, j.attempt_count, j.max_attempts, j.next_attempt_at, j.last_error, j.provider_message_id, j.created_at, j.updated_at, j.sent_at,
-			e.event_type, e.severity, e.title, e.message, e.payload_json, e.fingerprint,
+			e.event_type, e.severity, e.title, e.message, e.payload_json, e.fingerprint, e.resolves,
+			`+acknowledgedEventSQL+`,
 			r.name, r.cooldown_seconds, r.subject_template, r.body_template,
 			rr.recipients_json,
 			COALESCE(rp.delivery_mode, 'immediate'),
@@ -708,7 +869,8 @@ func (db *DB) ListDueAlertDispatchJobs(limit int) ([]AlertDispatchJobWithDetails
 		var escalationChannelID, escalationRecipientsJSON, escalationChannelName, escalationChannelType, escalationChannelConfig sql.NullString
 		if err := rows.Scan(
 			&item.ID, &item.EventID, &item.RuleID, &item.RouteID, &item.ChannelID, &item.Status, &item.AttemptCount, &item.MaxAttempts, &item.NextAttemptAt, &lastError, &providerMessageID, &item.CreatedAt, &item.UpdatedAt, &sentAt,
-			&item.EventType, &item.EventSeverity, &item.EventTitle, &item.EventMessage, &eventPayloadJSON, &eventFingerprint,
+			&item.EventType, &item.EventSeverity, &item.EventTitle, &item.EventMessage, &eventPayloadJSON, &eventFingerprint, &item.EventResolves,
+			&item.EventAcknowledged,
 			&item.RuleName, &item.RuleCooldownSeconds, &subjectTemplate, &bodyTemplate,
 			&item.RouteRecipientsJSON,
 			&item.RouteDeliveryMode, &item.RouteDigestWindowMins, &escalationChannelID, &escalationRecipientsJSON, &item.RouteEscalationAfterFailures,
@@ -784,6 +946,22 @@ func (db *DB) MarkAlertDispatchJobRetry(id string, nextAttemptAt time.Time, last
 	return nil
 }
 
+// MarkAlertDispatchJobCancelled stops a pending dispatch without sending it.
+func (db *DB) MarkAlertDispatchJobCancelled(id, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.conn.Exec(
+		`UPDATE alert_dispatch_jobs
+		 SET status = 'cancelled',
+		     last_error = ?,
+		     updated_at = ?
+		 WHERE id = ?`,
+		nullableString(reason), now, id,
+	); err != nil {
+		return fmt.Errorf("mark alert dispatch cancelled: %w", err)
+	}
+	return nil
+}
+
 func (db *DB) MarkAlertDispatchJobFailed(id, lastError string) error {
 	now := time.Now().UTC().Format(time.RFC3339)
 	if _, err := db.conn.Exec(
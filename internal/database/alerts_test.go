@@ -0,0 +1,119 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveAlertEventOnlyResolvesOpenConditions(t *testing.T) {
+	db := openTestDB(t)
+
+	if id, err := db.ResolveAlertEvent("schedule:s1:error", "ok", "run-0"); err != nil || id != "" {
+		t.Fatalf("resolve without a trigger = %q, %v; want no event", id, err)
+	}
+
+	if _, err := db.CreateAlertEvent(nil, "schedule.failed", "error", "Scheduled query failed: s1", "boom", nil, "schedule:s1:error", "run-1"); err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+	id, err := db.ResolveAlertEvent("schedule:s1:error", "ok", "run-2")
+	if err != nil || id == "" {
+		t.Fatalf("resolve open condition = %q, %v; want an event", id, err)
+	}
+	if again, err := db.ResolveAlertEvent("schedule:s1:error", "ok", "run-3"); err != nil || again != "" {
+		t.Fatalf("second resolve = %q, %v; want no event", again, err)
+	}
+
+	events, err := db.ListNewAlertEvents(10)
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 2 || events[1].ID != id || !events[1].Resolves || events[1].EventType != "schedule.failed" || events[1].Severity != "error" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if events[1].Title != "Resolved: Scheduled query failed: s1" {
+		t.Fatalf("resolution title = %q", events[1].Title)
+	}
+}
+
+func TestHasRecentAlertDispatchIgnoresResolvedTriggers(t *testing.T) {
+	db := openTestDB(t)
+
+	channelID, err := db.CreateAlertChannel("pd", "pagerduty", "enc", true, "admin")
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	ruleID, err := db.CreateAlertRule("failures", "schedule.failed", "error", true, 3600, 3, "", "", "admin")
+	if err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	if err := db.ReplaceAlertRuleRoutes(ruleID, []AlertRuleRoute{{ChannelID: channelID, Recipients: []string{}, IsActive: true, DeliveryMode: "immediate"}}); err != nil {
+		t.Fatalf("create route: %v", err)
+	}
+	routes, err := db.ListActiveAlertRuleRoutes(ruleID)
+	if err != nil || len(routes) != 1 {
+		t.Fatalf("list routes = %d, %v", len(routes), err)
+	}
+	routeID := routes[0].ID
+	since := time.Now().Add(-time.Hour)
+
+	triggerID, _ := db.CreateAlertEvent(nil, "schedule.failed", "error", "failed", "boom", nil, "fp", "")
+	if _, err := db.CreateAlertDispatchJob(triggerID, ruleID, routeID, channelID, 3, time.Now()); err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	if recent, _ := db.HasRecentAlertDispatch(routeID, "fp", since); !recent {
+		t.Fatal("trigger should be within cooldown")
+	}
+	if open, _ := db.HasOpenAlertDispatch(routeID, "fp"); !open {
+		t.Fatal("trigger should be open")
+	}
+
+	resolveID, err := db.ResolveAlertEvent("fp", "ok", "")
+	if err != nil || resolveID == "" {
+		t.Fatalf("resolve = %q, %v", resolveID, err)
+	}
+	if _, err := db.CreateAlertDispatchJob(resolveID, ruleID, routeID, channelID, 3, time.Now()); err != nil {
+		t.Fatalf("create resolve job: %v", err)
+	}
+	if recent, _ := db.HasRecentAlertDispatch(routeID, "fp", since); recent {
+		t.Fatal("a resolved trigger should not hold back a new one")
+	}
+	if open, _ := db.HasOpenAlertDispatch(routeID, "fp"); open {
+		t.Fatal("condition should be closed after the resolve")
+	}
+}
+
+func TestAcknowledgeAlertEventCoversFingerprintUntilResolved(t *testing.T) {
+	db := openTestDB(t)
+
+	channelID, _ := db.CreateAlertChannel("pd", "pagerduty", "enc", true, "admin")
+	ruleID, _ := db.CreateAlertRule("failures", "schedule.failed", "error", true, 0, 3, "", "", "admin")
+	if err := db.ReplaceAlertRuleRoutes(ruleID, []AlertRuleRoute{{ChannelID: channelID, Recipients: []string{}, IsActive: true, DeliveryMode: "immediate"}}); err != nil {
+		t.Fatalf("create route: %v", err)
+	}
+	routes, _ := db.ListActiveAlertRuleRoutes(ruleID)
+	routeID := routes[0].ID
+
+	firstID, _ := db.CreateAlertEvent(nil, "schedule.failed", "error", "failed", "boom", nil, "fp", "")
+	if ok, err := db.AcknowledgeAlertEvent(firstID, "oncall"); err != nil || !ok {
+		t.Fatalf("acknowledge = %v, %v", ok, err)
+	}
+	if acked, _ := db.IsAlertFingerprintAcknowledged("fp"); !acked {
+		t.Fatal("fingerprint should be acknowledged")
+	}
+
+	secondID, _ := db.CreateAlertEvent(nil, "schedule.failed", "error", "failed again", "boom", nil, "fp", "")
+	if _, err := db.CreateAlertDispatchJob(secondID, ruleID, routeID, channelID, 3, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	jobs, err := db.ListDueAlertDispatchJobs(10)
+	if err != nil || len(jobs) != 1 || !jobs[0].EventAcknowledged {
+		t.Fatalf("due jobs = %+v, %v; want one acknowledged job", jobs, err)
+	}
+
+	if _, err := db.ResolveAlertEvent("fp", "ok", ""); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if acked, _ := db.IsAlertFingerprintAcknowledged("fp"); acked {
+		t.Fatal("a resolution should end the acknowledgement")
+	}
+}
@@ -6,7 +6,7 @@ import (
 )
 
 // StartCleanupJobs launches background goroutines that periodically clean up
-// expired sessions and expired rate limits.
+// expired sessions, expired rate limits and old pipeline metrics.
 func (db *DB) StartCleanupJobs() {
 	slog.Info("Starting periodic cleanup jobs...")
 
@@ -28,6 +28,15 @@ func (db *DB) StartCleanupJobs() {
 		}
 	}()
 
+	// Prune pipeline metrics history (every 1 hour)
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			db.cleanupPipelineMetrics()
+		}
+	}()
+
 	slog.Info("Cleanup jobs scheduled")
 }
 
@@ -56,3 +65,18 @@ func (db *DB) cleanupRateLimits() {
 		slog.Info("Cleaned up expired rate limits", "count", cleaned)
 	}
 }
+
+// pipelineMetricsRetention is how long per-minute pipeline metrics are kept.
+const pipelineMetricsRetention = 30 * 24 * time.Hour
+
+// cleanupPipelineMetrics removes pipeline metric snapshots past retention.
+func (db *DB) cleanupPipelineMetrics() {
+	removed, err := db.DeletePipelineMetricsBefore(time.Now().Add(-pipelineMetricsRetention))
+	if err != nil {
+		slog.Error("Failed to cleanup pipeline metrics", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.Info("Cleaned up pipeline metrics", "count", removed)
+	}
+}
@@ -23,6 +23,8 @@ type Dashboard struct {
 	CreatedBy   *string `json:"created_by"`
 	CreatedAt   string  `json:"created_at"`
 	UpdatedAt   string  `json:"updated_at"`
+	// Variables holds the dashboard's template variable definitions as JSON.
+	Variables json.RawMessage `json:"variables"`
 }
 
 // Panel represents a dashboard panel.
@@ -46,7 +48,7 @@ type Panel struct {
 // GetDashboards retrieves all dashboards.
 func (db *DB) GetDashboards() ([]Dashboard, error) {
 	rows, err := db.conn.Query(
-		`SELECT id, name, description, created_by, created_at, updated_at
+		`SELECT id, name, description, created_by, created_at, updated_at, variables_json
 		 FROM dashboards ORDER BY updated_at DESC`,
 	)
 	if err != nil {
@@ -58,9 +60,11 @@ func (db *DB) GetDashboards() ([]Dashboard, error) {
 	for rows.Next() {
 		var d Dashboard
 		var desc, createdBy sql.NullString
-		if err := rows.Scan(&d.ID, &d.Name, &desc, &createdBy, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		var variables string
+		if err := rows.Scan(&d.ID, &d.Name, &desc, &createdBy, &d.CreatedAt, &d.UpdatedAt, &variables); err != nil {
 			return nil, fmt.Errorf("scan dashboard: %w", err)
 		}
+		d.Variables = json.RawMessage(variables)
 		d.Description = nullStringToPtr(desc)
 		d.CreatedBy = nullStringToPtr(createdBy)
 		dashboards = append(dashboards, d)
@@ -74,19 +78,21 @@ func (db *DB) GetDashboards() ([]Dashboard, error) {
 // GetDashboardByID retrieves a dashboard by ID.
 func (db *DB) GetDashboardByID(id string) (*Dashboard, error) {
 	row := db.conn.QueryRow(
-		`SELECT id, name, description, created_by, created_at, updated_at
+		`SELECT id, name, description, created_by, created_at, updated_at, variables_json
 		 FROM dashboards WHERE id = ?`, id,
 	)
 
 	var d Dashboard
 	var desc, createdBy sql.NullString
-	err := row.Scan(&d.ID, &d.Name, &desc, &createdBy, &d.CreatedAt, &d.UpdatedAt)
+	var variables string
+	err := row.Scan(&d.ID, &d.Name, &desc, &createdBy, &d.CreatedAt, &d.UpdatedAt, &variables)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("get dashboard by id: %w", err)
 	}
+	d.Variables = json.RawMessage(variables)
 	d.Description = nullStringToPtr(desc)
 	d.CreatedBy = nullStringToPtr(createdBy)
 	return &d, nil
@@ -135,6 +141,20 @@ func (db *DB) UpdateDashboard(id, name, description string) error {
 	return nil
 }
 
+// UpdateDashboardVariables replaces a dashboard's template variable
+// definitions with the given JSON list.
+func (db *DB) UpdateDashboardVariables(id, variablesJSON string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := db.conn.Exec(
+		"UPDATE dashboards SET variables_json = ?, updated_at = ? WHERE id = ?",
+		variablesJSON, now, id,
+	)
+	if err != nil {
+		return fmt.Errorf("update dashboard variables: %w", err)
+	}
+	return nil
+}
+
 // DeleteDashboard deletes a dashboard and all its panels (cascade).
 func (db *DB) DeleteDashboard(id string) error {
 	_, err := db.conn.Exec("DELETE FROM dashboards WHERE id = ?", id)
@@ -476,7 +496,9 @@ func (db *DB) ListShareInvites(shareID string) ([]DashboardShareInvite, error) {
 func (db *DB) GetFirstActiveAlertChannel() (*AlertChannel, error) {
 	row := db.conn.QueryRow(
 		`SELECT id, name, channel_type, config_encrypted, is_active, created_by, created_at, updated_at
-		 FROM alert_channels WHERE is_active = 1 ORDER BY created_at ASC LIMIT 1`,
+		 FROM alert_channels
+		 WHERE is_active = 1 AND channel_type IN ('smtp', 'resend', 'brevo')
+		 ORDER BY created_at ASC LIMIT 1`,
 	)
 	ch, err := scanAlertChannelRow(row)
 	if err == sql.ErrNoRows {
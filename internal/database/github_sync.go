@@ -27,14 +27,22 @@ type GitHubSyncLog struct {
 }
 
 // GitHubIntegration is the read-safe representation of a connection's GitHub config.
+// Despite the name it covers every model source provider: Repo is owner/repo
+// on GitHub, a project path on GitLab, a clone URL for plain git and a
+// directory for local sources.
 type GitHubIntegration struct {
 	Enabled          bool   `json:"enabled"`
+	Provider         string `json:"provider"`
+	URL              string `json:"url"`
 	Repo             string `json:"repo"`
 	Branch           string `json:"branch"`
 	Path             string `json:"path"`
 	HasPAT           bool   `json:"has_pat"`
 	HasWebhookSecret bool   `json:"has_webhook_secret"`
 	LastSyncSHA      string `json:"last_sync_sha"`
+	// Ready reports whether the source has everything needed to sync: a
+	// token for GitHub and GitLab, nothing more for plain git and local.
+	Ready bool `json:"ready"`
 }
 
 func ghKey(connectionID, key string) string {
@@ -53,6 +61,7 @@ func (db *DB) GetGitHubIntegration(connectionID string) (*GitHubIntegration, err
 	pat, _ := db.GetSetting(ghKey(connectionID, "encrypted_pat"))
 	secret, _ := db.GetSetting(ghKey(connectionID, "webhook_secret"))
 	sha, _ := db.GetSetting(ghKey(connectionID, "last_sync_sha"))
+	provider, url := db.GetGitHubSourceSettings(connectionID)
 
 	if branch == "" {
 		branch = "main"
@@ -63,12 +72,15 @@ func (db *DB) GetGitHubIntegration(connectionID string) (*GitHubIntegration, err
 
 	return &GitHubIntegration{
 		Enabled:          enabled == "true",
+		Provider:         provider,
+		URL:              url,
 		Repo:             repo,
 		Branch:           branch,
 		Path:             path,
 		HasPAT:           pat != "",
 		HasWebhookSecret: secret != "",
 		LastSyncSHA:      sha,
+		Ready:            pat != "" || provider == "git" || provider == "local",
 	}, nil
 }
 
@@ -89,6 +101,17 @@ func (db *DB) GetGitHubRawSettings(connectionID string) (repo, branch, path, enc
 	return
 }
 
+// GetGitHubSourceSettings returns the model source provider of a connection
+// (github unless set) and the GitLab instance URL.
+func (db *DB) GetGitHubSourceSettings(connectionID string) (provider, url string) {
+	provider, _ = db.GetSetting(ghKey(connectionID, "provider"))
+	url, _ = db.GetSetting(ghKey(connectionID, "url"))
+	if provider == "" {
+		provider = "github"
+	}
+	return
+}
+
 // SaveGitHubIntegration persists the GitHub integration settings for a connection.
 func (db *DB) SaveGitHubIntegration(connectionID string, fields map[string]string) error {
 	for k, v := range fields {
@@ -101,7 +124,7 @@ func (db *DB) SaveGitHubIntegration(connectionID string, fields map[string]strin
 
 // DeleteGitHubIntegration removes all github.* settings for a connection.
 func (db *DB) DeleteGitHubIntegration(connectionID string) error {
-	keys := []string{"enabled", "repo", "branch", "path", "encrypted_pat", "webhook_secret", "last_sync_sha"}
+	keys := []string{"enabled", "provider", "url", "repo", "branch", "path", "encrypted_pat", "webhook_secret", "last_sync_sha"}
 	for _, k := range keys {
 		if err := db.DeleteSetting(ghKey(connectionID, k)); err != nil && !strings.Contains(err.Error(), "no rows") {
 			return fmt.Errorf("delete github setting %s: %w", k, err)
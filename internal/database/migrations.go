@@ -762,6 +762,66 @@ func (db *DB) runMigrations() error {
 		`CREATE INDEX IF NOT EXISTS idx_alert_digest_due ON alert_route_digests(status, next_attempt_at, bucket_end)`,
 		`CREATE INDEX IF NOT EXISTS idx_alert_digest_route ON alert_route_digests(route_id, bucket_start)`,
 
+		// User-defined alerts on the value of a ClickHouse query, with the
+		// state the evaluator keeps between runs
+		`CREATE TABLE IF NOT EXISTS alert_metric_rules (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			connection_id TEXT NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+			credential_id TEXT,
+			query TEXT NOT NULL,
+			condition TEXT NOT NULL,
+			threshold REAL NOT NULL DEFAULT 0,
+			interval_seconds INTEGER NOT NULL DEFAULT 60,
+			for_seconds INTEGER NOT NULL DEFAULT 0,
+			severity TEXT NOT NULL DEFAULT 'warn',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			state TEXT NOT NULL DEFAULT 'ok',
+			pending_since TEXT,
+			last_value REAL,
+			last_error TEXT,
+			last_evaluated_at TEXT,
+			next_evaluation_at TEXT,
+			created_by TEXT,
+			created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+			updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_metric_rules_due ON alert_metric_rules(enabled, next_evaluation_at)`,
+
+		// Silences: one-off periods during which matching alert events are
+		// recorded but not dispatched
+		`CREATE TABLE IF NOT EXISTS alert_silences (
+			id TEXT PRIMARY KEY,
+			comment TEXT NOT NULL,
+			event_type TEXT NOT NULL DEFAULT '*',
+			connection_id TEXT,
+			severities_json TEXT NOT NULL DEFAULT '[]',
+			payload_matchers_json TEXT NOT NULL DEFAULT '{}',
+			starts_at TEXT NOT NULL,
+			ends_at TEXT NOT NULL,
+			created_by TEXT,
+			created_at TEXT DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_silences_ends ON alert_silences(ends_at)`,
+
+		// Maintenance windows: recurring weekly silences
+		`CREATE TABLE IF NOT EXISTS alert_maintenance_windows (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			event_type TEXT NOT NULL DEFAULT '*',
+			connection_id TEXT,
+			severities_json TEXT NOT NULL DEFAULT '[]',
+			payload_matchers_json TEXT NOT NULL DEFAULT '{}',
+			days_json TEXT NOT NULL DEFAULT '[]',
+			start_time TEXT NOT NULL,
+			end_time TEXT NOT NULL,
+			timezone TEXT NOT NULL DEFAULT 'UTC',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_by TEXT,
+			created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+			updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+		)`,
+
 		// ══════════════════════════════════════════════════════════════
 		// Pipeline tables (data ingestion pipelines)
 		// ══════════════════════════════════════════════════════════════
@@ -838,6 +898,33 @@ func (db *DB) runMigrations() error {
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_pipeline_run_log_run ON pipeline_run_logs(run_id, created_at)`,
 
+		// Pipeline source checkpoints (S3 object ETags, database watermarks).
+		// Written only after a batch has been durably delivered.
+		`CREATE TABLE IF NOT EXISTS pipeline_checkpoints (
+			pipeline_id TEXT NOT NULL REFERENCES pipelines(id) ON DELETE CASCADE,
+			checkpoint_key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			updated_at TEXT DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (pipeline_id, checkpoint_key)
+		)`,
+
+		// Per-minute pipeline activity, written by the runner while a run is
+		// active and pruned after 30 days.
+		`CREATE TABLE IF NOT EXISTS pipeline_metrics (
+			pipeline_id TEXT NOT NULL REFERENCES pipelines(id) ON DELETE CASCADE,
+			run_id TEXT NOT NULL REFERENCES pipeline_runs(id) ON DELETE CASCADE,
+			bucket TEXT NOT NULL,
+			rows_ingested INTEGER NOT NULL DEFAULT 0,
+			bytes_ingested INTEGER NOT NULL DEFAULT 0,
+			batches_sent INTEGER NOT NULL DEFAULT 0,
+			errors_count INTEGER NOT NULL DEFAULT 0,
+			rows_dead_lettered INTEGER NOT NULL DEFAULT 0,
+			lag_ms_avg INTEGER NOT NULL DEFAULT 0,
+			lag_ms_max INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (run_id, bucket)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_pipeline_metrics_pipeline ON pipeline_metrics(pipeline_id, bucket)`,
+
 		// ── Models (dbt-like SQL transformations) ─────────────────────────
 		`CREATE TABLE IF NOT EXISTS models (
 			id TEXT PRIMARY KEY,
@@ -961,6 +1048,23 @@ func (db *DB) runMigrations() error {
 			long_queries INTEGER NOT NULL DEFAULT 0
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_ch_health_samples_conn_time ON ch_health_samples(connection_id, captured_at)`,
+
+		// Service credentials: ClickHouse logins that background jobs run as,
+		// so they do not depend on someone having an active session.
+		`CREATE TABLE IF NOT EXISTS service_credentials (
+			id TEXT PRIMARY KEY,
+			connection_id TEXT NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			clickhouse_user TEXT NOT NULL,
+			encrypted_password TEXT NOT NULL,
+			is_default INTEGER NOT NULL DEFAULT 0,
+			created_by TEXT,
+			last_used_at TEXT,
+			created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+			updated_at TEXT DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(connection_id, name)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_service_credentials_conn ON service_credentials(connection_id)`,
 	}
 
 	for _, stmt := range stmts {
@@ -1011,6 +1115,10 @@ func (db *DB) runMigrations() error {
 	if err := db.ensureColumn("panels", "description", "TEXT DEFAULT ''"); err != nil {
 		return err
 	}
+	// Dashboard template variables: JSON list of variable definitions.
+	if err := db.ensureColumn("dashboards", "variables_json", "TEXT NOT NULL DEFAULT '[]'"); err != nil {
+		return err
+	}
 	if err := db.ensureColumn("models", "source", "TEXT NOT NULL DEFAULT 'manual'"); err != nil {
 		return err
 	}
@@ -1018,6 +1126,71 @@ func (db *DB) runMigrations() error {
 	if err := db.ensureColumn("saved_queries", "parameters", "TEXT"); err != nil {
 		return err
 	}
+	// Scheduled result delivery: encrypted JSON list of targets, and the
+	// outcome of each run's delivery.
+	if err := db.ensureColumn("schedules", "delivery_encrypted", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("schedule_runs", "delivery_status", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("schedule_runs", "delivery_error", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("schedule_runs", "artifact_bytes", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	// Service credential assignments; NULL means the connection's default.
+	for _, table := range []string{"schedules", "models", "pipelines", "ch_health_settings"} {
+		if err := db.ensureColumn(table, "credential_id", "TEXT"); err != nil {
+			return err
+		}
+	}
+	// Schedule orchestration: chained triggers (JSON list), retries with
+	// backoff, the overlap policy and an optional precondition query. Runs
+	// record what triggered them and which attempt they were.
+	scheduleColumns := []struct{ table, column, definition string }{
+		{"schedules", "triggers", "TEXT"},
+		{"schedules", "max_retries", "INTEGER NOT NULL DEFAULT 0"},
+		{"schedules", "retry_backoff_seconds", "INTEGER NOT NULL DEFAULT 60"},
+		{"schedules", "concurrency_policy", "TEXT NOT NULL DEFAULT 'skip'"},
+		{"schedules", "precondition_query", "TEXT"},
+		{"schedule_runs", "triggered_by", "TEXT"},
+		{"schedule_runs", "attempt", "INTEGER NOT NULL DEFAULT 1"},
+	}
+	for _, c := range scheduleColumns {
+		if err := db.ensureColumn(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	// Model materialization options for partitioned, incremental and
+	// dictionary models.
+	for _, column := range []string{"partition_by", "unique_key", "dictionary_layout", "dictionary_lifetime"} {
+		if err := db.ensureColumn("models", column, "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	// Model data tests and their outcomes per run.
+	if err := db.ensureColumn("models", "tests", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("model_run_results", "tests", "TEXT"); err != nil {
+		return err
+	}
+	// Alert events that mark a condition as cleared, so channels such as
+	// PagerDuty can resolve the incident they opened for it.
+	if err := db.ensureColumn("alert_events", "resolves", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("alert_events", "suppressed_by", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("alert_events", "acknowledged_by", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("alert_events", "acknowledged_at", "TEXT"); err != nil {
+		return err
+	}
 
 	// Drop legacy tables from the old SaaS schema
 	dropLegacy := []string{
@@ -2,7 +2,10 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -26,6 +29,54 @@ type Model struct {
 	Source          string  `json:"source"`
 	CreatedAt       string  `json:"created_at"`
 	UpdatedAt       string  `json:"updated_at"`
+	CredentialID    *string `json:"credential_id"`
+
+	ModelOptions
+	// Tests are data checks run against the model's target after each build.
+	Tests []ModelTest `json:"tests"`
+}
+
+// ModelOptions holds the materialization settings beyond engine and order.
+type ModelOptions struct {
+	// PartitionBy is the PARTITION BY expression of table-backed models.
+	// Incremental models without a unique key replace whole partitions.
+	PartitionBy string `json:"partition_by" yaml:"partition_by,omitempty"`
+	// UniqueKey is the key incremental models replace rows by, and the
+	// primary key of dictionaries.
+	UniqueKey string `json:"unique_key" yaml:"unique_key,omitempty"`
+	// Layout and Lifetime configure dictionary models.
+	Layout   string `json:"layout" yaml:"layout,omitempty"`
+	Lifetime string `json:"lifetime" yaml:"lifetime,omitempty"`
+}
+
+// ModelTest is a data check on a model's output.
+type ModelTest struct {
+	// Type is not_null, unique, accepted_values, relationships, row_count or sql.
+	Type   string `json:"type" yaml:"type"`
+	Column string `json:"column,omitempty" yaml:"column,omitempty"`
+	// Values are the accepted values of an accepted_values test.
+	Values []string `json:"values,omitempty" yaml:"values,omitempty"`
+	// To and Field name the model and column a relationships test checks
+	// Column against.
+	To    string `json:"to,omitempty" yaml:"to,omitempty"`
+	Field string `json:"field,omitempty" yaml:"field,omitempty"`
+	// MinRows and MaxRows bound a row_count test.
+	MinRows *int64 `json:"min_rows,omitempty" yaml:"min_rows,omitempty"`
+	MaxRows *int64 `json:"max_rows,omitempty" yaml:"max_rows,omitempty"`
+	// SQL is a query that must return no rows.
+	SQL string `json:"sql,omitempty" yaml:"sql,omitempty"`
+	// Severity is "error" (a failure blocks downstream models) or "warn".
+	Severity string `json:"severity" yaml:"severity"`
+}
+
+// ModelTestResult is the outcome of one test in a run.
+type ModelTestResult struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Status   string `json:"status"` // pass, fail or error
+	Failures int64  `json:"failures"`
+	Message  string `json:"message,omitempty"`
 }
 
 // ModelRun represents a batch execution of models.
@@ -56,6 +107,8 @@ type ModelRunResult struct {
 	StartedAt   *string `json:"started_at"`
 	FinishedAt  *string `json:"finished_at"`
 	CreatedAt   string  `json:"created_at"`
+
+	Tests []ModelTestResult `json:"tests"`
 }
 
 // ── Model CRUD ──────────────────────────────────────────────────────
@@ -65,7 +118,8 @@ func (db *DB) GetModelsByConnection(connectionID string) ([]Model, error) {
 	rows, err := db.conn.Query(
 		`SELECT id, name, description, connection_id, target_database, materialization,
 		        sql_body, table_engine, order_by, status, last_error, last_run_at,
-		        created_by, source, created_at, updated_at
+		        created_by, source, created_at, updated_at, credential_id,
+		        partition_by, unique_key, dictionary_layout, dictionary_lifetime, tests
 		 FROM models WHERE connection_id = ? ORDER BY name ASC`, connectionID,
 	)
 	if err != nil {
@@ -92,7 +146,8 @@ func (db *DB) GetModelByID(id string) (*Model, error) {
 	row := db.conn.QueryRow(
 		`SELECT id, name, description, connection_id, target_database, materialization,
 		        sql_body, table_engine, order_by, status, last_error, last_run_at,
-		        created_by, source, created_at, updated_at
+		        created_by, source, created_at, updated_at, credential_id,
+		        partition_by, unique_key, dictionary_layout, dictionary_lifetime, tests
 		 FROM models WHERE id = ?`, id,
 	)
 	m, err := scanModelRow(row)
@@ -110,7 +165,8 @@ func (db *DB) GetModelByName(connectionID, name string) (*Model, error) {
 	row := db.conn.QueryRow(
 		`SELECT id, name, description, connection_id, target_database, materialization,
 		        sql_body, table_engine, order_by, status, last_error, last_run_at,
-		        created_by, source, created_at, updated_at
+		        created_by, source, created_at, updated_at, credential_id,
+		        partition_by, unique_key, dictionary_layout, dictionary_lifetime, tests
 		 FROM models WHERE connection_id = ? AND name = ?`, connectionID, name,
 	)
 	m, err := scanModelRow(row)
@@ -162,6 +218,84 @@ func (db *DB) UpdateModel(id, name, description, targetDB, materialization, sqlB
 	return nil
 }
 
+// UpdateModelCredential assigns the service credential a model is built
+// with; an empty ID builds it with the run's credentials.
+func (db *DB) UpdateModelCredential(id, credentialID string) error {
+	var val interface{}
+	if credentialID != "" {
+		val = credentialID
+	}
+	_, err := db.conn.Exec(`UPDATE models SET credential_id = ?, updated_at = ? WHERE id = ?`,
+		val, time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return fmt.Errorf("update model credential: %w", err)
+	}
+	return nil
+}
+
+// UpdateModelOptions replaces a model's materialization options.
+func (db *DB) UpdateModelOptions(id string, opts ModelOptions) error {
+	_, err := db.conn.Exec(
+		`UPDATE models SET partition_by = ?, unique_key = ?, dictionary_layout = ?, dictionary_lifetime = ?, updated_at = ?
+		 WHERE id = ?`,
+		opts.PartitionBy, opts.UniqueKey, opts.Layout, opts.Lifetime, time.Now().UTC().Format(time.RFC3339), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update model options: %w", err)
+	}
+	return nil
+}
+
+// UpdateModelTests replaces a model's data tests.
+func (db *DB) UpdateModelTests(id string, tests []ModelTest) error {
+	var raw interface{}
+	if len(tests) > 0 {
+		b, err := json.Marshal(tests)
+		if err != nil {
+			return fmt.Errorf("encode model tests: %w", err)
+		}
+		raw = string(b)
+	}
+	_, err := db.conn.Exec(`UPDATE models SET tests = ?, updated_at = ? WHERE id = ?`,
+		raw, time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return fmt.Errorf("update model tests: %w", err)
+	}
+	return nil
+}
+
+// Bounds on how many models of a connection build at once.
+const (
+	DefaultModelParallelism = 4
+	MaxModelParallelism     = 16
+)
+
+func modelSettingKey(connectionID, key string) string {
+	return fmt.Sprintf("models.%s.%s", connectionID, key)
+}
+
+// GetModelParallelism returns how many independent models of a connection
+// may build concurrently.
+func (db *DB) GetModelParallelism(connectionID string) int {
+	v, _ := db.GetSetting(modelSettingKey(connectionID, "parallelism"))
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 1 {
+		return DefaultModelParallelism
+	}
+	if n > MaxModelParallelism {
+		return MaxModelParallelism
+	}
+	return n
+}
+
+// SetModelParallelism stores a connection's model parallelism.
+func (db *DB) SetModelParallelism(connectionID string, n int) error {
+	if n < 1 || n > MaxModelParallelism {
+		return fmt.Errorf("parallelism must be between 1 and %d", MaxModelParallelism)
+	}
+	return db.SetSetting(modelSettingKey(connectionID, "parallelism"), strconv.Itoa(n))
+}
+
 // DeleteModel removes a model by ID.
 func (db *DB) DeleteModel(id string) error {
 	_, err := db.conn.Exec("DELETE FROM models WHERE id = ?", id)
@@ -320,11 +454,27 @@ func (db *DB) UpdateModelRunResult(runID, modelID, status, resolvedSQL string, e
 	return nil
 }
 
+// SetModelRunResultTests records the test outcomes of a model in a run.
+func (db *DB) SetModelRunResultTests(runID, modelID string, results []ModelTestResult) error {
+	raw, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("encode model test results: %w", err)
+	}
+	_, err = db.conn.Exec(
+		`UPDATE model_run_results SET tests = ? WHERE run_id = ? AND model_id = ?`,
+		string(raw), runID, modelID,
+	)
+	if err != nil {
+		return fmt.Errorf("set model test results: %w", err)
+	}
+	return nil
+}
+
 // GetModelRunResults returns all results for a run.
 func (db *DB) GetModelRunResults(runID string) ([]ModelRunResult, error) {
 	rows, err := db.conn.Query(
 		`SELECT id, run_id, model_id, model_name, status, resolved_sql, elapsed_ms,
-		        error, started_at, finished_at, created_at
+		        error, started_at, finished_at, created_at, tests
 		 FROM model_run_results WHERE run_id = ? ORDER BY created_at ASC`, runID,
 	)
 	if err != nil {
@@ -335,11 +485,17 @@ func (db *DB) GetModelRunResults(runID string) ([]ModelRunResult, error) {
 	var results []ModelRunResult
 	for rows.Next() {
 		var r ModelRunResult
-		var resolvedSQL, errStr, started, finished sql.NullString
+		var resolvedSQL, errStr, started, finished, tests sql.NullString
 		if err := rows.Scan(&r.ID, &r.RunID, &r.ModelID, &r.ModelName, &r.Status,
-			&resolvedSQL, &r.ElapsedMs, &errStr, &started, &finished, &r.CreatedAt); err != nil {
+			&resolvedSQL, &r.ElapsedMs, &errStr, &started, &finished, &r.CreatedAt, &tests); err != nil {
 			return nil, fmt.Errorf("scan model run result: %w", err)
 		}
+		r.Tests = []ModelTestResult{}
+		if tests.String != "" {
+			if err := json.Unmarshal([]byte(tests.String), &r.Tests); err != nil {
+				return nil, fmt.Errorf("decode model test results: %w", err)
+			}
+		}
 		r.ResolvedSQL = nullStringToPtr(resolvedSQL)
 		r.Error = nullStringToPtr(errStr)
 		r.StartedAt = nullStringToPtr(started)
@@ -366,35 +522,56 @@ func (db *DB) HasRunningModelRun(connectionID string) (bool, error) {
 
 func scanModel(rows *sql.Rows) (Model, error) {
 	var m Model
-	var lastErr, lastRun, createdBy sql.NullString
+	var lastErr, lastRun, createdBy, credentialID, tests sql.NullString
 	if err := rows.Scan(&m.ID, &m.Name, &m.Description, &m.ConnectionID,
 		&m.TargetDatabase, &m.Materialization, &m.SQLBody, &m.TableEngine,
 		&m.OrderBy, &m.Status, &lastErr, &lastRun, &createdBy,
-		&m.Source, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		&m.Source, &m.CreatedAt, &m.UpdatedAt, &credentialID,
+		&m.PartitionBy, &m.UniqueKey, &m.Layout, &m.Lifetime, &tests); err != nil {
 		return m, fmt.Errorf("scan model: %w", err)
 	}
+	if err := decodeModelTests(&m, tests); err != nil {
+		return m, err
+	}
 	m.LastError = nullStringToPtr(lastErr)
 	m.LastRunAt = nullStringToPtr(lastRun)
 	m.CreatedBy = nullStringToPtr(createdBy)
+	m.CredentialID = nullStringToPtr(credentialID)
 	return m, nil
 }
 
 func scanModelRow(row *sql.Row) (*Model, error) {
 	var m Model
-	var lastErr, lastRun, createdBy sql.NullString
+	var lastErr, lastRun, createdBy, credentialID, tests sql.NullString
 	err := row.Scan(&m.ID, &m.Name, &m.Description, &m.ConnectionID,
 		&m.TargetDatabase, &m.Materialization, &m.SQLBody, &m.TableEngine,
 		&m.OrderBy, &m.Status, &lastErr, &lastRun, &createdBy,
-		&m.Source, &m.CreatedAt, &m.UpdatedAt)
+		&m.Source, &m.CreatedAt, &m.UpdatedAt, &credentialID,
+		&m.PartitionBy, &m.UniqueKey, &m.Layout, &m.Lifetime, &tests)
 	if err != nil {
 		return nil, err
 	}
+	if err := decodeModelTests(&m, tests); err != nil {
+		return nil, err
+	}
 	m.LastError = nullStringToPtr(lastErr)
 	m.LastRunAt = nullStringToPtr(lastRun)
 	m.CreatedBy = nullStringToPtr(createdBy)
+	m.CredentialID = nullStringToPtr(credentialID)
 	return &m, nil
 }
 
+func decodeModelTests(m *Model, raw sql.NullString) error {
+	m.Tests = []ModelTest{}
+	if raw.String == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(raw.String), &m.Tests); err != nil {
+		return fmt.Errorf("decode model tests: %w", err)
+	}
+	return nil
+}
+
 // SetModelSource updates the source field of a model.
 func (db *DB) SetModelSource(id, source string) error {
 	_, err := db.conn.Exec(`UPDATE models SET source = ?, updated_at = ? WHERE id = ?`,
@@ -410,7 +587,8 @@ func (db *DB) GetModelsByConnectionAndSource(connectionID, source string) ([]Mod
 	rows, err := db.conn.Query(
 		`SELECT id, name, description, connection_id, target_database, materialization,
 		        sql_body, table_engine, order_by, status, last_error, last_run_at,
-		        created_by, source, created_at, updated_at
+		        created_by, source, created_at, updated_at, credential_id,
+		        partition_by, unique_key, dictionary_layout, dictionary_lifetime, tests
 		 FROM models WHERE connection_id = ? AND source = ? ORDER BY name ASC`, connectionID, source,
 	)
 	if err != nil {
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPipelineMetrics_SnapshotsAccumulatePerMinute(t *testing.T) {
+	db := openTestDB(t)
+
+	conn, err := db.CreateConnection("local", "tok", true)
+	if err != nil {
+		t.Fatalf("CreateConnection: %v", err)
+	}
+	pipelineID, err := db.CreatePipeline("events", "", conn, "alice")
+	if err != nil {
+		t.Fatalf("CreatePipeline: %v", err)
+	}
+	runID, err := db.CreatePipelineRun(pipelineID, "running")
+	if err != nil {
+		t.Fatalf("CreatePipelineRun: %v", err)
+	}
+
+	bucket := time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)
+	for _, s := range []PipelineMetricSnapshot{
+		{RowsIngested: 10, BatchesSent: 1, LagMsAvg: 100, LagMsMax: 150},
+		{RowsIngested: 5, BatchesSent: 1, LagMsAvg: 80, LagMsMax: 300},
+	} {
+		s.PipelineID, s.RunID, s.Bucket = pipelineID, runID, bucket.Format(time.RFC3339)
+		if err := db.SavePipelineMetricSnapshot(s); err != nil {
+			t.Fatalf("SavePipelineMetricSnapshot: %v", err)
+		}
+	}
+	next := PipelineMetricSnapshot{PipelineID: pipelineID, RunID: runID, Bucket: bucket.Add(time.Minute).Format(time.RFC3339)}
+	if err := db.SavePipelineMetricSnapshot(next); err != nil {
+		t.Fatalf("SavePipelineMetricSnapshot: %v", err)
+	}
+
+	points, err := db.GetPipelineMetrics(pipelineID, "", bucket, bucket.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetPipelineMetrics: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("expected 2 points, got %d", len(points))
+	}
+	if p := points[0]; p.RowsIngested != 15 || p.BatchesSent != 2 || p.LagMsMax != 300 {
+		t.Fatalf("snapshots not merged: %+v", p)
+	}
+
+	removed, err := db.DeletePipelineMetricsBefore(bucket.Add(time.Minute))
+	if err != nil || removed != 1 {
+		t.Fatalf("DeletePipelineMetricsBefore: removed %d, %v", removed, err)
+	}
+}
@@ -22,6 +22,7 @@ type Pipeline struct {
 	LastError     *string `json:"last_error"`
 	CreatedAt     string  `json:"created_at"`
 	UpdatedAt     string  `json:"updated_at"`
+	CredentialID  *string `json:"credential_id"`
 }
 
 // PipelineNode represents a node in a pipeline graph.
@@ -79,7 +80,7 @@ func (db *DB) GetPipelines() ([]Pipeline, error) {
 	rows, err := db.conn.Query(
 		`SELECT id, name, description, connection_id, status, config,
 		        created_by, last_started_at, last_stopped_at, last_error,
-		        created_at, updated_at
+		        created_at, updated_at, credential_id
 		 FROM pipelines ORDER BY updated_at DESC`,
 	)
 	if err != nil {
@@ -106,15 +107,15 @@ func (db *DB) GetPipelineByID(id string) (*Pipeline, error) {
 	row := db.conn.QueryRow(
 		`SELECT id, name, description, connection_id, status, config,
 		        created_by, last_started_at, last_stopped_at, last_error,
-		        created_at, updated_at
+		        created_at, updated_at, credential_id
 		 FROM pipelines WHERE id = ?`, id,
 	)
 
 	var p Pipeline
-	var desc, createdBy, lastStarted, lastStopped, lastErr sql.NullString
+	var desc, createdBy, lastStarted, lastStopped, lastErr, credentialID sql.NullString
 	err := row.Scan(&p.ID, &p.Name, &desc, &p.ConnectionID, &p.Status, &p.Config,
 		&createdBy, &lastStarted, &lastStopped, &lastErr,
-		&p.CreatedAt, &p.UpdatedAt)
+		&p.CreatedAt, &p.UpdatedAt, &credentialID)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -126,6 +127,7 @@ func (db *DB) GetPipelineByID(id string) (*Pipeline, error) {
 	p.LastStartedAt = nullStringToPtr(lastStarted)
 	p.LastStoppedAt = nullStringToPtr(lastStopped)
 	p.LastError = nullStringToPtr(lastErr)
+	p.CredentialID = nullStringToPtr(credentialID)
 	return &p, nil
 }
 
@@ -134,7 +136,7 @@ func (db *DB) GetPipelinesByStatus(status string) ([]Pipeline, error) {
 	rows, err := db.conn.Query(
 		`SELECT id, name, description, connection_id, status, config,
 		        created_by, last_started_at, last_stopped_at, last_error,
-		        created_at, updated_at
+		        created_at, updated_at, credential_id
 		 FROM pipelines WHERE status = ? ORDER BY updated_at DESC`, status,
 	)
 	if err != nil {
@@ -199,6 +201,23 @@ func (db *DB) UpdatePipeline(id, name, description string) error {
 	return nil
 }
 
+// UpdatePipelineCredential assigns the service credential a pipeline's sinks
+// write with; an empty ID clears the assignment.
+func (db *DB) UpdatePipelineCredential(id, credentialID string) error {
+	var val interface{}
+	if credentialID != "" {
+		val = credentialID
+	}
+	_, err := db.conn.Exec(
+		"UPDATE pipelines SET credential_id = ?, updated_at = ? WHERE id = ?",
+		val, time.Now().UTC().Format(time.RFC3339), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update pipeline credential: %w", err)
+	}
+	return nil
+}
+
 // UpdatePipelineStatus updates a pipeline's status and optional error/timestamp fields.
 func (db *DB) UpdatePipelineStatus(id, status, lastError string) error {
 	now := time.Now().UTC().Format(time.RFC3339)
@@ -493,15 +512,177 @@ func (db *DB) GetPipelineRunLogs(runID string, limit int) ([]PipelineRunLog, err
 	return logs, nil
 }
 
+// ── Pipeline Checkpoints ───────────────────────────────────────────
+
+// PipelineCheckpoint is a persisted source position for a pipeline.
+type PipelineCheckpoint struct {
+	PipelineID string `json:"pipeline_id"`
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+// GetPipelineCheckpoints retrieves all checkpoint entries for a pipeline.
+func (db *DB) GetPipelineCheckpoints(pipelineID string) ([]PipelineCheckpoint, error) {
+	rows, err := db.conn.Query(
+		`SELECT pipeline_id, checkpoint_key, value, updated_at
+		 FROM pipeline_checkpoints WHERE pipeline_id = ? ORDER BY checkpoint_key ASC`, pipelineID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get pipeline checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []PipelineCheckpoint
+	for rows.Next() {
+		var c PipelineCheckpoint
+		if err := rows.Scan(&c.PipelineID, &c.Key, &c.Value, &c.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan pipeline checkpoint: %w", err)
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate checkpoint rows: %w", err)
+	}
+	return checkpoints, nil
+}
+
+// SavePipelineCheckpoints upserts checkpoint entries for a pipeline atomically.
+func (db *DB) SavePipelineCheckpoints(pipelineID string, entries map[string]string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("begin checkpoint transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for key, value := range entries {
+		if _, err := tx.Exec(
+			`INSERT INTO pipeline_checkpoints (pipeline_id, checkpoint_key, value, updated_at)
+			 VALUES (?, ?, ?, ?)
+			 ON CONFLICT(pipeline_id, checkpoint_key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+			pipelineID, key, value, now,
+		); err != nil {
+			return fmt.Errorf("save pipeline checkpoint %s: %w", key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit checkpoint transaction: %w", err)
+	}
+	return nil
+}
+
+// DeletePipelineCheckpoints removes all checkpoint entries for a pipeline so
+// its source starts over from the beginning.
+func (db *DB) DeletePipelineCheckpoints(pipelineID string) (int64, error) {
+	res, err := db.conn.Exec("DELETE FROM pipeline_checkpoints WHERE pipeline_id = ?", pipelineID)
+	if err != nil {
+		return 0, fmt.Errorf("delete pipeline checkpoints: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// ── Pipeline Metrics History ───────────────────────────────────────
+
+// PipelineMetricSnapshot is one minute of activity of a pipeline run. Counts
+// are for that minute only; lag is the delay from a batch being read at the
+// source to its records being written.
+type PipelineMetricSnapshot struct {
+	PipelineID       string `json:"pipeline_id"`
+	RunID            string `json:"run_id"`
+	Bucket           string `json:"bucket"`
+	RowsIngested     int64  `json:"rows_ingested"`
+	BytesIngested    int64  `json:"bytes_ingested"`
+	BatchesSent      int64  `json:"batches_sent"`
+	ErrorsCount      int64  `json:"errors_count"`
+	RowsDeadLettered int64  `json:"rows_dead_lettered"`
+	LagMsAvg         int64  `json:"lag_ms_avg"`
+	LagMsMax         int64  `json:"lag_ms_max"`
+}
+
+// SavePipelineMetricSnapshot stores a snapshot, adding to an existing one for
+// the same run and minute.
+func (db *DB) SavePipelineMetricSnapshot(s PipelineMetricSnapshot) error {
+	_, err := db.conn.Exec(
+		`INSERT INTO pipeline_metrics (pipeline_id, run_id, bucket, rows_ingested, bytes_ingested,
+			batches_sent, errors_count, rows_dead_lettered, lag_ms_avg, lag_ms_max)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(run_id, bucket) DO UPDATE SET
+			rows_ingested = rows_ingested + excluded.rows_ingested,
+			bytes_ingested = bytes_ingested + excluded.bytes_ingested,
+			batches_sent = batches_sent + excluded.batches_sent,
+			errors_count = errors_count + excluded.errors_count,
+			rows_dead_lettered = rows_dead_lettered + excluded.rows_dead_lettered,
+			lag_ms_avg = MAX(lag_ms_avg, excluded.lag_ms_avg),
+			lag_ms_max = MAX(lag_ms_max, excluded.lag_ms_max)`,
+		s.PipelineID, s.RunID, s.Bucket, s.RowsIngested, s.BytesIngested,
+		s.BatchesSent, s.ErrorsCount, s.RowsDeadLettered, s.LagMsAvg, s.LagMsMax,
+	)
+	if err != nil {
+		return fmt.Errorf("save pipeline metric snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetPipelineMetrics returns a pipeline's snapshots with from <= bucket < to
+// in time order, optionally limited to one run.
+func (db *DB) GetPipelineMetrics(pipelineID, runID string, from, to time.Time) ([]PipelineMetricSnapshot, error) {
+	query := `SELECT pipeline_id, run_id, bucket, rows_ingested, bytes_ingested, batches_sent,
+			errors_count, rows_dead_lettered, lag_ms_avg, lag_ms_max
+		 FROM pipeline_metrics WHERE pipeline_id = ? AND bucket >= ? AND bucket < ?`
+	args := []interface{}{pipelineID, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)}
+	if runID != "" {
+		query += " AND run_id = ?"
+		args = append(args, runID)
+	}
+	query += " ORDER BY bucket ASC"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get pipeline metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []PipelineMetricSnapshot
+	for rows.Next() {
+		var s PipelineMetricSnapshot
+		if err := rows.Scan(&s.PipelineID, &s.RunID, &s.Bucket, &s.RowsIngested, &s.BytesIngested,
+			&s.BatchesSent, &s.ErrorsCount, &s.RowsDeadLettered, &s.LagMsAvg, &s.LagMsMax); err != nil {
+			return nil, fmt.Errorf("scan pipeline metric snapshot: %w", err)
+		}
+		snapshots = append(snapshots, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate metric rows: %w", err)
+	}
+	return snapshots, nil
+}
+
+// DeletePipelineMetricsBefore removes snapshots older than cutoff.
+func (db *DB) DeletePipelineMetricsBefore(cutoff time.Time) (int64, error) {
+	res, err := db.conn.Exec("DELETE FROM pipeline_metrics WHERE bucket < ?", cutoff.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("delete pipeline metrics: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
 // ── Helpers ────────────────────────────────────────────────────────
 
 // scanPipeline scans a pipeline row from a *sql.Rows.
 func scanPipeline(rows *sql.Rows) (Pipeline, error) {
 	var p Pipeline
-	var desc, createdBy, lastStarted, lastStopped, lastErr sql.NullString
+	var desc, createdBy, lastStarted, lastStopped, lastErr, credentialID sql.NullString
 	if err := rows.Scan(&p.ID, &p.Name, &desc, &p.ConnectionID, &p.Status, &p.Config,
 		&createdBy, &lastStarted, &lastStopped, &lastErr,
-		&p.CreatedAt, &p.UpdatedAt); err != nil {
+		&p.CreatedAt, &p.UpdatedAt, &credentialID); err != nil {
 		return p, fmt.Errorf("scan pipeline: %w", err)
 	}
 	p.Description = nullStringToPtr(desc)
@@ -509,5 +690,6 @@ func scanPipeline(rows *sql.Rows) (Pipeline, error) {
 	p.LastStartedAt = nullStringToPtr(lastStarted)
 	p.LastStoppedAt = nullStringToPtr(lastStopped)
 	p.LastError = nullStringToPtr(lastErr)
+	p.CredentialID = nullStringToPtr(credentialID)
 	return p, nil
 }
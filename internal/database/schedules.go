@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -25,6 +26,43 @@ type Schedule struct {
 	CreatedBy    *string `json:"created_by"`
 	CreatedAt    string  `json:"created_at"`
 	UpdatedAt    string  `json:"updated_at"`
+
+	// CredentialID is the service credential the schedule runs as; nil uses
+	// the connection's default.
+	CredentialID *string `json:"credential_id"`
+
+	// DeliveryEncrypted holds the encrypted JSON list of result delivery
+	// targets, empty when results are not delivered.
+	DeliveryEncrypted string `json:"-"`
+
+	ScheduleExecution
+}
+
+// ScheduleExecution holds how a schedule is triggered and run beyond its cron
+// expression.
+type ScheduleExecution struct {
+	// Triggers start the schedule when another schedule, model or pipeline
+	// finishes.
+	Triggers []ScheduleTrigger `json:"triggers"`
+	// MaxRetries is how many times a failed run is retried.
+	MaxRetries int `json:"max_retries"`
+	// RetryBackoffSeconds is the delay before the first retry; it doubles
+	// with every further attempt.
+	RetryBackoffSeconds int `json:"retry_backoff_seconds"`
+	// ConcurrencyPolicy decides what happens when the schedule is due while
+	// a run is still in progress: "skip", "queue" or "allow".
+	ConcurrencyPolicy string `json:"concurrency_policy"`
+	// PreconditionQuery, when set, must return at least one row for the
+	// schedule to run.
+	PreconditionQuery string `json:"precondition_query"`
+}
+
+// ScheduleTrigger starts a schedule when a source finishes with a matching
+// outcome.
+type ScheduleTrigger struct {
+	SourceType string `json:"source_type"` // schedule, model or pipeline
+	SourceID   string `json:"source_id"`
+	On         string `json:"on"` // success, failure or any
 }
 
 // ScheduleRun represents a single execution of a scheduled query.
@@ -38,13 +76,24 @@ type ScheduleRun struct {
 	ElapsedMs    int     `json:"elapsed_ms"`
 	Error        *string `json:"error"`
 	CreatedAt    string  `json:"created_at"`
+
+	DeliveryStatus *string `json:"delivery_status"`
+	DeliveryError  *string `json:"delivery_error"`
+	ArtifactBytes  int64   `json:"artifact_bytes"`
+
+	// TriggeredBy is "cron", "manual" or "<source_type>:<source_id>" for
+	// chained runs.
+	TriggeredBy *string `json:"triggered_by"`
+	Attempt     int     `json:"attempt"`
 }
 
 // GetSchedules retrieves all schedules.
 func (db *DB) GetSchedules() ([]Schedule, error) {
 	rows, err := db.conn.Query(
 		`SELECT id, name, saved_query_id, connection_id, cron, timezone, enabled, timeout_ms,
-		        last_run_at, next_run_at, last_status, last_error, created_by, created_at, updated_at
+		        last_run_at, next_run_at, last_status, last_error, created_by, created_at, updated_at,
+		        COALESCE(delivery_encrypted, ''), credential_id, COALESCE(triggers, ''), max_retries,
+		        retry_backoff_seconds, concurrency_policy, COALESCE(precondition_query, '')
 		 FROM schedules ORDER BY created_at DESC`,
 	)
 	if err != nil {
@@ -70,7 +119,9 @@ func (db *DB) GetSchedules() ([]Schedule, error) {
 func (db *DB) GetEnabledSchedules() ([]Schedule, error) {
 	rows, err := db.conn.Query(
 		`SELECT id, name, saved_query_id, connection_id, cron, timezone, enabled, timeout_ms,
-		        last_run_at, next_run_at, last_status, last_error, created_by, created_at, updated_at
+		        last_run_at, next_run_at, last_status, last_error, created_by, created_at, updated_at,
+		        COALESCE(delivery_encrypted, ''), credential_id, COALESCE(triggers, ''), max_retries,
+		        retry_backoff_seconds, concurrency_policy, COALESCE(precondition_query, '')
 		 FROM schedules WHERE enabled = 1 ORDER BY created_at DESC`,
 	)
 	if err != nil {
@@ -96,30 +147,19 @@ func (db *DB) GetEnabledSchedules() ([]Schedule, error) {
 func (db *DB) GetScheduleByID(id string) (*Schedule, error) {
 	row := db.conn.QueryRow(
 		`SELECT id, name, saved_query_id, connection_id, cron, timezone, enabled, timeout_ms,
-		        last_run_at, next_run_at, last_status, last_error, created_by, created_at, updated_at
+		        last_run_at, next_run_at, last_status, last_error, created_by, created_at, updated_at,
+		        COALESCE(delivery_encrypted, ''), credential_id, COALESCE(triggers, ''), max_retries,
+		        retry_backoff_seconds, concurrency_policy, COALESCE(precondition_query, '')
 		 FROM schedules WHERE id = ?`, id,
 	)
 
-	var s Schedule
-	var connID, lastRun, nextRun, lastStatus, lastError, createdBy sql.NullString
-	var enabled int
-
-	err := row.Scan(&s.ID, &s.Name, &s.SavedQueryID, &connID, &s.Cron, &s.Timezone, &enabled, &s.TimeoutMs,
-		&lastRun, &nextRun, &lastStatus, &lastError, &createdBy, &s.CreatedAt, &s.UpdatedAt)
+	s, err := scanSchedule(row)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("get schedule by id: %w", err)
+		return nil, err
 	}
-
-	s.Enabled = enabled == 1
-	s.ConnectionID = nullStringToPtr(connID)
-	s.LastRunAt = nullStringToPtr(lastRun)
-	s.NextRunAt = nullStringToPtr(nextRun)
-	s.LastStatus = nullStringToPtr(lastStatus)
-	s.LastError = nullStringToPtr(lastError)
-	s.CreatedBy = nullStringToPtr(createdBy)
 	return &s, nil
 }
 
@@ -171,6 +211,78 @@ func (db *DB) UpdateSchedule(id, name, cron, timezone string, enabled bool, time
 	return nil
 }
 
+// UpdateScheduleDelivery replaces a schedule's encrypted delivery targets.
+func (db *DB) UpdateScheduleDelivery(id, deliveryEncrypted string) error {
+	var val interface{}
+	if deliveryEncrypted != "" {
+		val = deliveryEncrypted
+	}
+	_, err := db.conn.Exec(
+		`UPDATE schedules SET delivery_encrypted = ?, updated_at = ? WHERE id = ?`,
+		val, time.Now().UTC().Format(time.RFC3339), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update schedule delivery: %w", err)
+	}
+	return nil
+}
+
+// UpdateScheduleCredential assigns a service credential to a schedule; an
+// empty ID clears the assignment.
+func (db *DB) UpdateScheduleCredential(id, credentialID string) error {
+	var val interface{}
+	if credentialID != "" {
+		val = credentialID
+	}
+	_, err := db.conn.Exec(
+		`UPDATE schedules SET credential_id = ?, updated_at = ? WHERE id = ?`,
+		val, time.Now().UTC().Format(time.RFC3339), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update schedule credential: %w", err)
+	}
+	return nil
+}
+
+// UpdateScheduleExecution replaces a schedule's triggers, retry, concurrency
+// and precondition settings.
+func (db *DB) UpdateScheduleExecution(id string, e ScheduleExecution) error {
+	var triggers, precondition interface{}
+	if len(e.Triggers) > 0 {
+		raw, err := json.Marshal(e.Triggers)
+		if err != nil {
+			return fmt.Errorf("encode schedule triggers: %w", err)
+		}
+		triggers = string(raw)
+	}
+	if e.PreconditionQuery != "" {
+		precondition = e.PreconditionQuery
+	}
+	_, err := db.conn.Exec(
+		`UPDATE schedules SET triggers = ?, max_retries = ?, retry_backoff_seconds = ?, concurrency_policy = ?,
+		        precondition_query = ?, updated_at = ? WHERE id = ?`,
+		triggers, e.MaxRetries, e.RetryBackoffSeconds, e.ConcurrencyPolicy, precondition,
+		time.Now().UTC().Format(time.RFC3339), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update schedule execution: %w", err)
+	}
+	return nil
+}
+
+// SetScheduleNextRun moves a schedule's next run time without touching its
+// last run info.
+func (db *DB) SetScheduleNextRun(id string, nextRunAt *time.Time) error {
+	var nextVal interface{}
+	if nextRunAt != nil {
+		nextVal = nextRunAt.UTC().Format(time.RFC3339)
+	}
+	if _, err := db.conn.Exec(`UPDATE schedules SET next_run_at = ? WHERE id = ?`, nextVal, id); err != nil {
+		return fmt.Errorf("set schedule next run: %w", err)
+	}
+	return nil
+}
+
 // UpdateScheduleStatus updates the last run info for a schedule.
 func (db *DB) UpdateScheduleStatus(id, status, lastError string, nextRunAt *time.Time) error {
 	now := time.Now().UTC().Format(time.RFC3339)
@@ -203,14 +315,23 @@ func (db *DB) DeleteSchedule(id string) error {
 }
 
 // CreateScheduleRun creates a new schedule run record and returns its ID.
-func (db *DB) CreateScheduleRun(scheduleID, status string) (string, error) {
+// triggeredBy describes what started the run and attempt counts from 1.
+func (db *DB) CreateScheduleRun(scheduleID, status, triggeredBy string, attempt int) (string, error) {
 	id := uuid.NewString()
 	now := time.Now().UTC().Format(time.RFC3339)
 
+	var trigger interface{}
+	if triggeredBy != "" {
+		trigger = triggeredBy
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+
 	_, err := db.conn.Exec(
-		`INSERT INTO schedule_runs (id, schedule_id, started_at, status, created_at)
-		 VALUES (?, ?, ?, ?, ?)`,
-		id, scheduleID, now, status, now,
+		`INSERT INTO schedule_runs (id, schedule_id, started_at, status, created_at, triggered_by, attempt)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, scheduleID, now, status, now, trigger, attempt,
 	)
 	if err != nil {
 		return "", fmt.Errorf("create schedule run: %w", err)
@@ -237,6 +358,23 @@ func (db *DB) UpdateScheduleRun(id, status string, rowsAffected, elapsedMs int,
 	return nil
 }
 
+// UpdateScheduleRunDelivery records the outcome of delivering a run's result.
+func (db *DB) UpdateScheduleRunDelivery(id, status, deliveryError string, artifactBytes int64) error {
+	var errVal interface{}
+	if deliveryError != "" {
+		errVal = deliveryError
+	}
+
+	_, err := db.conn.Exec(
+		`UPDATE schedule_runs SET delivery_status = ?, delivery_error = ?, artifact_bytes = ? WHERE id = ?`,
+		status, errVal, artifactBytes, id,
+	)
+	if err != nil {
+		return fmt.Errorf("update schedule run delivery: %w", err)
+	}
+	return nil
+}
+
 // GetScheduleRuns retrieves runs for a schedule, most recent first.
 func (db *DB) GetScheduleRuns(scheduleID string, limit, offset int) ([]ScheduleRun, error) {
 	if limit <= 0 {
@@ -246,7 +384,8 @@ func (db *DB) GetScheduleRuns(scheduleID string, limit, offset int) ([]ScheduleR
 		offset = 0
 	}
 	rows, err := db.conn.Query(
-		`SELECT id, schedule_id, started_at, finished_at, status, rows_affected, elapsed_ms, error, created_at
+		`SELECT id, schedule_id, started_at, finished_at, status, rows_affected, elapsed_ms, error, created_at,
+		        delivery_status, delivery_error, artifact_bytes, triggered_by, attempt
 		 FROM schedule_runs WHERE schedule_id = ? ORDER BY started_at DESC LIMIT ? OFFSET ?`,
 		scheduleID, limit, offset,
 	)
@@ -258,12 +397,16 @@ func (db *DB) GetScheduleRuns(scheduleID string, limit, offset int) ([]ScheduleR
 	var runs []ScheduleRun
 	for rows.Next() {
 		var r ScheduleRun
-		var finishedAt, runError sql.NullString
-		if err := rows.Scan(&r.ID, &r.ScheduleID, &r.StartedAt, &finishedAt, &r.Status, &r.RowsAffected, &r.ElapsedMs, &runError, &r.CreatedAt); err != nil {
+		var finishedAt, runError, deliveryStatus, deliveryError, triggeredBy sql.NullString
+		if err := rows.Scan(&r.ID, &r.ScheduleID, &r.StartedAt, &finishedAt, &r.Status, &r.RowsAffected, &r.ElapsedMs, &runError, &r.CreatedAt,
+			&deliveryStatus, &deliveryError, &r.ArtifactBytes, &triggeredBy, &r.Attempt); err != nil {
 			return nil, fmt.Errorf("scan schedule run: %w", err)
 		}
 		r.FinishedAt = nullStringToPtr(finishedAt)
 		r.Error = nullStringToPtr(runError)
+		r.DeliveryStatus = nullStringToPtr(deliveryStatus)
+		r.DeliveryError = nullStringToPtr(deliveryError)
+		r.TriggeredBy = nullStringToPtr(triggeredBy)
 		runs = append(runs, r)
 	}
 	if err := rows.Err(); err != nil {
@@ -273,13 +416,18 @@ func (db *DB) GetScheduleRuns(scheduleID string, limit, offset int) ([]ScheduleR
 }
 
 // scanSchedule is a helper for scanning schedule rows.
-func scanSchedule(rows *sql.Rows) (Schedule, error) {
+func scanSchedule(row interface{ Scan(...interface{}) error }) (Schedule, error) {
 	var s Schedule
-	var connID, lastRun, nextRun, lastStatus, lastError, createdBy sql.NullString
+	var connID, lastRun, nextRun, lastStatus, lastError, createdBy, credentialID sql.NullString
 	var enabled int
+	var triggers string
 
-	err := rows.Scan(&s.ID, &s.Name, &s.SavedQueryID, &connID, &s.Cron, &s.Timezone, &enabled, &s.TimeoutMs,
-		&lastRun, &nextRun, &lastStatus, &lastError, &createdBy, &s.CreatedAt, &s.UpdatedAt)
+	err := row.Scan(&s.ID, &s.Name, &s.SavedQueryID, &connID, &s.Cron, &s.Timezone, &enabled, &s.TimeoutMs,
+		&lastRun, &nextRun, &lastStatus, &lastError, &createdBy, &s.CreatedAt, &s.UpdatedAt, &s.DeliveryEncrypted, &credentialID,
+		&triggers, &s.MaxRetries, &s.RetryBackoffSeconds, &s.ConcurrencyPolicy, &s.PreconditionQuery)
+	if err == sql.ErrNoRows {
+		return s, err
+	}
 	if err != nil {
 		return s, fmt.Errorf("scan schedule: %w", err)
 	}
@@ -291,5 +439,12 @@ func scanSchedule(rows *sql.Rows) (Schedule, error) {
 	s.LastStatus = nullStringToPtr(lastStatus)
 	s.LastError = nullStringToPtr(lastError)
 	s.CreatedBy = nullStringToPtr(createdBy)
+	s.CredentialID = nullStringToPtr(credentialID)
+	s.Triggers = []ScheduleTrigger{}
+	if triggers != "" {
+		if err := json.Unmarshal([]byte(triggers), &s.Triggers); err != nil {
+			return s, fmt.Errorf("decode schedule triggers: %w", err)
+		}
+	}
 	return s, nil
 }
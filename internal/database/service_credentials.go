@@ -0,0 +1,241 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SettingSessionCredentialFallback controls whether background jobs may borrow
+// the credentials of an active user session when no service credential is
+// assigned. Unset means enabled, which keeps installs without service
+// credentials working.
+const SettingSessionCredentialFallback = "background_jobs.session_fallback"
+
+// ServiceCredential is a ClickHouse login stored for a connection so that
+// scheduled queries, model runs, pipelines and monitoring can run without an
+// interactive session.
+type ServiceCredential struct {
+	ID                string  `json:"id"`
+	ConnectionID      string  `json:"connection_id"`
+	Name              string  `json:"name"`
+	ClickhouseUser    string  `json:"clickhouse_user"`
+	EncryptedPassword string  `json:"-"`
+	IsDefault         bool    `json:"is_default"`
+	CreatedBy         *string `json:"created_by"`
+	LastUsedAt        *string `json:"last_used_at"`
+	CreatedAt         string  `json:"created_at"`
+	UpdatedAt         string  `json:"updated_at"`
+}
+
+// SessionCredentialFallbackEnabled reports whether background jobs may fall
+// back to borrowing an active session's credentials.
+func (db *DB) SessionCredentialFallbackEnabled() bool {
+	v, _ := db.GetSetting(SettingSessionCredentialFallback)
+	return !strings.EqualFold(strings.TrimSpace(v), "false")
+}
+
+// SetSessionCredentialFallbackEnabled stores the session fallback flag.
+func (db *DB) SetSessionCredentialFallbackEnabled(enabled bool) error {
+	val := "false"
+	if enabled {
+		val = "true"
+	}
+	return db.SetSetting(SettingSessionCredentialFallback, val)
+}
+
+const serviceCredentialColumns = `id, connection_id, name, clickhouse_user, encrypted_password, is_default,
+	created_by, last_used_at, created_at, updated_at`
+
+// GetServiceCredentials lists the service credentials of a connection, or of
+// all connections when connectionID is empty.
+func (db *DB) GetServiceCredentials(connectionID string) ([]ServiceCredential, error) {
+	query := `SELECT ` + serviceCredentialColumns + ` FROM service_credentials`
+	var args []interface{}
+	if connectionID != "" {
+		query += ` WHERE connection_id = ?`
+		args = append(args, connectionID)
+	}
+	query += ` ORDER BY connection_id, name`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get service credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var creds []ServiceCredential
+	for rows.Next() {
+		c, err := scanServiceCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate service credential rows: %w", err)
+	}
+	return creds, nil
+}
+
+// GetServiceCredentialByID returns a service credential, or nil if not found.
+func (db *DB) GetServiceCredentialByID(id string) (*ServiceCredential, error) {
+	row := db.conn.QueryRow(`SELECT `+serviceCredentialColumns+` FROM service_credentials WHERE id = ?`, id)
+	c, err := scanServiceCredential(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetDefaultServiceCredential returns the default service credential of a
+// connection, or nil if none is marked default.
+func (db *DB) GetDefaultServiceCredential(connectionID string) (*ServiceCredential, error) {
+	row := db.conn.QueryRow(
+		`SELECT `+serviceCredentialColumns+` FROM service_credentials
+		 WHERE connection_id = ? AND is_default = 1 LIMIT 1`, connectionID,
+	)
+	c, err := scanServiceCredential(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// CreateServiceCredential stores a new service credential and returns its ID.
+// Marking it default clears the flag on the connection's other credentials.
+func (db *DB) CreateServiceCredential(connectionID, name, clickhouseUser, encryptedPassword string, isDefault bool, createdBy string) (string, error) {
+	id := uuid.NewString()
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	var creator interface{}
+	if createdBy != "" {
+		creator = createdBy
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return "", fmt.Errorf("begin service credential transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if isDefault {
+		if _, err := tx.Exec(`UPDATE service_credentials SET is_default = 0 WHERE connection_id = ?`, connectionID); err != nil {
+			return "", fmt.Errorf("clear default service credential: %w", err)
+		}
+	}
+	_, err = tx.Exec(
+		`INSERT INTO service_credentials (id, connection_id, name, clickhouse_user, encrypted_password, is_default, created_by, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, connectionID, name, clickhouseUser, encryptedPassword, boolToInt(isDefault), creator, now, now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("create service credential: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit service credential: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateServiceCredential updates a service credential. An empty
+// encryptedPassword keeps the stored password.
+func (db *DB) UpdateServiceCredential(id, name, clickhouseUser, encryptedPassword string, isDefault bool) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("begin service credential transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if isDefault {
+		if _, err := tx.Exec(
+			`UPDATE service_credentials SET is_default = 0
+			 WHERE connection_id = (SELECT connection_id FROM service_credentials WHERE id = ?) AND id != ?`,
+			id, id,
+		); err != nil {
+			return fmt.Errorf("clear default service credential: %w", err)
+		}
+	}
+	if encryptedPassword != "" {
+		_, err = tx.Exec(
+			`UPDATE service_credentials SET name = ?, clickhouse_user = ?, encrypted_password = ?, is_default = ?, updated_at = ? WHERE id = ?`,
+			name, clickhouseUser, encryptedPassword, boolToInt(isDefault), now, id,
+		)
+	} else {
+		_, err = tx.Exec(
+			`UPDATE service_credentials SET name = ?, clickhouse_user = ?, is_default = ?, updated_at = ? WHERE id = ?`,
+			name, clickhouseUser, boolToInt(isDefault), now, id,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("update service credential: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit service credential: %w", err)
+	}
+	return nil
+}
+
+// DeleteServiceCredential removes a service credential and clears every
+// assignment of it, so those jobs fall back to the connection default.
+func (db *DB) DeleteServiceCredential(id string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("begin service credential transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"schedules", "models", "pipelines", "ch_health_settings"} {
+		if _, err := tx.Exec(`UPDATE `+table+` SET credential_id = NULL WHERE credential_id = ?`, id); err != nil {
+			return fmt.Errorf("clear %s credential assignments: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM service_credentials WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete service credential: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit service credential deletion: %w", err)
+	}
+	return nil
+}
+
+// TouchServiceCredential records that a service credential was just used.
+func (db *DB) TouchServiceCredential(id string) error {
+	_, err := db.conn.Exec(
+		`UPDATE service_credentials SET last_used_at = ? WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339), id,
+	)
+	if err != nil {
+		return fmt.Errorf("touch service credential: %w", err)
+	}
+	return nil
+}
+
+func scanServiceCredential(row interface{ Scan(...interface{}) error }) (ServiceCredential, error) {
+	var c ServiceCredential
+	var isDefault int
+	var createdBy, lastUsed sql.NullString
+	err := row.Scan(&c.ID, &c.ConnectionID, &c.Name, &c.ClickhouseUser, &c.EncryptedPassword, &isDefault,
+		&createdBy, &lastUsed, &c.CreatedAt, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return c, err
+	}
+	if err != nil {
+		return c, fmt.Errorf("scan service credential: %w", err)
+	}
+	c.IsDefault = isDefault == 1
+	c.CreatedBy = nullStringToPtr(createdBy)
+	c.LastUsedAt = nullStringToPtr(lastUsed)
+	return c, nil
+}
@@ -1,7 +1,10 @@
 package github
 
 import (
+	"bytes"
+	"crypto/sha1"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -34,14 +37,30 @@ func NewClient(pat string) *Client {
 }
 
 func (c *Client) do(method, path string) ([]byte, int, error) {
+	return c.send(method, path, nil)
+}
+
+// send performs a request with an optional JSON body.
+func (c *Client) send(method, path string, payload interface{}) ([]byte, int, error) {
 	url := c.baseURL + path
-	req, err := http.NewRequest(method, url, nil)
+	var reqBody io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, 0, fmt.Errorf("encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, url, reqBody)
 	if err != nil {
 		return nil, 0, err
 	}
 	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Accept", "application/vnd.github+json")
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	resp, err := c.http.Do(req)
 	if err != nil {
@@ -162,3 +181,135 @@ func (c *Client) GetFileContent(owner, repo, path, ref string) (string, error) {
 	}
 	return string(decoded), nil
 }
+
+// GetCommitTreeSHA returns the SHA of the tree a commit points to.
+func (c *Client) GetCommitTreeSHA(owner, repo, commitSHA string) (string, error) {
+	body, status, err := c.do("GET", fmt.Sprintf("/repos/%s/%s/git/commits/%s", owner, repo, commitSHA))
+	if err != nil {
+		return "", err
+	}
+	if status != 200 {
+		return "", fmt.Errorf("failed to get commit %s: HTTP %d", commitSHA, status)
+	}
+	var result struct {
+		Tree struct {
+			SHA string `json:"sha"`
+		} `json:"tree"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("parse commit response: %w", err)
+	}
+	return result.Tree.SHA, nil
+}
+
+// CreateCommit writes files on top of a parent commit in a single commit and
+// returns its SHA. files maps repo paths to their new content. The commit is
+// not on any branch until a ref points to it.
+func (c *Client) CreateCommit(owner, repo, parentSHA, message string, files map[string]string) (string, error) {
+	baseTree, err := c.GetCommitTreeSHA(owner, repo, parentSHA)
+	if err != nil {
+		return "", err
+	}
+
+	type treeItem struct {
+		Path    string `json:"path"`
+		Mode    string `json:"mode"`
+		Type    string `json:"type"`
+		Content string `json:"content"`
+	}
+	items := make([]treeItem, 0, len(files))
+	for path, content := range files {
+		items = append(items, treeItem{Path: path, Mode: "100644", Type: "blob", Content: content})
+	}
+	body, status, err := c.send("POST", fmt.Sprintf("/repos/%s/%s/git/trees", owner, repo), map[string]interface{}{
+		"base_tree": baseTree,
+		"tree":      items,
+	})
+	if err != nil {
+		return "", err
+	}
+	if status != 201 {
+		return "", fmt.Errorf("failed to create tree: HTTP %d", status)
+	}
+	var tree struct {
+		SHA string `json:"sha"`
+	}
+	if err := json.Unmarshal(body, &tree); err != nil {
+		return "", fmt.Errorf("parse tree response: %w", err)
+	}
+
+	body, status, err = c.send("POST", fmt.Sprintf("/repos/%s/%s/git/commits", owner, repo), map[string]interface{}{
+		"message": message,
+		"tree":    tree.SHA,
+		"parents": []string{parentSHA},
+	})
+	if err != nil {
+		return "", err
+	}
+	if status != 201 {
+		return "", fmt.Errorf("failed to create commit: HTTP %d", status)
+	}
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	if err := json.Unmarshal(body, &commit); err != nil {
+		return "", fmt.Errorf("parse commit response: %w", err)
+	}
+	return commit.SHA, nil
+}
+
+// CreateBranch creates a branch pointing at the given commit.
+func (c *Client) CreateBranch(owner, repo, branch, commitSHA string) error {
+	_, status, err := c.send("POST", fmt.Sprintf("/repos/%s/%s/git/refs", owner, repo), map[string]string{
+		"ref": "refs/heads/" + branch,
+		"sha": commitSHA,
+	})
+	if err != nil {
+		return err
+	}
+	if status == 422 {
+		return fmt.Errorf("branch %s already exists", branch)
+	}
+	if status != 201 {
+		return fmt.Errorf("failed to create branch %s: HTTP %d", branch, status)
+	}
+	return nil
+}
+
+// PullRequest is an opened pull request.
+type PullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+}
+
+// CreatePullRequest opens a pull request merging head into base.
+func (c *Client) CreatePullRequest(owner, repo, head, base, title, body string) (*PullRequest, error) {
+	respBody, status, err := c.send("POST", fmt.Sprintf("/repos/%s/%s/pulls", owner, repo), map[string]string{
+		"title": title,
+		"head":  head,
+		"base":  base,
+		"body":  body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status == 401 || status == 403 {
+		return nil, fmt.Errorf("not allowed to open pull requests — the token needs pull request write access")
+	}
+	if status != 201 {
+		return nil, fmt.Errorf("failed to create pull request: HTTP %d", status)
+	}
+	var pr PullRequest
+	if err := json.Unmarshal(respBody, &pr); err != nil {
+		return nil, fmt.Errorf("parse pull request response: %w", err)
+	}
+	return &pr, nil
+}
+
+// BlobSHA returns the git blob SHA of content, as listed in repo trees.
+func BlobSHA(content string) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write([]byte(content))
+	return hex.EncodeToString(h.Sum(nil))
+}
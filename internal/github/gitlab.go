@@ -0,0 +1,171 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultGitLabURL is used when a GitLab source has no base URL.
+const DefaultGitLabURL = "https://gitlab.com"
+
+// GitLabClient is a minimal GitLab API client using a personal, project or
+// group access token. It works with gitlab.com and self-hosted instances.
+type GitLabClient struct {
+	token   string
+	baseURL string
+	http    *http.Client
+}
+
+// NewGitLabClient creates a GitLab API client for the instance at baseURL.
+func NewGitLabClient(baseURL, token string) *GitLabClient {
+	baseURL = strings.TrimSuffix(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		baseURL = DefaultGitLabURL
+	}
+	return &GitLabClient{
+		token:   token,
+		baseURL: baseURL + "/api/v4",
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *GitLabClient) do(path string) ([]byte, http.Header, int, error) {
+	req, err := http.NewRequest("GET", c.baseURL+path, nil)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("gitlab request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.Header, resp.StatusCode, fmt.Errorf("read response: %w", err)
+	}
+	return body, resp.Header, resp.StatusCode, nil
+}
+
+func projectPath(project string) string {
+	return "/projects/" + url.PathEscape(project)
+}
+
+// ValidateAccess checks that the token can read the given project.
+func (c *GitLabClient) ValidateAccess(project string) error {
+	_, _, status, err := c.do(projectPath(project))
+	if err != nil {
+		return err
+	}
+	if status == 401 || status == 403 {
+		return fmt.Errorf("authentication failed — check your access token")
+	}
+	if status == 404 {
+		return fmt.Errorf("project %s not found — check the path and token permissions", project)
+	}
+	if status != 200 {
+		return fmt.Errorf("unexpected status %d from GitLab API", status)
+	}
+	return nil
+}
+
+// GetBranchSHA returns the latest commit SHA for a branch.
+func (c *GitLabClient) GetBranchSHA(project, branch string) (string, error) {
+	body, _, status, err := c.do(projectPath(project) + "/repository/branches/" + url.PathEscape(branch))
+	if err != nil {
+		return "", err
+	}
+	if status != 200 {
+		return "", fmt.Errorf("failed to get branch %s: HTTP %d", branch, status)
+	}
+	var result struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("parse branch response: %w", err)
+	}
+	return result.Commit.ID, nil
+}
+
+// ListTree returns the entries directly under dir at a ref, following
+// pagination.
+func (c *GitLabClient) ListTree(project, ref, dir string) ([]TreeEntry, error) {
+	var entries []TreeEntry
+	page := "1"
+	for page != "" {
+		q := url.Values{}
+		q.Set("ref", ref)
+		q.Set("path", strings.TrimSuffix(dir, "/"))
+		q.Set("per_page", "100")
+		q.Set("page", page)
+		body, header, status, err := c.do(projectPath(project) + "/repository/tree?" + q.Encode())
+		if err != nil {
+			return nil, err
+		}
+		if status == 404 {
+			// The models directory does not exist at this ref.
+			return entries, nil
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("failed to get tree: HTTP %d", status)
+		}
+		var items []struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, fmt.Errorf("parse tree response: %w", err)
+		}
+		for _, it := range items {
+			entries = append(entries, TreeEntry{Path: it.Path, SHA: it.ID, Type: it.Type})
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return entries, nil
+}
+
+// GetFileContent fetches a file's raw content at a ref.
+func (c *GitLabClient) GetFileContent(project, path, ref string) (string, error) {
+	body, _, status, err := c.do(projectPath(project) + "/repository/files/" + url.PathEscape(path) + "/raw?ref=" + url.QueryEscape(ref))
+	if err != nil {
+		return "", err
+	}
+	if status != 200 {
+		return "", fmt.Errorf("failed to get file %s: HTTP %d", path, status)
+	}
+	return string(body), nil
+}
+
+// gitlabSource reads models through the GitLab REST API.
+type gitlabSource struct {
+	client  *GitLabClient
+	project string
+	branch  string
+	path    string
+}
+
+func (g *gitlabSource) Head() (string, error) {
+	return g.client.GetBranchSHA(g.project, g.branch)
+}
+
+func (g *gitlabSource) ListModelFiles(rev string) ([]TreeEntry, error) {
+	entries, err := g.client.ListTree(g.project, rev, g.path)
+	if err != nil {
+		return nil, err
+	}
+	return FilterSQLFiles(entries, g.path), nil
+}
+
+func (g *gitlabSource) ReadFile(path, rev string) (string, error) {
+	return g.client.GetFileContent(g.project, path, rev)
+}
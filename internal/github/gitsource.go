@@ -0,0 +1,151 @@
+package github
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// gitLocks serializes git commands per cache directory, so a webhook and a
+// manual sync do not fetch into the same clone at once.
+var gitLocks sync.Map
+
+// gitSource reads models from any git remote over HTTPS or SSH using the
+// git binary. The remote is fetched into a bare clone in the cache
+// directory, which keeps the history needed to compare revisions. HTTPS
+// remotes authenticate with the token; SSH remotes use the server's keys.
+type gitSource struct {
+	url    string
+	branch string
+	path   string
+	token  string
+	dir    string
+}
+
+func newGitSource(cacheDir, url, branch, path, token string) *gitSource {
+	sum := sha256.Sum256([]byte(url))
+	return &gitSource{
+		url:    url,
+		branch: branch,
+		path:   path,
+		token:  token,
+		dir:    filepath.Join(cacheDir, hex.EncodeToString(sum[:8])),
+	}
+}
+
+// validateGitURL accepts https://, http://, ssh:// and scp-like
+// user@host:path remotes.
+func validateGitURL(u string) error {
+	if strings.HasPrefix(u, "-") {
+		return fmt.Errorf("invalid git URL")
+	}
+	for _, scheme := range []string{"https://", "http://", "ssh://"} {
+		if strings.HasPrefix(u, scheme) {
+			return nil
+		}
+	}
+	if at, colon := strings.Index(u, "@"), strings.Index(u, ":"); at > 0 && colon > at+1 && !strings.Contains(u[:colon], "/") {
+		return nil
+	}
+	return fmt.Errorf("git URL must use https://, ssh:// or user@host:path")
+}
+
+func (g *gitSource) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.dir
+	cmd.Env = append(os.Environ(), g.env()...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return out, nil
+}
+
+// env returns the variables for a git command. The token goes into the
+// environment as GIT_CONFIG_* entries rather than onto the command line,
+// where other local users could read it from the process list.
+func (g *gitSource) env() []string {
+	env := []string{"GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND=ssh -o BatchMode=yes -o StrictHostKeyChecking=accept-new"}
+	if g.token == "" || !strings.HasPrefix(g.url, "http") {
+		return append(env, "GIT_CONFIG_COUNT=0")
+	}
+	// A username is required alongside the token; hosts accept any unless
+	// one is given as user:token.
+	cred := g.token
+	if !strings.Contains(cred, ":") {
+		cred = "oauth2:" + cred
+	}
+	return append(env,
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic "+base64.StdEncoding.EncodeToString([]byte(cred)),
+	)
+}
+
+// Head fetches the branch into the cached clone and returns its commit.
+func (g *gitSource) Head() (string, error) {
+	mu, _ := gitLocks.LoadOrStore(g.dir, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	if _, err := os.Stat(filepath.Join(g.dir, "HEAD")); err != nil {
+		if err := os.MkdirAll(g.dir, 0o700); err != nil {
+			return "", fmt.Errorf("create git cache: %w", err)
+		}
+		if _, err := g.git("init", "--bare", "-q"); err != nil {
+			return "", err
+		}
+	}
+	ref := "refs/heads/" + g.branch
+	if _, err := g.git("fetch", "-q", "--no-tags", g.url, "+"+ref+":"+ref); err != nil {
+		return "", err
+	}
+	out, err := g.git("rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g *gitSource) ListModelFiles(rev string) ([]TreeEntry, error) {
+	dir := strings.TrimSuffix(g.path, "/") + "/"
+	out, err := g.git("ls-tree", "-z", rev, "--", dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []TreeEntry
+	for _, line := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		meta, path, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 {
+			continue
+		}
+		entries = append(entries, TreeEntry{Path: path, SHA: fields[2], Type: fields[1]})
+	}
+	return FilterSQLFiles(entries, g.path), nil
+}
+
+func (g *gitSource) ReadFile(path, rev string) (string, error) {
+	out, err := g.git("cat-file", "blob", rev+":"+path)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
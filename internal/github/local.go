@@ -0,0 +1,82 @@
+package github
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// localSource reads models from a directory on the server, such as a
+// checked-out monorepo. It has no history: its revision is a hash of the
+// files, and only the revision last read from disk can be listed or read.
+type localSource struct {
+	root string
+	path string
+
+	rev     string
+	entries []TreeEntry
+	files   map[string]string
+}
+
+// snapshot reads the model files and hashes them into a revision.
+func (l *localSource) snapshot() error {
+	dir := filepath.Join(l.root, filepath.FromSlash(l.path))
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read models directory: %w", err)
+	}
+	prefix := strings.TrimSuffix(l.path, "/") + "/"
+	entries := []TreeEntry{}
+	files := make(map[string]string)
+	for _, it := range items {
+		if !it.Type().IsRegular() || !strings.HasSuffix(strings.ToLower(it.Name()), ".sql") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, it.Name()))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", it.Name(), err)
+		}
+		path := prefix + it.Name()
+		files[path] = string(content)
+		entries = append(entries, TreeEntry{Path: path, SHA: BlobSHA(string(content)), Type: "blob"})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	h := sha1.New()
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s %s\n", e.SHA, e.Path)
+	}
+	l.rev = hex.EncodeToString(h.Sum(nil))
+	l.entries = entries
+	l.files = files
+	return nil
+}
+
+func (l *localSource) Head() (string, error) {
+	if err := l.snapshot(); err != nil {
+		return "", err
+	}
+	return l.rev, nil
+}
+
+func (l *localSource) ListModelFiles(rev string) ([]TreeEntry, error) {
+	if rev != l.rev {
+		return nil, fmt.Errorf("revision %s is no longer on disk", rev)
+	}
+	return l.entries, nil
+}
+
+func (l *localSource) ReadFile(path, rev string) (string, error) {
+	if rev != l.rev {
+		return "", fmt.Errorf("revision %s is no longer on disk", rev)
+	}
+	content, ok := l.files[path]
+	if !ok {
+		return "", fmt.Errorf("file %s not found", path)
+	}
+	return content, nil
+}
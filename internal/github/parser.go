@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/models"
 	"gopkg.in/yaml.v3"
 )
 
@@ -12,9 +14,15 @@ import (
 type ModelFrontmatter struct {
 	Materialization string `yaml:"materialization"`
 	TargetDatabase  string `yaml:"target_database"`
-	TableEngine     string `yaml:"table_engine"`
-	OrderBy         string `yaml:"order_by"`
-	Description     string `yaml:"description"`
+	TableEngine     string `yaml:"table_engine,omitempty"`
+	OrderBy         string `yaml:"order_by,omitempty"`
+	Description     string `yaml:"description,omitempty"`
+
+	// partition_by, unique_key, layout and lifetime for incremental,
+	// materialized_view and dictionary models.
+	database.ModelOptions `yaml:",inline"`
+
+	Tests []database.ModelTest `yaml:"tests,omitempty"`
 }
 
 // ParsedModel is the result of parsing a .sql model file with YAML frontmatter.
@@ -58,7 +66,7 @@ func ParseModelFile(filename, content string) (*ParsedModel, error) {
 			if fm.TargetDatabase == "" {
 				fm.TargetDatabase = "default"
 			}
-			if fm.Materialization == "table" {
+			if models.UsesTableEngine(fm.Materialization) {
 				if fm.TableEngine == "" {
 					fm.TableEngine = "MergeTree"
 				}
@@ -72,6 +80,14 @@ func ParseModelFile(filename, content string) (*ParsedModel, error) {
 	if sqlBody == "" {
 		return nil, fmt.Errorf("model %s has no SQL body", filename)
 	}
+	if err := models.ValidateMaterialization(fm.Materialization, fm.ModelOptions); err != nil {
+		return nil, fmt.Errorf("model %s: %w", filename, err)
+	}
+	tests, err := models.NormalizeTests(fm.Tests)
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %w", filename, err)
+	}
+	fm.Tests = tests
 
 	return &ParsedModel{
 		Name:        name,
@@ -79,3 +95,30 @@ func ParseModelFile(filename, content string) (*ParsedModel, error) {
 		SQLBody:     sqlBody,
 	}, nil
 }
+
+// RenderModelFile writes a model as a .sql file with YAML frontmatter that
+// ParseModelFile reads back to the same model.
+func RenderModelFile(m database.Model) (string, error) {
+	fm := ModelFrontmatter{
+		Materialization: m.Materialization,
+		TargetDatabase:  m.TargetDatabase,
+		Description:     m.Description,
+		ModelOptions:    m.ModelOptions,
+		Tests:           m.Tests,
+	}
+	if models.UsesTableEngine(m.Materialization) {
+		fm.TableEngine = m.TableEngine
+		fm.OrderBy = m.OrderBy
+	}
+	header, err := yaml.Marshal(fm)
+	if err != nil {
+		return "", fmt.Errorf("render frontmatter for %s: %w", m.Name, err)
+	}
+	return "---\n" + string(header) + "---\n\n" + strings.TrimSpace(m.SQLBody) + "\n", nil
+}
+
+// ModelFilePath returns the repo path of a model's file under the models
+// directory.
+func ModelFilePath(dir, name string) string {
+	return strings.TrimSuffix(dir, "/") + "/" + name + ".sql"
+}
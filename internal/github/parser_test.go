@@ -0,0 +1,53 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+func TestRenderModelFileRoundTrip(t *testing.T) {
+	minRows := int64(1)
+	m := database.Model{
+		Name:            "daily_orders",
+		Description:     "Orders per day",
+		TargetDatabase:  "analytics",
+		Materialization: "incremental",
+		SQLBody:         "SELECT toDate(ts) AS day, count() AS n\nFROM $ref(orders)\nGROUP BY day\n",
+		TableEngine:     "ReplacingMergeTree",
+		OrderBy:         "day",
+		ModelOptions:    database.ModelOptions{UniqueKey: "day"},
+		Tests: []database.ModelTest{
+			{Type: "not_null", Column: "day", Severity: "error"},
+			{Type: "row_count", MinRows: &minRows, Severity: "warn"},
+		},
+	}
+
+	content, err := RenderModelFile(m)
+	if err != nil {
+		t.Fatalf("RenderModelFile: %v", err)
+	}
+	parsed, err := ParseModelFile(ModelFilePath("models/", m.Name), content)
+	if err != nil {
+		t.Fatalf("ParseModelFile: %v\n%s", err, content)
+	}
+	if parsed.Name != m.Name {
+		t.Fatalf("name = %q, want %q", parsed.Name, m.Name)
+	}
+	if modelChanged(m, parsed) {
+		t.Fatalf("model changed after a round trip:\n%s", content)
+	}
+
+	view := database.Model{Name: "v", TargetDatabase: "default", Materialization: "view", SQLBody: "SELECT 1", Tests: []database.ModelTest{}}
+	content, _ = RenderModelFile(view)
+	if want := "---\nmaterialization: view\ntarget_database: default\n---\n\nSELECT 1\n"; content != want {
+		t.Fatalf("view file = %q, want %q", content, want)
+	}
+}
+
+func TestBlobSHA(t *testing.T) {
+	// git hash-object of "hello\n"
+	if got := BlobSHA("hello\n"); got != "ce013625030ba8dba906f756967f9e9ca394464a" {
+		t.Fatalf("BlobSHA = %s", got)
+	}
+}
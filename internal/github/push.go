@@ -0,0 +1,169 @@
+package github
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PushOptions selects what PushConnection exports and how the pull request
+// is named.
+type PushOptions struct {
+	// ModelIDs limits the export to these models; empty exports all.
+	ModelIDs []string
+	// Branch is the branch to create; a timestamped ch-ui/models-* name is
+	// used when empty.
+	Branch string
+	Title  string
+	Body   string
+	// Force pushes models changed on both sides since the last sync,
+	// leaving the conflict to the pull request review.
+	Force       bool
+	TriggeredBy string
+}
+
+// PushResult holds the outcome of a push.
+type PushResult struct {
+	Branch            string
+	CommitSHA         string
+	PullRequestNumber int
+	PullRequestURL    string
+	Pushed            []string
+	Unchanged         int
+	// Behind are models changed only on GitHub since the last sync; a sync
+	// brings them in.
+	Behind []string
+	// Conflicts are models changed both in CH-UI and on GitHub since the
+	// last sync. Nothing is pushed while there are any, unless Force is set.
+	Conflicts []string
+}
+
+// PushConnection writes a connection's models as .sql files to a new branch
+// in a single commit and opens a pull request against the configured
+// branch. Files already matching CH-UI are left alone, so the pull request
+// only carries real changes. Nothing is pushed when there are none, or when
+// a model changed on both sides since the last sync and Force is not set.
+func (s *Syncer) PushConnection(connectionID string, opts PushOptions) (*PushResult, error) {
+	t, err := s.openRepo(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if t.provider != ProviderGitHub {
+		return nil, fmt.Errorf("pushing models is only supported for GitHub sources")
+	}
+
+	headSHA, err := t.client.GetBranchSHA(t.owner, t.repo, t.branch)
+	if err != nil {
+		return nil, fmt.Errorf("get branch SHA: %w", err)
+	}
+	tree, err := t.client.GetTree(t.owner, t.repo, headSHA)
+	if err != nil {
+		return nil, fmt.Errorf("get repo tree: %w", err)
+	}
+	head := indexModelFiles(FilterSQLFiles(tree, t.path))
+
+	base := head
+	if t.lastSHA != headSHA {
+		base = s.baseFiles(t)
+	}
+
+	all, err := s.db.GetModelsByConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("load models: %w", err)
+	}
+	selected := make(map[string]bool, len(opts.ModelIDs))
+	for _, id := range opts.ModelIDs {
+		selected[id] = true
+	}
+
+	result := &PushResult{}
+	files := make(map[string]string)
+	for _, m := range all {
+		if len(selected) > 0 && !selected[m.ID] {
+			continue
+		}
+		content, err := RenderModelFile(m)
+		if err != nil {
+			return nil, err
+		}
+
+		remote, inHead := head[m.Name]
+		if inHead && remote.SHA == BlobSHA(content) {
+			result.Unchanged++
+			continue
+		}
+		if base[m.Name].SHA != remote.SHA {
+			edited, err := s.editedSinceSync(t, base, m)
+			if err != nil {
+				return nil, fmt.Errorf("check %s: %w", m.Name, err)
+			}
+			if !edited {
+				result.Behind = append(result.Behind, m.Name)
+				continue
+			}
+			if !opts.Force {
+				result.Conflicts = append(result.Conflicts, m.Name)
+				continue
+			}
+		}
+
+		path := ModelFilePath(t.path, m.Name)
+		if inHead {
+			path = remote.Path
+		}
+		files[path] = content
+		result.Pushed = append(result.Pushed, m.Name)
+	}
+
+	if len(result.Conflicts) > 0 {
+		result.Pushed = nil
+		return result, nil
+	}
+	if len(files) == 0 {
+		return result, nil
+	}
+
+	title := strings.TrimSpace(opts.Title)
+	if title == "" {
+		title = fmt.Sprintf("Update %d model(s) from CH-UI", len(result.Pushed))
+	}
+	body := strings.TrimSpace(opts.Body)
+	if body == "" {
+		body = pushDescription(result.Pushed, opts.TriggeredBy)
+	}
+
+	commitSHA, err := t.client.CreateCommit(t.owner, t.repo, headSHA, title, files)
+	if err != nil {
+		return nil, fmt.Errorf("create commit: %w", err)
+	}
+	branch := strings.TrimSpace(opts.Branch)
+	if branch == "" {
+		branch = "ch-ui/models-" + time.Now().UTC().Format("20060102-150405")
+	}
+	if err := t.client.CreateBranch(t.owner, t.repo, branch, commitSHA); err != nil {
+		return nil, fmt.Errorf("create branch: %w", err)
+	}
+	pr, err := t.client.CreatePullRequest(t.owner, t.repo, branch, t.branch, title, body)
+	if err != nil {
+		return nil, fmt.Errorf("open pull request: %w", err)
+	}
+
+	result.Branch = branch
+	result.CommitSHA = commitSHA
+	result.PullRequestNumber = pr.Number
+	result.PullRequestURL = pr.HTMLURL
+	return result, nil
+}
+
+func pushDescription(names []string, triggeredBy string) string {
+	var b strings.Builder
+	b.WriteString("Models exported from CH-UI")
+	if triggeredBy != "" {
+		fmt.Fprintf(&b, " by %s", triggeredBy)
+	}
+	b.WriteString(":\n\n")
+	for _, n := range names {
+		fmt.Fprintf(&b, "- `%s`\n", n)
+	}
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package github
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Model source providers.
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	ProviderGit    = "git"
+	ProviderLocal  = "local"
+)
+
+// Source is where a connection's model files come from. Revisions are
+// opaque: commit SHAs for git hosts and a content hash for local
+// directories. Listed entries carry the git blob SHA of each file, so
+// changes are detected without reading the files.
+type Source interface {
+	// Head returns the current revision of the configured branch.
+	Head() (string, error)
+	// ListModelFiles lists the .sql files directly under the models
+	// directory at a revision.
+	ListModelFiles(rev string) ([]TreeEntry, error)
+	// ReadFile returns a file's content at a revision.
+	ReadFile(path, rev string) (string, error)
+}
+
+// NormalizeProvider lowercases a provider name, defaulting to GitHub.
+func NormalizeProvider(provider string) (string, error) {
+	p := strings.ToLower(strings.TrimSpace(provider))
+	switch p {
+	case "":
+		return ProviderGitHub, nil
+	case ProviderGitHub, ProviderGitLab, ProviderGit, ProviderLocal:
+		return p, nil
+	}
+	return "", fmt.Errorf("provider must be one of github, gitlab, git or local")
+}
+
+// TokenRequired reports whether a provider needs an access token. Plain git
+// can use SSH keys of the server instead, and local directories need none.
+func TokenRequired(provider string) bool {
+	return provider == ProviderGitHub || provider == ProviderGitLab
+}
+
+// ValidateRepo checks the repository setting of a provider: owner/repo on
+// GitHub, a project path on GitLab, a clone URL for plain git and an
+// absolute directory for local sources.
+func ValidateRepo(provider, repo string) error {
+	switch provider {
+	case ProviderGitHub:
+		parts := strings.SplitN(repo, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("repository must be in owner/repo format")
+		}
+	case ProviderGitLab:
+		if !strings.Contains(repo, "/") || strings.HasPrefix(repo, "/") || strings.HasSuffix(repo, "/") {
+			return fmt.Errorf("project must be a path like group/project")
+		}
+	case ProviderGit:
+		return validateGitURL(repo)
+	case ProviderLocal:
+		if !filepath.IsAbs(repo) {
+			return fmt.Errorf("directory must be an absolute path on the server")
+		}
+	}
+	return nil
+}
+
+// githubSource reads models through the GitHub REST API.
+type githubSource struct {
+	client *Client
+	owner  string
+	repo   string
+	branch string
+	path   string
+}
+
+func (g *githubSource) Head() (string, error) {
+	return g.client.GetBranchSHA(g.owner, g.repo, g.branch)
+}
+
+func (g *githubSource) ListModelFiles(rev string) ([]TreeEntry, error) {
+	tree, err := g.client.GetTree(g.owner, g.repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	return FilterSQLFiles(tree, g.path), nil
+}
+
+func (g *githubSource) ReadFile(path, rev string) (string, error) {
+	return g.client.GetFileContent(g.owner, g.repo, path, rev)
+}
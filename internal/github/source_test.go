@@ -0,0 +1,110 @@
+package github
+
+import (
+	"encoding/base64"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalSource(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "models")
+	if err := os.MkdirAll(filepath.Join(dir, "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("orders.sql", "SELECT 1\n")
+	write("README.md", "not a model")
+
+	src := &localSource{root: root, path: "models/"}
+	rev, err := src.Head()
+	if err != nil {
+		t.Fatalf("Head: %v", err)
+	}
+	files, err := src.ListModelFiles(rev)
+	if err != nil || len(files) != 1 || files[0].Path != "models/orders.sql" || files[0].SHA != BlobSHA("SELECT 1\n") {
+		t.Fatalf("ListModelFiles = %+v, %v", files, err)
+	}
+	if content, err := src.ReadFile("models/orders.sql", rev); err != nil || content != "SELECT 1\n" {
+		t.Fatalf("ReadFile = %q, %v", content, err)
+	}
+
+	write("orders.sql", "SELECT 2\n")
+	next, _ := src.Head()
+	if next == rev {
+		t.Fatal("revision must change with the files")
+	}
+	if _, err := src.ReadFile("models/orders.sql", rev); err == nil {
+		t.Fatal("an old revision of a local directory cannot be read")
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	remote := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = remote
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q", "-b", "main")
+	if err := os.MkdirAll(filepath.Join(remote, "models"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(remote, "models", "orders.sql"), []byte("SELECT 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", ".")
+	run("commit", "-q", "-m", "init")
+
+	// Local paths are not valid remotes in settings, but git fetches them
+	// the same way.
+	src := newGitSource(t.TempDir(), remote, "main", "models/", "")
+	rev, err := src.Head()
+	if err != nil {
+		t.Fatalf("Head: %v", err)
+	}
+	files, err := src.ListModelFiles(rev)
+	if err != nil || len(files) != 1 || files[0].SHA != BlobSHA("SELECT 1\n") {
+		t.Fatalf("ListModelFiles = %+v, %v", files, err)
+	}
+	if content, err := src.ReadFile(files[0].Path, rev); err != nil || content != "SELECT 1\n" {
+		t.Fatalf("ReadFile = %q, %v", content, err)
+	}
+}
+
+func TestValidateGitURL(t *testing.T) {
+	for _, u := range []string{"https://gitlab.example.com/data/models.git", "ssh://git@host/repo.git", "git@github.com:org/repo.git"} {
+		if err := validateGitURL(u); err != nil {
+			t.Errorf("%s: %v", u, err)
+		}
+	}
+	for _, u := range []string{"--upload-pack=touch /tmp/x", "/srv/repo", "file:///srv/repo", "ext::sh -c id"} {
+		if err := validateGitURL(u); err == nil {
+			t.Errorf("%s must be rejected", u)
+		}
+	}
+}
+
+func TestGitSourceKeepsTokenOffCommandLine(t *testing.T) {
+	src := newGitSource(t.TempDir(), "https://gitlab.example.com/data/models.git", "main", "models/", "tok")
+	env := strings.Join(src.env(), "\n")
+	if !strings.Contains(env, "GIT_CONFIG_KEY_0=http.extraHeader") || !strings.Contains(env, "GIT_CONFIG_VALUE_0=Authorization: Basic "+base64.StdEncoding.EncodeToString([]byte("oauth2:tok"))) {
+		t.Fatalf("token header not passed through the environment: %s", env)
+	}
+	if ssh := newGitSource(t.TempDir(), "git@host:repo.git", "main", "models/", "tok"); strings.Contains(strings.Join(ssh.env(), "\n"), "Authorization") {
+		t.Fatal("token must not be sent to SSH remotes")
+	}
+}
@@ -3,16 +3,27 @@ package github
 import (
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/caioricciuti/ch-ui/internal/crypto"
 	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/models"
 )
 
-// Syncer orchestrates pulling models from a GitHub repo into CH-UI.
+// Syncer orchestrates pulling models from a model source (GitHub, GitLab,
+// any git remote or a local directory) into CH-UI and pushing models edited
+// in CH-UI back to GitHub as pull requests.
 type Syncer struct {
-	db     *database.DB
-	secret string
+	db       *database.DB
+	secret   string
+	cacheDir string
+
+	mu      sync.Mutex
+	running bool
+	stopCh  chan struct{}
 }
 
 // SyncResult holds the outcome of a sync operation.
@@ -22,35 +33,107 @@ type SyncResult struct {
 	Deleted   int
 	Unchanged int
 	CommitSHA string
+	// Conflicts are models changed both in CH-UI and on GitHub since the
+	// last sync. They keep their CH-UI version until pushed or resolved.
+	Conflicts []string
 	Errors    []string
 }
 
-// NewSyncer creates a new GitHub sync orchestrator.
-func NewSyncer(db *database.DB, appSecret string) *Syncer {
-	return &Syncer{db: db, secret: appSecret}
+// repoTarget is the model source, branch and models directory configured
+// for a connection.
+type repoTarget struct {
+	provider string
+	source   Source
+	branch   string
+	path     string
+	lastSHA  string
+
+	// GitHub only, for pushing.
+	client *Client
+	owner  string
+	repo   string
 }
 
-// SyncConnection pulls models from GitHub for the given connection.
-func (s *Syncer) SyncConnection(connectionID, triggeredBy string) (*SyncResult, error) {
+// NewSyncer creates a new model sync orchestrator. Plain git sources are
+// cloned under cacheDir.
+func NewSyncer(db *database.DB, appSecret, cacheDir string) *Syncer {
+	return &Syncer{db: db, secret: appSecret, cacheDir: cacheDir}
+}
+
+// openRepo loads and decrypts a connection's source settings.
+func (s *Syncer) openRepo(connectionID string) (*repoTarget, error) {
 	repo, branch, path, encryptedPAT, _, lastSHA := s.db.GetGitHubRawSettings(connectionID)
-	if repo == "" || encryptedPAT == "" {
-		return nil, fmt.Errorf("GitHub integration not configured for this connection")
+	provider, url := s.db.GetGitHubSourceSettings(connectionID)
+	provider, err := NormalizeProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+	if repo == "" || (encryptedPAT == "" && TokenRequired(provider)) {
+		return nil, fmt.Errorf("model source not configured for this connection")
+	}
+	if err := ValidateRepo(provider, repo); err != nil {
+		return nil, fmt.Errorf("invalid repository %q: %w", repo, err)
 	}
 
-	pat, err := crypto.Decrypt(encryptedPAT, s.secret)
+	var token string
+	if encryptedPAT != "" {
+		token, err = crypto.Decrypt(encryptedPAT, s.secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt access token: %w", err)
+		}
+	}
+
+	t := &repoTarget{provider: provider, branch: branch, path: path, lastSHA: lastSHA}
+	switch provider {
+	case ProviderGitHub:
+		parts := strings.SplitN(repo, "/", 2)
+		t.client, t.owner, t.repo = NewClient(token), parts[0], parts[1]
+		t.source = &githubSource{client: t.client, owner: t.owner, repo: t.repo, branch: branch, path: path}
+	case ProviderGitLab:
+		t.source = &gitlabSource{client: NewGitLabClient(url, token), project: repo, branch: branch, path: path}
+	case ProviderGit:
+		t.source = newGitSource(s.cacheDir, repo, branch, path, token)
+	case ProviderLocal:
+		t.source = &localSource{root: repo, path: path}
+	}
+	return t, nil
+}
+
+// TestConnection checks that a connection's source is reachable and its
+// branch exists.
+func (s *Syncer) TestConnection(connectionID string) error {
+	t, err := s.openRepo(connectionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt GitHub PAT: %w", err)
+		return err
+	}
+	if t.provider == ProviderGitHub {
+		if err := t.client.ValidateAccess(t.owner, t.repo); err != nil {
+			return err
+		}
 	}
+	if gl, ok := t.source.(*gitlabSource); ok {
+		if err := gl.client.ValidateAccess(gl.project); err != nil {
+			return err
+		}
+	}
+	if _, err := t.source.Head(); err != nil {
+		return fmt.Errorf("branch %q not readable: %w", t.branch, err)
+	}
+	return nil
+}
 
-	parts := strings.SplitN(repo, "/", 2)
-	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
-		return nil, fmt.Errorf("invalid repo format %q — expected owner/repo", repo)
+// SyncConnection pulls models from the connection's source. Models edited
+// in CH-UI since the last sync are kept unless their file changed in the
+// source too, which is reported as a conflict.
+func (s *Syncer) SyncConnection(connectionID, triggeredBy string) (*SyncResult, error) {
+	t, err := s.openRepo(connectionID)
+	if err != nil {
+		return nil, err
 	}
-	owner, repoName := parts[0], parts[1]
 
 	logID, _ := s.db.CreateGitHubSyncLog(connectionID, triggeredBy)
 
-	result, syncErr := s.doSync(connectionID, owner, repoName, branch, path, pat, lastSHA)
+	result, syncErr := s.doSync(connectionID, t)
 	if syncErr != nil {
 		if logID != "" {
 			_ = s.db.FinalizeGitHubSyncLog(logID, "error", 0, 0, 0, 0, "", syncErr.Error())
@@ -73,30 +156,29 @@ func (s *Syncer) SyncConnection(connectionID, triggeredBy string) (*SyncResult,
 	return result, nil
 }
 
-func (s *Syncer) doSync(connectionID, owner, repoName, branch, path, pat, lastSHA string) (*SyncResult, error) {
-	client := NewClient(pat)
-
-	commitSHA, err := client.GetBranchSHA(owner, repoName, branch)
+func (s *Syncer) doSync(connectionID string, t *repoTarget) (*SyncResult, error) {
+	commitSHA, err := t.source.Head()
 	if err != nil {
 		return nil, fmt.Errorf("get branch SHA: %w", err)
 	}
 
-	if commitSHA == lastSHA && lastSHA != "" {
+	if commitSHA == t.lastSHA && t.lastSHA != "" {
 		return &SyncResult{CommitSHA: commitSHA}, nil
 	}
 
-	tree, err := client.GetTree(owner, repoName, branch)
+	sqlFiles, err := t.source.ListModelFiles(commitSHA)
 	if err != nil {
-		return nil, fmt.Errorf("get repo tree: %w", err)
+		return nil, fmt.Errorf("list model files: %w", err)
 	}
+	slog.Info("Model sync: found SQL files", "count", len(sqlFiles), "provider", t.provider, "branch", t.branch)
 
-	sqlFiles := FilterSQLFiles(tree, path)
-	slog.Info("GitHub sync: found SQL files", "count", len(sqlFiles), "repo", owner+"/"+repoName, "branch", branch)
+	base := s.baseFiles(t)
+	head := indexModelFiles(sqlFiles)
 
 	parsed := make([]*ParsedModel, 0, len(sqlFiles))
 	var parseErrors []string
 	for _, f := range sqlFiles {
-		content, err := client.GetFileContent(owner, repoName, f.Path, branch)
+		content, err := t.source.ReadFile(f.Path, commitSHA)
 		if err != nil {
 			parseErrors = append(parseErrors, fmt.Sprintf("fetch %s: %v", f.Path, err))
 			continue
@@ -109,9 +191,9 @@ func (s *Syncer) doSync(connectionID, owner, repoName, branch, path, pat, lastSH
 		parsed = append(parsed, model)
 	}
 
-	existing, err := s.db.GetModelsByConnectionAndSource(connectionID, "github")
+	existing, err := s.db.GetModelsByConnection(connectionID)
 	if err != nil {
-		return nil, fmt.Errorf("get existing github models: %w", err)
+		return nil, fmt.Errorf("get existing models: %w", err)
 	}
 
 	existingByName := make(map[string]database.Model, len(existing))
@@ -137,28 +219,81 @@ func (s *Syncer) doSync(connectionID, owner, repoName, branch, path, pat, lastSH
 				continue
 			}
 			_ = s.db.SetModelSource(id, "github")
+			if err := s.db.UpdateModelOptions(id, p.Frontmatter.ModelOptions); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("create %s: %v", p.Name, err))
+			}
+			if err := s.db.UpdateModelTests(id, p.Frontmatter.Tests); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("create %s: %v", p.Name, err))
+			}
 			result.Created++
 			continue
 		}
 
-		if modelChanged(ex, p) {
-			err := s.db.UpdateModel(
-				ex.ID, p.Name, p.Frontmatter.Description,
-				p.Frontmatter.TargetDatabase, p.Frontmatter.Materialization,
-				p.SQLBody, p.Frontmatter.TableEngine, p.Frontmatter.OrderBy,
-			)
+		if !modelChanged(ex, p) {
+			// A model created in CH-UI and pushed to GitHub is managed
+			// by the repo from now on.
+			if ex.Source != "github" {
+				_ = s.db.SetModelSource(ex.ID, "github")
+			}
+			result.Unchanged++
+			continue
+		}
+
+		remoteChanged := base == nil || base[p.Name].SHA != head[p.Name].SHA
+		if ex.Source != "github" || base != nil {
+			edited, err := s.editedSinceSync(t, base, ex)
 			if err != nil {
-				result.Errors = append(result.Errors, fmt.Sprintf("update %s: %v", p.Name, err))
+				result.Errors = append(result.Errors, fmt.Sprintf("check %s: %v", p.Name, err))
 				continue
 			}
-			result.Updated++
-		} else {
-			result.Unchanged++
+			if edited && !remoteChanged {
+				// Edited in CH-UI only; keep it until it is pushed.
+				result.Unchanged++
+				continue
+			}
+			if edited {
+				result.Conflicts = append(result.Conflicts, p.Name)
+				result.Errors = append(result.Errors, fmt.Sprintf("conflict %s: changed in CH-UI and on GitHub since the last sync", p.Name))
+				continue
+			}
+		}
+
+		if err := s.db.UpdateModel(
+			ex.ID, p.Name, p.Frontmatter.Description,
+			p.Frontmatter.TargetDatabase, p.Frontmatter.Materialization,
+			p.SQLBody, p.Frontmatter.TableEngine, p.Frontmatter.OrderBy,
+		); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("update %s: %v", p.Name, err))
+			continue
 		}
+		if err := s.db.UpdateModelOptions(ex.ID, p.Frontmatter.ModelOptions); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("update %s: %v", p.Name, err))
+			continue
+		}
+		if err := s.db.UpdateModelTests(ex.ID, p.Frontmatter.Tests); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("update %s: %v", p.Name, err))
+			continue
+		}
+		if ex.Source != "github" {
+			_ = s.db.SetModelSource(ex.ID, "github")
+		}
+		result.Updated++
 	}
 
 	for _, ex := range existing {
-		if !seen[ex.Name] {
+		if ex.Source == "github" && !seen[ex.Name] {
+			if base != nil {
+				edited, err := s.editedSinceSync(t, base, ex)
+				if err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("check %s: %v", ex.Name, err))
+					continue
+				}
+				if edited {
+					result.Conflicts = append(result.Conflicts, ex.Name)
+					result.Errors = append(result.Errors, fmt.Sprintf("conflict %s: removed on GitHub but changed in CH-UI since the last sync", ex.Name))
+					continue
+				}
+			}
 			if err := s.db.DeleteModel(ex.ID); err != nil {
 				result.Errors = append(result.Errors, fmt.Sprintf("delete %s: %v", ex.Name, err))
 				continue
@@ -172,7 +307,7 @@ func (s *Syncer) doSync(connectionID, owner, repoName, branch, path, pat, lastSH
 }
 
 func modelChanged(existing database.Model, parsed *ParsedModel) bool {
-	if existing.SQLBody != parsed.SQLBody {
+	if strings.TrimSpace(existing.SQLBody) != parsed.SQLBody {
 		return true
 	}
 	if existing.Description != parsed.Frontmatter.Description {
@@ -184,11 +319,68 @@ func modelChanged(existing database.Model, parsed *ParsedModel) bool {
 	if existing.TargetDatabase != parsed.Frontmatter.TargetDatabase {
 		return true
 	}
-	if existing.TableEngine != parsed.Frontmatter.TableEngine {
+	// Engine and order only matter for models backed by a table.
+	if models.UsesTableEngine(existing.Materialization) {
+		if existing.TableEngine != parsed.Frontmatter.TableEngine {
+			return true
+		}
+		if existing.OrderBy != parsed.Frontmatter.OrderBy {
+			return true
+		}
+	}
+	if existing.ModelOptions != parsed.Frontmatter.ModelOptions {
 		return true
 	}
-	if existing.OrderBy != parsed.Frontmatter.OrderBy {
+	if !reflect.DeepEqual(existing.Tests, parsed.Frontmatter.Tests) {
 		return true
 	}
 	return false
 }
+
+// baseFiles indexes the model files of the last synced commit by model name.
+// It returns nil when there was no sync yet, the source keeps no history
+// (local directories) or that commit cannot be read; then nothing is known
+// about what changed since.
+func (s *Syncer) baseFiles(t *repoTarget) map[string]TreeEntry {
+	if t.lastSHA == "" || t.provider == ProviderLocal {
+		return nil
+	}
+	files, err := t.source.ListModelFiles(t.lastSHA)
+	if err != nil {
+		slog.Warn("Model sync: failed to read last synced revision", "sha", t.lastSHA, "error", err)
+		return nil
+	}
+	return indexModelFiles(files)
+}
+
+// indexModelFiles maps model names to their files.
+func indexModelFiles(entries []TreeEntry) map[string]TreeEntry {
+	byName := make(map[string]TreeEntry, len(entries))
+	for _, e := range entries {
+		byName[strings.TrimSuffix(filepath.Base(e.Path), ".sql")] = e
+	}
+	return byName
+}
+
+// editedSinceSync reports whether a model differs from its file in the last
+// synced commit. A model with no file there counts as edited.
+func (s *Syncer) editedSinceSync(t *repoTarget, base map[string]TreeEntry, m database.Model) (bool, error) {
+	entry, ok := base[m.Name]
+	if !ok {
+		return true, nil
+	}
+	if content, err := RenderModelFile(m); err == nil && BlobSHA(content) == entry.SHA {
+		return false, nil
+	}
+	content, err := t.source.ReadFile(entry.Path, t.lastSHA)
+	if err != nil {
+		return false, err
+	}
+	parsed, err := ParseModelFile(entry.Path, content)
+	if err != nil {
+		// The synced file could not be loaded then either; whatever is
+		// in CH-UI was not pulled from it.
+		return true, nil
+	}
+	return modelChanged(m, parsed), nil
+}
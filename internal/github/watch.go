@@ -0,0 +1,84 @@
+package github
+
+import (
+	"log/slog"
+	"time"
+)
+
+// watchInterval is how often local model directories are checked for
+// changes.
+const watchInterval = 15 * time.Second
+
+// StartBackground starts watching the local-directory sources of all
+// connections, syncing a connection when its model files change.
+// Idempotent.
+func (s *Syncer) StartBackground() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.stopCh = make(chan struct{})
+	s.running = true
+	stopCh := s.stopCh
+	s.mu.Unlock()
+
+	go func() {
+		slog.Info("Local model source watcher started", "tick", watchInterval)
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				slog.Info("Local model source watcher stopped")
+				return
+			case <-ticker.C:
+				s.watchTick()
+			}
+		}
+	}()
+}
+
+// Stop stops the watcher. Safe when not running.
+func (s *Syncer) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return
+	}
+	close(s.stopCh)
+	s.running = false
+}
+
+func (s *Syncer) watchTick() {
+	conns, err := s.db.GetConnections()
+	if err != nil {
+		slog.Warn("Local model source watcher: failed to list connections", "error", err)
+		return
+	}
+	for _, c := range conns {
+		integration, err := s.db.GetGitHubIntegration(c.ID)
+		if err != nil || integration == nil || !integration.Enabled || integration.Provider != ProviderLocal {
+			continue
+		}
+		t, err := s.openRepo(c.ID)
+		if err != nil {
+			continue
+		}
+		head, err := t.source.Head()
+		if err != nil || head == t.lastSHA {
+			continue
+		}
+		result, err := s.SyncConnection(c.ID, "local-watcher")
+		if err != nil {
+			slog.Error("Local model source sync failed", "connectionId", c.ID, "error", err)
+			continue
+		}
+		slog.Info("Local model source sync completed",
+			"connectionId", c.ID,
+			"created", result.Created,
+			"updated", result.Updated,
+			"deleted", result.Deleted,
+		)
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/credentials"
 	"github.com/caioricciuti/ch-ui/internal/database"
 	"github.com/caioricciuti/ch-ui/internal/tunnel"
 )
@@ -28,6 +28,7 @@ type Syncer struct {
 	db             *database.DB
 	gateway        *tunnel.Gateway
 	secret         string
+	creds          *credentials.Resolver
 	activeSyncs    sync.Map     // connectionID → bool (prevents concurrent syncs per connection)
 	lastBorrowLog  sync.Map     // connectionID → time.Time (rate-limits credential borrow audit rows)
 	mu             sync.Mutex
@@ -42,6 +43,7 @@ func NewSyncer(store *Store, db *database.DB, gw *tunnel.Gateway, secret string)
 		db:      db,
 		gateway: gw,
 		secret:  secret,
+		creds:   credentials.NewResolver(db, secret),
 	}
 }
 
@@ -194,7 +196,7 @@ func (s *Syncer) backgroundTick() {
 			continue
 		}
 
-		// Borrow credentials from an active session
+		// Use the connection's service credential, or borrow a session's
 		creds, err := s.findCredentials(connID)
 		if err != nil {
 			slog.Debug("Governance sync: no credentials for connection",
@@ -271,28 +273,21 @@ func (s *Syncer) isSyncStale(connectionID string) bool {
 	return false
 }
 
-// findCredentials borrows credentials from an active session for the given connection.
-// It tries up to 3 recent sessions and returns the first one with a valid password.
+// findCredentials resolves the login to sync a connection with: its default
+// service credential or, if allowed, an active session's credentials.
 func (s *Syncer) findCredentials(connectionID string) (CHCredentials, error) {
-	sessions, err := s.db.GetActiveSessionsByConnection(connectionID, 3)
+	creds, err := s.creds.Resolve(connectionID, "")
 	if err != nil {
-		return CHCredentials{}, fmt.Errorf("failed to load sessions: %w", err)
+		return CHCredentials{}, err
 	}
-
-	for _, sess := range sessions {
-		password, err := crypto.Decrypt(sess.EncryptedPassword, s.secret)
-		if err != nil {
-			continue
-		}
-		s.auditCredentialBorrow(connectionID, sess)
-		return CHCredentials{
-			ConnectionID: connectionID,
-			User:         sess.ClickhouseUser,
-			Password:     password,
-		}, nil
+	if creds.Session != nil {
+		s.auditCredentialBorrow(connectionID, *creds.Session)
 	}
-
-	return CHCredentials{}, fmt.Errorf("no active sessions with valid credentials for connection %s", connectionID)
+	return CHCredentials{
+		ConnectionID: connectionID,
+		User:         creds.User,
+		Password:     creds.Password,
+	}, nil
 }
 
 // auditCredentialBorrow writes one audit row per connection per hour when the
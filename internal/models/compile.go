@@ -0,0 +1,195 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+// CompiledModel is what a run would do for one model.
+type CompiledModel struct {
+	ModelID         string   `json:"model_id"`
+	ModelName       string   `json:"model_name"`
+	Materialization string   `json:"materialization"`
+	ResolvedSQL     string   `json:"resolved_sql"`
+	DDL             []string `json:"ddl"`
+	Error           string   `json:"error,omitempty"`
+
+	// Dry-run fields, filled in when the query is checked against ClickHouse.
+	Columns    []ColumnDef    `json:"columns,omitempty"`
+	Deployed   bool           `json:"deployed"`
+	SchemaDiff []ColumnChange `json:"schema_diff,omitempty"`
+}
+
+// ColumnChange is a difference between a model's query and the columns of
+// its deployed target.
+type ColumnChange struct {
+	Column  string `json:"column"`
+	Change  string `json:"change"` // added, removed or type_changed
+	OldType string `json:"old_type,omitempty"`
+	NewType string `json:"new_type,omitempty"`
+}
+
+// Compile resolves every model of a connection in run order and returns the
+// SQL and DDL a run would execute. It changes nothing. With dryRun, each
+// query is also described in ClickHouse to catch type errors, the DDL is
+// planned against what is deployed and the query's columns are compared
+// with the deployed target's.
+func (r *Runner) Compile(connectionID string, dryRun bool) ([]CompiledModel, error) {
+	allModels, err := r.db.GetModelsByConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("load models: %w", err)
+	}
+	if len(allModels) == 0 {
+		return []CompiledModel{}, nil
+	}
+
+	dag, idToModel, modelTargets, err := r.buildDAG(allModels)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun && !r.gateway.IsTunnelOnline(connectionID) {
+		return nil, fmt.Errorf("tunnel not connected")
+	}
+	def := &defaultLogin{}
+
+	out := make([]CompiledModel, 0, len(dag.Order))
+	for _, id := range dag.Order {
+		m := idToModel[id]
+		c := CompiledModel{ModelID: m.ID, ModelName: m.Name, Materialization: m.Materialization}
+
+		resolvedSQL, err := ResolveRefs(m.SQLBody, modelTargets)
+		c.ResolvedSQL = resolvedSQL
+		if err != nil {
+			c.Error = err.Error()
+			out = append(out, c)
+			continue
+		}
+
+		if !dryRun {
+			c.DDL, err = compileDDL(m, resolvedSQL)
+		} else {
+			creds, credErr := r.modelLogin(connectionID, m, def)
+			if credErr != nil {
+				c.Error = fmt.Sprintf("no credentials: %v", credErr)
+				out = append(out, c)
+				continue
+			}
+			err = dryRunModel(r.runQuery(connectionID, creds.User, creds.Password), m, resolvedSQL, &c)
+		}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		if c.DDL == nil {
+			c.DDL = []string{}
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// compileDDL returns the DDL of a model's first build, without asking
+// ClickHouse what already exists.
+func compileDDL(m database.Model, resolvedSQL string) ([]string, error) {
+	sqlBody, err := ExpandMacros(resolvedSQL, m, false)
+	if err != nil {
+		return nil, err
+	}
+	switch m.Materialization {
+	case MaterializationTable:
+		return buildTableDDL(m, sqlBody, false, true), nil
+	case MaterializationIncremental:
+		return buildIncrementalDDL(m, sqlBody, false), nil
+	case MaterializationMaterializedView:
+		return buildMaterializedViewDDL(m, sqlBody), nil
+	case MaterializationDictionary:
+		// The dictionary's columns come from its query; a dry run
+		// describes it.
+		return []string{"-- dictionary DDL needs the query's columns; use a dry run to see it"}, nil
+	default:
+		return buildDDL(m, sqlBody), nil
+	}
+}
+
+// dryRunModel describes the model's query, plans its DDL against the
+// deployed objects and diffs the query's columns with the deployed target.
+// Only read-only queries are run.
+func dryRunModel(query queryFunc, m database.Model, resolvedSQL string, c *CompiledModel) error {
+	sqlBody, err := ExpandMacros(resolvedSQL, m, false)
+	if err != nil {
+		return err
+	}
+	cols, err := describeQuery(query, sqlBody)
+	if err != nil {
+		return err
+	}
+	c.Columns = cols
+
+	target, err := inspectTarget(query, m)
+	if err != nil {
+		return err
+	}
+	c.Deployed = target.Exists
+	if target.Exists {
+		deployed, err := deployedColumns(query, m)
+		if err != nil {
+			return err
+		}
+		c.SchemaDiff = diffColumns(deployed, cols)
+	}
+
+	c.DDL, err = planBuild(query, m, resolvedSQL)
+	return err
+}
+
+// deployedColumns lists the columns of a model's target in order.
+func deployedColumns(query queryFunc, m database.Model) ([]ColumnDef, error) {
+	rows, err := query(fmt.Sprintf(
+		"SELECT name, type FROM system.columns WHERE database = '%s' AND table = '%s' ORDER BY position",
+		escapeString(m.TargetDatabase), escapeString(m.Name),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("load deployed columns: %w", err)
+	}
+	cols := make([]ColumnDef, 0, len(rows))
+	for _, row := range rows {
+		var c ColumnDef
+		_ = json.Unmarshal(row["name"], &c.Name)
+		_ = json.Unmarshal(row["type"], &c.Type)
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// diffColumns compares deployed columns with the ones a query produces:
+// new columns first in query order, then removed and retyped ones in
+// deployed order.
+func diffColumns(deployed, next []ColumnDef) []ColumnChange {
+	old := make(map[string]string, len(deployed))
+	for _, c := range deployed {
+		old[c.Name] = c.Type
+	}
+	cur := make(map[string]string, len(next))
+	for _, c := range next {
+		cur[c.Name] = c.Type
+	}
+
+	var changes []ColumnChange
+	for _, c := range next {
+		if _, ok := old[c.Name]; !ok {
+			changes = append(changes, ColumnChange{Column: c.Name, Change: "added", NewType: c.Type})
+		}
+	}
+	for _, c := range deployed {
+		newType, ok := cur[c.Name]
+		switch {
+		case !ok:
+			changes = append(changes, ColumnChange{Column: c.Name, Change: "removed", OldType: c.Type})
+		case newType != c.Type:
+			changes = append(changes, ColumnChange{Column: c.Name, Change: "type_changed", OldType: c.Type, NewType: newType})
+		}
+	}
+	return changes
+}
@@ -151,3 +151,91 @@ func GetUpstreamDeps(modelID string, deps map[string][]string) map[string]bool {
 	walk(modelID)
 	return visited
 }
+
+// Walk visits the models in g.Order, calling build for each once all of its
+// upstreams within g.Order have finished. Up to parallelism builds run at
+// once. A model whose upstream failed or was skipped is not built; skip is
+// called for it instead. Dependencies outside g.Order count as built.
+func (g *DepGraph) Walk(parallelism int, build func(id string) bool, skip func(id string)) (succeeded, failed, skipped int) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	inOrder := make(map[string]bool, len(g.Order))
+	for _, id := range g.Order {
+		inOrder[id] = true
+	}
+	waiting := make(map[string]int, len(g.Order))
+	var ready []string
+	for _, id := range g.Order {
+		for _, dep := range g.Deps[id] {
+			if inOrder[dep] {
+				waiting[id]++
+			}
+		}
+		if waiting[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	// release queues the downstream models that id was the last wait of
+	release := func(id string) {
+		for _, down := range g.RevDeps[id] {
+			if !inOrder[down] {
+				continue
+			}
+			waiting[down]--
+			if waiting[down] == 0 {
+				ready = append(ready, down)
+			}
+		}
+	}
+
+	type outcome struct {
+		id string
+		ok bool
+	}
+	done := make(chan outcome)
+	bad := make(map[string]bool)
+	running := 0
+
+	for len(ready) > 0 || running > 0 {
+		for len(ready) > 0 && running < parallelism {
+			id := ready[0]
+			ready = ready[1:]
+
+			upstreamFailed := false
+			for _, dep := range g.Deps[id] {
+				if bad[dep] {
+					upstreamFailed = true
+					break
+				}
+			}
+			if upstreamFailed {
+				skipped++
+				bad[id] = true
+				skip(id)
+				release(id)
+				continue
+			}
+
+			running++
+			go func(id string) {
+				done <- outcome{id, build(id)}
+			}(id)
+		}
+		if running == 0 {
+			continue
+		}
+
+		o := <-done
+		running--
+		if o.ok {
+			succeeded++
+		} else {
+			failed++
+			bad[o.id] = true
+		}
+		release(o.id)
+	}
+	return succeeded, failed, skipped
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWalkParallel(t *testing.T) {
+	// a, b and c are independent; d reads a and b.
+	g, err := BuildDAG(
+		[]string{"a", "b", "c", "d"},
+		map[string][]string{"d": {"a_name", "b_name"}},
+		map[string]string{"a_name": "a", "b_name": "b"},
+	)
+	if err != nil {
+		t.Fatalf("BuildDAG: %v", err)
+	}
+
+	var mu sync.Mutex
+	finished := make(map[string]bool)
+	var active, peak int32
+	build := func(id string) bool {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		if id == "d" {
+			mu.Lock()
+			if !finished["a"] || !finished["b"] {
+				t.Error("d started before its upstreams finished")
+			}
+			mu.Unlock()
+		}
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		finished[id] = true
+		mu.Unlock()
+		atomic.AddInt32(&active, -1)
+		return true
+	}
+
+	succeeded, failed, skipped := g.Walk(2, build, func(string) { t.Error("nothing should be skipped") })
+	if succeeded != 4 || failed != 0 || skipped != 0 {
+		t.Fatalf("got %d/%d/%d, want 4/0/0", succeeded, failed, skipped)
+	}
+	if peak != 2 {
+		t.Fatalf("peak concurrency = %d, want 2", peak)
+	}
+}
+
+func TestWalkSkipsDownstreamOfFailure(t *testing.T) {
+	// a -> b -> c, and d on its own.
+	g, err := BuildDAG(
+		[]string{"a", "b", "c", "d"},
+		map[string][]string{"b": {"a"}, "c": {"b"}},
+		map[string]string{"a": "a", "b": "b", "c": "c", "d": "d"},
+	)
+	if err != nil {
+		t.Fatalf("BuildDAG: %v", err)
+	}
+
+	var mu sync.Mutex
+	var skippedIDs []string
+	succeeded, failed, skipped := g.Walk(4,
+		func(id string) bool { return id != "a" },
+		func(id string) {
+			mu.Lock()
+			skippedIDs = append(skippedIDs, id)
+			mu.Unlock()
+		},
+	)
+	if succeeded != 1 || failed != 1 || skipped != 2 {
+		t.Fatalf("got %d/%d/%d, want 1/1/2", succeeded, failed, skipped)
+	}
+	if len(skippedIDs) != 2 || skippedIDs[0] != "b" || skippedIDs[1] != "c" {
+		t.Fatalf("skipped %v, want [b c]", skippedIDs)
+	}
+}
+
+func TestWalkIgnoresDepsOutsideOrder(t *testing.T) {
+	g, err := BuildDAG([]string{"a", "b"}, map[string][]string{"b": {"a"}}, map[string]string{"a": "a"})
+	if err != nil {
+		t.Fatalf("BuildDAG: %v", err)
+	}
+	g.Order = []string{"b"}
+
+	succeeded, _, _ := g.Walk(1, func(string) bool { return true }, func(string) {})
+	if succeeded != 1 {
+		t.Fatal("a dependency outside the run must not block the model")
+	}
+}
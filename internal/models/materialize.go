@@ -0,0 +1,539 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+// Materializations a model can be built as.
+const (
+	MaterializationView             = "view"
+	MaterializationTable            = "table"
+	MaterializationIncremental      = "incremental"
+	MaterializationMaterializedView = "materialized_view"
+	MaterializationDictionary       = "dictionary"
+)
+
+const (
+	defaultDictionaryLifetime = "MIN 300 MAX 360"
+	// mvCommentPrefix marks materialized views built by a model; the rest of
+	// the comment is a fingerprint of the definition.
+	mvCommentPrefix = "ch-ui:"
+
+	// A table model is built into its shadow table and swapped in; the
+	// version it replaces is kept as the previous table for a rollback.
+	shadowSuffix   = "__shadow"
+	previousSuffix = "__previous"
+	stagingSuffix  = "__incremental"
+)
+
+// ValidateMaterialization checks a model's materialization and the options
+// it needs.
+func ValidateMaterialization(materialization string, opts database.ModelOptions) error {
+	switch materialization {
+	case MaterializationView, MaterializationTable, MaterializationIncremental, MaterializationMaterializedView:
+		return nil
+	case MaterializationDictionary:
+		if strings.TrimSpace(opts.UniqueKey) == "" {
+			return fmt.Errorf("dictionary models need a unique_key for the dictionary's primary key")
+		}
+		return nil
+	default:
+		return fmt.Errorf("materialization must be one of view, table, incremental, materialized_view or dictionary")
+	}
+}
+
+// UsesTableEngine reports whether a materialization stores rows in a table
+// with an engine and ORDER BY.
+func UsesTableEngine(materialization string) bool {
+	switch materialization {
+	case MaterializationTable, MaterializationIncremental, MaterializationMaterializedView:
+		return true
+	}
+	return false
+}
+
+var (
+	isIncrementalPattern = regexp.MustCompile(`\$is_incremental\(\s*\)`)
+	thisPattern          = regexp.MustCompile(`\$this\(\s*\)`)
+	ifIncrementalToken   = "$if_incremental("
+)
+
+// ExpandMacros replaces the incremental macros in a resolved SQL body:
+//
+//	$this()               the model's own target table
+//	$is_incremental()     1 when new rows are added to an existing table, else 0
+//	$if_incremental(...)  the enclosed SQL on incremental runs, nothing otherwise
+//
+// A typical incremental filter is
+// $if_incremental(WHERE ts > (SELECT max(ts) FROM $this())).
+func ExpandMacros(sqlBody string, m database.Model, incremental bool) (string, error) {
+	out, err := expandIfIncremental(sqlBody, incremental)
+	if err != nil {
+		return "", err
+	}
+	flag := "0"
+	if incremental {
+		flag = "1"
+	}
+	out = isIncrementalPattern.ReplaceAllString(out, flag)
+	out = thisPattern.ReplaceAllLiteralString(out, quoteTarget(m.TargetDatabase, m.Name))
+	return out, nil
+}
+
+// expandIfIncremental replaces every $if_incremental(...) block, matching
+// parentheses outside of string literals.
+func expandIfIncremental(sqlBody string, incremental bool) (string, error) {
+	var b strings.Builder
+	rest := sqlBody
+	for {
+		idx := strings.Index(rest, ifIncrementalToken)
+		if idx < 0 {
+			b.WriteString(rest)
+			return b.String(), nil
+		}
+		b.WriteString(rest[:idx])
+		body := rest[idx+len(ifIncrementalToken):]
+		end := matchingParen(body)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated $if_incremental(")
+		}
+		if incremental {
+			b.WriteString(body[:end])
+		}
+		rest = body[end+1:]
+	}
+}
+
+// matchingParen returns the index of the parenthesis closing an already
+// opened one, skipping quoted strings and identifiers, or -1.
+func matchingParen(s string) int {
+	depth := 1
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// targetState is what currently exists at a model's target.
+type targetState struct {
+	Exists  bool
+	Engine  string
+	Comment string
+}
+
+// ColumnDef is a column of a model's SELECT or of a deployed target.
+type ColumnDef struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// queryFunc runs a query for the model being built and returns its result
+// rows.
+type queryFunc func(sql string) ([]map[string]json.RawMessage, error)
+
+// inspectTarget looks up the model's target in system.tables.
+func inspectTarget(query queryFunc, m database.Model) (targetState, error) {
+	return inspectTable(query, m.TargetDatabase, m.Name)
+}
+
+// inspectTable looks up a table in system.tables.
+func inspectTable(query queryFunc, db, name string) (targetState, error) {
+	rows, err := query(fmt.Sprintf(
+		"SELECT engine, comment FROM system.tables WHERE database = '%s' AND name = '%s'",
+		escapeString(db), escapeString(name),
+	))
+	if err != nil {
+		return targetState{}, fmt.Errorf("inspect %s: %w", name, err)
+	}
+	if len(rows) == 0 {
+		return targetState{}, nil
+	}
+	st := targetState{Exists: true}
+	_ = json.Unmarshal(rows[0]["engine"], &st.Engine)
+	_ = json.Unmarshal(rows[0]["comment"], &st.Comment)
+	return st, nil
+}
+
+// supportsExchange reports whether a database can swap tables atomically
+// with EXCHANGE TABLES, which only Atomic databases (and their replicated
+// variant) implement.
+func supportsExchange(query queryFunc, db string) (bool, error) {
+	rows, err := query(fmt.Sprintf("SELECT engine FROM system.databases WHERE name = '%s'", escapeString(db)))
+	if err != nil {
+		return false, fmt.Errorf("inspect database: %w", err)
+	}
+	if len(rows) == 0 {
+		return false, fmt.Errorf("database %s does not exist", db)
+	}
+	var engine string
+	_ = json.Unmarshal(rows[0]["engine"], &engine)
+	return engine == "Atomic" || engine == "Replicated", nil
+}
+
+// describeQuery returns the columns a SELECT produces.
+func describeQuery(query queryFunc, sqlBody string) ([]ColumnDef, error) {
+	rows, err := query(fmt.Sprintf("DESCRIBE (%s)", sqlBody))
+	if err != nil {
+		return nil, fmt.Errorf("describe model query: %w", err)
+	}
+	cols := make([]ColumnDef, 0, len(rows))
+	for _, row := range rows {
+		var c ColumnDef
+		_ = json.Unmarshal(row["name"], &c.Name)
+		_ = json.Unmarshal(row["type"], &c.Type)
+		if c.Name != "" {
+			cols = append(cols, c)
+		}
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("model query returns no columns")
+	}
+	return cols, nil
+}
+
+// planBuild returns the statements that build a model. It queries
+// ClickHouse where the statements depend on what already exists. An empty
+// plan means the target is up to date.
+func planBuild(query queryFunc, m database.Model, resolvedSQL string) ([]string, error) {
+	switch m.Materialization {
+	case MaterializationIncremental:
+		target, err := inspectTarget(query, m)
+		if err != nil {
+			return nil, err
+		}
+		sqlBody, err := ExpandMacros(resolvedSQL, m, target.Exists)
+		if err != nil {
+			return nil, err
+		}
+		return buildIncrementalDDL(m, sqlBody, target.Exists), nil
+
+	case MaterializationMaterializedView:
+		sqlBody, err := ExpandMacros(resolvedSQL, m, false)
+		if err != nil {
+			return nil, err
+		}
+		target, err := inspectTarget(query, m)
+		if err != nil {
+			return nil, err
+		}
+		if target.Exists && target.Comment == materializedViewComment(m, sqlBody) {
+			return nil, nil
+		}
+		return buildMaterializedViewDDL(m, sqlBody), nil
+
+	case MaterializationDictionary:
+		sqlBody, err := ExpandMacros(resolvedSQL, m, false)
+		if err != nil {
+			return nil, err
+		}
+		cols, err := describeQuery(query, sqlBody)
+		if err != nil {
+			return nil, err
+		}
+		stmt, err := buildDictionaryDDL(m, sqlBody, cols)
+		if err != nil {
+			return nil, err
+		}
+		return []string{stmt}, nil
+
+	case MaterializationTable:
+		sqlBody, err := ExpandMacros(resolvedSQL, m, false)
+		if err != nil {
+			return nil, err
+		}
+		target, err := inspectTarget(query, m)
+		if err != nil {
+			return nil, err
+		}
+		exchange, err := supportsExchange(query, m.TargetDatabase)
+		if err != nil {
+			return nil, err
+		}
+		// EXCHANGE swaps two tables; a view being replaced by a table is
+		// renamed instead.
+		exchange = exchange && target.Engine != "View" && target.Engine != "MaterializedView"
+		return buildTableDDL(m, sqlBody, target.Exists, exchange), nil
+
+	default:
+		sqlBody, err := ExpandMacros(resolvedSQL, m, false)
+		if err != nil {
+			return nil, err
+		}
+		return buildDDL(m, sqlBody), nil
+	}
+}
+
+// cleanupDDL drops the scratch tables a failed build of m may leave behind.
+func cleanupDDL(m database.Model) []string {
+	switch m.Materialization {
+	case MaterializationTable:
+		return []string{fmt.Sprintf("DROP TABLE IF EXISTS %s", quoteTarget(m.TargetDatabase, m.Name+shadowSuffix))}
+	case MaterializationIncremental:
+		return []string{fmt.Sprintf("DROP TABLE IF EXISTS %s", quoteTarget(m.TargetDatabase, m.Name+stagingSuffix))}
+	}
+	return nil
+}
+
+// tableClauses renders the ENGINE, PARTITION BY and ORDER BY clauses of a
+// table-backed model.
+func tableClauses(m database.Model) string {
+	engine := m.TableEngine
+	if engine == "" {
+		engine = "MergeTree"
+	}
+	orderBy := m.OrderBy
+	if orderBy == "" {
+		orderBy = "tuple()"
+	}
+	clauses := "ENGINE = " + engine
+	if p := strings.TrimSpace(m.PartitionBy); p != "" {
+		clauses += " PARTITION BY " + p
+	}
+	return clauses + " ORDER BY " + orderBy
+}
+
+// buildIncrementalDDL creates the target on the first run. Later runs stage
+// the new rows and, with a unique key or partition expression, delete the
+// target rows they replace before inserting them; otherwise they append.
+func buildIncrementalDDL(m database.Model, sqlBody string, exists bool) []string {
+	target := quoteTarget(m.TargetDatabase, m.Name)
+	if !exists {
+		return []string{fmt.Sprintf("CREATE TABLE %s %s AS %s", target, tableClauses(m), sqlBody)}
+	}
+
+	key := strings.TrimSpace(m.UniqueKey)
+	if key == "" {
+		key = strings.TrimSpace(m.PartitionBy)
+	}
+	if key == "" {
+		return []string{fmt.Sprintf("INSERT INTO %s %s", target, sqlBody)}
+	}
+
+	staging := quoteTarget(m.TargetDatabase, m.Name+stagingSuffix)
+	return []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", staging),
+		fmt.Sprintf("CREATE TABLE %s AS %s", staging, target),
+		fmt.Sprintf("INSERT INTO %s %s", staging, sqlBody),
+		fmt.Sprintf("DELETE FROM %s WHERE (%s) IN (SELECT %s FROM %s)", target, key, key, staging),
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", target, staging),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", staging),
+	}
+}
+
+// materializedViewComment fingerprints a materialized view definition so an
+// unchanged view is not dropped and repopulated on every run.
+func materializedViewComment(m database.Model, sqlBody string) string {
+	sum := sha256.Sum256([]byte(tableClauses(m) + "\n" + sqlBody))
+	return mvCommentPrefix + hex.EncodeToString(sum[:8])
+}
+
+// buildMaterializedViewDDL recreates a materialized view, backfilling it from
+// the rows already in its source tables.
+func buildMaterializedViewDDL(m database.Model, sqlBody string) []string {
+	target := quoteTarget(m.TargetDatabase, m.Name)
+	return []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", target),
+		fmt.Sprintf("CREATE MATERIALIZED VIEW %s %s POPULATE AS %s COMMENT '%s'",
+			target, tableClauses(m), sqlBody, materializedViewComment(m, sqlBody)),
+	}
+}
+
+// buildDictionaryDDL creates or replaces a dictionary loaded by the model's
+// query.
+func buildDictionaryDDL(m database.Model, sqlBody string, cols []ColumnDef) (string, error) {
+	keys := splitKey(m.UniqueKey)
+	if len(keys) == 0 {
+		return "", fmt.Errorf("dictionary models need a unique_key")
+	}
+	types := make(map[string]string, len(cols))
+	for _, c := range cols {
+		types[c.Name] = c.Type
+	}
+	for _, k := range keys {
+		if _, ok := types[k]; !ok {
+			return "", fmt.Errorf("dictionary key %q is not a column of the model query", k)
+		}
+	}
+
+	defs := make([]string, 0, len(cols))
+	for _, c := range cols {
+		defs = append(defs, fmt.Sprintf("`%s` %s", c.Name, c.Type))
+	}
+
+	layout := strings.TrimSpace(m.Layout)
+	if layout == "" {
+		// HASHED needs a single UInt64 key; anything else is a complex key.
+		layout = "COMPLEX_KEY_HASHED"
+		if len(keys) == 1 && types[keys[0]] == "UInt64" {
+			layout = "HASHED"
+		}
+	}
+	if !strings.Contains(layout, "(") {
+		layout = strings.ToUpper(layout) + "()"
+	}
+
+	lifetime := strings.TrimSpace(m.Lifetime)
+	if lifetime == "" {
+		lifetime = defaultDictionaryLifetime
+	}
+
+	return fmt.Sprintf(
+		"CREATE OR REPLACE DICTIONARY %s (%s) PRIMARY KEY %s SOURCE(CLICKHOUSE(QUERY '%s')) LAYOUT(%s) LIFETIME(%s)",
+		quoteTarget(m.TargetDatabase, m.Name),
+		strings.Join(defs, ", "),
+		strings.Join(quoteIdents(keys), ", "),
+		escapeString(sqlBody),
+		layout,
+		lifetime,
+	), nil
+}
+
+// buildTableDDL rebuilds a table model without readers ever seeing it
+// missing or half-filled: the new version is created in a shadow table and
+// only swapped in once it is complete. The replaced version is kept as the
+// previous table. Without EXCHANGE support the swap is a multi-table RENAME,
+// which is not atomic but leaves the target missing only momentarily.
+func buildTableDDL(m database.Model, sqlBody string, exists, exchange bool) []string {
+	shadow := quoteTarget(m.TargetDatabase, m.Name+shadowSuffix)
+	previous := quoteTarget(m.TargetDatabase, m.Name+previousSuffix)
+
+	stmts := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", shadow),
+		fmt.Sprintf("CREATE TABLE %s %s AS %s", shadow, tableClauses(m), sqlBody),
+	}
+	if !exists {
+		return append(stmts, tableSwapDDL(m, exists, exchange))
+	}
+	stmts = append(stmts,
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", previous),
+		tableSwapDDL(m, exists, exchange),
+	)
+	if exchange {
+		stmts = append(stmts, fmt.Sprintf("RENAME TABLE %s TO %s", shadow, previous))
+	}
+	return stmts
+}
+
+// tableSwapDDL is the statement of a table build that puts the new version
+// in place of the target.
+func tableSwapDDL(m database.Model, exists, exchange bool) string {
+	target := quoteTarget(m.TargetDatabase, m.Name)
+	shadow := quoteTarget(m.TargetDatabase, m.Name+shadowSuffix)
+	previous := quoteTarget(m.TargetDatabase, m.Name+previousSuffix)
+	switch {
+	case !exists:
+		return fmt.Sprintf("RENAME TABLE %s TO %s", shadow, target)
+	case exchange:
+		return fmt.Sprintf("EXCHANGE TABLES %s AND %s", shadow, target)
+	default:
+		return fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", target, previous, shadow, target)
+	}
+}
+
+// isSwapDDL reports whether stmt is the swap of a table build. Once it has
+// run the new version is live, and the shadow table holds the replaced one.
+func isSwapDDL(m database.Model, stmt string) bool {
+	if m.Materialization != MaterializationTable {
+		return false
+	}
+	return stmt == tableSwapDDL(m, false, false) ||
+		stmt == tableSwapDDL(m, true, true) ||
+		stmt == tableSwapDDL(m, true, false)
+}
+
+// buildRollbackDDL swaps a table model with its previous version. Running it
+// twice restores the newer version.
+func buildRollbackDDL(m database.Model, exchange bool) []string {
+	target := quoteTarget(m.TargetDatabase, m.Name)
+	shadow := quoteTarget(m.TargetDatabase, m.Name+shadowSuffix)
+	previous := quoteTarget(m.TargetDatabase, m.Name+previousSuffix)
+	if exchange {
+		return []string{fmt.Sprintf("EXCHANGE TABLES %s AND %s", previous, target)}
+	}
+	return []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", shadow),
+		fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s, %s TO %s", target, shadow, previous, target, shadow, previous),
+	}
+}
+
+// buildDDL generates the DDL statement for a view model.
+func buildDDL(m database.Model, resolvedSQL string) []string {
+	return []string{
+		fmt.Sprintf("CREATE OR REPLACE VIEW `%s`.`%s` AS %s",
+			m.TargetDatabase, m.Name, resolvedSQL),
+	}
+}
+
+// runQuery executes a query and decodes its rows.
+func (r *Runner) runQuery(connectionID, user, password string) queryFunc {
+	return func(sql string) ([]map[string]json.RawMessage, error) {
+		result, err := r.gateway.ExecuteQuery(connectionID, sql, user, password, time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil || len(result.Data) == 0 {
+			return nil, nil
+		}
+		var rows []map[string]json.RawMessage
+		if err := json.Unmarshal(result.Data, &rows); err != nil {
+			return nil, fmt.Errorf("decode query result: %w", err)
+		}
+		return rows, nil
+	}
+}
+
+func quoteTarget(database, name string) string {
+	return fmt.Sprintf("`%s`.`%s`", database, name)
+}
+
+func quoteIdents(names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = "`" + n + "`"
+	}
+	return out
+}
+
+// splitKey splits a comma-separated key into column names.
+func splitKey(key string) []string {
+	var out []string
+	for _, part := range strings.Split(key, ",") {
+		part = strings.Trim(strings.TrimSpace(part), "`")
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func escapeString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
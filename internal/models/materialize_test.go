@@ -0,0 +1,190 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+func TestExpandMacros(t *testing.T) {
+	m := database.Model{Name: "events", TargetDatabase: "analytics"}
+	sql := "SELECT * FROM raw WHERE $is_incremental() = 0 OR id > 0 $if_incremental(AND ts > (SELECT max(ts) FROM $this()) AND note != ')')"
+
+	full, err := ExpandMacros(sql, m, false)
+	if err != nil {
+		t.Fatalf("ExpandMacros: %v", err)
+	}
+	if want := "SELECT * FROM raw WHERE 0 = 0 OR id > 0 "; full != want {
+		t.Fatalf("full run = %q, want %q", full, want)
+	}
+
+	inc, err := ExpandMacros(sql, m, true)
+	if err != nil {
+		t.Fatalf("ExpandMacros: %v", err)
+	}
+	if want := "SELECT * FROM raw WHERE 1 = 0 OR id > 0 AND ts > (SELECT max(ts) FROM `analytics`.`events`) AND note != ')'"; inc != want {
+		t.Fatalf("incremental run = %q, want %q", inc, want)
+	}
+
+	if _, err := ExpandMacros("SELECT 1 $if_incremental(WHERE (x", m, true); err == nil {
+		t.Fatal("expected error for an unterminated block")
+	}
+}
+
+func TestBuildIncrementalDDL(t *testing.T) {
+	m := database.Model{Name: "events", TargetDatabase: "db", Materialization: MaterializationIncremental}
+
+	first := buildIncrementalDDL(m, "SELECT 1", false)
+	if len(first) != 1 || first[0] != "CREATE TABLE `db`.`events` ENGINE = MergeTree ORDER BY tuple() AS SELECT 1" {
+		t.Fatalf("first run = %v", first)
+	}
+
+	appendOnly := buildIncrementalDDL(m, "SELECT 1", true)
+	if len(appendOnly) != 1 || appendOnly[0] != "INSERT INTO `db`.`events` SELECT 1" {
+		t.Fatalf("append run = %v", appendOnly)
+	}
+
+	m.UniqueKey = "id"
+	m.PartitionBy = "toYYYYMM(ts)"
+	keyed := buildIncrementalDDL(m, "SELECT 1", true)
+	if !contains(keyed, "DELETE FROM `db`.`events` WHERE (id) IN (SELECT id FROM `db`.`events__incremental`)") {
+		t.Fatalf("unique key must win over partition: %v", keyed)
+	}
+	if keyed[len(keyed)-1] != "DROP TABLE IF EXISTS `db`.`events__incremental`" {
+		t.Fatalf("staging table not dropped: %v", keyed)
+	}
+}
+
+func TestBuildTableDDL(t *testing.T) {
+	m := database.Model{Name: "daily", TargetDatabase: "db", Materialization: MaterializationTable}
+
+	first := buildTableDDL(m, "SELECT 1", false, true)
+	if first[len(first)-1] != "RENAME TABLE `db`.`daily__shadow` TO `db`.`daily`" {
+		t.Fatalf("first build = %v", first)
+	}
+
+	swap := buildTableDDL(m, "SELECT 1", true, true)
+	want := []string{
+		"DROP TABLE IF EXISTS `db`.`daily__shadow`",
+		"CREATE TABLE `db`.`daily__shadow` ENGINE = MergeTree ORDER BY tuple() AS SELECT 1",
+		"DROP TABLE IF EXISTS `db`.`daily__previous`",
+		"EXCHANGE TABLES `db`.`daily__shadow` AND `db`.`daily`",
+		"RENAME TABLE `db`.`daily__shadow` TO `db`.`daily__previous`",
+	}
+	if strings.Join(swap, ";") != strings.Join(want, ";") {
+		t.Fatalf("rebuild = %v", swap)
+	}
+	for _, stmt := range swap {
+		if strings.HasPrefix(stmt, "DROP TABLE IF EXISTS `db`.`daily`") {
+			t.Fatalf("the target must never be dropped: %v", swap)
+		}
+	}
+
+	rename := buildTableDDL(m, "SELECT 1", true, false)
+	if rename[len(rename)-1] != "RENAME TABLE `db`.`daily` TO `db`.`daily__previous`, `db`.`daily__shadow` TO `db`.`daily`" {
+		t.Fatalf("rename fallback = %v", rename)
+	}
+
+	for _, stmts := range [][]string{first, swap, rename} {
+		var swaps int
+		for _, stmt := range stmts {
+			if isSwapDDL(m, stmt) {
+				swaps++
+			}
+		}
+		if swaps != 1 {
+			t.Fatalf("expected exactly one swap statement in %v", stmts)
+		}
+	}
+	if isSwapDDL(m, swap[len(swap)-1]) {
+		t.Fatal("renaming the replaced version is not the swap")
+	}
+
+	if rb := buildRollbackDDL(m, true); len(rb) != 1 || rb[0] != "EXCHANGE TABLES `db`.`daily__previous` AND `db`.`daily`" {
+		t.Fatalf("rollback = %v", rb)
+	}
+}
+
+func TestPlanBuildMaterializedView(t *testing.T) {
+	m := database.Model{Name: "mv", TargetDatabase: "db", Materialization: MaterializationMaterializedView}
+	var comment string
+	query := func(sql string) ([]map[string]json.RawMessage, error) {
+		if comment == "" {
+			return nil, nil
+		}
+		c, _ := json.Marshal(comment)
+		return []map[string]json.RawMessage{{"engine": json.RawMessage(`"MaterializedView"`), "comment": c}}, nil
+	}
+
+	stmts, err := planBuild(query, m, "SELECT 1")
+	if err != nil || len(stmts) != 2 || !strings.Contains(stmts[1], "POPULATE AS SELECT 1") {
+		t.Fatalf("first build = %v, %v", stmts, err)
+	}
+
+	comment = materializedViewComment(m, "SELECT 1")
+	if stmts, _ := planBuild(query, m, "SELECT 1"); len(stmts) != 0 {
+		t.Fatalf("unchanged view must not be rebuilt: %v", stmts)
+	}
+	if stmts, _ := planBuild(query, m, "SELECT 2"); len(stmts) != 2 {
+		t.Fatalf("changed view must be rebuilt: %v", stmts)
+	}
+}
+
+func TestBuildDictionaryDDL(t *testing.T) {
+	m := database.Model{Name: "users", TargetDatabase: "db", Materialization: MaterializationDictionary}
+	m.UniqueKey = "id"
+	cols := []ColumnDef{{Name: "id", Type: "UInt64"}, {Name: "name", Type: "String"}}
+
+	got, err := buildDictionaryDDL(m, "SELECT id, name FROM t WHERE name != 'x'", cols)
+	if err != nil {
+		t.Fatalf("buildDictionaryDDL: %v", err)
+	}
+	want := "CREATE OR REPLACE DICTIONARY `db`.`users` (`id` UInt64, `name` String) PRIMARY KEY `id` " +
+		`SOURCE(CLICKHOUSE(QUERY 'SELECT id, name FROM t WHERE name != \'x\'')) LAYOUT(HASHED()) LIFETIME(MIN 300 MAX 360)`
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	m.UniqueKey = "name"
+	if got, _ := buildDictionaryDDL(m, "SELECT 1", cols); !strings.Contains(got, "LAYOUT(COMPLEX_KEY_HASHED())") {
+		t.Fatalf("string key needs a complex key layout: %s", got)
+	}
+	m.UniqueKey = "missing"
+	if _, err := buildDictionaryDDL(m, "SELECT 1", cols); err == nil {
+		t.Fatal("expected error for a key that is not a column")
+	}
+}
+
+func contains(stmts []string, want string) bool {
+	for _, s := range stmts {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDiffColumns(t *testing.T) {
+	deployed := []ColumnDef{{Name: "id", Type: "UInt64"}, {Name: "amount", Type: "Float32"}, {Name: "legacy", Type: "String"}}
+	next := []ColumnDef{{Name: "id", Type: "UInt64"}, {Name: "amount", Type: "Float64"}, {Name: "currency", Type: "String"}}
+
+	got := diffColumns(deployed, next)
+	want := []ColumnChange{
+		{Column: "currency", Change: "added", NewType: "String"},
+		{Column: "amount", Change: "type_changed", OldType: "Float32", NewType: "Float64"},
+		{Column: "legacy", Change: "removed", OldType: "String"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("change %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if diffColumns(next, next) != nil {
+		t.Fatal("identical schemas have no changes")
+	}
+}
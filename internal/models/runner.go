@@ -3,10 +3,11 @@ package models
 import (
 	"fmt"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/credentials"
 	"github.com/caioricciuti/ch-ui/internal/database"
 	"github.com/caioricciuti/ch-ui/internal/tunnel"
 )
@@ -16,8 +17,11 @@ type Runner struct {
 	db      *database.DB
 	gateway *tunnel.Gateway
 	secret  string
+	creds   *credentials.Resolver
 	mu      sync.Mutex // prevents concurrent runs per connection
 	running map[string]bool
+
+	onModelComplete func(modelID, status string)
 }
 
 // NewRunner creates a new model runner.
@@ -26,10 +30,17 @@ func NewRunner(db *database.DB, gw *tunnel.Gateway, secret string) *Runner {
 		db:      db,
 		gateway: gw,
 		secret:  secret,
+		creds:   credentials.NewResolver(db, secret),
 		running: make(map[string]bool),
 	}
 }
 
+// OnModelComplete registers fn to be called after each model of a run is
+// built, fails or is skipped. It must be set before any run starts.
+func (r *Runner) OnModelComplete(fn func(modelID, status string)) {
+	r.onModelComplete = fn
+}
+
 // RunAll executes all models for a connection in dependency order.
 func (r *Runner) RunAll(connectionID, triggeredBy string) (string, error) {
 	if err := r.acquireLock(connectionID); err != nil {
@@ -41,11 +52,6 @@ func (r *Runner) RunAll(connectionID, triggeredBy string) (string, error) {
 		return "", fmt.Errorf("tunnel not connected")
 	}
 
-	user, password, err := r.findCredentials(connectionID)
-	if err != nil {
-		return "", fmt.Errorf("no credentials: %w", err)
-	}
-
 	allModels, err := r.db.GetModelsByConnection(connectionID)
 	if err != nil {
 		return "", fmt.Errorf("load models: %w", err)
@@ -59,7 +65,7 @@ func (r *Runner) RunAll(connectionID, triggeredBy string) (string, error) {
 		return "", err
 	}
 
-	return r.execute(connectionID, triggeredBy, dag, idToModel, modelTargets, user, password)
+	return r.execute(connectionID, triggeredBy, dag, idToModel, modelTargets)
 }
 
 // RunPipeline executes only the connected component containing anchorModelID.
@@ -73,11 +79,6 @@ func (r *Runner) RunPipeline(connectionID, anchorModelID, triggeredBy string) (s
 		return "", fmt.Errorf("tunnel not connected")
 	}
 
-	user, password, err := r.findCredentials(connectionID)
-	if err != nil {
-		return "", fmt.Errorf("no credentials: %w", err)
-	}
-
 	allModels, err := r.db.GetModelsByConnection(connectionID)
 	if err != nil {
 		return "", fmt.Errorf("load models: %w", err)
@@ -97,7 +98,7 @@ func (r *Runner) RunPipeline(connectionID, anchorModelID, triggeredBy string) (s
 	}
 
 	dag.Order = component
-	return r.execute(connectionID, triggeredBy, dag, idToModel, modelTargets, user, password)
+	return r.execute(connectionID, triggeredBy, dag, idToModel, modelTargets)
 }
 
 // RunSingle executes a single model and its upstream dependencies.
@@ -111,11 +112,6 @@ func (r *Runner) RunSingle(connectionID, modelID, triggeredBy string) (string, e
 		return "", fmt.Errorf("tunnel not connected")
 	}
 
-	user, password, err := r.findCredentials(connectionID)
-	if err != nil {
-		return "", fmt.Errorf("no credentials: %w", err)
-	}
-
 	allModels, err := r.db.GetModelsByConnection(connectionID)
 	if err != nil {
 		return "", fmt.Errorf("load models: %w", err)
@@ -138,7 +134,7 @@ func (r *Runner) RunSingle(connectionID, modelID, triggeredBy string) (string, e
 	}
 	dag.Order = filteredIDs
 
-	return r.execute(connectionID, triggeredBy, dag, idToModel, modelTargets, user, password)
+	return r.execute(connectionID, triggeredBy, dag, idToModel, modelTargets)
 }
 
 // Validate checks all models for reference errors and cycles.
@@ -160,6 +156,29 @@ func (r *Runner) Validate(connectionID string) ([]ValidationError, error) {
 	refsByID := make(map[string][]string)
 
 	for _, m := range allModels {
+		if err := ValidateMaterialization(m.Materialization, m.ModelOptions); err != nil {
+			errors = append(errors, ValidationError{
+				ModelID:   m.ID,
+				ModelName: m.Name,
+				Error:     err.Error(),
+			})
+		}
+		if _, err := NormalizeTests(m.Tests); err != nil {
+			errors = append(errors, ValidationError{
+				ModelID:   m.ID,
+				ModelName: m.Name,
+				Error:     err.Error(),
+			})
+		}
+		for _, t := range m.Tests {
+			if t.Type == TestRelationships && nameToID[t.To] == "" {
+				errors = append(errors, ValidationError{
+					ModelID:   m.ID,
+					ModelName: m.Name,
+					Error:     fmt.Sprintf("relationships test points to unknown model %q", t.To),
+				})
+			}
+		}
 		refs := ExtractRefs(m.SQLBody)
 		refsByID[m.ID] = refs
 		for _, ref := range refs {
@@ -232,7 +251,7 @@ func (r *Runner) buildDAG(allModels []database.Model) (*DepGraph, map[string]dat
 	return dag, idToModel, modelTargets, nil
 }
 
-func (r *Runner) execute(connectionID, triggeredBy string, dag *DepGraph, idToModel map[string]database.Model, modelTargets map[string]string, user, password string) (string, error) {
+func (r *Runner) execute(connectionID, triggeredBy string, dag *DepGraph, idToModel map[string]database.Model, modelTargets map[string]string) (string, error) {
 	runID, err := r.db.CreateModelRun(connectionID, len(dag.Order), triggeredBy)
 	if err != nil {
 		return "", fmt.Errorf("create run: %w", err)
@@ -246,98 +265,216 @@ func (r *Runner) execute(connectionID, triggeredBy string, dag *DepGraph, idToMo
 		}
 	}
 
-	// Execute in topological order
-	failed := make(map[string]bool)
-	var succeeded, failedCount, skipped int
+	// Build models as soon as their upstreams are done, up to the
+	// connection's parallelism
+	parallelism := r.db.GetModelParallelism(connectionID)
+	def := &defaultLogin{}
+	succeeded, failedCount, skipped := dag.Walk(parallelism,
+		func(id string) bool {
+			return r.buildModel(runID, connectionID, idToModel[id], modelTargets, def)
+		},
+		func(id string) {
+			r.db.UpdateModelRunResult(runID, id, "skipped", "", 0, "upstream dependency failed")
+			r.db.UpdateModelStatus(id, "error", "upstream dependency failed")
+			r.notifyModel(id, "skipped")
+		},
+	)
 
-	for _, id := range dag.Order {
-		m := idToModel[id]
+	// Finalize run
+	runStatus := "success"
+	if failedCount > 0 && succeeded > 0 {
+		runStatus = "partial"
+	} else if failedCount > 0 || skipped == len(dag.Order) {
+		runStatus = "error"
+	}
+	r.db.FinalizeModelRun(runID, runStatus, succeeded, failedCount, skipped)
 
-		// Skip if any upstream dependency failed
-		shouldSkip := false
-		for _, depID := range dag.Deps[id] {
-			if failed[depID] {
-				shouldSkip = true
-				break
-			}
-		}
+	return runID, nil
+}
 
-		if shouldSkip {
-			skipped++
-			failed[id] = true
-			r.db.UpdateModelRunResult(runID, id, "skipped", "", 0, "upstream dependency failed")
-			r.db.UpdateModelStatus(id, "error", "upstream dependency failed")
-			continue
-		}
+// defaultLogin resolves a connection's default login on first use, so a run
+// whose models all have their own service credential never needs one.
+type defaultLogin struct {
+	once  sync.Once
+	creds credentials.Credentials
+	err   error
+}
 
-		// Resolve $ref()
-		resolvedSQL, resolveErr := ResolveRefs(m.SQLBody, modelTargets)
-		if resolveErr != nil {
-			failedCount++
-			failed[id] = true
-			r.db.UpdateModelRunResult(runID, id, "error", resolvedSQL, 0, resolveErr.Error())
-			r.db.UpdateModelStatus(id, "error", resolveErr.Error())
-			continue
-		}
+// modelLogin returns the login a model is built as: its own service
+// credential, or the connection default.
+func (r *Runner) modelLogin(connectionID string, m database.Model, def *defaultLogin) (credentials.Credentials, error) {
+	if m.CredentialID != nil && *m.CredentialID != "" {
+		return r.creds.Resolve(connectionID, *m.CredentialID)
+	}
+	def.once.Do(func() {
+		def.creds, def.err = r.creds.Resolve(connectionID, "")
+	})
+	return def.creds, def.err
+}
 
-		// Mark as running
-		r.db.UpdateModelRunResult(runID, id, "running", "", 0, "")
+// buildModel builds one model of a run, runs its tests and records the
+// result. It reports whether the model succeeded.
+func (r *Runner) buildModel(runID, connectionID string, m database.Model, modelTargets map[string]string, def *defaultLogin) bool {
+	id := m.ID
 
-		// Build and execute DDL
-		stmts := buildDDL(m, resolvedSQL)
-		start := time.Now()
-		var execErr error
+	// Resolve $ref()
+	resolvedSQL, resolveErr := ResolveRefs(m.SQLBody, modelTargets)
+	if resolveErr != nil {
+		r.db.UpdateModelRunResult(runID, id, "error", resolvedSQL, 0, resolveErr.Error())
+		r.db.UpdateModelStatus(id, "error", resolveErr.Error())
+		r.notifyModel(id, "error")
+		return false
+	}
 
-		for _, stmt := range stmts {
-			_, execErr = r.gateway.ExecuteQuery(connectionID, stmt, user, password, 5*time.Minute)
-			if execErr != nil {
-				break
-			}
-		}
+	// Mark as running
+	r.db.UpdateModelRunResult(runID, id, "running", "", 0, "")
+
+	start := time.Now()
+	var execErr error
 
-		elapsed := time.Since(start).Milliseconds()
-		ddlForLog := stmts[len(stmts)-1] // log the main statement
+	creds, credErr := r.modelLogin(connectionID, m, def)
+	if credErr != nil {
+		execErr = fmt.Errorf("no credentials: %w", credErr)
+	}
+	modelUser, modelPassword := creds.User, creds.Password
 
+	// Plan and execute DDL
+	var stmts []string
+	if execErr == nil {
+		stmts, execErr = planBuild(r.runQuery(connectionID, modelUser, modelPassword), m, resolvedSQL)
+	}
+	// After the swap the new version is live and the shadow table holds the
+	// replaced one, so a later failure only loses the rollback copy.
+	var swapped bool
+	var swapWarning string
+	for _, stmt := range stmts {
 		if execErr != nil {
-			failedCount++
-			failed[id] = true
-			r.db.UpdateModelRunResult(runID, id, "error", ddlForLog, elapsed, execErr.Error())
-			r.db.UpdateModelStatus(id, "error", execErr.Error())
-			slog.Error("Model execution failed", "model", m.Name, "error", execErr)
-		} else {
-			succeeded++
-			r.db.UpdateModelRunResult(runID, id, "success", ddlForLog, elapsed, "")
-			r.db.UpdateModelStatus(id, "success", "")
+			break
+		}
+		_, err := r.gateway.ExecuteQuery(connectionID, stmt, modelUser, modelPassword, 5*time.Minute)
+		switch {
+		case err == nil:
+			swapped = swapped || isSwapDDL(m, stmt)
+		case swapped:
+			swapWarning = fmt.Sprintf("new version is live but the previous version was not kept: %v", err)
+			slog.Warn("Model built but previous version was not kept", "model", m.Name, "error", err)
+		default:
+			execErr = err
+		}
+	}
+	if execErr != nil && len(stmts) > 0 && !swapped {
+		// The target is untouched until the final swap; drop what the
+		// failed build created so it does not linger until the next run.
+		for _, stmt := range cleanupDDL(m) {
+			if _, err := r.gateway.ExecuteQuery(connectionID, stmt, modelUser, modelPassword, time.Minute); err != nil {
+				slog.Warn("Failed to clean up after model build", "model", m.Name, "error", err)
+			}
 		}
 	}
 
-	// Finalize run
-	runStatus := "success"
-	if failedCount > 0 && succeeded > 0 {
-		runStatus = "partial"
-	} else if failedCount > 0 || skipped == len(dag.Order) {
-		runStatus = "error"
+	// Data tests run against the freshly built target
+	var testErr string
+	if execErr == nil && len(m.Tests) > 0 {
+		results, blocking := runTests(r.runQuery(connectionID, modelUser, modelPassword), m, modelTargets)
+		if err := r.db.SetModelRunResultTests(runID, id, results); err != nil {
+			slog.Error("Failed to save model test results", "model", m.Name, "error", err)
+		}
+		if blocking {
+			testErr = failedTests(results)
+		}
 	}
-	r.db.FinalizeModelRun(runID, runStatus, succeeded, failedCount, skipped)
 
-	return runID, nil
+	elapsed := time.Since(start).Milliseconds()
+	ddlForLog := resolvedSQL
+	if len(stmts) > 0 {
+		ddlForLog = strings.Join(stmts, ";\n") // log what was run
+		if swapWarning != "" {
+			ddlForLog += "\n-- warning: " + swapWarning
+		}
+	} else if execErr == nil {
+		ddlForLog = "-- up to date, nothing to build"
+	}
+
+	if execErr != nil {
+		r.db.UpdateModelRunResult(runID, id, "error", ddlForLog, elapsed, execErr.Error())
+		r.db.UpdateModelStatus(id, "error", execErr.Error())
+		slog.Error("Model execution failed", "model", m.Name, "error", execErr)
+		r.notifyModel(id, "error")
+		return false
+	}
+	if testErr != "" {
+		// Built, but downstream models must not read data that failed
+		// its tests
+		r.db.UpdateModelRunResult(runID, id, "error", ddlForLog, elapsed, testErr)
+		r.db.UpdateModelStatus(id, "error", testErr)
+		r.notifyModel(id, "error")
+		return false
+	}
+	r.db.UpdateModelRunResult(runID, id, "success", ddlForLog, elapsed, "")
+	r.db.UpdateModelStatus(id, "success", "")
+	r.notifyModel(id, "success")
+	return true
 }
 
-// buildDDL generates the DDL statement(s) for a model.
-// Returns a slice because TABLE needs DROP + CREATE as separate statements.
-func buildDDL(m database.Model, resolvedSQL string) []string {
-	switch m.Materialization {
-	case "table":
-		drop := fmt.Sprintf("DROP TABLE IF EXISTS `%s`.`%s`", m.TargetDatabase, m.Name)
-		create := fmt.Sprintf("CREATE TABLE `%s`.`%s` ENGINE = %s ORDER BY %s AS %s",
-			m.TargetDatabase, m.Name, m.TableEngine, m.OrderBy, resolvedSQL)
-		return []string{drop, create}
-	default: // view
-		return []string{
-			fmt.Sprintf("CREATE OR REPLACE VIEW `%s`.`%s` AS %s",
-				m.TargetDatabase, m.Name, resolvedSQL),
+// Rollback swaps a table model back to the version its last build replaced.
+// Rolling back again restores the newer version.
+func (r *Runner) Rollback(connectionID, modelID string) error {
+	if err := r.acquireLock(connectionID); err != nil {
+		return err
+	}
+	defer r.releaseLock(connectionID)
+
+	if !r.gateway.IsTunnelOnline(connectionID) {
+		return fmt.Errorf("tunnel not connected")
+	}
+
+	m, err := r.db.GetModelByID(modelID)
+	if err != nil {
+		return fmt.Errorf("load model: %w", err)
+	}
+	if m == nil || m.ConnectionID != connectionID {
+		return fmt.Errorf("model not found")
+	}
+	if m.Materialization != MaterializationTable {
+		return fmt.Errorf("only table models keep a previous version to roll back to")
+	}
+
+	credentialID := ""
+	if m.CredentialID != nil {
+		credentialID = *m.CredentialID
+	}
+	creds, err := r.creds.Resolve(connectionID, credentialID)
+	if err != nil {
+		return fmt.Errorf("no credentials: %w", err)
+	}
+	query := r.runQuery(connectionID, creds.User, creds.Password)
+
+	previous, err := inspectTable(query, m.TargetDatabase, m.Name+previousSuffix)
+	if err != nil {
+		return err
+	}
+	if !previous.Exists {
+		return fmt.Errorf("no previous version of %s to roll back to", m.Name)
+	}
+	exchange, err := supportsExchange(query, m.TargetDatabase)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range buildRollbackDDL(*m, exchange) {
+		if _, err := r.gateway.ExecuteQuery(connectionID, stmt, creds.User, creds.Password, time.Minute); err != nil {
+			return fmt.Errorf("roll back %s: %w", m.Name, err)
 		}
 	}
+	return nil
+}
+
+// notifyModel reports a finished model to the completion hook without
+// holding up the run.
+func (r *Runner) notifyModel(modelID, status string) {
+	if r.onModelComplete != nil {
+		go r.onModelComplete(modelID, status)
+	}
 }
 
 func (r *Runner) acquireLock(connectionID string) error {
@@ -355,18 +492,3 @@ func (r *Runner) releaseLock(connectionID string) {
 	defer r.mu.Unlock()
 	delete(r.running, connectionID)
 }
-
-func (r *Runner) findCredentials(connectionID string) (string, string, error) {
-	sessions, err := r.db.GetActiveSessionsByConnection(connectionID, 3)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to load sessions: %w", err)
-	}
-	for _, s := range sessions {
-		password, err := crypto.Decrypt(s.EncryptedPassword, r.secret)
-		if err != nil {
-			continue
-		}
-		return s.ClickhouseUser, password, nil
-	}
-	return "", "", fmt.Errorf("no active sessions with valid credentials for connection %s", connectionID)
-}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/caioricciuti/ch-ui/internal/credentials"
+	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+func TestModelLoginResolvesDefaultOnlyWhenNeeded(t *testing.T) {
+	const secret = "test-secret-key"
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	conn, err := db.CreateConnection("local", "tok", true)
+	if err != nil {
+		t.Fatalf("CreateConnection: %v", err)
+	}
+	enc, err := crypto.Encrypt("etl-pw", secret)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	credID, err := db.CreateServiceCredential(conn, "etl", "etl_user", enc, false, "admin")
+	if err != nil {
+		t.Fatalf("CreateServiceCredential: %v", err)
+	}
+
+	r := &Runner{db: db, creds: credentials.NewResolver(db, secret)}
+	def := &defaultLogin{}
+
+	// A model with its own credential builds without a connection default.
+	creds, err := r.modelLogin(conn, database.Model{CredentialID: &credID}, def)
+	if err != nil || creds.User != "etl_user" {
+		t.Fatalf("own credential = %+v, %v", creds, err)
+	}
+	if _, err := r.modelLogin(conn, database.Model{}, def); err == nil {
+		t.Fatal("expected an error for a model that needs the missing default")
+	}
+}
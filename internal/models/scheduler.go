@@ -90,7 +90,7 @@ func (s *Scheduler) tick() {
 
 		// Compute next run and update status by schedule ID
 		var nextRunAt *string
-		if next := scheduler.ComputeNextRun(sched.Cron, time.Now().UTC()); next != nil {
+		if next := scheduler.ComputeNextRun(sched.Cron, "UTC", time.Now().UTC()); next != nil {
 			formatted := next.Format(time.RFC3339)
 			nextRunAt = &formatted
 		}
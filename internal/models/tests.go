@@ -0,0 +1,227 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+// Data test types.
+const (
+	TestNotNull        = "not_null"
+	TestUnique         = "unique"
+	TestAcceptedValues = "accepted_values"
+	TestRelationships  = "relationships"
+	TestRowCount       = "row_count"
+	TestSQL            = "sql"
+)
+
+// Test severities. A failing error test blocks the models downstream of the
+// tested one; a failing warn test is only reported.
+const (
+	SeverityError = "error"
+	SeverityWarn  = "warn"
+)
+
+// Test outcomes.
+const (
+	TestPass  = "pass"
+	TestFail  = "fail"
+	TestError = "error"
+)
+
+// NormalizeTests trims and validates a model's data tests and fills in the
+// default severity.
+func NormalizeTests(tests []database.ModelTest) ([]database.ModelTest, error) {
+	out := make([]database.ModelTest, 0, len(tests))
+	for i, t := range tests {
+		t.Type = strings.ToLower(strings.TrimSpace(t.Type))
+		t.Column = strings.TrimSpace(t.Column)
+		t.To = strings.TrimSpace(t.To)
+		t.Field = strings.TrimSpace(t.Field)
+		t.SQL = strings.TrimSpace(t.SQL)
+		t.Severity = strings.ToLower(strings.TrimSpace(t.Severity))
+		if t.Severity == "" {
+			t.Severity = SeverityError
+		}
+		if t.Severity != SeverityError && t.Severity != SeverityWarn {
+			return nil, fmt.Errorf("test %d: severity must be %q or %q", i+1, SeverityError, SeverityWarn)
+		}
+
+		switch t.Type {
+		case TestNotNull, TestUnique, TestAcceptedValues, TestRelationships:
+			if t.Column == "" {
+				return nil, fmt.Errorf("test %d: %s needs a column", i+1, t.Type)
+			}
+		}
+		switch t.Type {
+		case TestNotNull, TestUnique:
+		case TestAcceptedValues:
+			if len(t.Values) == 0 {
+				return nil, fmt.Errorf("test %d: accepted_values needs values", i+1)
+			}
+		case TestRelationships:
+			if err := ValidateModelName(t.To); err != nil {
+				return nil, fmt.Errorf("test %d: relationships needs the model it points to: %w", i+1, err)
+			}
+			if t.Field == "" {
+				return nil, fmt.Errorf("test %d: relationships needs the field it points to", i+1)
+			}
+		case TestRowCount:
+			if t.MinRows == nil && t.MaxRows == nil {
+				return nil, fmt.Errorf("test %d: row_count needs min_rows or max_rows", i+1)
+			}
+			if t.MinRows != nil && t.MaxRows != nil && *t.MinRows > *t.MaxRows {
+				return nil, fmt.Errorf("test %d: min_rows is greater than max_rows", i+1)
+			}
+		case TestSQL:
+			if t.SQL == "" {
+				return nil, fmt.Errorf("test %d: sql needs a query", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("test %d: type must be one of not_null, unique, accepted_values, relationships, row_count or sql", i+1)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// testName is a short label for a test in run results.
+func testName(t database.ModelTest) string {
+	switch t.Type {
+	case TestRelationships:
+		return fmt.Sprintf("relationships(%s -> %s.%s)", t.Column, t.To, t.Field)
+	case TestRowCount, TestSQL:
+		return t.Type
+	default:
+		return fmt.Sprintf("%s(%s)", t.Type, t.Column)
+	}
+}
+
+// testQuery returns a query whose single value is the number of rows that
+// violate t, or for row_count the number of rows in the target.
+func testQuery(t database.ModelTest, m database.Model, modelTargets map[string]string) (string, error) {
+	target := quoteTarget(m.TargetDatabase, m.Name)
+	col := "`" + strings.Trim(t.Column, "`") + "`"
+
+	switch t.Type {
+	case TestNotNull:
+		return fmt.Sprintf("SELECT count() FROM %s WHERE %s IS NULL", target, col), nil
+	case TestUnique:
+		return fmt.Sprintf("SELECT count() FROM (SELECT %s FROM %s GROUP BY %s HAVING count() > 1)", col, target, col), nil
+	case TestAcceptedValues:
+		values := make([]string, len(t.Values))
+		for i, v := range t.Values {
+			values[i] = "'" + escapeString(v) + "'"
+		}
+		return fmt.Sprintf("SELECT count() FROM %s WHERE toString(%s) NOT IN (%s)", target, col, strings.Join(values, ", ")), nil
+	case TestRelationships:
+		db, ok := modelTargets[t.To]
+		if !ok {
+			return "", fmt.Errorf("unknown model %q", t.To)
+		}
+		field := "`" + strings.Trim(t.Field, "`") + "`"
+		return fmt.Sprintf("SELECT count() FROM %s WHERE %s IS NOT NULL AND %s NOT IN (SELECT %s FROM %s)",
+			target, col, col, field, quoteTarget(db, t.To)), nil
+	case TestRowCount:
+		return fmt.Sprintf("SELECT count() FROM %s", target), nil
+	case TestSQL:
+		resolved, err := ResolveRefs(t.SQL, modelTargets)
+		if err != nil {
+			return "", err
+		}
+		resolved, err = ExpandMacros(resolved, m, false)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("SELECT count() FROM (%s)", strings.TrimRight(resolved, "; \n\t")), nil
+	}
+	return "", fmt.Errorf("unknown test type %q", t.Type)
+}
+
+// runTests runs a built model's data tests. Tests read the targets as they
+// are when the model is built, so a relationships test sees the version of
+// the other model from its last build. blocking reports whether an
+// error-severity test did not pass.
+func runTests(query queryFunc, m database.Model, modelTargets map[string]string) (results []database.ModelTestResult, blocking bool) {
+	results = make([]database.ModelTestResult, 0, len(m.Tests))
+	for _, t := range m.Tests {
+		res := database.ModelTestResult{Name: testName(t), Type: t.Type, Severity: t.Severity}
+		count, err := runTestQuery(query, t, m, modelTargets)
+		switch {
+		case err != nil:
+			res.Status = TestError
+			res.Message = err.Error()
+		case t.Type == TestRowCount:
+			res.Status = TestPass
+			if t.MinRows != nil && count < *t.MinRows {
+				res.Status = TestFail
+				res.Message = fmt.Sprintf("%d rows, expected at least %d", count, *t.MinRows)
+			} else if t.MaxRows != nil && count > *t.MaxRows {
+				res.Status = TestFail
+				res.Message = fmt.Sprintf("%d rows, expected at most %d", count, *t.MaxRows)
+			}
+			if res.Status == TestFail {
+				res.Failures = 1
+			}
+		default:
+			res.Failures = count
+			res.Status = TestPass
+			if count > 0 {
+				res.Status = TestFail
+				res.Message = fmt.Sprintf("%d failing rows", count)
+			}
+		}
+		if res.Status != TestPass && t.Severity != SeverityWarn {
+			blocking = true
+		}
+		results = append(results, res)
+	}
+	return results, blocking
+}
+
+func runTestQuery(query queryFunc, t database.ModelTest, m database.Model, modelTargets map[string]string) (int64, error) {
+	sql, err := testQuery(t, m, modelTargets)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := query(sql)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, fmt.Errorf("test query returned no rows")
+	}
+	for _, v := range rows[0] {
+		return decodeCount(v)
+	}
+	return 0, fmt.Errorf("test query returned no columns")
+}
+
+// decodeCount reads a count from a JSON row value. ClickHouse quotes 64-bit
+// integers in JSON output by default.
+func decodeCount(raw json.RawMessage) (int64, error) {
+	var n int64
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, fmt.Errorf("decode count %s: %w", raw, err)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// failedTests summarises the tests that did not pass.
+func failedTests(results []database.ModelTestResult) string {
+	var names []string
+	for _, r := range results {
+		if r.Status != TestPass && r.Severity != SeverityWarn {
+			names = append(names, r.Name)
+		}
+	}
+	return fmt.Sprintf("%d blocking test(s) failed: %s", len(names), strings.Join(names, ", "))
+}
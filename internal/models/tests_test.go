@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+func TestNormalizeTests(t *testing.T) {
+	tests, err := NormalizeTests([]database.ModelTest{{Type: " Not_Null ", Column: " id "}})
+	if err != nil {
+		t.Fatalf("NormalizeTests: %v", err)
+	}
+	if tests[0].Type != TestNotNull || tests[0].Column != "id" || tests[0].Severity != SeverityError {
+		t.Fatalf("unexpected test: %+v", tests[0])
+	}
+
+	minRows, maxRows := int64(10), int64(5)
+	for _, bad := range []database.ModelTest{
+		{Type: TestUnique},
+		{Type: TestAcceptedValues, Column: "status"},
+		{Type: TestRelationships, Column: "user_id", To: "users"},
+		{Type: TestRowCount},
+		{Type: TestRowCount, MinRows: &minRows, MaxRows: &maxRows},
+		{Type: TestSQL},
+		{Type: TestNotNull, Column: "id", Severity: "fatal"},
+		{Type: "fresh"},
+	} {
+		if _, err := NormalizeTests([]database.ModelTest{bad}); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestTestQuery(t *testing.T) {
+	m := database.Model{Name: "orders", TargetDatabase: "shop"}
+	targets := map[string]string{"orders": "shop", "users": "crm"}
+
+	cases := []struct {
+		test database.ModelTest
+		want string
+	}{
+		{database.ModelTest{Type: TestNotNull, Column: "id"}, "SELECT count() FROM `shop`.`orders` WHERE `id` IS NULL"},
+		{database.ModelTest{Type: TestAcceptedValues, Column: "status", Values: []string{"new", "it's"}},
+			"SELECT count() FROM `shop`.`orders` WHERE toString(`status`) NOT IN ('new', 'it\\'s')"},
+		{database.ModelTest{Type: TestRelationships, Column: "user_id", To: "users", Field: "id"},
+			"SELECT count() FROM `shop`.`orders` WHERE `user_id` IS NOT NULL AND `user_id` NOT IN (SELECT `id` FROM `crm`.`users`)"},
+		{database.ModelTest{Type: TestSQL, SQL: "SELECT * FROM $this() o JOIN $ref(users) u ON o.user_id = u.id WHERE u.banned;"},
+			"SELECT count() FROM (SELECT * FROM `shop`.`orders` o JOIN `crm`.`users` u ON o.user_id = u.id WHERE u.banned)"},
+	}
+	for _, c := range cases {
+		got, err := testQuery(c.test, m, targets)
+		if err != nil {
+			t.Fatalf("testQuery(%s): %v", c.test.Type, err)
+		}
+		if got != c.want {
+			t.Fatalf("testQuery(%s)\n got  %s\n want %s", c.test.Type, got, c.want)
+		}
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	minRows := int64(100)
+	m := database.Model{Name: "orders", TargetDatabase: "shop", Tests: []database.ModelTest{
+		{Type: TestNotNull, Column: "id", Severity: SeverityError},
+		{Type: TestUnique, Column: "id", Severity: SeverityWarn},
+		{Type: TestRowCount, MinRows: &minRows, Severity: SeverityError},
+	}}
+	query := func(sql string) ([]map[string]json.RawMessage, error) {
+		switch {
+		case strings.Contains(sql, "IS NULL"):
+			return []map[string]json.RawMessage{{"count()": json.RawMessage(`"0"`)}}, nil
+		case strings.Contains(sql, "HAVING"):
+			return []map[string]json.RawMessage{{"count()": json.RawMessage(`3`)}}, nil
+		default:
+			return []map[string]json.RawMessage{{"count()": json.RawMessage(`"42"`)}}, nil
+		}
+	}
+
+	results, blocking := runTests(query, m, map[string]string{"orders": "shop"})
+	if !blocking {
+		t.Fatal("a failed error-severity row count must block")
+	}
+	if results[0].Status != TestPass || results[1].Status != TestFail || results[1].Failures != 3 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if results[2].Status != TestFail || results[2].Message != "42 rows, expected at least 100" {
+		t.Fatalf("unexpected row count result: %+v", results[2])
+	}
+
+	m.Tests = m.Tests[:2]
+	if _, blocking := runTests(query, m, nil); blocking {
+		t.Fatal("warn-only failures must not block")
+	}
+}
@@ -0,0 +1,315 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+// avroDecoder decodes Confluent-framed Avro messages using writer schemas
+// fetched from the registry.
+type avroDecoder struct {
+	registry *SchemaRegistry
+
+	mu      sync.Mutex
+	schemas map[int]avro.Schema
+}
+
+func newAvroDecoder(registry *SchemaRegistry) *avroDecoder {
+	return &avroDecoder{registry: registry, schemas: make(map[int]avro.Schema)}
+}
+
+func (d *avroDecoder) PassThrough() bool { return false }
+
+// Decode maps each field of a record schema to a column. Non-record
+// top-level schemas are stored in a single "value" column.
+func (d *avroDecoder) Decode(ctx context.Context, value []byte) (map[string]interface{}, map[string]string, error) {
+	id, payload, err := splitConfluentFrame(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	schema, err := d.schema(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var v interface{}
+	if err := avro.Unmarshal(schema, payload, &v); err != nil {
+		return nil, nil, fmt.Errorf("decode avro (schema %d): %w", id, err)
+	}
+
+	record, ok := schema.(*avro.RecordSchema)
+	if !ok {
+		return map[string]interface{}{"value": avroColumn(schema, v)},
+			map[string]string{"value": avroClickHouseType(schema)}, nil
+	}
+
+	m, _ := v.(map[string]interface{})
+	data := make(map[string]interface{}, len(record.Fields()))
+	types := make(map[string]string, len(record.Fields()))
+	for _, f := range record.Fields() {
+		data[f.Name()] = avroColumn(f.Type(), m[f.Name()])
+		types[f.Name()] = avroClickHouseType(f.Type())
+	}
+	return data, types, nil
+}
+
+// schema returns the parsed writer schema for id, parsing its references
+// into a cache private to that schema so versions of the same named type
+// never collide.
+func (d *avroDecoder) schema(ctx context.Context, id int) (avro.Schema, error) {
+	d.mu.Lock()
+	s, ok := d.schemas[id]
+	d.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	rs, err := d.registry.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rs.SchemaType != "" && rs.SchemaType != "AVRO" {
+		return nil, fmt.Errorf("schema %d is %s, not AVRO", id, rs.SchemaType)
+	}
+
+	cache := &avro.SchemaCache{}
+	if err := d.parseReferences(ctx, rs.References, cache); err != nil {
+		return nil, err
+	}
+	s, err = avro.ParseWithCache(rs.Schema, "", cache)
+	if err != nil {
+		return nil, fmt.Errorf("parse avro schema %d: %w", id, err)
+	}
+
+	d.mu.Lock()
+	d.schemas[id] = s
+	d.mu.Unlock()
+	return s, nil
+}
+
+func (d *avroDecoder) parseReferences(ctx context.Context, refs []schemaReference, cache *avro.SchemaCache) error {
+	for _, ref := range refs {
+		rs, err := d.registry.SchemaBySubject(ctx, ref.Subject, ref.Version)
+		if err != nil {
+			return err
+		}
+		if err := d.parseReferences(ctx, rs.References, cache); err != nil {
+			return err
+		}
+		if _, err := avro.ParseWithCache(rs.Schema, "", cache); err != nil {
+			return fmt.Errorf("parse avro reference %s: %w", ref.Name, err)
+		}
+	}
+	return nil
+}
+
+// avroClickHouseType maps an Avro schema to a ClickHouse column type. Nested
+// records and multi-type unions are stored as JSON strings.
+func avroClickHouseType(schema avro.Schema) string {
+	switch s := schema.(type) {
+	case *avro.RefSchema:
+		return avroClickHouseType(s.Schema())
+	case *avro.PrimitiveSchema:
+		if ls := s.Logical(); ls != nil {
+			switch ls.Type() {
+			case avro.Date:
+				return "Date32"
+			case avro.TimestampMillis, avro.LocalTimestampMillis:
+				return "DateTime64(3)"
+			case avro.TimestampMicros, avro.LocalTimestampMicros:
+				return "DateTime64(6)"
+			case avro.UUID:
+				return "UUID"
+			case avro.Decimal:
+				dec := ls.(*avro.DecimalLogicalSchema)
+				return fmt.Sprintf("Decimal(%d, %d)", dec.Precision(), dec.Scale())
+			}
+		}
+		switch s.Type() {
+		case avro.Boolean:
+			return "Bool"
+		case avro.Int:
+			return "Int32"
+		case avro.Long:
+			return "Int64"
+		case avro.Float:
+			return "Float32"
+		case avro.Double:
+			return "Float64"
+		case avro.Null:
+			return "Nullable(String)"
+		}
+		return "String"
+	case *avro.FixedSchema:
+		if dec, ok := s.Logical().(*avro.DecimalLogicalSchema); ok {
+			return fmt.Sprintf("Decimal(%d, %d)", dec.Precision(), dec.Scale())
+		}
+		return "String"
+	case *avro.EnumSchema:
+		return "LowCardinality(String)"
+	case *avro.ArraySchema:
+		return "Array(" + avroClickHouseType(s.Items()) + ")"
+	case *avro.MapSchema:
+		return "Map(String, " + avroClickHouseType(s.Values()) + ")"
+	case *avro.UnionSchema:
+		if branches := avroNonNullBranches(s); len(branches) == 1 {
+			t := avroClickHouseType(branches[0])
+			if s.Nullable() {
+				return nullableType(t)
+			}
+			return t
+		}
+		return "Nullable(String)"
+	}
+	return "String"
+}
+
+// avroColumn converts a decoded Avro value into the JSON shape of the column
+// type chosen by avroClickHouseType.
+func avroColumn(schema avro.Schema, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch s := schema.(type) {
+	case *avro.RefSchema:
+		return avroColumn(s.Schema(), v)
+	case *avro.PrimitiveSchema:
+		if ls := s.Logical(); ls != nil {
+			switch ls.Type() {
+			case avro.Date:
+				if t, ok := v.(time.Time); ok {
+					return t.UTC().Format("2006-01-02")
+				}
+			case avro.Decimal:
+				if r, ok := v.(*big.Rat); ok {
+					return json.Number(r.FloatString(ls.(*avro.DecimalLogicalSchema).Scale()))
+				}
+			}
+		}
+		return decodedScalar(v)
+	case *avro.FixedSchema:
+		if dec, ok := s.Logical().(*avro.DecimalLogicalSchema); ok {
+			if r, ok := v.(*big.Rat); ok {
+				return json.Number(r.FloatString(dec.Scale()))
+			}
+		}
+		return string(fixedBytes(v))
+	case *avro.ArraySchema:
+		items, _ := v.([]interface{})
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			out[i] = avroColumn(s.Items(), item)
+		}
+		return out
+	case *avro.MapSchema:
+		m, _ := v.(map[string]interface{})
+		out := make(map[string]interface{}, len(m))
+		for k, item := range m {
+			out[k] = avroColumn(s.Values(), item)
+		}
+		return out
+	case *avro.UnionSchema:
+		branch, inner := avroUnionBranch(s, v)
+		if len(avroNonNullBranches(s)) == 1 {
+			return avroColumn(branch, inner)
+		}
+		return jsonString(avroNative(branch, inner))
+	case *avro.RecordSchema:
+		return jsonString(avroNative(s, v))
+	}
+	return decodedScalar(v)
+}
+
+// avroNative converts a decoded value into plain JSON-compatible Go values,
+// keeping nested records as objects.
+func avroNative(schema avro.Schema, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch s := schema.(type) {
+	case *avro.RefSchema:
+		return avroNative(s.Schema(), v)
+	case *avro.RecordSchema:
+		m, _ := v.(map[string]interface{})
+		out := make(map[string]interface{}, len(m))
+		for _, f := range s.Fields() {
+			out[f.Name()] = avroNative(f.Type(), m[f.Name()])
+		}
+		return out
+	case *avro.ArraySchema:
+		items, _ := v.([]interface{})
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			out[i] = avroNative(s.Items(), item)
+		}
+		return out
+	case *avro.MapSchema:
+		m, _ := v.(map[string]interface{})
+		out := make(map[string]interface{}, len(m))
+		for k, item := range m {
+			out[k] = avroNative(s.Values(), item)
+		}
+		return out
+	case *avro.UnionSchema:
+		branch, inner := avroUnionBranch(s, v)
+		return avroNative(branch, inner)
+	case *avro.FixedSchema:
+		if _, ok := s.Logical().(*avro.DecimalLogicalSchema); !ok {
+			return string(fixedBytes(v))
+		}
+	}
+	return decodedScalar(v)
+}
+
+func avroNonNullBranches(s *avro.UnionSchema) []avro.Schema {
+	var out []avro.Schema
+	for _, t := range s.Types() {
+		if t.Type() != avro.Null {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// avroUnionBranch finds the branch a decoded union value belongs to. Values
+// of unresolvable branches are decoded as a single-key map keyed by the
+// branch name.
+func avroUnionBranch(s *avro.UnionSchema, v interface{}) (avro.Schema, interface{}) {
+	branches := avroNonNullBranches(s)
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+		for _, b := range branches {
+			name := string(b.Type())
+			if named, ok := b.(avro.NamedSchema); ok {
+				name = named.FullName()
+			}
+			if inner, ok := m[name]; ok {
+				return b, inner
+			}
+		}
+	}
+	if len(branches) > 0 {
+		return branches[0], v
+	}
+	return s, v
+}
+
+// fixedBytes returns the bytes of a decoded Avro fixed value ([N]byte).
+func fixedBytes(v interface{}) []byte {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Array {
+		if b, ok := v.([]byte); ok {
+			return b
+		}
+		return nil
+	}
+	out := make([]byte, rv.Len())
+	reflect.Copy(reflect.ValueOf(out), rv)
+	return out
+}
@@ -0,0 +1,194 @@
+package pipelines
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Change-data-capture records carry the source row plus these columns. They
+// map directly onto ClickHouse's mutable-table engines:
+//
+//	ENGINE = ReplacingMergeTree(_version, _is_deleted) ORDER BY (<primary key>)
+//	ENGINE = CollapsingMergeTree(_sign) ORDER BY (<primary key>)
+//
+// Updates emit the old row image (when the source provides one) as a
+// cancelling row with _sign = -1 and _is_deleted = 1, followed by the new row.
+const (
+	cdcOpInsert = "insert"
+	cdcOpUpdate = "update"
+	cdcOpDelete = "delete"
+)
+
+var cdcMetaColumnTypes = map[string]string{
+	"_op":         "LowCardinality(String)",
+	"_version":    "UInt64",
+	"_sign":       "Int8",
+	"_is_deleted": "UInt8",
+	"_table":      "LowCardinality(String)",
+	"_commit_ts":  "DateTime64(6)",
+}
+
+// cdcColumn describes a column of a captured table.
+type cdcColumn struct {
+	name   string
+	chType string
+	key    bool
+}
+
+// cdcRecord builds a change record. cancel marks delete rows and the old
+// image of an update.
+func cdcRecord(table, op string, version uint64, commitTS time.Time, cols []cdcColumn, values []interface{}, cancel bool) Record {
+	data := make(map[string]interface{}, len(cols)+len(cdcMetaColumnTypes))
+	for i, c := range cols {
+		if i < len(values) {
+			data[c.name] = values[i]
+		} else {
+			data[c.name] = nil
+		}
+	}
+	sign, deleted := 1, 0
+	if cancel {
+		sign, deleted = -1, 1
+	}
+	data["_op"] = op
+	data["_version"] = version
+	data["_sign"] = sign
+	data["_is_deleted"] = deleted
+	data["_table"] = table
+	data["_commit_ts"] = commitTS.UTC().Format("2006-01-02 15:04:05.000000")
+	return Record{Data: data}
+}
+
+// cdcBatcher accumulates change records and emits them together with the
+// source position of the last transaction commit seen. Batches are cut by
+// size or age; a batch may end mid-transaction, in which case its checkpoint
+// is the previous commit and the partial transaction is replayed on restart.
+type cdcBatcher struct {
+	out       chan<- Batch
+	batchSize int
+	maxAge    time.Duration
+
+	buf        []Record
+	types      map[string]string
+	checkpoint map[string]string
+	ack        func(bool)
+	started    time.Time
+}
+
+func newCDCBatcher(out chan<- Batch, batchSize int, maxAge time.Duration) *cdcBatcher {
+	return &cdcBatcher{out: out, batchSize: batchSize, maxAge: maxAge}
+}
+
+func (b *cdcBatcher) add(rec Record, cols []cdcColumn) {
+	if len(b.buf) == 0 && b.checkpoint == nil {
+		b.started = time.Now()
+	}
+	if b.types == nil {
+		b.types = make(map[string]string, len(cols)+len(cdcMetaColumnTypes))
+		for k, v := range cdcMetaColumnTypes {
+			b.types[k] = v
+		}
+	}
+	for _, c := range cols {
+		if _, ok := b.types[c.name]; !ok {
+			b.types[c.name] = c.chType
+		}
+	}
+	b.buf = append(b.buf, rec)
+}
+
+// commit records the position to resume from once everything buffered so
+// far is delivered. ack, if set, is called with the delivery result.
+func (b *cdcBatcher) commit(checkpoint map[string]string, ack func(bool)) {
+	if len(b.buf) == 0 && b.checkpoint == nil {
+		b.started = time.Now()
+	}
+	b.checkpoint = checkpoint
+	b.ack = ack
+}
+
+// due reports whether the batch should be flushed now.
+func (b *cdcBatcher) due() bool {
+	if len(b.buf) >= b.batchSize {
+		return true
+	}
+	return (len(b.buf) > 0 || b.checkpoint != nil) && time.Since(b.started) >= b.maxAge
+}
+
+func (b *cdcBatcher) flush(ctx context.Context) error {
+	if len(b.buf) == 0 && b.checkpoint == nil {
+		return nil
+	}
+	batch := Batch{
+		Records:     b.buf,
+		SourceTS:    time.Now(),
+		ColumnTypes: b.types,
+		Checkpoint:  b.checkpoint,
+		Ack:         b.ack,
+	}
+	select {
+	case b.out <- batch:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.buf, b.types, b.checkpoint, b.ack = nil, nil, nil, nil
+	return nil
+}
+
+// cdcTableFilter parses the comma-separated "tables" field into a set of
+// schema-qualified names. An empty set captures every table.
+func cdcTableFilter(fields map[string]interface{}) map[string]bool {
+	set := make(map[string]bool)
+	for _, t := range strings.Split(stringField(fields, "tables", ""), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			set[t] = true
+		}
+	}
+	return set
+}
+
+var cdcNameSanitizer = regexp.MustCompile(`[^a-z0-9_]`)
+
+// cdcDefaultName derives a replication slot or publication name from the
+// pipeline ID.
+func cdcDefaultName(fields map[string]interface{}) string {
+	id := cdcNameSanitizer.ReplaceAllString(strings.ToLower(stringField(fields, "pipeline_id", "")), "_")
+	name := "ch_ui_" + id
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
+
+// validateCDC checks the configuration of a database source in cdc mode.
+func validateCDC(cfg ConnectorConfig) error {
+	// No initial snapshot is taken: Postgres creates the slot without
+	// exporting one and MySQL starts at the current binlog position, so
+	// rows that exist before the first start are never read. The pipeline
+	// must acknowledge that rather than silently mirror a partial table.
+	if !boolField(cfg.Fields, "skip_snapshot", false) {
+		return fmt.Errorf("cdc mode does not copy existing rows, only changes made after it starts; backfill the target first and set skip_snapshot to confirm")
+	}
+	switch stringField(cfg.Fields, "db_type", "") {
+	case "postgres":
+		for _, key := range []string{"slot_name", "publication"} {
+			if v := stringField(cfg.Fields, key, ""); v != "" && !isPlainIdentifier(v) {
+				return fmt.Errorf("%s must contain only letters, digits and underscores", key)
+			}
+		}
+	case "mysql":
+		if intField(cfg.Fields, "server_id", 0) < 0 {
+			return fmt.Errorf("server_id must be positive")
+		}
+	default:
+		return fmt.Errorf("cdc mode supports postgres and mysql only")
+	}
+	return nil
+}
+
+var plainIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func isPlainIdentifier(s string) bool { return plainIdentifier.MatchString(s) }
@@ -0,0 +1,463 @@
+package pipelines
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Checkpoint entries holding the binlog position after the last delivered
+// transaction.
+const (
+	mysqlFileCheckpointKey = "binlog_file"
+	mysqlPosCheckpointKey  = "binlog_pos"
+)
+
+// Binlog event types handled by the CDC reader.
+const (
+	mysqlEventQuery              = 2
+	mysqlEventRotate             = 4
+	mysqlEventFormatDescription  = 15
+	mysqlEventXID                = 16
+	mysqlEventTableMap           = 19
+	mysqlEventWriteRowsV1        = 23
+	mysqlEventUpdateRowsV1       = 24
+	mysqlEventDeleteRowsV1       = 25
+	mysqlEventWriteRowsV2        = 30
+	mysqlEventUpdateRowsV2       = 31
+	mysqlEventDeleteRowsV2       = 32
+	mysqlEventPartialUpdateRows  = 39
+	mysqlEventTransactionPayload = 40
+)
+
+// mysqlTableMap is the column layout announced by a TABLE_MAP event.
+type mysqlTableMap struct {
+	name  string // schema.table
+	types []byte
+	meta  []uint16
+}
+
+// mysqlStream decodes a row-based binlog stream into change records.
+type mysqlStream struct {
+	db       *sql.DB
+	tables   map[string]bool
+	batcher  *cdcBatcher
+	checksum bool
+
+	file        string
+	fileSeq     uint64
+	tableIDSize int
+	tableMaps   map[uint64]*mysqlTableMap
+	columns     map[string][]mysqlColumn
+}
+
+// startMySQLCDC streams row changes from the binlog, acting as a replica.
+// The server must run with binlog_format=ROW; binlog_row_image=FULL is
+// needed for complete update and delete images. Column names and types come
+// from information_schema, which is re-read after DDL.
+func (d *DatabaseSource) startMySQLCDC(ctx context.Context, cfg ConnectorConfig, out chan<- Batch) error {
+	connStr := stringField(cfg.Fields, "connection_string", "")
+	dsn, err := mysql.ParseDSN(connStr)
+	if err != nil {
+		return fmt.Errorf("parse connection string: %w", err)
+	}
+	allowPublicKey, err := takePublicKeyRetrieval(dsn)
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var format, checksum string
+	if err := db.QueryRowContext(ctx, "SELECT @@global.binlog_format").Scan(&format); err != nil {
+		return fmt.Errorf("read binlog_format: %w", err)
+	}
+	if !strings.EqualFold(format, "ROW") {
+		return fmt.Errorf("cdc mode requires binlog_format=ROW (server uses %s)", format)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT @@global.binlog_checksum").Scan(&checksum); err != nil {
+		checksum = "NONE"
+	}
+
+	file := cfg.Checkpoint[mysqlFileCheckpointKey]
+	var pos uint32 = 4
+	if file != "" {
+		p, err := strconv.ParseUint(cfg.Checkpoint[mysqlPosCheckpointKey], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s checkpoint: %w", mysqlPosCheckpointKey, err)
+		}
+		pos = uint32(p)
+	} else if file, pos, err = mysqlCurrentPosition(ctx, db); err != nil {
+		return err
+	}
+
+	serverID := uint32(intField(cfg.Fields, "server_id", 0))
+	if serverID == 0 {
+		serverID = 1000 + crc32.ChecksumIEEE([]byte(stringField(cfg.Fields, "pipeline_id", "")))%1000000
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conn, err := dialMySQL(ctx, dsn, allowPublicKey)
+	if err != nil {
+		return fmt.Errorf("connect for replication: %w", err)
+	}
+	defer conn.Close()
+	if err := conn.exec("SET @master_binlog_checksum = @@global.binlog_checksum"); err != nil {
+		return fmt.Errorf("negotiate binlog checksum: %w", err)
+	}
+	if err := conn.exec("SET @master_heartbeat_period = 10000000000"); err != nil {
+		return fmt.Errorf("set heartbeat period: %w", err)
+	}
+	if err := conn.binlogDump(serverID, file, pos); err != nil {
+		return fmt.Errorf("start binlog dump: %w", err)
+	}
+
+	slog.Info("MySQL CDC started", "server_id", serverID, "binlog_file", file, "binlog_pos", pos)
+
+	s := &mysqlStream{
+		db:          db,
+		tables:      cdcTableFilter(cfg.Fields),
+		batcher:     newCDCBatcher(out, intField(cfg.Fields, "batch_size", 1000), time.Duration(intField(cfg.Fields, "batch_timeout_ms", 2000))*time.Millisecond),
+		checksum:    strings.EqualFold(checksum, "CRC32"),
+		tableIDSize: 6,
+		tableMaps:   make(map[uint64]*mysqlTableMap),
+		columns:     make(map[string][]mysqlColumn),
+	}
+	s.setFile(file)
+
+	// Reads block, so they happen on their own goroutine; closing the
+	// connection on return unblocks it.
+	packets := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			pkt, err := conn.readPacket()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case packets <- pkt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("read binlog: %w", err)
+		case pkt := <-packets:
+			if err := s.handlePacket(ctx, pkt); err != nil {
+				return err
+			}
+		case <-ticker.C:
+		}
+		if s.batcher.due() {
+			if err := s.batcher.flush(ctx); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// mysqlCurrentPosition returns the server's current binlog coordinates.
+func mysqlCurrentPosition(ctx context.Context, db *sql.DB) (string, uint32, error) {
+	var lastErr error
+	// SHOW MASTER STATUS was renamed in MySQL 8.2 and removed in 8.4.
+	for _, q := range []string{"SHOW BINARY LOG STATUS", "SHOW MASTER STATUS"} {
+		file, pos, err := mysqlStatusRow(ctx, db, q)
+		if err == nil {
+			return file, pos, nil
+		}
+		lastErr = err
+	}
+	return "", 0, fmt.Errorf("read binlog position: %w", lastErr)
+}
+
+func mysqlStatusRow(ctx context.Context, db *sql.DB, query string) (string, uint32, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return "", 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", 0, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", 0, err
+		}
+		return "", 0, fmt.Errorf("binary logging is disabled")
+	}
+	values := make([]sql.RawBytes, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return "", 0, err
+	}
+	if len(values) < 2 {
+		return "", 0, fmt.Errorf("unexpected %s result", query)
+	}
+	pos, err := strconv.ParseUint(string(values[1]), 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("unexpected binlog position %q", values[1])
+	}
+	return string(values[0]), uint32(pos), nil
+}
+
+// setFile records the current binlog file. Its numeric suffix forms the
+// high half of record versions so they keep increasing across rotations.
+func (s *mysqlStream) setFile(file string) {
+	s.file = file
+	ext := strings.TrimPrefix(path.Ext(file), ".")
+	s.fileSeq, _ = strconv.ParseUint(ext, 10, 32)
+}
+
+func (s *mysqlStream) handlePacket(ctx context.Context, pkt []byte) error {
+	if len(pkt) == 0 {
+		return nil
+	}
+	switch pkt[0] {
+	case 0xff:
+		return mysqlError(pkt)
+	case 0xfe:
+		return fmt.Errorf("binlog stream ended")
+	}
+	ev := pkt[1:]
+	if s.checksum {
+		if len(ev) < 4 {
+			return fmt.Errorf("short binlog event")
+		}
+		ev = ev[:len(ev)-4]
+	}
+	if len(ev) < 19 {
+		return fmt.Errorf("short binlog event")
+	}
+	ts := time.Unix(int64(binary.LittleEndian.Uint32(ev)), 0)
+	typ := ev[4]
+	logPos := binary.LittleEndian.Uint32(ev[13:])
+	r := &mysqlReader{buf: ev[19:]}
+
+	switch typ {
+	case mysqlEventRotate:
+		r.uint64()
+		s.setFile(string(r.buf))
+	case mysqlEventFormatDescription:
+		// The post-header length of TABLE_MAP tells 4-byte from 6-byte table IDs.
+		if body := ev[19:]; len(body) > 57+mysqlEventTableMap-1 && body[57+mysqlEventTableMap-1] == 6 {
+			s.tableIDSize = 4
+		}
+	case mysqlEventQuery:
+		r.take(8) // thread id, exec time
+		dbLen := int(r.byte())
+		r.take(2) // error code
+		r.take(int(r.uint16()))
+		r.take(dbLen + 1)
+		query := strings.TrimSpace(string(r.buf))
+		if strings.EqualFold(query, "BEGIN") {
+			return r.err
+		}
+		// DDL commits implicitly and may change table layouts.
+		if !strings.EqualFold(query, "COMMIT") {
+			s.columns = make(map[string][]mysqlColumn)
+		}
+		s.commit(logPos)
+	case mysqlEventXID:
+		s.commit(logPos)
+	case mysqlEventTableMap:
+		id := r.uint(s.tableIDSize)
+		r.take(2) // flags
+		schema := string(r.take(int(r.byte())))
+		r.byte()
+		table := string(r.take(int(r.byte())))
+		r.byte()
+		n := int(r.lenenc())
+		tm := &mysqlTableMap{name: schema + "." + table, types: append([]byte(nil), r.take(n)...)}
+		mr := &mysqlReader{buf: r.take(int(r.lenenc()))}
+		for _, t := range tm.types {
+			tm.meta = append(tm.meta, mysqlColumnMeta(mr, t))
+		}
+		if r.err == nil && mr.err == nil {
+			s.tableMaps[id] = tm
+		}
+	case mysqlEventWriteRowsV1, mysqlEventUpdateRowsV1, mysqlEventDeleteRowsV1,
+		mysqlEventWriteRowsV2, mysqlEventUpdateRowsV2, mysqlEventDeleteRowsV2:
+		return s.handleRows(ctx, r, typ, uint64(logPos)|s.fileSeq<<32, ts)
+	case mysqlEventPartialUpdateRows:
+		return fmt.Errorf("partial JSON updates are not supported; set binlog_row_value_options=''")
+	case mysqlEventTransactionPayload:
+		return fmt.Errorf("compressed binlog transactions are not supported; disable binlog_transaction_compression")
+	}
+	return r.err
+}
+
+// commit marks the end of a transaction at logPos in the current file.
+func (s *mysqlStream) commit(logPos uint32) {
+	s.batcher.commit(map[string]string{
+		mysqlFileCheckpointKey: s.file,
+		mysqlPosCheckpointKey:  strconv.FormatUint(uint64(logPos), 10),
+	}, nil)
+}
+
+func (s *mysqlStream) handleRows(ctx context.Context, r *mysqlReader, typ byte, version uint64, ts time.Time) error {
+	tm, ok := s.tableMaps[r.uint(s.tableIDSize)]
+	if !ok {
+		return fmt.Errorf("rows event for unknown table id")
+	}
+	if len(s.tables) > 0 && !s.tables[tm.name] {
+		return nil
+	}
+	r.take(2) // flags
+	if typ >= mysqlEventWriteRowsV2 {
+		r.take(int(r.uint16()) - 2) // extra data, length includes itself
+	}
+	n := int(r.lenenc())
+	if n != len(tm.types) {
+		return fmt.Errorf("%s: rows event has %d columns, table map has %d", tm.name, n, len(tm.types))
+	}
+	present := r.take((n + 7) / 8)
+	presentAfter := present
+	update := typ == mysqlEventUpdateRowsV1 || typ == mysqlEventUpdateRowsV2
+	if update {
+		presentAfter = r.take((n + 7) / 8)
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	cols, err := s.tableColumns(ctx, tm)
+	if err != nil {
+		return err
+	}
+	base := make([]cdcColumn, len(cols))
+	for i := range cols {
+		base[i] = cols[i].cdcColumn
+	}
+
+	for len(r.buf) > 0 {
+		row, err := mysqlRow(r, tm, cols, present)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tm.name, err)
+		}
+		switch typ {
+		case mysqlEventWriteRowsV1, mysqlEventWriteRowsV2:
+			s.batcher.add(cdcRecord(tm.name, cdcOpInsert, version, ts, base, row, false), base)
+		case mysqlEventDeleteRowsV1, mysqlEventDeleteRowsV2:
+			s.batcher.add(cdcRecord(tm.name, cdcOpDelete, version, ts, base, row, true), base)
+		default:
+			after, err := mysqlRow(r, tm, cols, presentAfter)
+			if err != nil {
+				return fmt.Errorf("%s: %w", tm.name, err)
+			}
+			s.batcher.add(cdcRecord(tm.name, cdcOpUpdate, version, ts, base, row, true), base)
+			s.batcher.add(cdcRecord(tm.name, cdcOpUpdate, version, ts, base, after, false), base)
+		}
+	}
+	return nil
+}
+
+// mysqlRow decodes one row image. Columns absent from the image (with
+// binlog_row_image=MINIMAL) decode as nil.
+func mysqlRow(r *mysqlReader, tm *mysqlTableMap, cols []mysqlColumn, present []byte) ([]interface{}, error) {
+	count := 0
+	for i := range tm.types {
+		if present[i/8]&(1<<(i%8)) != 0 {
+			count++
+		}
+	}
+	nulls := r.take((count + 7) / 8)
+	values := make([]interface{}, len(cols))
+	idx := 0
+	for i, typ := range tm.types {
+		if present[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
+		isNull := nulls[idx/8]&(1<<(idx%8)) != 0
+		idx++
+		if isNull {
+			continue
+		}
+		v, err := mysqlValue(r, typ, tm.meta[i], &cols[i])
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", cols[i].name, err)
+		}
+		values[i] = v
+	}
+	return values, r.err
+}
+
+// tableColumns returns the columns of a table, reading information_schema
+// when the cached layout is missing or no longer matches the binlog.
+func (s *mysqlStream) tableColumns(ctx context.Context, tm *mysqlTableMap) ([]mysqlColumn, error) {
+	if cols, ok := s.columns[tm.name]; ok && len(cols) == len(tm.types) {
+		return cols, nil
+	}
+	schema, table, _ := strings.Cut(tm.name, ".")
+	rows, err := s.db.QueryContext(ctx, `SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY,
+		COALESCE(NUMERIC_PRECISION, 0), COALESCE(NUMERIC_SCALE, 0)
+		FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION`, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("read columns of %s: %w", tm.name, err)
+	}
+	defer rows.Close()
+
+	var cols []mysqlColumn
+	for rows.Next() {
+		var name, dataType, columnType, nullable, key string
+		var precision, scale int
+		if err := rows.Scan(&name, &dataType, &columnType, &nullable, &key, &precision, &scale); err != nil {
+			return nil, fmt.Errorf("read columns of %s: %w", tm.name, err)
+		}
+		c := mysqlColumn{
+			cdcColumn: cdcColumn{
+				name:   name,
+				chType: mysqlClickHouseType(dataType, columnType, precision, scale),
+				key:    key == "PRI",
+			},
+			unsigned: strings.Contains(columnType, "unsigned"),
+		}
+		if nullable == "YES" {
+			c.chType = nullableType(c.chType)
+		}
+		if dataType == "enum" || dataType == "set" {
+			c.values = mysqlEnumMembers(columnType)
+		}
+		cols = append(cols, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read columns of %s: %w", tm.name, err)
+	}
+	if len(cols) != len(tm.types) {
+		return nil, fmt.Errorf("%s has %d columns but the binlog row has %d; the table changed since this event was written", tm.name, len(cols), len(tm.types))
+	}
+	s.columns[tm.name] = cols
+	return cols, nil
+}
@@ -0,0 +1,434 @@
+package pipelines
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Client capability flags and commands of the MySQL client/server protocol.
+const (
+	mysqlClientLongPassword  = 0x00000001
+	mysqlClientConnectWithDB = 0x00000008
+	mysqlClientProtocol41    = 0x00000200
+	mysqlClientSSL           = 0x00000800
+	mysqlClientTransactions  = 0x00002000
+	mysqlClientSecureConn    = 0x00008000
+	mysqlClientPluginAuth    = 0x00080000
+
+	mysqlComQuery      = 0x03
+	mysqlComBinlogDump = 0x12
+
+	mysqlMaxPacket = 1<<24 - 1
+	mysqlCharset   = 45 // utf8mb4_general_ci
+)
+
+// mysqlConn is a minimal MySQL protocol connection, just enough to
+// authenticate, run session statements and request a binlog stream.
+type mysqlConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	seq  byte
+}
+
+// mysqlPublicKeyRetrievalParam is the DSN parameter that allows fetching the
+// server's RSA key over a connection without TLS.
+const mysqlPublicKeyRetrievalParam = "allowPublicKeyRetrieval"
+
+// takePublicKeyRetrieval removes allowPublicKeyRetrieval from the DSN's
+// parameters, so go-sql-driver does not send it as a session variable, and
+// reports whether it was enabled.
+func takePublicKeyRetrieval(cfg *mysql.Config) (bool, error) {
+	v, ok := cfg.Params[mysqlPublicKeyRetrievalParam]
+	if !ok {
+		return false, nil
+	}
+	delete(cfg.Params, mysqlPublicKeyRetrievalParam)
+	allow, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %q", mysqlPublicKeyRetrievalParam, v)
+	}
+	return allow, nil
+}
+
+// dialMySQL connects and authenticates using the settings of a
+// go-sql-driver DSN.
+func dialMySQL(ctx context.Context, cfg *mysql.Config, allowPublicKey bool) (*mysqlConn, error) {
+	var dialer net.Dialer
+	nc, err := dialer.DialContext(ctx, cfg.Net, cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &mysqlConn{conn: nc, br: bufio.NewReader(nc)}
+	if err := c.handshake(cfg, allowPublicKey); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *mysqlConn) Close() error { return c.conn.Close() }
+
+// readPacket reads one logical packet, joining packets split at the
+// protocol's 16 MiB boundary.
+func (c *mysqlConn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+			return nil, err
+		}
+		n := int(uint32(hdr[0]) | uint32(hdr[1])<<8 | uint32(hdr[2])<<16)
+		c.seq = hdr[3] + 1
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(c.br, buf); err != nil {
+			return nil, err
+		}
+		if payload == nil && n < mysqlMaxPacket {
+			return buf, nil
+		}
+		payload = append(payload, buf...)
+		if n < mysqlMaxPacket {
+			return payload, nil
+		}
+	}
+}
+
+func (c *mysqlConn) writePacket(payload []byte) error {
+	for {
+		n := len(payload)
+		if n > mysqlMaxPacket {
+			n = mysqlMaxPacket
+		}
+		pkt := make([]byte, 4, 4+n)
+		pkt[0], pkt[1], pkt[2], pkt[3] = byte(n), byte(n>>8), byte(n>>16), c.seq
+		c.seq++
+		if _, err := c.conn.Write(append(pkt, payload[:n]...)); err != nil {
+			return err
+		}
+		payload = payload[n:]
+		if n < mysqlMaxPacket {
+			return nil
+		}
+	}
+}
+
+func (c *mysqlConn) handshake(cfg *mysql.Config, allowPublicKey bool) error {
+	pkt, err := c.readPacket()
+	if err != nil {
+		return fmt.Errorf("read handshake: %w", err)
+	}
+	if len(pkt) > 0 && pkt[0] == 0xff {
+		return mysqlError(pkt)
+	}
+	if len(pkt) == 0 || pkt[0] != 10 {
+		return fmt.Errorf("unsupported MySQL protocol version")
+	}
+
+	r := &mysqlReader{buf: pkt[1:]}
+	r.cstring() // server version
+	r.take(4)   // connection id
+	scramble := append([]byte(nil), r.take(8)...)
+	r.take(1)
+	serverCaps := uint32(r.uint16())
+	plugin := "mysql_native_password"
+	if len(r.buf) > 0 {
+		r.take(3) // charset, status flags
+		serverCaps |= uint32(r.uint16()) << 16
+		authLen := int(r.byte())
+		r.take(10)
+		if serverCaps&mysqlClientSecureConn != 0 {
+			n := authLen - 8
+			if n < 13 {
+				n = 13
+			}
+			scramble = append(scramble, bytes.TrimRight(r.take(n), "\x00")...)
+		}
+		if serverCaps&mysqlClientPluginAuth != 0 {
+			plugin = string(bytes.TrimRight(r.buf, "\x00"))
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	caps := uint32(mysqlClientLongPassword | mysqlClientProtocol41 | mysqlClientTransactions | mysqlClientSecureConn | mysqlClientPluginAuth)
+	if cfg.DBName != "" {
+		caps |= mysqlClientConnectWithDB
+	}
+	secure := cfg.Net == "unix"
+	if cfg.TLS != nil {
+		if serverCaps&mysqlClientSSL == 0 {
+			return fmt.Errorf("server does not support TLS")
+		}
+		caps |= mysqlClientSSL
+		req := make([]byte, 32)
+		binary.LittleEndian.PutUint32(req, caps)
+		binary.LittleEndian.PutUint32(req[4:], mysqlMaxPacket)
+		req[8] = mysqlCharset
+		if err := c.writePacket(req); err != nil {
+			return err
+		}
+		tc := tls.Client(c.conn, cfg.TLS)
+		if err := tc.Handshake(); err != nil {
+			return fmt.Errorf("tls handshake: %w", err)
+		}
+		c.conn, c.br = tc, bufio.NewReader(tc)
+		secure = true
+	}
+
+	authResp, err := mysqlScramble(plugin, scramble, cfg.Passwd)
+	if err != nil {
+		return err
+	}
+	resp := make([]byte, 32, 128)
+	binary.LittleEndian.PutUint32(resp, caps)
+	binary.LittleEndian.PutUint32(resp[4:], mysqlMaxPacket)
+	resp[8] = mysqlCharset
+	resp = append(append(resp, cfg.User...), 0)
+	resp = append(append(resp, byte(len(authResp))), authResp...)
+	if cfg.DBName != "" {
+		resp = append(append(resp, cfg.DBName...), 0)
+	}
+	resp = append(append(resp, plugin...), 0)
+	if err := c.writePacket(resp); err != nil {
+		return err
+	}
+	return c.authenticate(plugin, scramble, cfg.Passwd, secure, allowPublicKey)
+}
+
+// authenticate handles the server's replies to the handshake response:
+// plugin switches and the caching_sha2_password full-authentication exchange.
+// Like the standard driver, it only fetches the server's RSA key over an
+// insecure connection when the DSN sets allowPublicKeyRetrieval, since a
+// man-in-the-middle could otherwise substitute its own key.
+func (c *mysqlConn) authenticate(plugin string, scramble []byte, password string, secure, allowPublicKey bool) error {
+	keyRequested := false
+	for {
+		pkt, err := c.readPacket()
+		if err != nil {
+			return fmt.Errorf("read auth response: %w", err)
+		}
+		if len(pkt) == 0 {
+			return fmt.Errorf("empty auth response")
+		}
+		switch pkt[0] {
+		case 0x00:
+			return nil
+		case 0xff:
+			return mysqlError(pkt)
+		case 0xfe: // auth switch request
+			r := &mysqlReader{buf: pkt[1:]}
+			plugin = r.cstring()
+			scramble = bytes.TrimRight(r.buf, "\x00")
+			resp, err := mysqlScramble(plugin, scramble, password)
+			if err != nil {
+				return err
+			}
+			if err := c.writePacket(resp); err != nil {
+				return err
+			}
+		case 0x01: // more data
+			if plugin != "caching_sha2_password" {
+				return fmt.Errorf("unexpected auth data for %s", plugin)
+			}
+			var resp []byte
+			switch {
+			case len(pkt) == 2 && pkt[1] == 3: // fast auth succeeded, OK follows
+				continue
+			case len(pkt) == 2 && pkt[1] == 4 && secure:
+				resp = append([]byte(password), 0)
+			case len(pkt) == 2 && pkt[1] == 4 && !allowPublicKey:
+				return fmt.Errorf("caching_sha2_password full authentication needs TLS or allowPublicKeyRetrieval=true")
+			case len(pkt) == 2 && pkt[1] == 4:
+				resp = []byte{2} // request the server's public key
+				keyRequested = true
+			case !keyRequested:
+				return fmt.Errorf("unexpected public key from server")
+			default:
+				if resp, err = mysqlEncryptPassword(pkt[1:], password, scramble); err != nil {
+					return err
+				}
+			}
+			if err := c.writePacket(resp); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected auth packet 0x%02x", pkt[0])
+		}
+	}
+}
+
+// mysqlScramble computes the auth response for a password plugin.
+func mysqlScramble(plugin string, scramble []byte, password string) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	if len(scramble) < 20 {
+		return nil, fmt.Errorf("short auth scramble from server")
+	}
+	switch plugin {
+	case "mysql_native_password":
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		h1 := sha1.Sum([]byte(password))
+		h2 := sha1.Sum(h1[:])
+		h := sha1.New()
+		h.Write(scramble[:20])
+		h.Write(h2[:])
+		return xorBytes(h1[:], h.Sum(nil)), nil
+	case "caching_sha2_password":
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		h1 := sha256.Sum256([]byte(password))
+		h2 := sha256.Sum256(h1[:])
+		h := sha256.New()
+		h.Write(h2[:])
+		h.Write(scramble[:20])
+		return xorBytes(h1[:], h.Sum(nil)), nil
+	}
+	return nil, fmt.Errorf("unsupported MySQL auth plugin %q", plugin)
+}
+
+// mysqlEncryptPassword encrypts the password with the server's RSA key for
+// caching_sha2_password full authentication over an insecure connection.
+func mysqlEncryptPassword(pubPEM []byte, password string, scramble []byte) ([]byte, error) {
+	block, _ := pem.Decode(pubPEM)
+	if block == nil {
+		return nil, fmt.Errorf("invalid server public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse server public key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("server public key is not RSA")
+	}
+	plain := append([]byte(password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaKey, plain, nil)
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// exec runs a statement that returns no result set.
+func (c *mysqlConn) exec(query string) error {
+	c.seq = 0
+	if err := c.writePacket(append([]byte{mysqlComQuery}, query...)); err != nil {
+		return err
+	}
+	pkt, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(pkt) > 0 && pkt[0] == 0xff {
+		return mysqlError(pkt)
+	}
+	if len(pkt) == 0 || pkt[0] != 0x00 {
+		return fmt.Errorf("unexpected result for %q", query)
+	}
+	return nil
+}
+
+// binlogDump asks the server to stream binlog events from file:pos. The
+// server ID must be unique among the server's replicas.
+func (c *mysqlConn) binlogDump(serverID uint32, file string, pos uint32) error {
+	c.seq = 0
+	buf := make([]byte, 11, 11+len(file))
+	buf[0] = mysqlComBinlogDump
+	binary.LittleEndian.PutUint32(buf[1:], pos)
+	binary.LittleEndian.PutUint32(buf[7:], serverID)
+	return c.writePacket(append(buf, file...))
+}
+
+func mysqlError(pkt []byte) error {
+	if len(pkt) < 3 {
+		return fmt.Errorf("mysql error")
+	}
+	code := binary.LittleEndian.Uint16(pkt[1:])
+	msg := pkt[3:]
+	if len(msg) >= 6 && msg[0] == '#' {
+		msg = msg[6:]
+	}
+	return fmt.Errorf("mysql error %d: %s", code, msg)
+}
+
+// mysqlReader decodes the little-endian fields of MySQL packets and binlog
+// events. Reads past the end set err and return zeros.
+type mysqlReader struct {
+	buf []byte
+	err error
+}
+
+func (r *mysqlReader) take(n int) []byte {
+	if r.err != nil || n < 0 || len(r.buf) < n {
+		if r.err == nil {
+			r.err = fmt.Errorf("truncated MySQL packet")
+		}
+		return make([]byte, max(n, 0))
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *mysqlReader) byte() byte     { return r.take(1)[0] }
+func (r *mysqlReader) uint16() uint16 { return binary.LittleEndian.Uint16(r.take(2)) }
+func (r *mysqlReader) uint32() uint32 { return binary.LittleEndian.Uint32(r.take(4)) }
+func (r *mysqlReader) uint64() uint64 { return binary.LittleEndian.Uint64(r.take(8)) }
+
+// uint reads an n-byte little-endian unsigned integer.
+func (r *mysqlReader) uint(n int) uint64 {
+	var v uint64
+	for i, b := range r.take(n) {
+		v |= uint64(b) << (8 * i)
+	}
+	return v
+}
+
+// lenenc reads a length-encoded integer.
+func (r *mysqlReader) lenenc() uint64 {
+	switch b := r.byte(); b {
+	case 0xfc:
+		return r.uint(2)
+	case 0xfd:
+		return r.uint(3)
+	case 0xfe:
+		return r.uint(8)
+	default:
+		return uint64(b)
+	}
+}
+
+func (r *mysqlReader) cstring() string {
+	if i := bytes.IndexByte(r.buf, 0); i >= 0 {
+		s := string(r.buf[:i])
+		r.buf = r.buf[i+1:]
+		return s
+	}
+	if r.err == nil {
+		r.err = fmt.Errorf("truncated MySQL packet")
+	}
+	return ""
+}
@@ -0,0 +1,599 @@
+package pipelines
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Column type codes used in binlog TABLE_MAP events.
+const (
+	mysqlTypeDecimal    = 0
+	mysqlTypeTiny       = 1
+	mysqlTypeShort      = 2
+	mysqlTypeLong       = 3
+	mysqlTypeFloat      = 4
+	mysqlTypeDouble     = 5
+	mysqlTypeNull       = 6
+	mysqlTypeTimestamp  = 7
+	mysqlTypeLongLong   = 8
+	mysqlTypeInt24      = 9
+	mysqlTypeDate       = 10
+	mysqlTypeTime       = 11
+	mysqlTypeDateTime   = 12
+	mysqlTypeYear       = 13
+	mysqlTypeVarChar    = 15
+	mysqlTypeBit        = 16
+	mysqlTypeTimestamp2 = 17
+	mysqlTypeDateTime2  = 18
+	mysqlTypeTime2      = 19
+	mysqlTypeJSON       = 245
+	mysqlTypeNewDecimal = 246
+	mysqlTypeEnum       = 247
+	mysqlTypeSet        = 248
+	mysqlTypeBlob       = 252
+	mysqlTypeVarString  = 253
+	mysqlTypeString     = 254
+	mysqlTypeGeometry   = 255
+)
+
+const mysqlTimeLayout = "2006-01-02 15:04:05.000000"
+
+// mysqlColumnMeta reads the TABLE_MAP metadata of one column.
+func mysqlColumnMeta(r *mysqlReader, typ byte) uint16 {
+	switch typ {
+	case mysqlTypeString, mysqlTypeNewDecimal:
+		b := r.take(2)
+		return uint16(b[0])<<8 | uint16(b[1])
+	case mysqlTypeVarString, mysqlTypeVarChar, mysqlTypeBit:
+		return r.uint16()
+	case mysqlTypeBlob, mysqlTypeDouble, mysqlTypeFloat, mysqlTypeGeometry, mysqlTypeJSON,
+		mysqlTypeTime2, mysqlTypeDateTime2, mysqlTypeTimestamp2:
+		return uint16(r.byte())
+	}
+	return 0
+}
+
+// mysqlValue decodes one column of a binlog row image.
+func mysqlValue(r *mysqlReader, typ byte, meta uint16, col *mysqlColumn) (interface{}, error) {
+	switch typ {
+	case mysqlTypeNull:
+		return nil, nil
+	case mysqlTypeTiny:
+		v := r.byte()
+		if col.unsigned {
+			return uint64(v), nil
+		}
+		return int64(int8(v)), nil
+	case mysqlTypeShort:
+		v := r.uint16()
+		if col.unsigned {
+			return uint64(v), nil
+		}
+		return int64(int16(v)), nil
+	case mysqlTypeInt24:
+		v := uint32(r.uint(3))
+		if col.unsigned {
+			return uint64(v), nil
+		}
+		return int64(int32(v<<8) >> 8), nil
+	case mysqlTypeLong:
+		v := r.uint32()
+		if col.unsigned {
+			return uint64(v), nil
+		}
+		return int64(int32(v)), nil
+	case mysqlTypeLongLong:
+		v := r.uint64()
+		if col.unsigned {
+			return v, nil
+		}
+		return int64(v), nil
+	case mysqlTypeFloat:
+		return math.Float32frombits(r.uint32()), nil
+	case mysqlTypeDouble:
+		return math.Float64frombits(r.uint64()), nil
+	case mysqlTypeYear:
+		if y := r.byte(); y != 0 {
+			return 1900 + int64(y), nil
+		}
+		return int64(0), nil
+	case mysqlTypeDate:
+		v := r.uint(3)
+		return fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)&15, v&31), nil
+	case mysqlTypeTimestamp:
+		return time.Unix(int64(r.uint32()), 0).UTC().Format(mysqlTimeLayout), nil
+	case mysqlTypeTimestamp2:
+		secs := binary.BigEndian.Uint32(r.take(4))
+		usec := mysqlFraction(r, meta)
+		return time.Unix(int64(secs), usec*1000).UTC().Format(mysqlTimeLayout), nil
+	case mysqlTypeDateTime:
+		v := r.uint64()
+		d, t := v/1000000, v%1000000
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d.000000", d/10000, (d/100)%100, d%100, t/10000, (t/100)%100, t%100), nil
+	case mysqlTypeDateTime2:
+		packed := int64(mysqlBigEndian(r.take(5))) - 0x8000000000
+		return mysqlPackedDatetime(packed, mysqlFraction(r, meta)), nil
+	case mysqlTypeTime:
+		v := int32(uint32(r.uint(3))<<8) >> 8
+		sign := ""
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, v/10000, (v/100)%100, v%100), nil
+	case mysqlTypeTime2:
+		return mysqlTime2(r, meta), nil
+	case mysqlTypeNewDecimal:
+		s, err := mysqlDecimal(r, int(meta>>8), int(meta&0xff))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(s), nil
+	case mysqlTypeVarChar, mysqlTypeVarString:
+		return string(r.take(mysqlStringLength(r, int(meta)))), nil
+	case mysqlTypeString:
+		realType, length := byte(mysqlTypeString), int(meta)
+		if meta >= 256 {
+			b0, b1 := byte(meta>>8), byte(meta)
+			if b0&0x30 != 0x30 {
+				length = int(b1) | int((b0&0x30)^0x30)<<4
+				realType = b0 | 0x30
+			} else {
+				realType, length = b0, int(b1)
+			}
+		}
+		switch realType {
+		case mysqlTypeEnum:
+			return col.enumValue(int(r.uint(length))), nil
+		case mysqlTypeSet:
+			return col.setValue(r.uint(length)), nil
+		}
+		return string(r.take(mysqlStringLength(r, length))), nil
+	case mysqlTypeEnum:
+		return col.enumValue(int(r.uint(int(meta & 0xff)))), nil
+	case mysqlTypeSet:
+		return col.setValue(r.uint(int(meta & 0xff))), nil
+	case mysqlTypeBit:
+		bits := int(meta>>8)*8 + int(meta&0xff)
+		return mysqlBigEndian(r.take((bits + 7) / 8)), nil
+	case mysqlTypeBlob, mysqlTypeGeometry:
+		return string(r.take(int(r.uint(int(meta))))), nil
+	case mysqlTypeJSON:
+		raw := r.take(int(r.uint(int(meta))))
+		if len(raw) == 0 {
+			return nil, nil
+		}
+		v, err := mysqlJSON(raw)
+		if err != nil {
+			return nil, err
+		}
+		out, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(out), nil
+	}
+	return nil, fmt.Errorf("unsupported binlog column type %d", typ)
+}
+
+// mysqlStringLength reads the 1- or 2-byte length prefix of a string whose
+// maximum byte length is max.
+func mysqlStringLength(r *mysqlReader, max int) int {
+	if max < 256 {
+		return int(r.byte())
+	}
+	return int(r.uint16())
+}
+
+func mysqlBigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// mysqlFraction reads the fractional-seconds part of a temporal value with
+// fsp digits of precision and returns it in microseconds.
+func mysqlFraction(r *mysqlReader, fsp uint16) int64 {
+	switch fsp {
+	case 1, 2:
+		return int64(r.byte()) * 10000
+	case 3, 4:
+		return int64(binary.BigEndian.Uint16(r.take(2))) * 100
+	case 5, 6:
+		return int64(mysqlBigEndian(r.take(3)))
+	}
+	return 0
+}
+
+// mysqlPackedDatetime formats the packed year-month-day-time integer shared
+// by DATETIME2 columns and JSON datetime values.
+func mysqlPackedDatetime(packed, usec int64) string {
+	if packed < 0 {
+		packed = -packed
+	}
+	ymd, hms := packed>>17, packed&(1<<17-1)
+	ym := ymd >> 5
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d.%06d", ym/13, ym%13, ymd&31, hms>>12, (hms>>6)&63, hms&63, usec)
+}
+
+// mysqlTime2 decodes a TIME2 value into [-]HH:MM:SS[.ffffff].
+func mysqlTime2(r *mysqlReader, fsp uint16) string {
+	var packed int64 // hms << 24 | microseconds, signed
+	switch fsp {
+	case 1, 2:
+		intPart := int64(mysqlBigEndian(r.take(3))) - 0x800000
+		frac := int64(r.byte())
+		if intPart < 0 && frac != 0 {
+			intPart++
+			frac -= 0x100
+		}
+		packed = intPart<<24 + frac*10000
+	case 3, 4:
+		intPart := int64(mysqlBigEndian(r.take(3))) - 0x800000
+		frac := int64(binary.BigEndian.Uint16(r.take(2)))
+		if intPart < 0 && frac != 0 {
+			intPart++
+			frac -= 0x10000
+		}
+		packed = intPart<<24 + frac*100
+	case 5, 6:
+		packed = int64(mysqlBigEndian(r.take(6))) - 0x800000000000
+	default:
+		packed = (int64(mysqlBigEndian(r.take(3))) - 0x800000) << 24
+	}
+	sign := ""
+	if packed < 0 {
+		sign, packed = "-", -packed
+	}
+	hms, usec := packed>>24, packed&(1<<24-1)
+	s := fmt.Sprintf("%s%02d:%02d:%02d", sign, (hms>>12)&0x3ff, (hms>>6)&63, hms&63)
+	if usec != 0 {
+		s += fmt.Sprintf(".%06d", usec)
+	}
+	return s
+}
+
+// mysqlDecimalBytes is the storage size of a group of 0-9 decimal digits.
+var mysqlDecimalBytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// mysqlDecimal decodes MySQL's binary DECIMAL format: base-10⁹ groups of
+// big-endian integers with the sign in the top bit and negative values
+// stored inverted.
+func mysqlDecimal(r *mysqlReader, precision, scale int) (string, error) {
+	if scale > precision || precision > 65 {
+		return "", fmt.Errorf("invalid decimal(%d, %d)", precision, scale)
+	}
+	intg, frac := precision-scale, scale
+	size := intg/9*4 + mysqlDecimalBytes[intg%9] + frac/9*4 + mysqlDecimalBytes[frac%9]
+	buf := append([]byte(nil), r.take(size)...)
+	if len(buf) == 0 {
+		return "0", nil
+	}
+	negative := buf[0]&0x80 == 0
+	buf[0] ^= 0x80
+	if negative {
+		for i := range buf {
+			buf[i] = ^buf[i]
+		}
+	}
+
+	group := func(n int) uint64 {
+		v := mysqlBigEndian(buf[:n])
+		buf = buf[n:]
+		return v
+	}
+	var digits strings.Builder
+	if n := mysqlDecimalBytes[intg%9]; n > 0 {
+		fmt.Fprintf(&digits, "%d", group(n))
+	}
+	for i := 0; i < intg/9; i++ {
+		fmt.Fprintf(&digits, "%09d", group(4))
+	}
+	intPart := strings.TrimLeft(digits.String(), "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	var out strings.Builder
+	if negative {
+		out.WriteByte('-')
+	}
+	out.WriteString(intPart)
+	if frac > 0 {
+		out.WriteByte('.')
+		for i := 0; i < frac/9; i++ {
+			fmt.Fprintf(&out, "%09d", group(4))
+		}
+		if n := frac % 9; n > 0 {
+			fmt.Fprintf(&out, "%0*d", n, group(mysqlDecimalBytes[n]))
+		}
+	}
+	return out.String(), nil
+}
+
+// mysqlJSON decodes MySQL's binary JSON column format.
+func mysqlJSON(b []byte) (interface{}, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	return mysqlJSONValue(b[0], b[1:])
+}
+
+func mysqlJSONValue(typ byte, data []byte) (interface{}, error) {
+	need := func(n int) error {
+		if len(data) < n {
+			return fmt.Errorf("truncated JSON value")
+		}
+		return nil
+	}
+	switch typ {
+	case 0x00, 0x01, 0x02, 0x03:
+		return mysqlJSONContainer(data, typ&1 == 1, typ < 0x02)
+	case 0x04:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		switch data[0] {
+		case 1:
+			return true, nil
+		case 2:
+			return false, nil
+		}
+		return nil, nil
+	case 0x05, 0x06:
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		v := binary.LittleEndian.Uint16(data)
+		if typ == 0x05 {
+			return int64(int16(v)), nil
+		}
+		return uint64(v), nil
+	case 0x07, 0x08:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		v := binary.LittleEndian.Uint32(data)
+		if typ == 0x07 {
+			return int64(int32(v)), nil
+		}
+		return uint64(v), nil
+	case 0x09, 0x0a, 0x0b:
+		if err := need(8); err != nil {
+			return nil, err
+		}
+		v := binary.LittleEndian.Uint64(data)
+		switch typ {
+		case 0x09:
+			return int64(v), nil
+		case 0x0a:
+			return v, nil
+		}
+		return math.Float64frombits(v), nil
+	case 0x0c:
+		n, size := mysqlJSONVarLen(data)
+		if size == 0 || len(data) < size+n {
+			return nil, fmt.Errorf("truncated JSON string")
+		}
+		return string(data[size : size+n]), nil
+	case 0x0f:
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		n, size := mysqlJSONVarLen(data[1:])
+		if size == 0 || len(data) < 1+size+n {
+			return nil, fmt.Errorf("truncated JSON opaque value")
+		}
+		return mysqlJSONOpaque(data[0], data[1+size:1+size+n])
+	}
+	return nil, fmt.Errorf("unknown JSON value type %d", typ)
+}
+
+// mysqlJSONContainer decodes an object or array. Entry offsets are relative
+// to the start of the container; small containers use 2-byte offsets and
+// large ones 4-byte offsets.
+func mysqlJSONContainer(data []byte, large, object bool) (interface{}, error) {
+	size := 2
+	if large {
+		size = 4
+	}
+	word := func(off int) (int, error) {
+		if off < 0 || off+size > len(data) {
+			return 0, fmt.Errorf("truncated JSON container")
+		}
+		if large {
+			return int(binary.LittleEndian.Uint32(data[off:])), nil
+		}
+		return int(binary.LittleEndian.Uint16(data[off:])), nil
+	}
+	count, err := word(0)
+	if err != nil {
+		return nil, err
+	}
+	valuesAt := 2 * size
+	if object {
+		valuesAt += count * (size + 2)
+	}
+
+	values := make([]interface{}, count)
+	for i := range values {
+		entry := valuesAt + i*(1+size)
+		if entry+1+size > len(data) {
+			return nil, fmt.Errorf("truncated JSON container")
+		}
+		typ := data[entry]
+		inline := typ == 0x04 || typ == 0x05 || typ == 0x06 || (large && (typ == 0x07 || typ == 0x08))
+		if inline {
+			values[i], err = mysqlJSONValue(typ, data[entry+1:entry+1+size])
+		} else {
+			var off int
+			if off, err = word(entry + 1); err == nil {
+				if off > len(data) {
+					return nil, fmt.Errorf("truncated JSON container")
+				}
+				values[i], err = mysqlJSONValue(typ, data[off:])
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !object {
+		return values, nil
+	}
+
+	obj := make(map[string]interface{}, count)
+	for i := range values {
+		entry := 2*size + i*(size+2)
+		off, err := word(entry)
+		if err != nil {
+			return nil, err
+		}
+		n := int(binary.LittleEndian.Uint16(data[entry+size:]))
+		if off+n > len(data) {
+			return nil, fmt.Errorf("truncated JSON key")
+		}
+		obj[string(data[off:off+n])] = values[i]
+	}
+	return obj, nil
+}
+
+// mysqlJSONVarLen reads a JSON string length: 7 bits per byte, low group
+// first. size is 0 if the length is malformed.
+func mysqlJSONVarLen(b []byte) (n, size int) {
+	for i := 0; i < 5 && i < len(b); i++ {
+		n |= int(b[i]&0x7f) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return n, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// mysqlJSONOpaque decodes the SQL-typed scalars MySQL stores inside JSON.
+func mysqlJSONOpaque(typ byte, data []byte) (interface{}, error) {
+	switch typ {
+	case mysqlTypeNewDecimal:
+		if len(data) < 2 {
+			return nil, fmt.Errorf("truncated JSON decimal")
+		}
+		r := &mysqlReader{buf: data[2:]}
+		s, err := mysqlDecimal(r, int(data[0]), int(data[1]))
+		if err == nil {
+			err = r.err
+		}
+		return json.Number(s), err
+	case mysqlTypeDate, mysqlTypeDateTime, mysqlTypeTimestamp, mysqlTypeDateTime2, mysqlTypeTimestamp2:
+		if len(data) < 8 {
+			return nil, fmt.Errorf("truncated JSON datetime")
+		}
+		v := int64(binary.LittleEndian.Uint64(data))
+		if v < 0 {
+			v = -v
+		}
+		s := mysqlPackedDatetime(v>>24, v&(1<<24-1))
+		if typ == mysqlTypeDate {
+			s = s[:10]
+		}
+		return s, nil
+	}
+	return string(data), nil
+}
+
+// mysqlColumn is a captured MySQL column with the details needed to decode
+// binlog values.
+type mysqlColumn struct {
+	cdcColumn
+	unsigned bool
+	values   []string // ENUM and SET members
+}
+
+func (c *mysqlColumn) enumValue(i int) string {
+	if i < 1 || i > len(c.values) {
+		return ""
+	}
+	return c.values[i-1]
+}
+
+func (c *mysqlColumn) setValue(bits uint64) string {
+	var members []string
+	for i, v := range c.values {
+		if i < 64 && bits&(1<<i) != 0 {
+			members = append(members, v)
+		}
+	}
+	return strings.Join(members, ",")
+}
+
+// mysqlClickHouseType maps an information_schema column to a ClickHouse type.
+func mysqlClickHouseType(dataType, columnType string, precision, scale int) string {
+	unsigned := strings.Contains(columnType, "unsigned")
+	pick := func(signed, uns string) string {
+		if unsigned {
+			return uns
+		}
+		return signed
+	}
+	switch dataType {
+	case "tinyint":
+		return pick("Int8", "UInt8")
+	case "smallint":
+		return pick("Int16", "UInt16")
+	case "mediumint", "int":
+		return pick("Int32", "UInt32")
+	case "bigint":
+		return pick("Int64", "UInt64")
+	case "float":
+		return "Float32"
+	case "double":
+		return "Float64"
+	case "decimal":
+		return fmt.Sprintf("Decimal(%d, %d)", precision, scale)
+	case "date":
+		return "Date32"
+	case "datetime", "timestamp":
+		return "DateTime64(6)"
+	case "year":
+		return "UInt16"
+	case "bit":
+		return "UInt64"
+	case "enum":
+		return "LowCardinality(String)"
+	}
+	return "String"
+}
+
+// mysqlEnumMembers parses the members of an enum(...) or set(...) column
+// type, e.g. enum('a','b”c').
+func mysqlEnumMembers(columnType string) []string {
+	open := strings.IndexByte(columnType, '(')
+	if open < 0 || !strings.HasSuffix(columnType, ")") {
+		return nil
+	}
+	body := columnType[open+1 : len(columnType)-1]
+	var members []string
+	var cur strings.Builder
+	inQuote := false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\'' && inQuote && i+1 < len(body) && body[i+1] == '\'':
+			cur.WriteByte('\'')
+			i++
+		case c == '\'':
+			if inQuote {
+				members = append(members, cur.String())
+				cur.Reset()
+			}
+			inQuote = !inQuote
+		case inQuote:
+			cur.WriteByte(c)
+		}
+	}
+	return members
+}
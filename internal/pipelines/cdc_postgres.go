@@ -0,0 +1,507 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// pgLSNCheckpointKey is the checkpoint entry holding the end LSN of the last
+// delivered transaction.
+const pgLSNCheckpointKey = "pg_lsn"
+
+// pgEpoch is the origin of PostgreSQL replication timestamps.
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// pgRelation is a table description received from pgoutput.
+type pgRelation struct {
+	name    string // schema.table
+	columns []cdcColumn
+	oids    []uint32
+}
+
+// startPostgresCDC streams row changes from a logical replication slot using
+// the pgoutput plugin. The slot and publication are created on first start.
+// The server is told a position is flushed only after the runner has
+// delivered every change up to it, so the slot retains anything in flight.
+func (d *DatabaseSource) startPostgresCDC(ctx context.Context, cfg ConnectorConfig, out chan<- Batch) error {
+	slot := stringField(cfg.Fields, "slot_name", cdcDefaultName(cfg.Fields))
+	publication := stringField(cfg.Fields, "publication", cdcDefaultName(cfg.Fields))
+	tables := cdcTableFilter(cfg.Fields)
+
+	conn, err := pgconn.Connect(ctx, pgReplicationConnString(stringField(cfg.Fields, "connection_string", "")))
+	if err != nil {
+		return fmt.Errorf("connect for replication: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if err := pgEnsurePublication(ctx, conn, publication, tables); err != nil {
+		return err
+	}
+	if err := pgCheckReplicaIdentity(ctx, conn, publication, tables); err != nil {
+		return err
+	}
+	if err := pgEnsureSlot(ctx, conn, slot); err != nil {
+		return err
+	}
+
+	var startLSN uint64
+	if v, ok := cfg.Checkpoint[pgLSNCheckpointKey]; ok {
+		if startLSN, err = parseLSN(v); err != nil {
+			return fmt.Errorf("invalid %s checkpoint: %w", pgLSNCheckpointKey, err)
+		}
+	}
+
+	query := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL %s (proto_version '1', publication_names '%s')", slot, formatLSN(startLSN), publication)
+	conn.Frontend().Send(&pgproto3.Query{String: query})
+	if err := conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("start replication: %w", err)
+	}
+	if err := pgAwaitCopyBoth(ctx, conn); err != nil {
+		return fmt.Errorf("start replication: %w", err)
+	}
+
+	slog.Info("Postgres CDC started", "slot", slot, "publication", publication, "start_lsn", formatLSN(startLSN))
+
+	batcher := newCDCBatcher(out, intField(cfg.Fields, "batch_size", 1000), time.Duration(intField(cfg.Fields, "batch_timeout_ms", 2000))*time.Millisecond)
+	var confirmed atomic.Uint64
+	confirmed.Store(startLSN)
+
+	relations := make(map[uint32]*pgRelation)
+	var commitTS time.Time
+	nextStatus := time.Now()
+
+	for {
+		if time.Now().After(nextStatus) {
+			if err := pgSendStandbyStatus(conn, confirmed.Load()); err != nil {
+				return fmt.Errorf("send standby status: %w", err)
+			}
+			nextStatus = time.Now().Add(10 * time.Second)
+		}
+		if batcher.due() {
+			if err := batcher.flush(ctx); err != nil {
+				return nil
+			}
+		}
+
+		recvCtx, cancel := context.WithTimeout(ctx, time.Second)
+		raw, err := conn.ReceiveMessage(recvCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if pgconn.Timeout(err) {
+				continue
+			}
+			return fmt.Errorf("receive replication message: %w", err)
+		}
+
+		var data []byte
+		switch msg := raw.(type) {
+		case *pgproto3.CopyData:
+			data = msg.Data
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("replication error: %w", pgconn.ErrorResponseToPgError(msg))
+		default:
+			continue
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		switch data[0] {
+		case 'k': // primary keepalive
+			if len(data) >= 18 && data[17] == 1 {
+				nextStatus = time.Time{}
+			}
+		case 'w': // XLogData
+			if len(data) < 25 {
+				return fmt.Errorf("short XLogData message")
+			}
+			walStart := binary.BigEndian.Uint64(data[1:9])
+			if err := handlePgOutput(data[25:], walStart, tables, relations, &commitTS, batcher, &confirmed); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handlePgOutput decodes one pgoutput protocol message.
+func handlePgOutput(msg []byte, walStart uint64, tables map[string]bool, relations map[uint32]*pgRelation, commitTS *time.Time, batcher *cdcBatcher, confirmed *atomic.Uint64) error {
+	if len(msg) == 0 {
+		return fmt.Errorf("empty pgoutput message")
+	}
+	r := &pgReader{buf: msg[1:]}
+	switch msg[0] {
+	case 'B': // begin: final LSN, commit time, xid
+		r.uint64()
+		*commitTS = pgEpoch.Add(time.Duration(r.int64()) * time.Microsecond)
+	case 'C': // commit: flags, commit LSN, end LSN, commit time
+		r.byte()
+		r.uint64()
+		endLSN := r.uint64()
+		if r.err != nil {
+			return r.err
+		}
+		batcher.commit(map[string]string{pgLSNCheckpointKey: formatLSN(endLSN)}, func(delivered bool) {
+			if delivered {
+				confirmed.Store(endLSN)
+			}
+		})
+	case 'R':
+		rel := &pgRelation{}
+		id := r.uint32()
+		namespace, name := r.cstring(), r.cstring()
+		rel.name = namespace + "." + name
+		r.byte() // replica identity
+		n := int(r.uint16())
+		for i := 0; i < n; i++ {
+			flags := r.byte()
+			colName := r.cstring()
+			oid := r.uint32()
+			typmod := int32(r.uint32())
+			chType := pgClickHouseType(oid, typmod)
+			key := flags&1 == 1
+			if !key {
+				chType = nullableType(chType)
+			}
+			rel.columns = append(rel.columns, cdcColumn{name: colName, chType: chType, key: key})
+			rel.oids = append(rel.oids, oid)
+		}
+		if r.err != nil {
+			return r.err
+		}
+		relations[id] = rel
+	case 'I', 'U', 'D':
+		rel, ok := relations[r.uint32()]
+		if r.err != nil {
+			return r.err
+		}
+		if !ok {
+			return fmt.Errorf("pgoutput change for unknown relation")
+		}
+		if len(tables) > 0 && !tables[rel.name] {
+			return nil
+		}
+		switch msg[0] {
+		case 'I':
+			r.byte() // 'N'
+			values, _ := r.tuple(rel)
+			if r.err != nil {
+				return r.err
+			}
+			batcher.add(cdcRecord(rel.name, cdcOpInsert, walStart, *commitTS, rel.columns, values, false), rel.columns)
+		case 'U':
+			var old []interface{}
+			kind := r.byte()
+			if kind == 'K' || kind == 'O' {
+				old, _ = r.tuple(rel)
+				if r.err != nil {
+					return r.err
+				}
+				batcher.add(cdcRecord(rel.name, cdcOpUpdate, walStart, *commitTS, rel.columns, old, true), rel.columns)
+				r.byte() // 'N'
+			}
+			values, unchanged := r.tuple(rel)
+			if r.err != nil {
+				return r.err
+			}
+			// Unchanged TOASTed values are only available from a full old
+			// image. Writing them as NULL would replace the correct row.
+			for _, i := range unchanged {
+				if kind != 'O' {
+					return fmt.Errorf("update on %s omits unchanged TOAST column %s; set REPLICA IDENTITY FULL", rel.name, rel.columns[i].name)
+				}
+				values[i] = old[i]
+			}
+			batcher.add(cdcRecord(rel.name, cdcOpUpdate, walStart, *commitTS, rel.columns, values, false), rel.columns)
+		case 'D':
+			r.byte() // 'K' or 'O'
+			values, _ := r.tuple(rel)
+			if r.err != nil {
+				return r.err
+			}
+			batcher.add(cdcRecord(rel.name, cdcOpDelete, walStart, *commitTS, rel.columns, values, true), rel.columns)
+		}
+	}
+	return r.err
+}
+
+// pgReader decodes the big-endian fields of a pgoutput message.
+type pgReader struct {
+	buf []byte
+	err error
+}
+
+// take returns the next n bytes, or nil and sets r.err when fewer remain.
+// Lengths come from the message itself, so nothing is allocated for them.
+func (r *pgReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.buf) < n {
+		r.err = fmt.Errorf("truncated pgoutput message")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// fixed is take for the fixed-size integer fields; after an error it
+// returns zeroes so decoding can finish before r.err is checked.
+func (r *pgReader) fixed(n int) []byte {
+	if b := r.take(n); b != nil {
+		return b
+	}
+	return make([]byte, n)
+}
+
+func (r *pgReader) byte() byte     { return r.fixed(1)[0] }
+func (r *pgReader) uint16() uint16 { return binary.BigEndian.Uint16(r.fixed(2)) }
+func (r *pgReader) uint32() uint32 { return binary.BigEndian.Uint32(r.fixed(4)) }
+func (r *pgReader) uint64() uint64 { return binary.BigEndian.Uint64(r.fixed(8)) }
+func (r *pgReader) int64() int64   { return int64(r.uint64()) }
+
+func (r *pgReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.buf {
+		if c == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+	r.err = fmt.Errorf("truncated pgoutput message")
+	return ""
+}
+
+// tuple decodes TupleData into values aligned with rel.columns. Unchanged
+// TOASTed values are not sent by the server; their indexes are returned so
+// the caller can take them from the old image.
+func (r *pgReader) tuple(rel *pgRelation) (values []interface{}, unchanged []int) {
+	n := int(r.uint16())
+	values = make([]interface{}, len(rel.columns))
+	for i := 0; i < n && r.err == nil; i++ {
+		switch r.byte() {
+		case 't':
+			text := string(r.take(int(r.uint32())))
+			if i < len(values) {
+				values[i] = pgTextValue(rel.oids[i], text)
+			}
+		case 'b':
+			r.take(int(r.uint32()))
+		case 'u':
+			if i < len(values) {
+				unchanged = append(unchanged, i)
+			}
+		}
+	}
+	return values, unchanged
+}
+
+// pgClickHouseType maps a PostgreSQL type OID to a ClickHouse type.
+func pgClickHouseType(oid uint32, typmod int32) string {
+	switch oid {
+	case 16:
+		return "Bool"
+	case 21:
+		return "Int16"
+	case 23:
+		return "Int32"
+	case 20:
+		return "Int64"
+	case 700:
+		return "Float32"
+	case 701:
+		return "Float64"
+	case 1700:
+		if typmod >= 4 {
+			mod := typmod - 4
+			return fmt.Sprintf("Decimal(%d, %d)", (mod>>16)&0xffff, mod&0xffff)
+		}
+		return "Float64"
+	case 1082:
+		return "Date32"
+	case 1114, 1184:
+		return "DateTime64(6)"
+	case 2950:
+		return "UUID"
+	}
+	return "String"
+}
+
+// pgTextValue converts a value in PostgreSQL text output format.
+func pgTextValue(oid uint32, text string) interface{} {
+	switch oid {
+	case 16:
+		return text == "t"
+	case 20, 21, 23:
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n
+		}
+	case 700, 701:
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+	case 1700:
+		if _, err := strconv.ParseFloat(text, 64); err == nil {
+			return json.Number(text)
+		}
+	case 1184:
+		for _, layout := range []string{"2006-01-02 15:04:05.999999Z07", "2006-01-02 15:04:05.999999Z07:00", "2006-01-02 15:04:05.999999Z07:00:00"} {
+			if t, err := time.Parse(layout, text); err == nil {
+				return t.UTC().Format("2006-01-02 15:04:05.000000")
+			}
+		}
+	}
+	return text
+}
+
+// pgReplicationConnString switches a connection string to a logical
+// replication connection.
+func pgReplicationConnString(connStr string) string {
+	if strings.Contains(connStr, "://") {
+		if u, err := url.Parse(connStr); err == nil {
+			q := u.Query()
+			q.Set("replication", "database")
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return connStr + " replication=database"
+}
+
+func pgEnsurePublication(ctx context.Context, conn *pgconn.PgConn, name string, tables map[string]bool) error {
+	res, err := conn.Exec(ctx, fmt.Sprintf("SELECT 1 FROM pg_publication WHERE pubname = '%s'", name)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("check publication: %w", err)
+	}
+	if len(res) > 0 && len(res[0].Rows) > 0 {
+		return nil
+	}
+
+	target := "ALL TABLES"
+	if len(tables) > 0 {
+		quoted := make([]string, 0, len(tables))
+		for t := range tables {
+			parts := strings.SplitN(t, ".", 2)
+			for i := range parts {
+				parts[i] = `"` + strings.ReplaceAll(parts[i], `"`, `""`) + `"`
+			}
+			quoted = append(quoted, strings.Join(parts, "."))
+		}
+		target = "TABLE " + strings.Join(quoted, ", ")
+	}
+	if _, err := conn.Exec(ctx, fmt.Sprintf("CREATE PUBLICATION %s FOR %s", name, target)).ReadAll(); err != nil {
+		return fmt.Errorf("create publication: %w", err)
+	}
+	slog.Info("Created Postgres publication", "publication", name, "tables", target)
+	return nil
+}
+
+// pgCheckReplicaIdentity refuses to start unless every captured table uses
+// REPLICA IDENTITY FULL. Without it, updates omit unchanged TOASTed values
+// (large text, jsonb or bytea) and the mirror cannot be kept correct.
+func pgCheckReplicaIdentity(ctx context.Context, conn *pgconn.PgConn, publication string, tables map[string]bool) error {
+	res, err := conn.Exec(ctx, fmt.Sprintf(`SELECT pt.schemaname || '.' || pt.tablename
+FROM pg_publication_tables pt
+JOIN pg_namespace n ON n.nspname = pt.schemaname
+JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = pt.tablename
+WHERE pt.pubname = '%s' AND c.relreplident <> 'f'`, publication)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("check replica identity: %w", err)
+	}
+	var missing []string
+	for _, r := range res {
+		for _, row := range r.Rows {
+			name := string(row[0])
+			if len(tables) == 0 || tables[name] {
+				missing = append(missing, name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cdc mode requires REPLICA IDENTITY FULL on %s (ALTER TABLE ... REPLICA IDENTITY FULL)", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func pgEnsureSlot(ctx context.Context, conn *pgconn.PgConn, slot string) error {
+	res, err := conn.Exec(ctx, fmt.Sprintf("SELECT 1 FROM pg_replication_slots WHERE slot_name = '%s'", slot)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("check replication slot: %w", err)
+	}
+	if len(res) > 0 && len(res[0].Rows) > 0 {
+		return nil
+	}
+	if _, err := conn.Exec(ctx, fmt.Sprintf("CREATE_REPLICATION_SLOT %s LOGICAL pgoutput NOEXPORT_SNAPSHOT", slot)).ReadAll(); err != nil {
+		return fmt.Errorf("create replication slot: %w", err)
+	}
+	slog.Info("Created Postgres replication slot", "slot", slot)
+	return nil
+}
+
+func pgAwaitCopyBoth(ctx context.Context, conn *pgconn.PgConn) error {
+	for {
+		msg, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return err
+		}
+		switch m := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(m)
+		case *pgproto3.NoticeResponse:
+		default:
+			return fmt.Errorf("unexpected message %T", msg)
+		}
+	}
+}
+
+// pgSendStandbyStatus reports lsn as written, flushed and applied so the
+// server can recycle WAL up to it.
+func pgSendStandbyStatus(conn *pgconn.PgConn, lsn uint64) error {
+	buf := make([]byte, 34)
+	buf[0] = 'r'
+	binary.BigEndian.PutUint64(buf[1:], lsn)
+	binary.BigEndian.PutUint64(buf[9:], lsn)
+	binary.BigEndian.PutUint64(buf[17:], lsn)
+	binary.BigEndian.PutUint64(buf[25:], uint64(time.Since(pgEpoch).Microseconds()))
+	conn.Frontend().Send(&pgproto3.CopyData{Data: buf})
+	return conn.Frontend().Flush()
+}
+
+func formatLSN(lsn uint64) string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+func parseLSN(s string) (uint64, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, fmt.Errorf("malformed LSN %q", s)
+	}
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("malformed LSN %q", s)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("malformed LSN %q", s)
+	}
+	return h<<32 | l, nil
+}
@@ -0,0 +1,199 @@
+package pipelines
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLSNRoundTrip(t *testing.T) {
+	lsn, err := parseLSN("16/B374D848")
+	if err != nil {
+		t.Fatalf("parseLSN: %v", err)
+	}
+	if lsn != 0x16B374D848 || formatLSN(lsn) != "16/B374D848" {
+		t.Fatalf("got %X / %s", lsn, formatLSN(lsn))
+	}
+	if _, err := parseLSN("nope"); err == nil {
+		t.Fatal("expected error for malformed LSN")
+	}
+}
+
+func TestPgOutputUpdate(t *testing.T) {
+	out := make(chan Batch, 1)
+	batcher := newCDCBatcher(out, 100, time.Hour)
+	relations := map[uint32]*pgRelation{}
+	var commitTS time.Time
+
+	// Relation 7: public.users (id int8 key, name text)
+	rel := []byte{'R', 0, 0, 0, 7}
+	rel = append(rel, "public\x00users\x00"...)
+	rel = append(rel, 'd', 0, 2)
+	rel = append(rel, 1)
+	rel = append(rel, "id\x00"...)
+	rel = append(rel, 0, 0, 0, 20, 0xff, 0xff, 0xff, 0xff)
+	rel = append(rel, 0)
+	rel = append(rel, "name\x00"...)
+	rel = append(rel, 0, 0, 0, 25, 0xff, 0xff, 0xff, 0xff)
+	if err := handlePgOutput(rel, 0, nil, relations, &commitTS, batcher, nil); err != nil {
+		t.Fatalf("relation: %v", err)
+	}
+
+	upd := []byte{'U', 0, 0, 0, 7, 'O', 0, 2, 't', 0, 0, 0, 1, '5', 't', 0, 0, 0, 1, 'a', 'N', 0, 2, 't', 0, 0, 0, 1, '5', 'n'}
+	if err := handlePgOutput(upd, 42, nil, relations, &commitTS, batcher, nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if len(batcher.buf) != 2 {
+		t.Fatalf("expected old and new rows, got %d", len(batcher.buf))
+	}
+	old, cur := batcher.buf[0].Data, batcher.buf[1].Data
+	if old["id"] != int64(5) || old["name"] != "a" || old["_sign"] != -1 || old["_is_deleted"] != 1 {
+		t.Fatalf("unexpected old row: %+v", old)
+	}
+	if cur["name"] != nil || cur["_sign"] != 1 || cur["_version"] != uint64(42) || cur["_op"] != cdcOpUpdate {
+		t.Fatalf("unexpected new row: %+v", cur)
+	}
+	if batcher.types["id"] != "Int64" || batcher.types["name"] != "Nullable(String)" {
+		t.Fatalf("unexpected types: %+v", batcher.types)
+	}
+}
+
+func TestPgOutputUpdateKeepsUnchangedToast(t *testing.T) {
+	out := make(chan Batch, 1)
+	batcher := newCDCBatcher(out, 100, time.Hour)
+	relations := map[uint32]*pgRelation{7: {
+		name:    "public.docs",
+		columns: []cdcColumn{{name: "id", chType: "Int64", key: true}, {name: "body", chType: "Nullable(String)"}},
+		oids:    []uint32{20, 25},
+	}}
+	var commitTS time.Time
+
+	upd := []byte{'U', 0, 0, 0, 7, 'O', 0, 2, 't', 0, 0, 0, 1, '5', 't', 0, 0, 0, 3, 'b', 'i', 'g', 'N', 0, 2, 't', 0, 0, 0, 1, '5', 'u'}
+	if err := handlePgOutput(upd, 42, nil, relations, &commitTS, batcher, nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if cur := batcher.buf[1].Data; cur["body"] != "big" {
+		t.Fatalf("unchanged TOAST value lost: %+v", cur)
+	}
+
+	// Without a full old image the value cannot be recovered.
+	upd = []byte{'U', 0, 0, 0, 7, 'N', 0, 2, 't', 0, 0, 0, 1, '5', 'u'}
+	if err := handlePgOutput(upd, 43, nil, relations, &commitTS, batcher, nil); err == nil {
+		t.Fatal("expected error for unchanged TOAST value without old image")
+	}
+}
+
+func TestPgOutputRejectsMalformedMessages(t *testing.T) {
+	out := make(chan Batch, 1)
+	batcher := newCDCBatcher(out, 100, time.Hour)
+	relations := map[uint32]*pgRelation{7: {
+		name:    "public.docs",
+		columns: []cdcColumn{{name: "id", chType: "Int64", key: true}},
+		oids:    []uint32{20},
+	}}
+	var commitTS time.Time
+
+	for name, msg := range map[string][]byte{
+		"empty":     {},
+		"truncated": {'I', 0, 0, 0, 7, 'N', 0, 1, 't', 0, 0, 0, 4, '5'},
+		"oversized": {'I', 0, 0, 0, 7, 'N', 0, 1, 't', 0xff, 0xff, 0xff, 0xff},
+		"commit":    {'C', 0, 0, 0, 0},
+	} {
+		if err := handlePgOutput(msg, 42, nil, relations, &commitTS, batcher, nil); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if len(batcher.buf) != 0 {
+		t.Fatalf("malformed messages produced rows: %+v", batcher.buf)
+	}
+}
+
+func TestMySQLDecimal(t *testing.T) {
+	cases := []struct {
+		data             []byte
+		precision, scale int
+		want             string
+	}{
+		{[]byte{0x80, 0x7b, 0x2d}, 5, 2, "123.45"},
+		{[]byte{0x7f, 0x84, 0xd2}, 5, 2, "-123.45"},
+		{[]byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07}, 18, 0, "7"},
+	}
+	for _, c := range cases {
+		got, err := mysqlDecimal(&mysqlReader{buf: c.data}, c.precision, c.scale)
+		if err != nil || got != c.want {
+			t.Errorf("decimal(%d,%d) %x: got %q, %v; want %q", c.precision, c.scale, c.data, got, err, c.want)
+		}
+	}
+}
+
+func TestMySQLJSON(t *testing.T) {
+	// {"a": 1, "b": [true, "x"]} in MySQL's binary format.
+	doc := []byte{
+		0x00,       // small object
+		0x02, 0x00, // element count
+		0x20, 0x00, // size
+		0x12, 0x00, 0x01, 0x00, // key "a" at 18
+		0x13, 0x00, 0x01, 0x00, // key "b" at 19
+		0x05, 0x01, 0x00, // int16 1, inlined
+		0x02, 0x14, 0x00, // small array at 20
+		'a', 'b',
+		0x02, 0x00, // element count
+		0x0c, 0x00, // size
+		0x04, 0x01, 0x00, // literal true, inlined
+		0x0c, 0x0a, 0x00, // string at 10 from the array start
+		0x01, 'x',
+	}
+	v, err := mysqlJSON(doc)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	got, _ := json.Marshal(v)
+	if string(got) != `{"a":1,"b":[true,"x"]}` {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestMySQLEnumMembers(t *testing.T) {
+	got := mysqlEnumMembers("enum('new','it''s','a,b')")
+	if want := []string{"new", "it's", "a,b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	col := mysqlColumn{values: got}
+	if col.enumValue(2) != "it's" || col.setValue(0b101) != "new,a,b" {
+		t.Fatalf("unexpected enum/set decoding")
+	}
+}
+
+func TestMySQLAuthRefusesPublicKeyRetrievalByDefault(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		// caching_sha2_password "perform full authentication".
+		server.Write([]byte{2, 0, 0, 2, 0x01, 4})
+		// Drain whatever the client sends so a key request cannot block.
+		server.Read(make([]byte, 64))
+	}()
+
+	c := &mysqlConn{conn: client, br: bufio.NewReader(client)}
+	err := c.authenticate("caching_sha2_password", bytes.Repeat([]byte{1}, 20), "secret", false, false)
+	if err == nil || !strings.Contains(err.Error(), "allowPublicKeyRetrieval") {
+		t.Fatalf("expected public key retrieval to be refused, got %v", err)
+	}
+}
+
+func TestValidateCDCRequiresSnapshotAcknowledgement(t *testing.T) {
+	cfg := ConnectorConfig{Fields: map[string]interface{}{"db_type": "postgres", "connection_string": "postgres://x", "mode": "cdc"}}
+	if err := (&DatabaseSource{}).Validate(cfg); err == nil || !strings.Contains(err.Error(), "skip_snapshot") {
+		t.Fatalf("expected cdc without skip_snapshot to be rejected, got %v", err)
+	}
+	cfg.Fields["skip_snapshot"] = true
+	if err := (&DatabaseSource{}).Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
@@ -2,15 +2,19 @@ package pipelines
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/credentials"
 	"github.com/caioricciuti/ch-ui/internal/database"
 	"github.com/caioricciuti/ch-ui/internal/tunnel"
 )
@@ -20,6 +24,7 @@ type ClickHouseSink struct {
 	gateway   *tunnel.Gateway
 	db        *database.DB
 	secretKey string
+	creds     *credentials.Resolver
 
 	tableOnce sync.Once
 	tableErr  error
@@ -31,6 +36,7 @@ func NewClickHouseSink(gw *tunnel.Gateway, db *database.DB, secretKey string) *C
 		gateway:   gw,
 		db:        db,
 		secretKey: secretKey,
+		creds:     credentials.NewResolver(db, secretKey),
 	}
 }
 
@@ -68,43 +74,135 @@ func (s *ClickHouseSink) WriteBatch(ctx context.Context, cfg ConnectorConfig, ba
 	db, _ := cfg.Fields["database"].(string)
 	table, _ := cfg.Fields["table"].(string)
 
-	// Build JSONEachRow payload
+	payload, err := jsonEachRowPayload(batch.Records)
+	if err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf("INSERT INTO `%s`.`%s` FORMAT JSONEachRow\n%s", db, table, payload)
+
+	// The token makes a retried insert of the same source range a no-op on
+	// tables with insert deduplication (replicated tables, or MergeTree with
+	// non_replicated_deduplication_window), including retries after a
+	// timeout whose outcome is unknown.
+	var settings map[string]string
+	if boolField(cfg.Fields, "insert_deduplication", true) && batch.Position != "" {
+		settings = map[string]string{"insert_deduplication_token": insertDeduplicationToken(cfg, db, table, batch.Position)}
+	}
+
+	if err := s.exec(ctx, cfg, query, settings); err != nil {
+		return 0, fmt.Errorf("execute insert: %w", err)
+	}
+
+	return len(batch.Records), nil
+}
+
+// jsonEachRowPayload renders records as JSONEachRow, forwarding pass-through
+// bytes unchanged.
+func jsonEachRowPayload(records []Record) (string, error) {
 	var sb strings.Builder
-	for _, rec := range batch.Records {
+	for _, rec := range records {
 		if len(rec.RawJSON) > 0 {
 			sb.Write(rec.RawJSON)
 		} else {
 			raw, err := json.Marshal(rec.Data)
 			if err != nil {
-				return 0, fmt.Errorf("marshal record: %w", err)
+				return "", fmt.Errorf("marshal record: %w", err)
 			}
 			sb.Write(raw)
 		}
 		sb.WriteByte('\n')
 	}
+	return sb.String(), nil
+}
 
-	query := fmt.Sprintf("INSERT INTO `%s`.`%s` FORMAT JSONEachRow\n%s", db, table, sb.String())
+// insertDeduplicationToken derives a token from the pipeline, sink node,
+// target table and the batch's source position. Identical rows read from
+// different positions are distinct inserts; only a retry or replay of the
+// same position maps to the same token.
+func insertDeduplicationToken(cfg ConnectorConfig, db, table, position string) string {
+	h := sha256.New()
+	for _, part := range []string{stringField(cfg.Fields, "pipeline_id", ""), stringField(cfg.Fields, "node_id", ""), db, table, position} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	// Find credentials from the pipeline's connection
+// exec runs a statement on the sink's connection, retrying transient
+// failures with exponential backoff: up to max_retries more attempts (default
+// 5), starting at retry_backoff_ms (default 500) and doubling up to 30s.
+// While the tunnel is offline attempts are not sent at all.
+func (s *ClickHouseSink) exec(ctx context.Context, cfg ConnectorConfig, query string, settings map[string]string) error {
 	connectionID, _ := cfg.Fields["connection_id"].(string)
 	if connectionID == "" {
-		return 0, fmt.Errorf("no connection_id in sink config")
+		return fmt.Errorf("no connection_id in sink config")
 	}
 
-	user, password, err := s.findCredentials(connectionID)
+	creds, err := s.creds.Resolve(connectionID, stringField(cfg.Fields, "credential_id", ""))
 	if err != nil {
-		return 0, fmt.Errorf("find credentials: %w", err)
+		return fmt.Errorf("find credentials: %w", err)
 	}
+	user, password := creds.User, creds.Password
 
-	_, execErr := s.gateway.ExecuteQuery(connectionID, query, user, password, 30*time.Second)
-	if execErr != nil {
-		return 0, fmt.Errorf("execute insert: %w", execErr)
+	retries := intField(cfg.Fields, "max_retries", 5)
+	backoff := time.Duration(intField(cfg.Fields, "retry_backoff_ms", 500)) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		if s.gateway.IsTunnelOnline(connectionID) {
+			_, err = s.gateway.ExecuteQueryWithSettings(connectionID, query, user, password, settings, 30*time.Second)
+			if err == nil || !isRetryableInsertError(err) {
+				return err
+			}
+		} else {
+			err = fmt.Errorf("tunnel for connection %s is offline", connectionID)
+		}
+		if attempt >= retries {
+			return fmt.Errorf("%w (gave up after %d attempts)", err, attempt+1)
+		}
+
+		slog.Warn("ClickHouse sink write failed, retrying", "connection", connectionID, "attempt", attempt+1, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (retry cancelled)", err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
 	}
+}
 
-	return len(batch.Records), nil
+// clickhouseErrorCode extracts the numeric code of a ClickHouse exception.
+var clickhouseErrorCode = regexp.MustCompile(`Code: (\d+)\.`)
+
+// transientClickHouseCodes are server errors that clear without changes to
+// the query or data.
+var transientClickHouseCodes = map[int]bool{
+	159: true, // TIMEOUT_EXCEEDED
+	202: true, // TOO_MANY_SIMULTANEOUS_QUERIES
+	209: true, // SOCKET_TIMEOUT
+	210: true, // NETWORK_ERROR
+	242: true, // TABLE_IS_READ_ONLY
+	252: true, // TOO_MANY_PARTS
+	285: true, // TOO_FEW_LIVE_REPLICAS
+	319: true, // UNKNOWN_STATUS_OF_INSERT
+	425: true, // SYSTEM_ERROR
+	999: true, // KEEPER_EXCEPTION
 }
 
-// ensureTable creates the target table if it doesn't exist, inferring schema from the first batch.
+// isRetryableInsertError reports whether a failed statement may succeed if
+// sent again. Errors without a ClickHouse exception code come from the
+// tunnel or the agent's connection to ClickHouse and are retried; exceptions
+// are retried only for transient codes, never for schema or data errors.
+func isRetryableInsertError(err error) bool {
+	m := clickhouseErrorCode.FindStringSubmatch(err.Error())
+	if m == nil {
+		return true
+	}
+	code, _ := strconv.Atoi(m[1])
+	return transientClickHouseCodes[code]
+}
+
+// ensureTable creates the target table if it doesn't exist, using create_table_columns
+// when set and otherwise the first batch's fields, typed from the source schema
+// where known and inferred from values otherwise.
 func (s *ClickHouseSink) ensureTable(ctx context.Context, cfg ConnectorConfig, batch Batch) error {
 	db := stringField(cfg.Fields, "database", "default")
 	table := stringField(cfg.Fields, "table", "")
@@ -118,46 +216,47 @@ func (s *ClickHouseSink) ensureTable(ctx context.Context, cfg ConnectorConfig, b
 		orderBy = "tuple()"
 	}
 
-	// Infer columns from first record
-	if len(batch.Records) == 0 {
-		return fmt.Errorf("cannot infer schema from empty batch")
-	}
+	// Explicit column definitions take precedence over inference
+	var cols []string
+	if explicit := strings.TrimSpace(stringField(cfg.Fields, "create_table_columns", "")); explicit != "" {
+		for _, line := range strings.Split(explicit, "\n") {
+			if line = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), ",")); line != "" {
+				cols = append(cols, line)
+			}
+		}
+	} else {
+		// Infer columns from first record
+		if len(batch.Records) == 0 {
+			return fmt.Errorf("cannot infer schema from empty batch")
+		}
 
-	data := batch.Records[0].Data
-	if len(data) == 0 {
-		return fmt.Errorf("cannot infer schema from empty record")
-	}
+		data := batch.Records[0].Data
+		if len(data) == 0 {
+			return fmt.Errorf("cannot infer schema from empty record")
+		}
 
-	// Collect column names sorted for deterministic output
-	colNames := make([]string, 0, len(data))
-	for k := range data {
-		colNames = append(colNames, k)
-	}
-	sort.Strings(colNames)
+		// Collect column names sorted for deterministic output
+		colNames := make([]string, 0, len(data))
+		for k := range data {
+			colNames = append(colNames, k)
+		}
+		sort.Strings(colNames)
 
-	// Build column definitions
-	var cols []string
-	for _, name := range colNames {
-		chType := inferClickHouseType(data[name])
-		cols = append(cols, fmt.Sprintf("`%s` %s", name, chType))
+		// Build column definitions
+		for _, name := range colNames {
+			chType, ok := batch.ColumnTypes[name]
+			if !ok {
+				chType = inferClickHouseType(data[name])
+			}
+			cols = append(cols, fmt.Sprintf("`%s` %s", name, chType))
+		}
 	}
 
 	ddl := fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s` (\n  %s\n) ENGINE = %s\nORDER BY %s",
 		db, table, strings.Join(cols, ",\n  "), engine, orderBy)
 
-	connectionID, _ := cfg.Fields["connection_id"].(string)
-	if connectionID == "" {
-		return fmt.Errorf("no connection_id in sink config")
-	}
-
-	user, password, err := s.findCredentials(connectionID)
-	if err != nil {
-		return fmt.Errorf("find credentials: %w", err)
-	}
-
-	_, execErr := s.gateway.ExecuteQuery(connectionID, ddl, user, password, 30*time.Second)
-	if execErr != nil {
-		return fmt.Errorf("execute CREATE TABLE: %w", execErr)
+	if err := s.exec(ctx, cfg, ddl, nil); err != nil {
+		return fmt.Errorf("execute CREATE TABLE: %w", err)
 	}
 
 	slog.Info("Auto-created ClickHouse table", "database", db, "table", table, "engine", engine, "columns", len(cols))
@@ -179,21 +278,3 @@ func inferClickHouseType(v interface{}) string {
 		return "String"
 	}
 }
-
-// findCredentials retrieves ClickHouse credentials from active sessions.
-func (s *ClickHouseSink) findCredentials(connectionID string) (string, string, error) {
-	sessions, err := s.db.GetActiveSessionsByConnection(connectionID, 3)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to load sessions: %w", err)
-	}
-
-	for _, sess := range sessions {
-		password, err := crypto.Decrypt(sess.EncryptedPassword, s.secretKey)
-		if err != nil {
-			continue
-		}
-		return sess.ClickhouseUser, password, nil
-	}
-
-	return "", "", fmt.Errorf("no active sessions with valid credentials for connection %s", connectionID)
-}
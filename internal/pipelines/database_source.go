@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -13,7 +14,8 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-// DatabaseSource polls a PostgreSQL or MySQL database for new rows.
+// DatabaseSource polls a PostgreSQL or MySQL database for new rows, or in
+// cdc mode streams row changes from its replication log.
 type DatabaseSource struct{}
 
 func (d *DatabaseSource) Type() string { return "source_database" }
@@ -33,6 +35,13 @@ func (d *DatabaseSource) Validate(cfg ConnectorConfig) error {
 	if connStr == "" {
 		return fmt.Errorf("connection_string is required")
 	}
+	switch stringField(cfg.Fields, "mode", "poll") {
+	case "poll":
+	case "cdc":
+		return validateCDC(cfg)
+	default:
+		return fmt.Errorf("mode must be 'poll' or 'cdc'")
+	}
 	if query == "" {
 		return fmt.Errorf("query is required")
 	}
@@ -42,6 +51,12 @@ func (d *DatabaseSource) Validate(cfg ConnectorConfig) error {
 // Start begins polling the source database and sends batches to the output channel.
 func (d *DatabaseSource) Start(ctx context.Context, cfg ConnectorConfig, out chan<- Batch) error {
 	dbType := stringField(cfg.Fields, "db_type", "")
+	if stringField(cfg.Fields, "mode", "poll") == "cdc" {
+		if dbType == "mysql" {
+			return d.startMySQLCDC(ctx, cfg, out)
+		}
+		return d.startPostgresCDC(ctx, cfg, out)
+	}
 	connStr := stringField(cfg.Fields, "connection_string", "")
 	query := stringField(cfg.Fields, "query", "")
 	pollIntervalSec := intField(cfg.Fields, "poll_interval", 60)
@@ -70,7 +85,14 @@ func (d *DatabaseSource) Start(ctx context.Context, cfg ConnectorConfig, out cha
 
 	slog.Info("Database source started", "type", dbType, "poll_interval", pollIntervalSec)
 
+	// Resume from the committed watermark, if any, bound with the Go type
+	// the driver returned for it.
 	var watermark interface{}
+	if wm, ok := cfg.Checkpoint[watermarkCheckpointKey]; ok && watermarkCol != "" {
+		if watermark, err = parseWatermarkCheckpoint(wm); err != nil {
+			return fmt.Errorf("invalid %s checkpoint: %w", watermarkCheckpointKey, err)
+		}
+	}
 	ticker := time.NewTicker(time.Duration(pollIntervalSec) * time.Second)
 	defer ticker.Stop()
 
@@ -132,7 +154,7 @@ func (d *DatabaseSource) Start(ctx context.Context, cfg ConnectorConfig, out cha
 
 			if len(buf) >= batchSize {
 				select {
-				case out <- Batch{Records: buf, SourceTS: time.Now()}:
+				case out <- Batch{Records: buf, SourceTS: time.Now(), Checkpoint: watermarkCheckpoint(watermarkCol, watermark)}:
 				case <-ctx.Done():
 					return nil
 				}
@@ -147,7 +169,7 @@ func (d *DatabaseSource) Start(ctx context.Context, cfg ConnectorConfig, out cha
 		// Flush remaining
 		if len(buf) > 0 {
 			select {
-			case out <- Batch{Records: buf, SourceTS: time.Now()}:
+			case out <- Batch{Records: buf, SourceTS: time.Now(), Checkpoint: watermarkCheckpoint(watermarkCol, watermark)}:
 			case <-ctx.Done():
 				return nil
 			}
@@ -172,3 +194,66 @@ func (d *DatabaseSource) Start(ctx context.Context, cfg ConnectorConfig, out cha
 		}
 	}
 }
+
+// watermarkCheckpointKey is the checkpoint entry holding the last delivered
+// watermark value.
+const watermarkCheckpointKey = "watermark"
+
+// watermarkValue is the stored form of a watermark. The type is kept so a
+// timestamp is bound as a time.Time on resume rather than as a string the
+// database would have to coerce.
+type watermarkValue struct {
+	Type  string `json:"type"` // datetime, int, uint, float or string
+	Value string `json:"value"`
+}
+
+// watermarkCheckpoint returns the checkpoint entry for the current watermark,
+// or nil when incremental polling is not configured.
+func watermarkCheckpoint(watermarkCol string, watermark interface{}) map[string]string {
+	if watermarkCol == "" || watermark == nil {
+		return nil
+	}
+	var v watermarkValue
+	switch t := watermark.(type) {
+	case time.Time:
+		v = watermarkValue{Type: "datetime", Value: t.Format(time.RFC3339Nano)}
+	case int64, int32, int:
+		v = watermarkValue{Type: "int", Value: fmt.Sprint(t)}
+	case uint64, uint32:
+		v = watermarkValue{Type: "uint", Value: fmt.Sprint(t)}
+	case float64:
+		v = watermarkValue{Type: "float", Value: strconv.FormatFloat(t, 'g', -1, 64)}
+	case []byte:
+		v = watermarkValue{Type: "string", Value: string(t)}
+	default:
+		v = watermarkValue{Type: "string", Value: fmt.Sprint(t)}
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return map[string]string{watermarkCheckpointKey: string(raw)}
+}
+
+// parseWatermarkCheckpoint restores a watermark saved by watermarkCheckpoint.
+// Checkpoints saved before watermarks were typed hold the bare value and are
+// returned as a string.
+func parseWatermarkCheckpoint(s string) (interface{}, error) {
+	var v watermarkValue
+	if err := json.Unmarshal([]byte(s), &v); err != nil || v.Type == "" {
+		return s, nil
+	}
+	switch v.Type {
+	case "datetime":
+		return time.Parse(time.RFC3339Nano, v.Value)
+	case "int":
+		return strconv.ParseInt(v.Value, 10, 64)
+	case "uint":
+		return strconv.ParseUint(v.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(v.Value, 64)
+	case "string":
+		return v.Value, nil
+	}
+	return nil, fmt.Errorf("unknown watermark type %q", v.Type)
+}
@@ -0,0 +1,34 @@
+package pipelines
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatermarkCheckpointRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 45, 123456000, time.FixedZone("CET", 3600))
+	for _, wm := range []interface{}{ts, int64(42), uint64(1 << 63), 1.5, "abc"} {
+		cp := watermarkCheckpoint("updated_at", wm)
+		got, err := parseWatermarkCheckpoint(cp[watermarkCheckpointKey])
+		if err != nil {
+			t.Fatalf("%v: %v", wm, err)
+		}
+		if gt, ok := got.(time.Time); ok {
+			if !gt.Equal(ts) {
+				t.Fatalf("datetime watermark: got %v, want %v", gt, ts)
+			}
+			continue
+		}
+		if got != wm {
+			t.Fatalf("watermark %v (%T) restored as %v (%T)", wm, wm, got, got)
+		}
+	}
+
+	// Checkpoints saved before watermarks were typed still resume.
+	if got, err := parseWatermarkCheckpoint("2024-03-01T11:30:45Z"); err != nil || got != "2024-03-01T11:30:45Z" {
+		t.Fatalf("legacy watermark: got %v, %v", got, err)
+	}
+	if _, err := parseWatermarkCheckpoint(`{"type":"datetime","value":"yesterday"}`); err == nil {
+		t.Fatal("expected error for malformed datetime watermark")
+	}
+}
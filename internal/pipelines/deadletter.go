@@ -0,0 +1,138 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deadLetterColumns is the fixed schema of ClickHouse dead-letter tables.
+const deadLetterColumns = "`failed_at` DateTime64(3)\n" +
+	"`pipeline_id` String\n" +
+	"`run_id` String\n" +
+	"`stage_id` String\n" +
+	"`stage` String\n" +
+	"`stage_type` String\n" +
+	"`error` String\n" +
+	"`record` String\n" +
+	"`source_ts` DateTime64(3)"
+
+// stageFailure is a batch that a transform or sink stage could not process.
+// firstSeq and lastSeq span the source batches its records came from.
+type stageFailure struct {
+	stage *stage
+	batch Batch
+	err   error
+
+	firstSeq uint64
+	lastSeq  uint64
+}
+
+// deadLetterBatch wraps every record of a failed batch into a dead-letter
+// record carrying the pipeline, stage and error so it can be replayed later.
+func deadLetterBatch(pipelineID, runID string, f stageFailure) Batch {
+	now := time.Now().UTC().Format("2006-01-02 15:04:05.000")
+	sourceTS := f.batch.SourceTS
+	if sourceTS.IsZero() {
+		sourceTS = time.Now()
+	}
+
+	out := Batch{Records: make([]Record, 0, len(f.batch.Records)), SourceTS: sourceTS}
+	if f.batch.Position != "" {
+		out.Position = f.batch.Position + "/" + f.stage.node.ID
+	}
+	for _, rec := range f.batch.Records {
+		payload := rec.RawJSON
+		if len(payload) == 0 {
+			payload, _ = json.Marshal(rec.Data)
+		}
+		out.Records = append(out.Records, Record{Data: map[string]interface{}{
+			"failed_at":   now,
+			"pipeline_id": pipelineID,
+			"run_id":      runID,
+			"stage_id":    f.stage.node.ID,
+			"stage":       f.stage.label(),
+			"stage_type":  f.stage.node.NodeType,
+			"error":       f.err.Error(),
+			"record":      string(payload),
+			"source_ts":   sourceTS.UTC().Format("2006-01-02 15:04:05.000"),
+		}})
+	}
+	return out
+}
+
+// deadLetterSinkConfig turns a sink_dead_letter node config into the config of
+// the underlying ClickHouse sink, forcing the fixed dead-letter schema.
+func deadLetterSinkConfig(cfg ConnectorConfig) ConnectorConfig {
+	fields := make(map[string]interface{}, len(cfg.Fields)+4)
+	for k, v := range cfg.Fields {
+		fields[k] = v
+	}
+	fields["create_table"] = true
+	fields["create_table_engine"] = "MergeTree"
+	fields["create_table_order_by"] = "(pipeline_id, failed_at)"
+	fields["create_table_columns"] = deadLetterColumns
+	return ConnectorConfig{NodeType: "sink_clickhouse", Fields: fields}
+}
+
+// FileSpoolSink appends records as NDJSON to hourly files in a local directory.
+// It is used as a dead-letter destination when ClickHouse itself is the
+// thing failing.
+type FileSpoolSink struct {
+	mu sync.Mutex
+}
+
+func (s *FileSpoolSink) Type() string { return "sink_file_spool" }
+
+// Validate checks the spool configuration.
+func (s *FileSpoolSink) Validate(cfg ConnectorConfig) error {
+	if stringField(cfg.Fields, "directory", "") == "" {
+		return fmt.Errorf("directory is required")
+	}
+	return nil
+}
+
+// WriteBatch appends every record to <directory>/<YYYYMMDD-HH>.ndjson.
+func (s *FileSpoolSink) WriteBatch(_ context.Context, cfg ConnectorConfig, batch Batch) (int, error) {
+	if len(batch.Records) == 0 {
+		return 0, nil
+	}
+
+	dir := stringField(cfg.Fields, "directory", "")
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return 0, fmt.Errorf("create spool directory: %w", err)
+	}
+
+	var sb strings.Builder
+	for _, rec := range batch.Records {
+		raw := rec.RawJSON
+		if len(raw) == 0 {
+			var err error
+			if raw, err = json.Marshal(rec.Data); err != nil {
+				return 0, fmt.Errorf("marshal record: %w", err)
+			}
+		}
+		sb.Write(raw)
+		sb.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := filepath.Join(dir, time.Now().UTC().Format("20060102-15")+".ndjson")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return 0, fmt.Errorf("open spool file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(sb.String()); err != nil {
+		return 0, fmt.Errorf("write spool file: %w", err)
+	}
+	return len(batch.Records), nil
+}
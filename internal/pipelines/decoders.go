@@ -0,0 +1,115 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// MessageDecoder turns a raw message value into a record.
+type MessageDecoder interface {
+	// Decode returns the record fields and, when the format carries a
+	// schema, the ClickHouse type of each field.
+	Decode(ctx context.Context, value []byte) (data map[string]interface{}, columnTypes map[string]string, err error)
+
+	// PassThrough reports whether the raw value, once any Confluent frame
+	// is stripped with unframedJSON, is valid JSONEachRow and can be
+	// forwarded to the sink unchanged.
+	PassThrough() bool
+}
+
+// newMessageDecoder builds the decoder selected by the "format" field.
+func newMessageDecoder(cfg ConnectorConfig) (MessageDecoder, error) {
+	format := stringField(cfg.Fields, "format", "json")
+	switch format {
+	case "json":
+		return jsonDecoder{}, nil
+	case "string":
+		return stringDecoder{}, nil
+	case "avro", "protobuf":
+		registryURL := stringField(cfg.Fields, "schema_registry_url", "")
+		if registryURL == "" {
+			return nil, fmt.Errorf("schema_registry_url is required for %s messages", format)
+		}
+		registry := NewSchemaRegistry(registryURL,
+			stringField(cfg.Fields, "schema_registry_username", ""),
+			stringField(cfg.Fields, "schema_registry_password", ""))
+		if format == "avro" {
+			return newAvroDecoder(registry), nil
+		}
+		return newProtobufDecoder(registry), nil
+	default:
+		return nil, fmt.Errorf("unsupported message format: %s", format)
+	}
+}
+
+// jsonDecoder decodes JSON objects. Values framed with a Confluent JSON
+// Schema header are accepted; the header is skipped.
+type jsonDecoder struct{}
+
+func (jsonDecoder) PassThrough() bool { return true }
+
+func (jsonDecoder) Decode(_ context.Context, value []byte) (map[string]interface{}, map[string]string, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(unframedJSON(value), &data); err != nil {
+		return nil, nil, err
+	}
+	return data, nil, nil
+}
+
+// unframedJSON strips the Confluent JSON Schema header, if any, from a JSON
+// message value. A JSON document never starts with the 0 magic byte.
+func unframedJSON(value []byte) []byte {
+	if _, payload, err := splitConfluentFrame(value); err == nil {
+		return payload
+	}
+	return value
+}
+
+// stringDecoder stores the whole message as a single "value" column.
+type stringDecoder struct{}
+
+func (stringDecoder) PassThrough() bool { return false }
+
+func (stringDecoder) Decode(_ context.Context, value []byte) (map[string]interface{}, map[string]string, error) {
+	return map[string]interface{}{"value": string(value)}, map[string]string{"value": "String"}, nil
+}
+
+// nullableType wraps a ClickHouse type in Nullable where ClickHouse allows it.
+func nullableType(t string) string {
+	switch {
+	case strings.HasPrefix(t, "Array("), strings.HasPrefix(t, "Map("), strings.HasPrefix(t, "Nullable("):
+		return t
+	case t == "LowCardinality(String)":
+		return "LowCardinality(Nullable(String))"
+	}
+	return "Nullable(" + t + ")"
+}
+
+// decodedScalar converts decoder-specific scalar values into values that
+// marshal to JSON ClickHouse accepts for the mapped column type.
+func decodedScalar(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.UTC().Format("2006-01-02 15:04:05.000000")
+	case *big.Rat:
+		return json.Number(x.FloatString(10))
+	case time.Duration:
+		return x.Microseconds()
+	}
+	return v
+}
+
+// jsonString encodes nested values stored in String columns.
+func jsonString(v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
@@ -0,0 +1,168 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func fakeRegistry(t *testing.T, schemas map[string]registrySchema) *SchemaRegistry {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := schemas[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(s)
+	}))
+	t.Cleanup(srv.Close)
+	return NewSchemaRegistry(srv.URL, "", "")
+}
+
+func confluentFrame(id uint32, payload []byte) []byte {
+	out := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(out[1:], id)
+	return append(out, payload...)
+}
+
+func TestAvroDecoder(t *testing.T) {
+	const schema = `{"type":"record","name":"Event","fields":[
+		{"name":"id","type":"long"},
+		{"name":"name","type":["null","string"]},
+		{"name":"tags","type":{"type":"array","items":"string"}},
+		{"name":"ts","type":{"type":"long","logicalType":"timestamp-millis"}}]}`
+	registry := fakeRegistry(t, map[string]registrySchema{"/schemas/ids/7": {Schema: schema}})
+
+	payload, err := avro.Marshal(avro.MustParse(schema), map[string]interface{}{
+		"id": int64(42), "name": "click", "tags": []string{"a"}, "ts": int64(1700000000000),
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	data, types, err := newAvroDecoder(registry).Decode(context.Background(), confluentFrame(7, payload))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if data["id"] != int64(42) || data["name"] != "click" || data["ts"] != "2023-11-14 22:13:20.000000" {
+		t.Fatalf("unexpected data: %+v", data)
+	}
+	want := map[string]string{"id": "Int64", "name": "Nullable(String)", "tags": "Array(String)", "ts": "DateTime64(3)"}
+	for k, v := range want {
+		if types[k] != v {
+			t.Fatalf("column %s: got type %q, want %q", k, types[k], v)
+		}
+	}
+}
+
+func TestProtobufDecoder(t *testing.T) {
+	const schema = `syntax = "proto3";
+package demo;
+message Other { string x = 1; }
+message Order {
+  int64 id = 1;
+  optional string note = 2;
+  repeated int32 qty = 3;
+  Status status = 4;
+  enum Status { NEW = 0; PAID = 1; }
+}`
+	registry := fakeRegistry(t, map[string]registrySchema{"/schemas/ids/3": {Schema: schema, SchemaType: "PROTOBUF"}})
+	dec := newProtobufDecoder(registry)
+
+	fd, err := dec.file(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	md := fd.Messages().Get(1)
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("id"), protoreflect.ValueOfInt64(9))
+	msg.Set(md.Fields().ByName("status"), protoreflect.ValueOfEnum(1))
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	// Message index path [1] selects the second top-level message.
+	value := confluentFrame(3, append([]byte{2, 2}, payload...))
+	data, types, err := dec.Decode(context.Background(), value)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if data["id"] != int64(9) || data["status"] != "PAID" || data["note"] != nil {
+		t.Fatalf("unexpected data: %+v", data)
+	}
+	if types["note"] != "Nullable(String)" || types["qty"] != "Array(Int32)" || types["status"] != "LowCardinality(String)" {
+		t.Fatalf("unexpected types: %+v", types)
+	}
+}
+
+func TestReadMessageIndexes_RejectsMalformedHeader(t *testing.T) {
+	huge := binary.AppendVarint(nil, 1<<60)
+	cases := map[string][]byte{
+		"empty":     {},
+		"negative":  {1},
+		"oversized": append(huge, 2),
+		"truncated": {4, 2},
+	}
+	for name, b := range cases {
+		if _, _, err := readMessageIndexes(b); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	indexes, rest, err := readMessageIndexes([]byte{4, 2, 0, 7})
+	if err != nil {
+		t.Fatalf("valid header: %v", err)
+	}
+	if len(indexes) != 2 || indexes[0] != 1 || indexes[1] != 0 || len(rest) != 1 {
+		t.Fatalf("unexpected indexes %v rest %v", indexes, rest)
+	}
+
+	registry := fakeRegistry(t, map[string]registrySchema{})
+	if _, _, err := newProtobufDecoder(registry).Decode(context.Background(), confluentFrame(1, huge)); err == nil {
+		t.Fatal("expected decode error for oversized index count")
+	}
+}
+
+func TestKafkaFramedJSONReachesSinkUnframed(t *testing.T) {
+	h := &kafkaGroupHandler{decoder: jsonDecoder{}}
+	msg := &sarama.ConsumerMessage{Value: confluentFrame(7, []byte(`{"id":1,"name":"a"}`))}
+	rec, _, err := h.record(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	payload, err := jsonEachRowPayload([]Record{rec})
+	if err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if payload != "{\"id\":1,\"name\":\"a\"}\n" {
+		t.Fatalf("sink payload = %q", payload)
+	}
+}
+
+func TestKafkaRegistryOutageIsRetried(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	h := &kafkaGroupHandler{decoder: newAvroDecoder(NewSchemaRegistry(srv.URL, "", ""))}
+	if _, _, err := h.record(context.Background(), &sarama.ConsumerMessage{Value: confluentFrame(1, []byte{2})}); err == nil {
+		t.Fatal("expected a registry outage to be returned, not wrapped as a raw row")
+	}
+
+	// A payload that is not in the wire format at all is wrapped.
+	rec, _, err := h.record(context.Background(), &sarama.ConsumerMessage{Value: []byte("garbage")})
+	if err != nil || rec.Data["_raw"] != "garbage" {
+		t.Fatalf("undecodable payload = %+v, %v", rec, err)
+	}
+}
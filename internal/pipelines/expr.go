@@ -0,0 +1,797 @@
+package pipelines
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expr is a compiled record expression used by filter and compute transforms.
+//
+// The grammar is intentionally small:
+//
+//	literals     42, 3.14, 'text', "text", true, false, null
+//	fields       user_id, payload.country, `field with spaces`
+//	operators    + - * / %   == != < <= > >=   and or not   && || !
+//	functions    lower(x), upper(x), trim(x), length(x), concat(a, b, ...),
+//	             coalesce(a, b, ...), if(cond, a, b), contains(s, sub),
+//	             starts_with(s, p), ends_with(s, p), abs(x), round(x),
+//	             to_string(x), to_number(x), now()
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// CompileExpr parses an expression string into an evaluable Expr.
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{lex: newExprLexer(src)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.tok.text, p.tok.pos)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the original expression source.
+func (e *Expr) String() string { return e.src }
+
+// Eval evaluates the expression against a record.
+func (e *Expr) Eval(data map[string]interface{}) (interface{}, error) {
+	return e.root.eval(data)
+}
+
+// EvalBool evaluates the expression and coerces the result to a boolean.
+func (e *Expr) EvalBool(data map[string]interface{}) (bool, error) {
+	v, err := e.root.eval(data)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// ── Lexer ──────────────────────────────────────────────────────────
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type exprLexer struct {
+	src string
+	pos int
+}
+
+func newExprLexer(src string) *exprLexer {
+	return &exprLexer{src: src}
+}
+
+func (l *exprLexer) next() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+
+	switch {
+	case c == '(':
+		l.pos++
+		return token{kind: tokLParen, text: "(", pos: start}, nil
+	case c == ')':
+		l.pos++
+		return token{kind: tokRParen, text: ")", pos: start}, nil
+	case c == ',':
+		l.pos++
+		return token{kind: tokComma, text: ",", pos: start}, nil
+	case c == '\'' || c == '"':
+		return l.lexString(c)
+	case c == '`':
+		end := strings.IndexByte(l.src[l.pos+1:], '`')
+		if end < 0 {
+			return token{}, fmt.Errorf("unterminated quoted identifier at position %d", start)
+		}
+		l.pos += end + 2
+		return token{kind: tokIdent, text: l.src[start+1 : l.pos-1], pos: start}, nil
+	case c >= '0' && c <= '9' || (c == '.' && l.pos+1 < len(l.src) && l.src[l.pos+1] >= '0' && l.src[l.pos+1] <= '9'):
+		for l.pos < len(l.src) && (l.src[l.pos] >= '0' && l.src[l.pos] <= '9' || l.src[l.pos] == '.' || l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+			l.pos++
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos], pos: start}, nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || l.src[l.pos] == '.' || unicode.IsLetter(rune(l.src[l.pos])) || unicode.IsDigit(rune(l.src[l.pos]))) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}, nil
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<>"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	if strings.ContainsRune("+-*/%<>!=", rune(c)) {
+		l.pos++
+		return token{kind: tokOp, text: string(c), pos: start}, nil
+	}
+
+	return token{}, fmt.Errorf("unexpected character %q at position %d", c, start)
+}
+
+func (l *exprLexer) lexString(quote byte) (token, error) {
+	start := l.pos
+	l.pos++
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '\\' && l.pos+1 < len(l.src) {
+			sb.WriteByte(l.src[l.pos+1])
+			l.pos += 2
+			continue
+		}
+		if c == quote {
+			l.pos++
+			return token{kind: tokString, text: sb.String(), pos: start}, nil
+		}
+		sb.WriteByte(c)
+		l.pos++
+	}
+	return token{}, fmt.Errorf("unterminated string at position %d", start)
+}
+
+// ── Parser ─────────────────────────────────────────────────────────
+
+type exprParser struct {
+	lex *exprLexer
+	tok token
+}
+
+func (p *exprParser) advance() error {
+	t, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = t
+	return nil
+}
+
+func (p *exprParser) isKeyword(words ...string) bool {
+	if p.tok.kind != tokIdent {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(p.tok.text, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") || p.isKeyword("or") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") || p.isKeyword("and") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.isOp("!") || p.isKeyword("not") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{inner: inner}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("==", "=", "!=", "<>", "<", "<=", ">", ">=") {
+		op := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &compareNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+", "-") {
+		op := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*", "/", "%") {
+		op := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOp("-") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithNode{op: "-", left: &literalNode{value: float64(0)}, right: inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return &literalNode{value: n}, nil
+
+	case tokString:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return &literalNode{value: tok.text}, nil
+
+	case tokLParen:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at position %d", p.tok.pos)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return inner, nil
+
+	case tokIdent:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if p.tok.kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		return &fieldNode{path: strings.Split(tok.text, ".")}, nil
+	}
+
+	if tok.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+func (p *exprParser) parseCall(name token) (exprNode, error) {
+	fn, ok := exprFuncs[strings.ToLower(name.text)]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos)
+	}
+	if err := p.advance(); err != nil { // consume (
+		return nil, err
+	}
+
+	var args []exprNode
+	for p.tok.kind != tokRParen {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.tok.kind == tokComma {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if p.tok.kind != tokRParen {
+			return nil, fmt.Errorf("expected , or ) at position %d", p.tok.pos)
+		}
+	}
+	if err := p.advance(); err != nil { // consume )
+		return nil, err
+	}
+
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments for %s()", strings.ToLower(name.text))
+	}
+	return &callNode{name: strings.ToLower(name.text), fn: fn.call, args: args}, nil
+}
+
+// ── AST ────────────────────────────────────────────────────────────
+
+type exprNode interface {
+	eval(data map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct{ value interface{} }
+
+func (n *literalNode) eval(map[string]interface{}) (interface{}, error) { return n.value, nil }
+
+type fieldNode struct{ path []string }
+
+func (n *fieldNode) eval(data map[string]interface{}) (interface{}, error) {
+	// Prefer an exact match so flattened keys containing dots still resolve.
+	if v, ok := data[strings.Join(n.path, ".")]; ok {
+		return v, nil
+	}
+	var cur interface{} = data
+	for _, part := range n.path {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		cur = m[part]
+	}
+	return cur, nil
+}
+
+type notNode struct{ inner exprNode }
+
+func (n *notNode) eval(data map[string]interface{}) (interface{}, error) {
+	v, err := n.inner.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *logicalNode) eval(data map[string]interface{}) (interface{}, error) {
+	l, err := n.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "and" && !truthy(l) {
+		return false, nil
+	}
+	if n.op == "or" && truthy(l) {
+		return true, nil
+	}
+	r, err := n.right.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(r), nil
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *compareNode) eval(data map[string]interface{}) (interface{}, error) {
+	l, err := n.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==", "=":
+		return valuesEqual(l, r), nil
+	case "!=", "<>":
+		return !valuesEqual(l, r), nil
+	}
+
+	if l == nil || r == nil {
+		return false, nil
+	}
+	cmp, err := compareValues(l, r)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+type arithNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *arithNode) eval(data map[string]interface{}) (interface{}, error) {
+	l, err := n.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	// String concatenation with +
+	if n.op == "+" {
+		_, ls := l.(string)
+		_, rs := r.(string)
+		if ls || rs {
+			return toString(l) + toString(r), nil
+		}
+	}
+
+	lf, lok := toFloat(l)
+	rf, rok := toFloat(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s requires numeric operands", n.op)
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, nil
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, nil
+		}
+		return math.Mod(lf, rf), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+type callNode struct {
+	name string
+	fn   func(args []interface{}) (interface{}, error)
+	args []exprNode
+}
+
+func (n *callNode) eval(data map[string]interface{}) (interface{}, error) {
+	// if() evaluates lazily so only the selected branch runs.
+	if n.name == "if" {
+		cond, err := n.args[0].eval(data)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return n.args[1].eval(data)
+		}
+		return n.args[2].eval(data)
+	}
+
+	vals := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(data)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return n.fn(vals)
+}
+
+// ── Functions ──────────────────────────────────────────────────────
+
+type exprFunc struct {
+	minArgs int
+	maxArgs int // -1 = variadic
+	call    func(args []interface{}) (interface{}, error)
+}
+
+var exprFuncs = map[string]exprFunc{
+	"lower": {1, 1, func(a []interface{}) (interface{}, error) { return strings.ToLower(toString(a[0])), nil }},
+	"upper": {1, 1, func(a []interface{}) (interface{}, error) { return strings.ToUpper(toString(a[0])), nil }},
+	"trim":  {1, 1, func(a []interface{}) (interface{}, error) { return strings.TrimSpace(toString(a[0])), nil }},
+	"length": {1, 1, func(a []interface{}) (interface{}, error) {
+		switch v := a[0].(type) {
+		case nil:
+			return float64(0), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		default:
+			return float64(len([]rune(toString(v)))), nil
+		}
+	}},
+	"concat": {1, -1, func(a []interface{}) (interface{}, error) {
+		var sb strings.Builder
+		for _, v := range a {
+			sb.WriteString(toString(v))
+		}
+		return sb.String(), nil
+	}},
+	"coalesce": {1, -1, func(a []interface{}) (interface{}, error) {
+		for _, v := range a {
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	}},
+	"if": {3, 3, nil}, // handled lazily in callNode.eval
+	"contains": {2, 2, func(a []interface{}) (interface{}, error) {
+		return strings.Contains(toString(a[0]), toString(a[1])), nil
+	}},
+	"starts_with": {2, 2, func(a []interface{}) (interface{}, error) {
+		return strings.HasPrefix(toString(a[0]), toString(a[1])), nil
+	}},
+	"ends_with": {2, 2, func(a []interface{}) (interface{}, error) {
+		return strings.HasSuffix(toString(a[0]), toString(a[1])), nil
+	}},
+	"abs": {1, 1, func(a []interface{}) (interface{}, error) {
+		f, ok := toFloat(a[0])
+		if !ok {
+			return nil, nil
+		}
+		return math.Abs(f), nil
+	}},
+	"round": {1, 2, func(a []interface{}) (interface{}, error) {
+		f, ok := toFloat(a[0])
+		if !ok {
+			return nil, nil
+		}
+		places := 0.0
+		if len(a) > 1 {
+			places, _ = toFloat(a[1])
+		}
+		scale := math.Pow(10, places)
+		return math.Round(f*scale) / scale, nil
+	}},
+	"to_string": {1, 1, func(a []interface{}) (interface{}, error) {
+		if a[0] == nil {
+			return nil, nil
+		}
+		return toString(a[0]), nil
+	}},
+	"to_number": {1, 1, func(a []interface{}) (interface{}, error) {
+		f, ok := toFloat(a[0])
+		if !ok {
+			return nil, nil
+		}
+		return f, nil
+	}},
+	"now": {0, 0, func([]interface{}) (interface{}, error) {
+		return time.Now().UTC().Format(time.RFC3339), nil
+	}},
+}
+
+// ── Value helpers ──────────────────────────────────────────────────
+
+// truthy reports whether a value counts as true in a boolean context.
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case int:
+		return t != 0
+	case int64:
+		return t != 0
+	case string:
+		return t != "" && !strings.EqualFold(t, "false") && t != "0"
+	default:
+		return true
+	}
+}
+
+// toFloat converts numeric-like values (including numeric strings) to float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case uint64:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case bool:
+		if t {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// toString renders any value as a string, JSON-encoding composite values.
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(t)
+		return string(b)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	_, aStr := a.(string)
+	_, bStr := b.(string)
+	if aok && bok && !(aStr && bStr) {
+		return af == bf
+	}
+	return toString(a) == toString(b)
+}
+
+func compareValues(a, b interface{}) (int, error) {
+	_, aStr := a.(string)
+	_, bStr := b.(string)
+	if af, aok := toFloat(a); aok && !(aStr && bStr) {
+		if bf, bok := toFloat(b); bok {
+			switch {
+			case af < bf:
+				return -1, nil
+			case af > bf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return strings.Compare(toString(a), toString(b)), nil
+}
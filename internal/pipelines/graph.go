@@ -0,0 +1,241 @@
+package pipelines
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+// stage is a single node of a pipeline graph together with its runtime
+// connector. Exactly one of transform/sink is set for non-source stages.
+type stage struct {
+	node      database.PipelineNode
+	cfg       ConnectorConfig
+	transform TransformConnector
+	sink      SinkConnector
+	buffer    *sinkBuffer // nil when the sink writes every batch straight through
+	parents   []string
+	children  []string
+}
+
+func (s *stage) label() string {
+	if s.node.Label != "" {
+		return s.node.Label
+	}
+	return s.node.NodeType
+}
+
+// pipelineGraph is a validated pipeline DAG with one source node.
+type pipelineGraph struct {
+	source *stage
+	stages map[string]*stage
+	order  []string // topological order, source first
+
+	// deadLetter receives batches that failed in any stage. It is not wired
+	// with edges and may be nil.
+	deadLetter *stage
+}
+
+// buildPipelineGraph parses node configs, wires edges and validates that the
+// graph is a DAG rooted at a single source where every node is reachable
+// from the source and every transform leads to at least one sink.
+func buildPipelineGraph(nodes []database.PipelineNode, edges []database.PipelineEdge) (*pipelineGraph, error) {
+	g := &pipelineGraph{stages: make(map[string]*stage, len(nodes))}
+
+	var sinkCount int
+	for i := range nodes {
+		n := nodes[i]
+		cfg, err := parseNodeConfig(&n)
+		if err != nil {
+			return nil, fmt.Errorf("parse config for node %s: %w", n.Label, err)
+		}
+		st := &stage{node: n, cfg: cfg}
+
+		switch {
+		case isSourceType(n.NodeType):
+			if g.source != nil {
+				return nil, fmt.Errorf("pipeline has multiple source nodes")
+			}
+			g.source = st
+		case isSinkType(n.NodeType):
+			sinkCount++
+		case isTransformType(n.NodeType):
+		case isDeadLetterType(n.NodeType):
+			if g.deadLetter != nil {
+				return nil, fmt.Errorf("pipeline has multiple dead-letter nodes")
+			}
+			g.deadLetter = st
+			continue
+		default:
+			return nil, fmt.Errorf("unknown node type: %s", n.NodeType)
+		}
+		g.stages[n.ID] = st
+	}
+
+	if g.source == nil {
+		return nil, fmt.Errorf("pipeline has no source node")
+	}
+	if sinkCount == 0 {
+		return nil, fmt.Errorf("pipeline has no sink node")
+	}
+
+	for _, e := range edges {
+		if g.deadLetter != nil && (e.SourceNodeID == g.deadLetter.node.ID || e.TargetNodeID == g.deadLetter.node.ID) {
+			return nil, fmt.Errorf("dead-letter node %s must not be connected; it receives failures from every stage", g.deadLetter.label())
+		}
+		from, ok := g.stages[e.SourceNodeID]
+		if !ok {
+			return nil, fmt.Errorf("edge %s references unknown node %s", e.ID, e.SourceNodeID)
+		}
+		to, ok := g.stages[e.TargetNodeID]
+		if !ok {
+			return nil, fmt.Errorf("edge %s references unknown node %s", e.ID, e.TargetNodeID)
+		}
+		if isSinkType(from.node.NodeType) {
+			return nil, fmt.Errorf("sink node %s cannot have outgoing edges", from.label())
+		}
+		if isSourceType(to.node.NodeType) {
+			return nil, fmt.Errorf("source node %s cannot have incoming edges", to.label())
+		}
+		from.children = append(from.children, to.node.ID)
+		to.parents = append(to.parents, from.node.ID)
+	}
+
+	// Kahn's algorithm from the source; any other root is disconnected.
+	indegree := make(map[string]int, len(g.stages))
+	for id, st := range g.stages {
+		indegree[id] = len(st.parents)
+	}
+	queue := []string{g.source.node.ID}
+	for _, n := range nodes {
+		st, ok := g.stages[n.ID]
+		if ok && st != g.source && indegree[n.ID] == 0 {
+			return nil, fmt.Errorf("node %s is not connected to the source", st.label())
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		g.order = append(g.order, id)
+		for _, child := range g.stages[id].children {
+			indegree[child]--
+			if indegree[child] == 0 {
+				queue = append(queue, child)
+			}
+		}
+	}
+	if len(g.order) != len(g.stages) {
+		return nil, fmt.Errorf("pipeline graph contains a cycle")
+	}
+
+	for _, st := range g.stages {
+		if isTransformType(st.node.NodeType) && !g.reachesSink(st) {
+			return nil, fmt.Errorf("transform node %s is not connected to a sink", st.label())
+		}
+	}
+
+	return g, nil
+}
+
+// reachesSink reports whether any path from st ends at a sink node.
+func (g *pipelineGraph) reachesSink(st *stage) bool {
+	if isSinkType(st.node.NodeType) {
+		return true
+	}
+	for _, child := range st.children {
+		if g.reachesSink(g.stages[child]) {
+			return true
+		}
+	}
+	return false
+}
+
+// execute pushes a source batch through every downstream stage in
+// topological order. A stage with several parents receives the merged
+// output of all of them. A failing stage is reported with its input batch
+// and contributes no records downstream; sibling branches still run.
+// Buffered sinks only write when a size threshold is reached. It returns the
+// total number of rows written across all sinks.
+func (g *pipelineGraph) execute(ctx context.Context, batch Batch) (int, []stageFailure) {
+	outputs := map[string]Batch{g.source.node.ID: batch}
+	rows := 0
+	var failures []stageFailure
+
+	for _, id := range g.order[1:] {
+		st := g.stages[id]
+
+		in := Batch{SourceTS: batch.SourceTS, ColumnTypes: batch.ColumnTypes, Position: batch.Position}
+		for _, parent := range st.parents {
+			in.Records = append(in.Records, outputs[parent].Records...)
+		}
+
+		switch {
+		case st.transform != nil:
+			out, err := st.transform.Apply(ctx, st.cfg, in)
+			if err != nil {
+				failures = append(failures, stageFailure{stage: st, batch: in, err: fmt.Errorf("transform %s: %w", st.label(), err), firstSeq: batch.seq, lastSeq: batch.seq})
+				continue
+			}
+			outputs[id] = out
+		case st.buffer != nil:
+			st.buffer.add(batch.seq, in)
+			if st.buffer.full() {
+				n, f := g.flushSink(ctx, st)
+				rows += n
+				if f != nil {
+					failures = append(failures, *f)
+				}
+			}
+		case st.sink != nil:
+			n, err := st.sink.WriteBatch(ctx, st.cfg, in)
+			if err != nil {
+				failures = append(failures, stageFailure{stage: st, batch: in, err: fmt.Errorf("sink %s: %w", st.label(), err), firstSeq: batch.seq, lastSeq: batch.seq})
+				continue
+			}
+			rows += n
+		}
+	}
+
+	return rows, failures
+}
+
+// flush writes out buffered sinks whose age threshold has passed, or every
+// non-empty buffer when force is set.
+func (g *pipelineGraph) flush(ctx context.Context, force bool) (int, []stageFailure) {
+	rows := 0
+	var failures []stageFailure
+	for _, id := range g.order[1:] {
+		st := g.stages[id]
+		if st.buffer == nil || len(st.buffer.records) == 0 || !(force || st.buffer.due()) {
+			continue
+		}
+		n, f := g.flushSink(ctx, st)
+		rows += n
+		if f != nil {
+			failures = append(failures, *f)
+		}
+	}
+	return rows, failures
+}
+
+func (g *pipelineGraph) flushSink(ctx context.Context, st *stage) (int, *stageFailure) {
+	in, first, last := st.buffer.take()
+	n, err := st.sink.WriteBatch(ctx, st.cfg, in)
+	if err != nil {
+		return 0, &stageFailure{stage: st, batch: in, err: fmt.Errorf("sink %s: %w", st.label(), err), firstSeq: first, lastSeq: last}
+	}
+	return n, nil
+}
+
+// bufferedSince returns the sequence number of the oldest source batch that
+// still has records in a sink buffer, or 0 when every buffer is empty.
+func (g *pipelineGraph) bufferedSince() uint64 {
+	var oldest uint64
+	for _, st := range g.stages {
+		if st.buffer != nil && len(st.buffer.records) > 0 && (oldest == 0 || st.buffer.firstSeq < oldest) {
+			oldest = st.buffer.firstSeq
+		}
+	}
+	return oldest
+}
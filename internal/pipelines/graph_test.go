@@ -0,0 +1,224 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/caioricciuti/ch-ui/internal/config"
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+func TestBuildPipelineGraph_TopologicalOrder(t *testing.T) {
+	nodes := []database.PipelineNode{
+		{ID: "sink", NodeType: "sink_clickhouse", ConfigEncrypted: `{}`},
+		{ID: "t2", NodeType: "transform_drop", ConfigEncrypted: `{}`},
+		{ID: "src", NodeType: "source_webhook", ConfigEncrypted: `{}`},
+		{ID: "t1", NodeType: "transform_rename", ConfigEncrypted: `{}`},
+	}
+	edges := []database.PipelineEdge{
+		{ID: "e3", SourceNodeID: "t2", TargetNodeID: "sink"},
+		{ID: "e1", SourceNodeID: "src", TargetNodeID: "t1"},
+		{ID: "e2", SourceNodeID: "t1", TargetNodeID: "t2"},
+	}
+	g, err := buildPipelineGraph(nodes, edges)
+	if err != nil {
+		t.Fatalf("build graph: %v", err)
+	}
+	want := []string{"src", "t1", "t2", "sink"}
+	for i, id := range want {
+		if g.order[i] != id {
+			t.Fatalf("expected order %v, got %v", want, g.order)
+		}
+	}
+}
+
+func TestBuildPipelineGraph_Rejects(t *testing.T) {
+	cases := map[string]struct {
+		nodes []database.PipelineNode
+		edges []database.PipelineEdge
+	}{
+		"cycle": {
+			nodes: []database.PipelineNode{
+				{ID: "src", NodeType: "source_webhook", ConfigEncrypted: `{}`},
+				{ID: "a", NodeType: "transform_drop", ConfigEncrypted: `{}`},
+				{ID: "b", NodeType: "transform_drop", ConfigEncrypted: `{}`},
+				{ID: "sink", NodeType: "sink_clickhouse", ConfigEncrypted: `{}`},
+			},
+			edges: []database.PipelineEdge{
+				{SourceNodeID: "src", TargetNodeID: "a"},
+				{SourceNodeID: "a", TargetNodeID: "b"},
+				{SourceNodeID: "b", TargetNodeID: "a"},
+				{SourceNodeID: "b", TargetNodeID: "sink"},
+			},
+		},
+		"dangling transform": {
+			nodes: []database.PipelineNode{
+				{ID: "src", NodeType: "source_webhook", ConfigEncrypted: `{}`},
+				{ID: "a", NodeType: "transform_drop", ConfigEncrypted: `{}`},
+				{ID: "sink", NodeType: "sink_clickhouse", ConfigEncrypted: `{}`},
+			},
+			edges: []database.PipelineEdge{
+				{SourceNodeID: "src", TargetNodeID: "a"},
+				{SourceNodeID: "src", TargetNodeID: "sink"},
+			},
+		},
+		"disconnected sink": {
+			nodes: []database.PipelineNode{
+				{ID: "src", NodeType: "source_webhook", ConfigEncrypted: `{}`},
+				{ID: "sink", NodeType: "sink_clickhouse", ConfigEncrypted: `{}`},
+			},
+		},
+	}
+	for name, tc := range cases {
+		if _, err := buildPipelineGraph(tc.nodes, tc.edges); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+type fakeSink struct {
+	fail    bool
+	written []Batch
+}
+
+func (s *fakeSink) Type() string                       { return "sink_fake" }
+func (s *fakeSink) Validate(cfg ConnectorConfig) error { return nil }
+func (s *fakeSink) WriteBatch(_ context.Context, _ ConnectorConfig, b Batch) (int, error) {
+	if s.fail {
+		return 0, errors.New("insert failed")
+	}
+	s.written = append(s.written, b)
+	return len(b.Records), nil
+}
+
+func TestPipelineGraph_FanOutIsolatesFailingSink(t *testing.T) {
+	nodes := []database.PipelineNode{
+		{ID: "src", NodeType: "source_webhook", ConfigEncrypted: `{}`},
+		{ID: "keep", NodeType: "transform_filter", ConfigEncrypted: `{"expression":"n > 1"}`},
+		{ID: "a", NodeType: "sink_clickhouse", ConfigEncrypted: `{}`},
+		{ID: "b", NodeType: "sink_clickhouse", ConfigEncrypted: `{}`},
+		{ID: "dlq", NodeType: "sink_dead_letter", ConfigEncrypted: `{}`},
+	}
+	edges := []database.PipelineEdge{
+		{SourceNodeID: "src", TargetNodeID: "keep"},
+		{SourceNodeID: "keep", TargetNodeID: "a"},
+		{SourceNodeID: "src", TargetNodeID: "b"},
+	}
+	g, err := buildPipelineGraph(nodes, edges)
+	if err != nil {
+		t.Fatalf("build graph: %v", err)
+	}
+	if g.deadLetter == nil || g.deadLetter.node.ID != "dlq" {
+		t.Fatalf("expected dead-letter node to be detected")
+	}
+
+	filter := &FilterTransform{}
+	if err := filter.Validate(g.stages["keep"].cfg); err != nil {
+		t.Fatalf("validate filter: %v", err)
+	}
+	good, bad := &fakeSink{}, &fakeSink{fail: true}
+	g.stages["keep"].transform = filter
+	g.stages["a"].sink = good
+	g.stages["b"].sink = bad
+
+	batch := Batch{Records: []Record{
+		{Data: map[string]interface{}{"n": 1.0}},
+		{Data: map[string]interface{}{"n": 2.0}},
+		{Data: map[string]interface{}{"n": 3.0}},
+	}}
+	rows, failures := g.execute(context.Background(), batch)
+	if rows != 2 {
+		t.Fatalf("expected 2 rows written to healthy sink, got %d", rows)
+	}
+	if len(failures) != 1 || failures[0].stage.node.ID != "b" || len(failures[0].batch.Records) != 3 {
+		t.Fatalf("unexpected failures: %+v", failures)
+	}
+
+	dl := deadLetterBatch("p1", "r1", failures[0])
+	if len(dl.Records) != 3 || dl.Records[0].Data["error"] == "" || dl.Records[0].Data["record"] != `{"n":1}` {
+		t.Fatalf("unexpected dead-letter batch: %+v", dl.Records[0].Data)
+	}
+}
+
+func TestPipelineGraph_BufferedSinkHoldsBatches(t *testing.T) {
+	nodes := []database.PipelineNode{
+		{ID: "src", NodeType: "source_webhook", ConfigEncrypted: `{}`},
+		{ID: "a", NodeType: "sink_clickhouse", ConfigEncrypted: `{"flush_rows": 4}`},
+	}
+	edges := []database.PipelineEdge{{SourceNodeID: "src", TargetNodeID: "a"}}
+	g, err := buildPipelineGraph(nodes, edges)
+	if err != nil {
+		t.Fatalf("build graph: %v", err)
+	}
+	sink := &fakeSink{}
+	g.stages["a"].sink = sink
+	g.stages["a"].buffer = newSinkBuffer(g.stages["a"].cfg)
+
+	two := func(seq uint64) Batch {
+		return Batch{seq: seq, Position: fmt.Sprintf("p%d", seq), Records: []Record{
+			{Data: map[string]interface{}{"n": 1.0}},
+			{Data: map[string]interface{}{"n": 2.0}},
+		}}
+	}
+	if rows, _ := g.execute(context.Background(), two(1)); rows != 0 || g.bufferedSince() != 1 {
+		t.Fatalf("expected first batch to stay buffered, rows=%d since=%d", rows, g.bufferedSince())
+	}
+	if rows, _ := g.execute(context.Background(), two(2)); rows != 4 || g.bufferedSince() != 0 {
+		t.Fatalf("expected flush at 4 rows, rows=%d since=%d", rows, g.bufferedSince())
+	}
+	if len(sink.written) != 1 || string(sink.written[0].Records[3].RawJSON) != `{"n":2}` || sink.written[0].Position != "p1..p2" {
+		t.Fatalf("unexpected writes: %+v", sink.written)
+	}
+
+	g.execute(context.Background(), two(3))
+	sink.fail = true
+	_, failures := g.flush(context.Background(), true)
+	if len(failures) != 1 || failures[0].firstSeq != 3 || failures[0].lastSeq != 3 {
+		t.Fatalf("unexpected failures: %+v", failures)
+	}
+}
+
+func TestIsRetryableInsertError(t *testing.T) {
+	cases := map[string]bool{
+		"tunnel not connected": true,
+		"query timeout":        true,
+		"ClickHouse error: Code: 252. DB::Exception: Too many parts (300)":             true,
+		"ClickHouse error: Code: 27. DB::Exception: Cannot parse input: expected '\"'": false,
+	}
+	for msg, want := range cases {
+		if got := isRetryableInsertError(errors.New(msg)); got != want {
+			t.Errorf("%q: got %v, want %v", msg, got, want)
+		}
+	}
+}
+
+func TestInsertDeduplicationToken_FollowsSourcePosition(t *testing.T) {
+	cfg := ConnectorConfig{Fields: map[string]interface{}{"pipeline_id": "p1", "node_id": "a"}}
+	token := insertDeduplicationToken(cfg, "db", "events", "orders/0@10-19")
+
+	if insertDeduplicationToken(cfg, "db", "events", "orders/0@10-19") != token {
+		t.Fatal("expected a replay of the same position to reuse the token")
+	}
+	if insertDeduplicationToken(cfg, "db", "events", "orders/0@20-29") == token {
+		t.Fatal("expected a new position to get a new token, even with identical rows")
+	}
+	other := ConnectorConfig{Fields: map[string]interface{}{"pipeline_id": "p1", "node_id": "b"}}
+	if insertDeduplicationToken(other, "db", "events", "orders/0@10-19") == token {
+		t.Fatal("expected sinks writing the same table to get distinct tokens")
+	}
+}
+
+func TestSetupDeadLetter_FileSpoolIgnoresConfiguredDirectory(t *testing.T) {
+	dataDir := t.TempDir()
+	r := &Runner{cfg: &config.Config{DatabasePath: filepath.Join(dataDir, "ch-ui.db")}}
+	dl := &stage{cfg: ConnectorConfig{Fields: map[string]interface{}{"destination": "file", "directory": "/etc"}}}
+	if err := r.setupDeadLetter(dl, &database.Pipeline{ID: "p1"}); err != nil {
+		t.Fatalf("setupDeadLetter: %v", err)
+	}
+	if got, want := stringField(dl.cfg.Fields, "directory", ""), filepath.Join(dataDir, "deadletter", "p1"); got != want {
+		t.Fatalf("spool directory = %q, want %q", got, want)
+	}
+}
@@ -3,10 +3,11 @@ package pipelines
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -27,20 +28,39 @@ func (k *KafkaSource) Validate(cfg ConnectorConfig) error {
 	if topic == "" {
 		return fmt.Errorf("topic is required")
 	}
+	switch stringField(cfg.Fields, "start_offset", "latest") {
+	case "latest", "earliest":
+	case "timestamp":
+		if _, err := time.Parse(time.RFC3339, stringField(cfg.Fields, "start_timestamp", "")); err != nil {
+			return fmt.Errorf("start_timestamp must be an RFC 3339 time when start_offset is timestamp")
+		}
+	default:
+		return fmt.Errorf("start_offset must be latest, earliest or timestamp")
+	}
+	if _, err := newMessageDecoder(cfg); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Start begins consuming messages from Kafka and sends batches to the output channel.
+// Offsets are committed only after the runner acknowledges a batch as
+// delivered, so messages are processed at least once.
 func (k *KafkaSource) Start(ctx context.Context, cfg ConnectorConfig, out chan<- Batch) error {
 	brokers := strings.Split(stringField(cfg.Fields, "brokers", ""), ",")
 	topic := stringField(cfg.Fields, "topic", "")
 	group := stringField(cfg.Fields, "consumer_group", "ch-ui-pipeline")
 	batchSize := intField(cfg.Fields, "batch_size", 500)
 	batchTimeoutMs := intField(cfg.Fields, "batch_timeout_ms", 5000)
+	startOffset := stringField(cfg.Fields, "start_offset", "latest")
 
 	config := sarama.NewConfig()
 	config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
 	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	if startOffset == "earliest" {
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+	config.Consumer.Offsets.AutoCommit.Enable = false
 	config.Version = sarama.V2_6_0_0
 
 	// SASL configuration
@@ -70,93 +90,255 @@ func (k *KafkaSource) Start(ctx context.Context, cfg ConnectorConfig, out chan<-
 		}
 	}
 
-	// Create consumer group
-	client, err := sarama.NewConsumerGroup(brokers, group, config)
+	client, err := sarama.NewClient(brokers, config)
 	if err != nil {
-		return fmt.Errorf("create kafka consumer group: %w", err)
+		return fmt.Errorf("create kafka client: %w", err)
 	}
 	defer client.Close()
 
+	decoder, err := newMessageDecoder(cfg)
+	if err != nil {
+		return err
+	}
+
 	handler := &kafkaGroupHandler{
 		batchSize:      batchSize,
 		batchTimeoutMs: batchTimeoutMs,
+		decoder:        decoder,
 		out:            out,
 	}
 
-	slog.Info("Kafka source started", "brokers", brokers, "topic", topic, "group", group)
+	if startOffset == "timestamp" {
+		ts, err := time.Parse(time.RFC3339, stringField(cfg.Fields, "start_timestamp", ""))
+		if err != nil {
+			return fmt.Errorf("invalid start_timestamp: %w", err)
+		}
+		if handler.startOffsets, err = kafkaOffsetsForTime(client, group, topic, ts); err != nil {
+			return err
+		}
+	}
+
+	// Create consumer group
+	consumer, err := sarama.NewConsumerGroupFromClient(group, client)
+	if err != nil {
+		return fmt.Errorf("create kafka consumer group: %w", err)
+	}
+	defer consumer.Close()
+
+	slog.Info("Kafka source started", "brokers", brokers, "topic", topic, "group", group, "start_offset", startOffset)
 
+	backoff := time.Second
 	for {
 		if ctx.Err() != nil {
 			return nil
 		}
-		if err := client.Consume(ctx, []string{topic}, handler); err != nil {
+		if err := consumer.Consume(ctx, []string{topic}, handler); err != nil {
 			return fmt.Errorf("kafka consume: %w", err)
 		}
+
+		// A batch that did not reach ClickHouse, or a message the schema
+		// registry could not be reached for, ends the session without
+		// committing; rejoining rewinds to the last committed offset.
+		if handler.undelivered.Swap(false) {
+			slog.Warn("Kafka batch not delivered, replaying from last committed offset", "topic", topic, "retry_in", backoff)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		backoff = time.Second
 	}
 }
 
+// kafkaOffsetsForTime resolves, for every partition without a committed
+// offset in the group, the first offset at or after ts. Partitions with a
+// committed offset keep resuming from it.
+func kafkaOffsetsForTime(client sarama.Client, group, topic string, ts time.Time) (map[int32]int64, error) {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("list kafka partitions: %w", err)
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("create kafka admin: %w", err)
+	}
+	committed, err := admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions})
+	if err != nil {
+		return nil, fmt.Errorf("list kafka group offsets: %w", err)
+	}
+
+	offsets := make(map[int32]int64)
+	for _, p := range partitions {
+		if block := committed.GetBlock(topic, p); block != nil && block.Offset >= 0 {
+			continue
+		}
+		off, err := client.GetOffset(topic, p, ts.UnixMilli())
+		if err != nil {
+			return nil, fmt.Errorf("resolve offset for partition %d: %w", p, err)
+		}
+		// -1 means no message at or after ts; fall back to the log end.
+		if off >= 0 {
+			offsets[p] = off
+		}
+	}
+	return offsets, nil
+}
+
+// errKafkaBatchNotDelivered ends a claim whose batch was not acknowledged.
+var errKafkaBatchNotDelivered = errors.New("kafka batch not delivered")
+
 // kafkaGroupHandler implements sarama.ConsumerGroupHandler.
 type kafkaGroupHandler struct {
 	batchSize      int
 	batchTimeoutMs int
+	decoder        MessageDecoder
 	out            chan<- Batch
+
+	// startOffsets are applied once, on the first session, to partitions
+	// that had no committed offset.
+	startOffsets map[int32]int64
+	undelivered  atomic.Bool
+}
+
+func (h *kafkaGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	for topic, partitions := range session.Claims() {
+		for _, p := range partitions {
+			if off, ok := h.startOffsets[p]; ok {
+				session.ResetOffset(topic, p, off, "")
+			}
+		}
+	}
+	h.startOffsets = nil
+	return nil
 }
 
-func (h *kafkaGroupHandler) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
 func (h *kafkaGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
 
+// record decodes one message. A payload that cannot be decoded is wrapped as
+// a raw row so it is not lost; a schema registry that cannot be reached is
+// returned as an error, since the message may decode fine once it is back.
+func (h *kafkaGroupHandler) record(ctx context.Context, msg *sarama.ConsumerMessage) (Record, map[string]string, error) {
+	data, types, err := h.decoder.Decode(ctx, msg.Value)
+	if err != nil {
+		var regErr *registryError
+		if errors.As(err, &regErr) {
+			return Record{}, nil, err
+		}
+		slog.Warn("Kafka message decode error, wrapping as raw", "error", err, "offset", msg.Offset)
+		return Record{Data: map[string]interface{}{
+			"_raw":       string(msg.Value),
+			"_topic":     msg.Topic,
+			"_partition": msg.Partition,
+			"_offset":    msg.Offset,
+			"_timestamp": msg.Timestamp.UTC().Format(time.RFC3339),
+		}}, nil, nil
+	}
+	rec := Record{Data: data}
+	if h.decoder.PassThrough() {
+		rec.RawJSON = unframedJSON(msg.Value)
+	}
+	return rec, types, nil
+}
+
 func (h *kafkaGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	var buf []Record
+	var first, last *sarama.ConsumerMessage
+	var columnTypes map[string]string
 	ticker := time.NewTicker(time.Duration(h.batchTimeoutMs) * time.Millisecond)
 	defer ticker.Stop()
 
-	flush := func() {
+	partitionKey := fmt.Sprintf("%s/%d", claim.Topic(), claim.Partition())
+
+	// failed is set by the first undelivered batch of this claim. Later
+	// verdicts are ignored so the committed offset never moves past it.
+	var failed atomic.Bool
+	notDelivered := make(chan struct{}, 1)
+
+	// flush hands the buffer to the runner. Batches may wait in sink
+	// buffers before the runner acks them, in order, so the offset of the
+	// last message is marked and committed from the ack instead of
+	// blocking consumption here.
+	flush := func() error {
+		if failed.Load() {
+			return errKafkaBatchNotDelivered
+		}
 		if len(buf) == 0 {
-			return
+			return nil
 		}
+		lastMsg := last
 		batch := Batch{
-			Records:  buf,
-			SourceTS: time.Now(),
+			Records:     buf,
+			SourceTS:    time.Now(),
+			ColumnTypes: columnTypes,
+			SourceLag:   map[string]int64{partitionKey: max(claim.HighWaterMarkOffset()-last.Offset-1, 0)},
+			Position:    fmt.Sprintf("%s@%d-%d", partitionKey, first.Offset, last.Offset),
+			Ack: func(delivered bool) {
+				if failed.Load() || session.Context().Err() != nil {
+					return
+				}
+				if !delivered {
+					failed.Store(true)
+					h.undelivered.Store(true)
+					select {
+					case notDelivered <- struct{}{}:
+					default:
+					}
+					return
+				}
+				session.MarkMessage(lastMsg, "")
+				session.Commit()
+			},
 		}
 		select {
 		case h.out <- batch:
 		case <-session.Context().Done():
-			return
+			return nil
 		}
 		buf = nil
+		columnTypes = nil
+		return nil
 	}
 
 	for {
 		select {
 		case <-session.Context().Done():
-			flush()
+			// Unflushed messages stay uncommitted and are redelivered.
 			return nil
 		case msg, ok := <-claim.Messages():
 			if !ok {
-				flush()
-				return nil
+				return flush()
 			}
-			var data map[string]interface{}
-			if err := json.Unmarshal(msg.Value, &data); err != nil {
-				slog.Warn("Kafka message parse error, wrapping as raw", "error", err, "offset", msg.Offset)
-				data = map[string]interface{}{
-					"_raw":       string(msg.Value),
-					"_topic":     msg.Topic,
-					"_partition": msg.Partition,
-					"_offset":    msg.Offset,
-					"_timestamp": msg.Timestamp.UTC().Format(time.RFC3339),
-				}
+			rec, types, err := h.record(session.Context(), msg)
+			if err != nil {
+				// Nothing from this message on is marked, so the session
+				// rejoins at the last committed offset after a backoff.
+				slog.Warn("Schema registry unavailable, retrying Kafka message", "error", err, "offset", msg.Offset)
+				h.undelivered.Store(true)
+				return err
+			}
+			if columnTypes == nil {
+				columnTypes = types
 			}
-			buf = append(buf, Record{
-				Data:    data,
-				RawJSON: msg.Value,
-			})
-			session.MarkMessage(msg, "")
+			if len(buf) == 0 {
+				first = msg
+			}
+			buf = append(buf, rec)
+			last = msg
 			if len(buf) >= h.batchSize {
-				flush()
+				if err := flush(); err != nil {
+					return err
+				}
 			}
 		case <-ticker.C:
-			flush()
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-notDelivered:
+			return errKafkaBatchNotDelivered
 		}
 	}
 }
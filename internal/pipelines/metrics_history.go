@@ -0,0 +1,60 @@
+package pipelines
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+// metricsRecorder turns the cumulative counters of a run into per-minute
+// snapshots. A snapshot is written every minute even when nothing happened,
+// so a stalled pipeline shows up as a run of zeros rather than a gap.
+type metricsRecorder struct {
+	db    *database.DB
+	rp    *RunningPipeline
+	start time.Time
+
+	rows, bytes, batches, errors, deadLettered int64
+}
+
+func newMetricsRecorder(db *database.DB, rp *RunningPipeline) *metricsRecorder {
+	return &metricsRecorder{db: db, rp: rp, start: time.Now()}
+}
+
+// untilNext returns the time left until the next minute boundary.
+func (m *metricsRecorder) untilNext() time.Duration {
+	now := time.Now()
+	return now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+}
+
+// record writes the activity since the previous snapshot into the bucket of
+// the minute the interval started in.
+func (m *metricsRecorder) record() {
+	metrics := m.rp.Metrics
+	rows := metrics.RowsIngested.Load()
+	bytes := metrics.BytesIngested.Load()
+	batches := metrics.BatchesSent.Load()
+	errors := metrics.ErrorsCount.Load()
+	deadLettered := metrics.RowsDeadLettered.Load()
+	lagAvg, lagMax := metrics.takeLag()
+
+	snapshot := database.PipelineMetricSnapshot{
+		PipelineID:       m.rp.PipelineID,
+		RunID:            m.rp.RunID,
+		Bucket:           m.start.UTC().Truncate(time.Minute).Format(time.RFC3339),
+		RowsIngested:     rows - m.rows,
+		BytesIngested:    bytes - m.bytes,
+		BatchesSent:      batches - m.batches,
+		ErrorsCount:      errors - m.errors,
+		RowsDeadLettered: deadLettered - m.deadLettered,
+		LagMsAvg:         lagAvg.Milliseconds(),
+		LagMsMax:         lagMax.Milliseconds(),
+	}
+	m.rows, m.bytes, m.batches, m.errors, m.deadLettered = rows, bytes, batches, errors, deadLettered
+	m.start = time.Now()
+
+	if err := m.db.SavePipelineMetricSnapshot(snapshot); err != nil {
+		slog.Warn("Failed to save pipeline metrics snapshot", "pipeline", m.rp.PipelineID, "error", err)
+	}
+}
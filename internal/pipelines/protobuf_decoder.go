@@ -0,0 +1,262 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protobufDecoder decodes Confluent-framed Protobuf messages. The .proto
+// schema text and its references are fetched from the registry and
+// compiled once per schema ID.
+type protobufDecoder struct {
+	registry *SchemaRegistry
+
+	mu    sync.Mutex
+	files map[int]protoreflect.FileDescriptor
+}
+
+func newProtobufDecoder(registry *SchemaRegistry) *protobufDecoder {
+	return &protobufDecoder{registry: registry, files: make(map[int]protoreflect.FileDescriptor)}
+}
+
+func (d *protobufDecoder) PassThrough() bool { return false }
+
+// Decode maps each top-level message field to a column.
+func (d *protobufDecoder) Decode(ctx context.Context, value []byte) (map[string]interface{}, map[string]string, error) {
+	id, payload, err := splitConfluentFrame(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	indexes, payload, err := readMessageIndexes(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd, err := d.file(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	md, err := messageByIndexes(fd, indexes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("schema %d: %w", id, err)
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, nil, fmt.Errorf("decode protobuf (schema %d): %w", id, err)
+	}
+
+	fields := md.Fields()
+	data := make(map[string]interface{}, fields.Len())
+	types := make(map[string]string, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		name := string(f.Name())
+		types[name] = protoClickHouseType(f)
+		if f.HasPresence() && !msg.Has(f) {
+			data[name] = nil
+			continue
+		}
+		data[name] = protoColumn(f, msg.Get(f))
+	}
+	return data, types, nil
+}
+
+// file compiles the schema registered under id together with its references.
+func (d *protobufDecoder) file(ctx context.Context, id int) (protoreflect.FileDescriptor, error) {
+	d.mu.Lock()
+	fd, ok := d.files[id]
+	d.mu.Unlock()
+	if ok {
+		return fd, nil
+	}
+
+	rs, err := d.registry.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rs.SchemaType != "PROTOBUF" {
+		return nil, fmt.Errorf("schema %d is not PROTOBUF", id)
+	}
+
+	const root = "schema.proto"
+	sources := map[string]string{root: rs.Schema}
+	if err := d.collectReferences(ctx, rs.References, sources); err != nil {
+		return nil, err
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(sources),
+		}),
+	}
+	files, err := compiler.Compile(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("compile protobuf schema %d: %w", id, err)
+	}
+
+	d.mu.Lock()
+	d.files[id] = files[0]
+	d.mu.Unlock()
+	return files[0], nil
+}
+
+func (d *protobufDecoder) collectReferences(ctx context.Context, refs []schemaReference, sources map[string]string) error {
+	for _, ref := range refs {
+		if _, ok := sources[ref.Name]; ok {
+			continue
+		}
+		rs, err := d.registry.SchemaBySubject(ctx, ref.Subject, ref.Version)
+		if err != nil {
+			return err
+		}
+		sources[ref.Name] = rs.Schema
+		if err := d.collectReferences(ctx, rs.References, sources); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMessageIndexes reads the Confluent message-index path that follows the
+// schema ID: a zigzag varint count followed by that many indexes, where a
+// single 0 byte is shorthand for the first message in the file.
+func readMessageIndexes(b []byte) ([]int, []byte, error) {
+	n, size := binary.Varint(b)
+	if size <= 0 || n < 0 {
+		return nil, nil, fmt.Errorf("invalid protobuf message index header")
+	}
+	b = b[size:]
+	if n == 0 {
+		return []int{0}, b, nil
+	}
+	// Every index takes at least one byte, so a count larger than the
+	// remaining payload is malformed and must not drive the allocation.
+	if n > int64(len(b)) {
+		return nil, nil, fmt.Errorf("invalid protobuf message index header")
+	}
+	indexes := make([]int, n)
+	for i := range indexes {
+		v, size := binary.Varint(b)
+		if size <= 0 {
+			return nil, nil, fmt.Errorf("invalid protobuf message index header")
+		}
+		indexes[i] = int(v)
+		b = b[size:]
+	}
+	return indexes, b, nil
+}
+
+// messageByIndexes walks the message-index path into nested messages.
+func messageByIndexes(fd protoreflect.FileDescriptor, indexes []int) (protoreflect.MessageDescriptor, error) {
+	msgs := fd.Messages()
+	var md protoreflect.MessageDescriptor
+	for _, i := range indexes {
+		if i < 0 || i >= msgs.Len() {
+			return nil, fmt.Errorf("message index %v out of range", indexes)
+		}
+		md = msgs.Get(i)
+		msgs = md.Messages()
+	}
+	if md == nil {
+		return nil, fmt.Errorf("schema defines no messages")
+	}
+	return md, nil
+}
+
+const protoTimestamp = "google.protobuf.Timestamp"
+
+// protoClickHouseType maps a Protobuf field to a ClickHouse column type.
+// Nested messages other than Timestamp are stored as JSON strings.
+func protoClickHouseType(f protoreflect.FieldDescriptor) string {
+	switch {
+	case f.IsMap():
+		return "Map(" + protoScalarType(f.MapKey()) + ", " + protoScalarType(f.MapValue()) + ")"
+	case f.IsList():
+		return "Array(" + protoScalarType(f) + ")"
+	case f.HasPresence():
+		return nullableType(protoScalarType(f))
+	}
+	return protoScalarType(f)
+}
+
+func protoScalarType(f protoreflect.FieldDescriptor) string {
+	switch f.Kind() {
+	case protoreflect.BoolKind:
+		return "Bool"
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return "Int32"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return "UInt32"
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return "Int64"
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return "UInt64"
+	case protoreflect.FloatKind:
+		return "Float32"
+	case protoreflect.DoubleKind:
+		return "Float64"
+	case protoreflect.EnumKind:
+		return "LowCardinality(String)"
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if f.Message().FullName() == protoTimestamp {
+			return "DateTime64(9)"
+		}
+	}
+	return "String"
+}
+
+// protoColumn converts a field value into the JSON shape of its column.
+func protoColumn(f protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch {
+	case f.IsMap():
+		out := make(map[string]interface{}, v.Map().Len())
+		v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+			out[k.String()] = protoScalar(f.MapValue(), mv)
+			return true
+		})
+		return out
+	case f.IsList():
+		list := v.List()
+		out := make([]interface{}, list.Len())
+		for i := range out {
+			out[i] = protoScalar(f, list.Get(i))
+		}
+		return out
+	}
+	return protoScalar(f, v)
+}
+
+func protoScalar(f protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch f.Kind() {
+	case protoreflect.EnumKind:
+		if ev := f.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return fmt.Sprint(v.Enum())
+	case protoreflect.BytesKind:
+		return string(v.Bytes())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		m := v.Message()
+		if m.Descriptor().FullName() == protoTimestamp {
+			fields := m.Descriptor().Fields()
+			secs := m.Get(fields.ByName("seconds")).Int()
+			nanos := m.Get(fields.ByName("nanos")).Int()
+			return time.Unix(secs, nanos).UTC().Format("2006-01-02 15:04:05.000000000")
+		}
+		raw, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m.Interface())
+		if err != nil {
+			return nil
+		}
+		return string(raw)
+	}
+	return v.Interface()
+}
@@ -17,3 +17,23 @@ func NewSource(nodeType string) (SourceConnector, error) {
 		return nil, fmt.Errorf("unknown source type: %s", nodeType)
 	}
 }
+
+// NewTransform returns a TransformConnector for the given node type.
+func NewTransform(nodeType string) (TransformConnector, error) {
+	switch nodeType {
+	case "transform_rename":
+		return &RenameTransform{}, nil
+	case "transform_drop":
+		return &DropTransform{}, nil
+	case "transform_cast":
+		return &CastTransform{}, nil
+	case "transform_filter":
+		return &FilterTransform{}, nil
+	case "transform_flatten":
+		return &FlattenTransform{}, nil
+	case "transform_compute":
+		return &ComputeTransform{}, nil
+	default:
+		return nil, fmt.Errorf("unknown transform type: %s", nodeType)
+	}
+}
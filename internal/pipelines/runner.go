@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -21,6 +22,11 @@ type RunningPipeline struct {
 	Metrics    *Metrics
 	StartedAt  time.Time
 	Done       chan struct{}
+
+	// checkpointsHeld is set once a batch is lost without a dead-letter
+	// copy. Later checkpoints would move the resume point past the lost
+	// records, so none are saved for the rest of the run.
+	checkpointsHeld bool
 }
 
 // Runner manages the lifecycle of all running pipelines.
@@ -32,6 +38,8 @@ type Runner struct {
 	mu        sync.RWMutex
 	pipelines map[string]*RunningPipeline
 	stopCh    chan struct{}
+
+	onRunComplete func(pipelineID, status string)
 }
 
 // NewRunner creates a new pipeline runner.
@@ -45,6 +53,12 @@ func NewRunner(db *database.DB, gw *tunnel.Gateway, cfg *config.Config) *Runner
 	}
 }
 
+// OnRunComplete registers fn to be called when a pipeline run finishes. It
+// must be set before Start.
+func (r *Runner) OnRunComplete(fn func(pipelineID, status string)) {
+	r.onRunComplete = fn
+}
+
 // Start resumes any pipelines that were in "running" status (crash recovery).
 func (r *Runner) Start() {
 	go func() {
@@ -109,70 +123,61 @@ func (r *Runner) StartPipeline(pipelineID string) error {
 		return fmt.Errorf("load pipeline graph: %w", err)
 	}
 
-	// Find source and sink nodes
-	var sourceNode *database.PipelineNode
-	var sinkNode *database.PipelineNode
-	for i := range nodes {
-		switch {
-		case isSourceType(nodes[i].NodeType):
-			if sourceNode != nil {
-				return fmt.Errorf("pipeline has multiple source nodes")
-			}
-			sourceNode = &nodes[i]
-		case nodes[i].NodeType == "sink_clickhouse":
-			if sinkNode != nil {
-				return fmt.Errorf("pipeline has multiple sink nodes")
-			}
-			sinkNode = &nodes[i]
-		}
-	}
-
-	if sourceNode == nil {
-		return fmt.Errorf("pipeline has no source node")
-	}
-	if sinkNode == nil {
-		return fmt.Errorf("pipeline has no sink node")
-	}
-
-	// Validate that source connects to sink
-	connected := false
-	for _, e := range edges {
-		if e.SourceNodeID == sourceNode.ID && e.TargetNodeID == sinkNode.ID {
-			connected = true
-			break
-		}
-	}
-	if !connected {
-		return fmt.Errorf("source node is not connected to sink node")
-	}
-
-	// Parse node configs
-	sourceCfg, err := parseNodeConfig(sourceNode)
+	graph, err := buildPipelineGraph(nodes, edges)
 	if err != nil {
-		return fmt.Errorf("parse source config: %w", err)
-	}
-	sinkCfg, err := parseNodeConfig(sinkNode)
-	if err != nil {
-		return fmt.Errorf("parse sink config: %w", err)
+		return err
 	}
 
-	// Inject runtime fields into configs
-	sinkCfg.Fields["connection_id"] = pipeline.ConnectionID
+	// Inject runtime fields and instantiate connectors
+	sourceCfg := graph.source.cfg
 	sourceCfg.Fields["pipeline_id"] = pipelineID
-
-	// Instantiate connectors
 	source, err := NewSource(sourceCfg.NodeType)
 	if err != nil {
 		return fmt.Errorf("create source connector: %w", err)
 	}
-	sink := NewClickHouseSink(r.gateway, r.db, r.cfg.AppSecretKey)
-
-	// Validate configs
 	if err := source.Validate(sourceCfg); err != nil {
 		return fmt.Errorf("validate source config: %w", err)
 	}
-	if err := sink.Validate(sinkCfg); err != nil {
-		return fmt.Errorf("validate sink config: %w", err)
+
+	checkpoints, err := r.db.GetPipelineCheckpoints(pipelineID)
+	if err != nil {
+		return fmt.Errorf("load pipeline checkpoints: %w", err)
+	}
+	sourceCfg.Checkpoint = make(map[string]string, len(checkpoints))
+	for _, c := range checkpoints {
+		sourceCfg.Checkpoint[c.Key] = c.Value
+	}
+
+	for _, id := range graph.order[1:] {
+		st := graph.stages[id]
+		switch {
+		case isTransformType(st.node.NodeType):
+			t, err := NewTransform(st.node.NodeType)
+			if err != nil {
+				return fmt.Errorf("create transform %s: %w", st.label(), err)
+			}
+			if err := t.Validate(st.cfg); err != nil {
+				return fmt.Errorf("validate transform %s: %w", st.label(), err)
+			}
+			st.transform = t
+		case isSinkType(st.node.NodeType):
+			// Sinks may target another connection; default to the pipeline's.
+			defaultSinkConnection(st.cfg, pipeline)
+			st.cfg.Fields["pipeline_id"] = pipelineID
+			st.cfg.Fields["node_id"] = st.node.ID
+			sink := NewClickHouseSink(r.gateway, r.db, r.cfg.AppSecretKey)
+			if err := sink.Validate(st.cfg); err != nil {
+				return fmt.Errorf("validate sink %s: %w", st.label(), err)
+			}
+			st.sink = sink
+			st.buffer = newSinkBuffer(st.cfg)
+		}
+	}
+
+	if dl := graph.deadLetter; dl != nil {
+		if err := r.setupDeadLetter(dl, pipeline); err != nil {
+			return fmt.Errorf("dead-letter %s: %w", dl.label(), err)
+		}
 	}
 
 	// Create run record
@@ -202,10 +207,10 @@ func (r *Runner) StartPipeline(pipelineID string) error {
 	r.pipelines[pipelineID] = rp
 	r.mu.Unlock()
 
-	go r.runPipeline(ctx, rp, source, sink, sourceCfg, sinkCfg, pipeline.ConnectionID)
+	go r.runPipeline(ctx, rp, source, sourceCfg, graph)
 
 	r.db.CreatePipelineRunLog(runID, "info", "Pipeline started")
-	slog.Info("Pipeline started", "pipeline", pipelineID, "source", sourceCfg.NodeType, "run", runID)
+	slog.Info("Pipeline started", "pipeline", pipelineID, "source", sourceCfg.NodeType, "stages", len(graph.order), "run", runID)
 	return nil
 }
 
@@ -245,7 +250,7 @@ func (r *Runner) GetRunningMetrics(pipelineID string) *Metrics {
 }
 
 // runPipeline is the main execution loop for a single pipeline.
-func (r *Runner) runPipeline(ctx context.Context, rp *RunningPipeline, source SourceConnector, sink SinkConnector, sourceCfg, sinkCfg ConnectorConfig, connectionID string) {
+func (r *Runner) runPipeline(ctx context.Context, rp *RunningPipeline, source SourceConnector, sourceCfg ConnectorConfig, graph *pipelineGraph) {
 	defer close(rp.Done)
 	defer func() {
 		r.mu.Lock()
@@ -262,33 +267,59 @@ func (r *Runner) runPipeline(ctx context.Context, rp *RunningPipeline, source So
 		close(batchCh)
 	}()
 
-	// Consume batches and write to sink
-	for batch := range batchCh {
+	// Consume batches and push them through the graph. The ticker drives
+	// time-based flushes of buffered sinks while the source is idle.
+	var seq uint64
+	var pending []pendingBatch
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	history := newMetricsRecorder(r.db, rp)
+	snapshot := time.NewTimer(history.untilNext())
+	defer snapshot.Stop()
+
+loop:
+	for {
 		select {
 		case <-ctx.Done():
-			goto done
-		default:
-		}
+			break loop
+		case batch, ok := <-batchCh:
+			if !ok {
+				break loop
+			}
+			seq++
+			batch.seq = seq
+			if batch.Position == "" {
+				batch.Position = fmt.Sprintf("run:%s/%d", rp.RunID, seq)
+			}
+			pending = append(pending, pendingBatch{seq: seq, checkpoint: batch.Checkpoint, ack: batch.Ack, sourceTS: batch.SourceTS, delivered: true})
 
-		rows, err := sink.WriteBatch(ctx, sinkCfg, batch)
-		if err != nil {
-			rp.Metrics.ErrorsCount.Add(1)
-			r.db.CreatePipelineRunLog(rp.RunID, "error", fmt.Sprintf("Write batch failed: %v", err))
-			slog.Error("Pipeline batch write failed", "pipeline", rp.PipelineID, "error", err)
-			continue
-		}
+			rows, failures := graph.execute(ctx, batch)
+			pending = r.settle(ctx, rp, graph, pending, rows, failures)
 
-		rp.Metrics.RowsIngested.Add(int64(rows))
-		rp.Metrics.BatchesSent.Add(1)
-		rp.Metrics.LastBatchAt.Store(time.Now())
-
-		// Estimate bytes from raw JSON
-		for _, rec := range batch.Records {
-			rp.Metrics.BytesIngested.Add(int64(len(rec.RawJSON)))
+			if len(batch.SourceLag) > 0 {
+				rp.Metrics.SetSourceLag(batch.SourceLag)
+			}
+			// Estimate bytes from the source's raw JSON
+			for _, rec := range batch.Records {
+				rp.Metrics.BytesIngested.Add(int64(len(rec.RawJSON)))
+			}
+		case <-ticker.C:
+			rows, failures := graph.flush(ctx, false)
+			pending = r.settle(ctx, rp, graph, pending, rows, failures)
+		case <-snapshot.C:
+			history.record()
+			snapshot.Reset(history.untilNext())
 		}
 	}
 
-done:
+	// Write out whatever the sinks still buffer. The pipeline context may
+	// already be cancelled, so the final flush gets its own deadline.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 10*time.Second)
+	rows, failures := graph.flush(flushCtx, true)
+	r.settle(flushCtx, rp, graph, pending, rows, failures)
+	cancelFlush()
+	history.record()
+
 	// Finalize
 	status := "success"
 	errMsg := ""
@@ -299,17 +330,140 @@ done:
 		status = "stopped"
 	}
 
+	metricsJSON, _ := json.Marshal(map[string]int64{
+		"batches_sent":       rp.Metrics.BatchesSent.Load(),
+		"rows_dead_lettered": rp.Metrics.RowsDeadLettered.Load(),
+	})
 	r.db.UpdatePipelineRun(
 		rp.RunID, status,
 		rp.Metrics.RowsIngested.Load(),
 		rp.Metrics.BytesIngested.Load(),
 		rp.Metrics.ErrorsCount.Load(),
-		errMsg, "{}",
+		errMsg, string(metricsJSON),
 	)
 	r.db.UpdatePipelineStatus(rp.PipelineID, status, errMsg)
-	r.db.CreatePipelineRunLog(rp.RunID, "info", fmt.Sprintf("Pipeline %s (rows: %d, errors: %d)", status, rp.Metrics.RowsIngested.Load(), rp.Metrics.ErrorsCount.Load()))
+	r.db.CreatePipelineRunLog(rp.RunID, "info", fmt.Sprintf("Pipeline %s (rows: %d, errors: %d, dead-lettered: %d)", status, rp.Metrics.RowsIngested.Load(), rp.Metrics.ErrorsCount.Load(), rp.Metrics.RowsDeadLettered.Load()))
 
 	slog.Info("Pipeline finished", "pipeline", rp.PipelineID, "status", status, "rows", rp.Metrics.RowsIngested.Load())
+
+	if r.onRunComplete != nil {
+		go r.onRunComplete(rp.PipelineID, status)
+	}
+}
+
+// pendingBatch is a source batch whose checkpoint and ack wait until none of
+// its records remain in a sink buffer.
+type pendingBatch struct {
+	seq        uint64
+	checkpoint map[string]string
+	ack        func(delivered bool)
+	sourceTS   time.Time
+	delivered  bool
+}
+
+// settle handles the failures of one graph step, records its metrics and
+// releases, in source order, every pending batch whose records have all left
+// the sink buffers. It returns the batches still waiting.
+func (r *Runner) settle(ctx context.Context, rp *RunningPipeline, graph *pipelineGraph, pending []pendingBatch, rows int, failures []stageFailure) []pendingBatch {
+	for _, f := range failures {
+		rp.Metrics.ErrorsCount.Add(1)
+		r.db.CreatePipelineRunLog(rp.RunID, "error", fmt.Sprintf("Batch failed: %v", f.err))
+		slog.Error("Pipeline batch failed", "pipeline", rp.PipelineID, "stage", f.stage.label(), "error", f.err)
+		if !r.deadLetter(ctx, rp, graph.deadLetter, f) {
+			for i := range pending {
+				if pending[i].seq >= f.firstSeq && pending[i].seq <= f.lastSeq {
+					pending[i].delivered = false
+				}
+			}
+		}
+	}
+
+	if rows > 0 {
+		rp.Metrics.RowsIngested.Add(int64(rows))
+		rp.Metrics.BatchesSent.Add(1)
+		rp.Metrics.LastBatchAt.Store(time.Now())
+	}
+
+	since := graph.bufferedSince()
+	n := 0
+	for ; n < len(pending) && (since == 0 || pending[n].seq < since); n++ {
+		p := pending[n]
+		if p.delivered && !p.sourceTS.IsZero() {
+			rp.Metrics.ObserveLag(time.Since(p.sourceTS))
+		}
+		if !p.delivered && !rp.checkpointsHeld {
+			rp.checkpointsHeld = true
+			r.db.CreatePipelineRunLog(rp.RunID, "warn", "Batch not delivered; source checkpoints are held for the rest of this run")
+			slog.Warn("Holding pipeline checkpoints after undelivered batch", "pipeline", rp.PipelineID)
+		}
+		// Advance the source position only once every record has landed
+		// in a sink or the dead-letter destination, and never past a batch
+		// that was lost.
+		if p.delivered && !rp.checkpointsHeld && len(p.checkpoint) > 0 {
+			if err := r.db.SavePipelineCheckpoints(rp.PipelineID, p.checkpoint); err != nil {
+				rp.Metrics.ErrorsCount.Add(1)
+				slog.Error("Failed to save pipeline checkpoint", "pipeline", rp.PipelineID, "error", err)
+			}
+		}
+		if p.ack != nil {
+			p.ack(p.delivered)
+		}
+	}
+	return pending[n:]
+}
+
+// defaultSinkConnection points a sink without its own connection_id at the
+// pipeline's connection, writing as the pipeline's service credential unless
+// the sink names one.
+func defaultSinkConnection(cfg ConnectorConfig, pipeline *database.Pipeline) {
+	if stringField(cfg.Fields, "connection_id", "") != "" {
+		return
+	}
+	cfg.Fields["connection_id"] = pipeline.ConnectionID
+	if pipeline.CredentialID != nil && stringField(cfg.Fields, "credential_id", "") == "" {
+		cfg.Fields["credential_id"] = *pipeline.CredentialID
+	}
+}
+
+// setupDeadLetter instantiates the connector behind a sink_dead_letter node.
+// The "clickhouse" destination writes to an auto-created table; "file" spools
+// NDJSON under the data directory so failures survive a ClickHouse outage.
+// The spool directory is fixed per pipeline; a node cannot choose where on
+// the host it writes.
+func (r *Runner) setupDeadLetter(dl *stage, pipeline *database.Pipeline) error {
+	switch dest := stringField(dl.cfg.Fields, "destination", "clickhouse"); dest {
+	case "clickhouse":
+		defaultSinkConnection(dl.cfg, pipeline)
+		dl.cfg = deadLetterSinkConfig(dl.cfg)
+		dl.sink = NewClickHouseSink(r.gateway, r.db, r.cfg.AppSecretKey)
+	case "file":
+		dl.cfg.Fields["directory"] = filepath.Join(filepath.Dir(r.cfg.DatabasePath), "deadletter", pipeline.ID)
+		dl.sink = &FileSpoolSink{}
+	default:
+		return fmt.Errorf("unknown destination: %s", dest)
+	}
+	return dl.sink.Validate(dl.cfg)
+}
+
+// deadLetter forwards a failed batch to the pipeline's dead-letter node. It
+// reports whether the failed records were preserved there.
+func (r *Runner) deadLetter(ctx context.Context, rp *RunningPipeline, dl *stage, f stageFailure) bool {
+	if len(f.batch.Records) == 0 {
+		return true
+	}
+	if dl == nil {
+		return false
+	}
+	n, err := dl.sink.WriteBatch(ctx, dl.cfg, deadLetterBatch(rp.PipelineID, rp.RunID, f))
+	if err != nil {
+		rp.Metrics.ErrorsCount.Add(1)
+		r.db.CreatePipelineRunLog(rp.RunID, "error", fmt.Sprintf("Dead-letter write failed, %d records lost: %v", len(f.batch.Records), err))
+		slog.Error("Pipeline dead-letter write failed", "pipeline", rp.PipelineID, "error", err)
+		return false
+	}
+	rp.Metrics.RowsDeadLettered.Add(int64(n))
+	r.db.CreatePipelineRunLog(rp.RunID, "warn", fmt.Sprintf("%d records from %s sent to dead-letter", n, f.stage.label()))
+	return true
 }
 
 // Helper functions
@@ -322,11 +476,31 @@ func isSourceType(nodeType string) bool {
 	return false
 }
 
+func isSinkType(nodeType string) bool {
+	return nodeType == "sink_clickhouse"
+}
+
+func isDeadLetterType(nodeType string) bool {
+	return nodeType == "sink_dead_letter"
+}
+
+func isTransformType(nodeType string) bool {
+	switch nodeType {
+	case "transform_rename", "transform_drop", "transform_cast",
+		"transform_filter", "transform_flatten", "transform_compute":
+		return true
+	}
+	return false
+}
+
 func parseNodeConfig(node *database.PipelineNode) (ConnectorConfig, error) {
 	var fields map[string]interface{}
 	if err := json.Unmarshal([]byte(node.ConfigEncrypted), &fields); err != nil {
 		return ConnectorConfig{}, fmt.Errorf("unmarshal node config: %w", err)
 	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
 	return ConnectorConfig{
 		NodeType: node.NodeType,
 		Fields:   fields,
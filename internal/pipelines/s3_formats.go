@@ -0,0 +1,393 @@
+package pipelines
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/ocf"
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+	pqminio "github.com/xitongsys/parquet-go-source/minio"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/types"
+)
+
+// detectCompression returns the compression codec of an object from its key
+// extension, falling back to its Content-Encoding header.
+func detectCompression(key, contentEncoding string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".gz", ".gzip":
+		return "gzip"
+	case ".zst", ".zstd":
+		return "zstd"
+	case ".snappy", ".sz":
+		return "snappy"
+	}
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "gzip", "x-gzip":
+		return "gzip"
+	case "zstd":
+		return "zstd"
+	case "snappy", "x-snappy-framed":
+		return "snappy"
+	}
+	return ""
+}
+
+// formatFromKey guesses the file format from the key, ignoring a trailing
+// compression extension (e.g. "events.json.gz" is json).
+func formatFromKey(key string) string {
+	key = strings.ToLower(key)
+	if detectCompression(key, "") != "" {
+		key = strings.TrimSuffix(key, path.Ext(key))
+	}
+	switch path.Ext(key) {
+	case ".csv":
+		return "csv"
+	case ".parquet", ".pq":
+		return "parquet"
+	case ".avro":
+		return "avro"
+	}
+	return "json"
+}
+
+// decompress wraps r with a streaming decoder for the given codec.
+func decompress(r io.Reader, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case "":
+		return io.NopCloser(r), nil
+	case "gzip":
+		return gzip.NewReader(r)
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case "snappy":
+		return io.NopCloser(snappy.NewReader(r)), nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", codec)
+}
+
+// parseAvro reads an Avro object container file, mapping record fields to
+// columns and typing them from the embedded writer schema.
+func (s *S3Source) parseAvro(ctx context.Context, r io.Reader, batchSize int, checkpoint map[string]string, out chan<- Batch) error {
+	dec, err := ocf.NewDecoder(r)
+	if err != nil {
+		return fmt.Errorf("open avro container: %w", err)
+	}
+
+	schema := dec.Schema()
+	record, _ := schema.(*avro.RecordSchema)
+	var columnTypes map[string]string
+	if record != nil {
+		columnTypes = make(map[string]string, len(record.Fields()))
+		for _, f := range record.Fields() {
+			columnTypes[f.Name()] = avroClickHouseType(f.Type())
+		}
+	} else {
+		columnTypes = map[string]string{"value": avroClickHouseType(schema)}
+	}
+
+	var buf []Record
+	for dec.HasNext() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return flushFinal(ctx, Batch{}, fmt.Errorf("decode avro record: %w", err), checkpoint, out)
+		}
+
+		data := map[string]interface{}{}
+		if record != nil {
+			m, _ := v.(map[string]interface{})
+			for _, f := range record.Fields() {
+				data[f.Name()] = avroColumn(f.Type(), m[f.Name()])
+			}
+		} else {
+			data["value"] = avroColumn(schema, v)
+		}
+		buf = append(buf, Record{Data: data})
+
+		if len(buf) >= batchSize {
+			select {
+			case out <- Batch{Records: buf, SourceTS: time.Now(), ColumnTypes: columnTypes}:
+			case <-ctx.Done():
+				return nil
+			}
+			buf = nil
+		}
+	}
+
+	return flushFinal(ctx, Batch{Records: buf, ColumnTypes: columnTypes}, dec.Error(), checkpoint, out)
+}
+
+// parseParquet reads a Parquet object with ranged requests, one row group
+// page at a time, so large objects are never loaded whole.
+func (s *S3Source) parseParquet(ctx context.Context, client *minio.Client, bucket, key string, batchSize int, checkpoint map[string]string, out chan<- Batch) error {
+	pf, err := pqminio.NewS3FileReaderWithClient(ctx, client, bucket, key)
+	if err != nil {
+		return fmt.Errorf("open parquet object: %w", err)
+	}
+	defer pf.Close()
+
+	pr, err := reader.NewParquetReader(pf, nil, 4)
+	if err != nil {
+		return fmt.Errorf("read parquet footer: %w", err)
+	}
+	defer pr.ReadStop()
+
+	columns := parquetTopLevelColumns(pr)
+	columnTypes := make(map[string]string, len(columns))
+	exNames := make(map[string]string, len(pr.SchemaHandler.Infos))
+	for _, info := range pr.SchemaHandler.Infos {
+		exNames[info.InName] = info.ExName
+	}
+	for _, c := range columns {
+		columnTypes[c.name] = c.chType
+	}
+
+	total := pr.GetNumRows()
+	for read := int64(0); read < total; {
+		if ctx.Err() != nil {
+			return nil
+		}
+		n := min(int64(batchSize), total-read)
+		rows, err := pr.ReadByNumber(int(n))
+		if err != nil {
+			return flushFinal(ctx, Batch{}, fmt.Errorf("read parquet rows: %w", err), checkpoint, out)
+		}
+		read += int64(len(rows))
+
+		buf := make([]Record, 0, len(rows))
+		for _, row := range rows {
+			rv := reflect.ValueOf(row)
+			data := make(map[string]interface{}, len(columns))
+			for _, c := range columns {
+				data[c.name] = c.convert(parquetNative(rv.FieldByName(c.inName), exNames))
+			}
+			buf = append(buf, Record{Data: data})
+		}
+
+		batch := Batch{Records: buf, SourceTS: time.Now(), ColumnTypes: columnTypes}
+		if read >= total {
+			batch.Checkpoint = checkpoint
+		}
+		select {
+		case out <- batch:
+		case <-ctx.Done():
+			return nil
+		}
+		if len(rows) == 0 {
+			return fmt.Errorf("parquet object ended after %d of %d rows", read, total)
+		}
+	}
+	if total == 0 {
+		return flushFinal(ctx, Batch{}, nil, checkpoint, out)
+	}
+	return nil
+}
+
+// parquetColumn is a top-level Parquet field with its ClickHouse mapping.
+type parquetColumn struct {
+	name    string
+	inName  string
+	chType  string
+	convert func(interface{}) interface{}
+}
+
+// parquetTopLevelColumns maps the root's direct children to columns. Leaf
+// columns get typed ClickHouse columns; groups (structs, lists, maps) are
+// stored as JSON strings.
+func parquetTopLevelColumns(pr *reader.ParquetReader) []parquetColumn {
+	elems := pr.SchemaHandler.SchemaElements
+	infos := pr.SchemaHandler.Infos
+
+	var cols []parquetColumn
+	for i := 1; i < len(elems); i = skipParquetSubtree(elems, i) {
+		el := elems[i]
+		col := parquetColumn{name: infos[i].ExName, inName: infos[i].InName, convert: func(v interface{}) interface{} { return v }}
+		if el.GetNumChildren() > 0 {
+			col.chType = "String"
+			col.convert = func(v interface{}) interface{} {
+				if v == nil {
+					return nil
+				}
+				return jsonString(v)
+			}
+		} else {
+			col.chType, col.convert = parquetLeafType(el)
+		}
+		switch el.GetRepetitionType() {
+		case parquet.FieldRepetitionType_OPTIONAL:
+			col.chType = nullableType(col.chType)
+		case parquet.FieldRepetitionType_REPEATED:
+			if el.GetNumChildren() == 0 {
+				col.chType = "Array(" + col.chType + ")"
+				col.convert = parquetEach(col.convert)
+			}
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+// skipParquetSubtree returns the index following the subtree rooted at i in
+// the depth-first schema element list.
+func skipParquetSubtree(elems []*parquet.SchemaElement, i int) int {
+	pending := 1
+	for pending > 0 && i < len(elems) {
+		pending += int(elems[i].GetNumChildren()) - 1
+		i++
+	}
+	return i
+}
+
+func parquetLeafType(el *parquet.SchemaElement) (string, func(interface{}) interface{}) {
+	identity := func(v interface{}) interface{} { return v }
+	precision, scale := int(el.GetPrecision()), int(el.GetScale())
+
+	if lt := el.GetLogicalType(); lt != nil && lt.IsSetTIMESTAMP() {
+		unit := lt.GetTIMESTAMP().GetUnit()
+		switch {
+		case unit.IsSetMILLIS():
+			return "DateTime64(3)", parquetEpoch(time.Millisecond)
+		case unit.IsSetMICROS():
+			return "DateTime64(6)", parquetEpoch(time.Microsecond)
+		default:
+			return "DateTime64(9)", parquetEpoch(time.Nanosecond)
+		}
+	}
+
+	if el.ConvertedType != nil {
+		switch el.GetConvertedType() {
+		case parquet.ConvertedType_TIMESTAMP_MILLIS:
+			return "DateTime64(3)", parquetEpoch(time.Millisecond)
+		case parquet.ConvertedType_TIMESTAMP_MICROS:
+			return "DateTime64(6)", parquetEpoch(time.Microsecond)
+		case parquet.ConvertedType_DATE:
+			return "Date32", func(v interface{}) interface{} {
+				if days, ok := v.(int32); ok {
+					return time.Unix(int64(days)*86400, 0).UTC().Format("2006-01-02")
+				}
+				return v
+			}
+		case parquet.ConvertedType_DECIMAL:
+			return fmt.Sprintf("Decimal(%d, %d)", precision, scale), func(v interface{}) interface{} {
+				switch x := v.(type) {
+				case int32:
+					return json.Number(types.DECIMAL_INT_ToString(int64(x), precision, scale))
+				case int64:
+					return json.Number(types.DECIMAL_INT_ToString(x, precision, scale))
+				case string:
+					return json.Number(types.DECIMAL_BYTE_ARRAY_ToString([]byte(x), precision, scale))
+				}
+				return v
+			}
+		case parquet.ConvertedType_UINT_8, parquet.ConvertedType_UINT_16, parquet.ConvertedType_UINT_32:
+			return "UInt32", identity
+		case parquet.ConvertedType_UINT_64:
+			return "UInt64", identity
+		}
+	}
+
+	switch el.GetType() {
+	case parquet.Type_BOOLEAN:
+		return "Bool", identity
+	case parquet.Type_INT32:
+		return "Int32", identity
+	case parquet.Type_INT64:
+		return "Int64", identity
+	case parquet.Type_INT96:
+		return "DateTime64(9)", func(v interface{}) interface{} {
+			if s, ok := v.(string); ok {
+				return types.INT96ToTime(s).UTC().Format("2006-01-02 15:04:05.000000000")
+			}
+			return v
+		}
+	case parquet.Type_FLOAT:
+		return "Float32", identity
+	case parquet.Type_DOUBLE:
+		return "Float64", identity
+	}
+	return "String", identity
+}
+
+// parquetEach applies convert to every element of a repeated leaf value.
+func parquetEach(convert func(interface{}) interface{}) func(interface{}) interface{} {
+	return func(v interface{}) interface{} {
+		items, ok := v.([]interface{})
+		if !ok {
+			return v
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			out[i] = convert(item)
+		}
+		return out
+	}
+}
+
+// parquetEpoch converts an integer timestamp in the given unit to a
+// ClickHouse DateTime64 string.
+func parquetEpoch(unit time.Duration) func(interface{}) interface{} {
+	return func(v interface{}) interface{} {
+		n, ok := v.(int64)
+		if !ok {
+			return v
+		}
+		return time.Unix(0, n*int64(unit)).UTC().Format("2006-01-02 15:04:05.000000000")
+	}
+}
+
+// parquetNative turns a value read by parquet-go (dynamic structs with
+// exported field names) into plain Go values keyed by the file's column names.
+func parquetNative(v reflect.Value, exNames map[string]string) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return parquetNative(v.Elem(), exNames)
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Name
+			if ex, ok := exNames[name]; ok {
+				name = ex
+			}
+			out[name] = parquetNative(v.Field(i), exNames)
+		}
+		return out
+	case reflect.Slice:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = parquetNative(v.Index(i), exNames)
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = parquetNative(iter.Value(), exNames)
+		}
+		return out
+	}
+	return v.Interface()
+}
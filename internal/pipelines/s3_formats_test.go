@@ -0,0 +1,100 @@
+package pipelines
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/hamba/avro/v2/ocf"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestFormatAndCompressionDetection(t *testing.T) {
+	cases := map[string][2]string{
+		"logs/2024/01/events.json.gz": {"json", "gzip"},
+		"exports/part-0001.parquet":   {"parquet", ""},
+		"a/b.csv.zst":                 {"csv", "zstd"},
+		"c.avro":                      {"avro", ""},
+		"d.ndjson.sz":                 {"json", "snappy"},
+	}
+	for key, want := range cases {
+		if got := formatFromKey(key); got != want[0] {
+			t.Fatalf("%s: format %q, want %q", key, got, want[0])
+		}
+		if got := detectCompression(key, ""); got != want[1] {
+			t.Fatalf("%s: compression %q, want %q", key, got, want[1])
+		}
+	}
+	if got := detectCompression("events.json", "gzip"); got != "gzip" {
+		t.Fatalf("expected Content-Encoding fallback, got %q", got)
+	}
+}
+
+func collectBatches(t *testing.T, run func(out chan<- Batch) error) []Batch {
+	t.Helper()
+	out := make(chan Batch, 16)
+	if err := run(out); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	close(out)
+	var batches []Batch
+	for b := range out {
+		batches = append(batches, b)
+	}
+	return batches
+}
+
+func TestParseCompressedNDJSON(t *testing.T) {
+	payload := []byte("{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n")
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(payload)
+	gw.Close()
+
+	var zs bytes.Buffer
+	zw, _ := zstd.NewWriter(&zs)
+	zw.Write(payload)
+	zw.Close()
+
+	for codec, data := range map[string][]byte{"gzip": gz.Bytes(), "zstd": zs.Bytes()} {
+		r, err := decompress(bytes.NewReader(data), codec)
+		if err != nil {
+			t.Fatalf("%s: %v", codec, err)
+		}
+		cp := map[string]string{"s3:k": "etag"}
+		batches := collectBatches(t, func(out chan<- Batch) error {
+			return (&S3Source{}).parseNDJSON(context.Background(), r, 2, cp, out)
+		})
+		if len(batches) != 2 || len(batches[0].Records) != 2 || batches[1].Checkpoint["s3:k"] != "etag" {
+			t.Fatalf("%s: unexpected batches: %+v", codec, batches)
+		}
+	}
+}
+
+func TestParseAvroContainer(t *testing.T) {
+	const schema = `{"type":"record","name":"Row","fields":[{"name":"id","type":"int"},{"name":"label","type":"string"}]}`
+	var buf bytes.Buffer
+	enc, err := ocf.NewEncoder(schema, &buf)
+	if err != nil {
+		t.Fatalf("encoder: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := enc.Encode(map[string]interface{}{"id": i, "label": "x"}); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+	}
+	enc.Close()
+
+	batches := collectBatches(t, func(out chan<- Batch) error {
+		return (&S3Source{}).parseAvro(context.Background(), &buf, 10, map[string]string{"s3:k": "e"}, out)
+	})
+	if len(batches) != 1 || len(batches[0].Records) != 3 {
+		t.Fatalf("unexpected batches: %+v", batches)
+	}
+	b := batches[0]
+	if b.ColumnTypes["id"] != "Int32" || b.Records[2].Data["id"] != 2 || b.Checkpoint == nil {
+		t.Fatalf("unexpected batch: %+v", b)
+	}
+}
@@ -39,6 +39,11 @@ func (s *S3Source) Validate(cfg ConnectorConfig) error {
 	if secretKey == "" {
 		return fmt.Errorf("secret_key is required")
 	}
+	switch strings.ToLower(stringField(cfg.Fields, "format", "json")) {
+	case "json", "ndjson", "jsonl", "csv", "parquet", "avro", "auto":
+	default:
+		return fmt.Errorf("unsupported format: %s", stringField(cfg.Fields, "format", ""))
+	}
 	return nil
 }
 
@@ -66,8 +71,14 @@ func (s *S3Source) Start(ctx context.Context, cfg ConnectorConfig, out chan<- Ba
 
 	slog.Info("S3 source started", "endpoint", endpoint, "bucket", bucket, "prefix", prefix, "format", format)
 
-	// Track processed files to avoid reprocessing
+	// Track processed objects (key -> ETag) to avoid reprocessing. Seeded from
+	// the committed checkpoint so a restart resumes instead of re-ingesting.
 	var processed sync.Map
+	for k, etag := range cfg.Checkpoint {
+		if key, ok := strings.CutPrefix(k, s3CheckpointPrefix); ok {
+			processed.Store(key, etag)
+		}
+	}
 
 	ticker := time.NewTicker(time.Duration(pollIntervalSec) * time.Second)
 	defer ticker.Stop()
@@ -84,12 +95,14 @@ func (s *S3Source) Start(ctx context.Context, cfg ConnectorConfig, out chan<- Ba
 				continue
 			}
 
-			// Skip already processed
-			if _, seen := processed.LoadOrStore(obj.Key, true); seen {
+			// Skip already processed, unless the object was overwritten
+			if etag, seen := processed.Load(obj.Key); seen && etag.(string) == obj.ETag {
 				continue
 			}
+			processed.Store(obj.Key, obj.ETag)
 
-			if err := s.processFile(ctx, client, bucket, obj.Key, format, batchSize, out); err != nil {
+			checkpoint := map[string]string{s3CheckpointPrefix + obj.Key: obj.ETag}
+			if err := s.processFile(ctx, client, bucket, obj.Key, format, batchSize, checkpoint, out); err != nil {
 				slog.Error("S3 file processing error", "key", obj.Key, "error", err)
 				processed.Delete(obj.Key) // Allow retry
 			}
@@ -115,28 +128,78 @@ func (s *S3Source) Start(ctx context.Context, cfg ConnectorConfig, out chan<- Ba
 	}
 }
 
-// processFile reads and parses a single S3 object.
-func (s *S3Source) processFile(ctx context.Context, client *minio.Client, bucket, key, format string, batchSize int, out chan<- Batch) error {
+// processFile reads and parses a single S3 object. The checkpoint entry is
+// attached to the object's final batch so the object is only marked as
+// processed after all of its records have been delivered.
+func (s *S3Source) processFile(ctx context.Context, client *minio.Client, bucket, key, format string, batchSize int, checkpoint map[string]string, out chan<- Batch) error {
 	obj, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
 	if err != nil {
 		return fmt.Errorf("get object: %w", err)
 	}
 	defer obj.Close()
 
-	slog.Info("Processing S3 file", "key", key, "format", format)
+	info, err := obj.Stat()
+	if err != nil {
+		return fmt.Errorf("stat object: %w", err)
+	}
+	compression := detectCompression(key, info.Metadata.Get("Content-Encoding"))
+
+	format = strings.ToLower(format)
+	if format == "auto" {
+		format = formatFromKey(key)
+	}
+
+	slog.Info("Processing S3 file", "key", key, "format", format, "compression", compression)
 
-	switch strings.ToLower(format) {
+	// Parquet needs random access to its footer, so it is read with ranged
+	// requests instead of through the decompressing stream.
+	if format == "parquet" {
+		if compression != "" {
+			return fmt.Errorf("%s-compressed parquet objects are not supported; parquet compresses pages internally", compression)
+		}
+		return s.parseParquet(ctx, client, bucket, key, batchSize, checkpoint, out)
+	}
+
+	r, err := decompress(obj, compression)
+	if err != nil {
+		return fmt.Errorf("open %s stream: %w", compression, err)
+	}
+	defer r.Close()
+
+	switch format {
 	case "json", "ndjson", "jsonl":
-		return s.parseNDJSON(ctx, obj, batchSize, out)
+		return s.parseNDJSON(ctx, r, batchSize, checkpoint, out)
 	case "csv":
-		return s.parseCSV(ctx, obj, batchSize, out)
+		return s.parseCSV(ctx, r, batchSize, checkpoint, out)
+	case "avro":
+		return s.parseAvro(ctx, r, batchSize, checkpoint, out)
 	default:
 		return fmt.Errorf("unsupported format: %s", format)
 	}
 }
 
+// s3CheckpointPrefix namespaces S3 object entries in the pipeline checkpoint.
+const s3CheckpointPrefix = "s3:"
+
+// flushFinal sends the remaining records of an object together with its
+// checkpoint. The checkpoint is dropped when reading failed part-way so the
+// object is retried; an empty batch is sent if only the checkpoint remains.
+func flushFinal(ctx context.Context, batch Batch, readErr error, checkpoint map[string]string, out chan<- Batch) error {
+	if readErr == nil {
+		batch.Checkpoint = checkpoint
+	}
+	if len(batch.Records) > 0 || batch.Checkpoint != nil {
+		batch.SourceTS = time.Now()
+		select {
+		case out <- batch:
+		case <-ctx.Done():
+		}
+	}
+	return readErr
+}
+
 // parseNDJSON reads newline-delimited JSON.
-func (s *S3Source) parseNDJSON(ctx context.Context, r io.Reader, batchSize int, out chan<- Batch) error {
+func (s *S3Source) parseNDJSON(ctx context.Context, r io.Reader, batchSize int, checkpoint map[string]string, out chan<- Batch) error {
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024) // 10MB max line
 
@@ -171,18 +234,11 @@ func (s *S3Source) parseNDJSON(ctx context.Context, r io.Reader, batchSize int,
 		}
 	}
 
-	if len(buf) > 0 {
-		select {
-		case out <- Batch{Records: buf, SourceTS: time.Now()}:
-		case <-ctx.Done():
-		}
-	}
-
-	return scanner.Err()
+	return flushFinal(ctx, Batch{Records: buf}, scanner.Err(), checkpoint, out)
 }
 
 // parseCSV reads CSV files (first row = headers).
-func (s *S3Source) parseCSV(ctx context.Context, r io.Reader, batchSize int, out chan<- Batch) error {
+func (s *S3Source) parseCSV(ctx context.Context, r io.Reader, batchSize int, checkpoint map[string]string, out chan<- Batch) error {
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
 
@@ -231,12 +287,5 @@ func (s *S3Source) parseCSV(ctx context.Context, r io.Reader, batchSize int, out
 		}
 	}
 
-	if len(buf) > 0 {
-		select {
-		case out <- Batch{Records: buf, SourceTS: time.Now()}:
-		case <-ctx.Done():
-		}
-	}
-
-	return scanner.Err()
+	return flushFinal(ctx, Batch{Records: buf}, scanner.Err(), checkpoint, out)
 }
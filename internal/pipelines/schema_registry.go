@@ -0,0 +1,146 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// registrySchema is a schema as returned by a Confluent-compatible registry.
+type registrySchema struct {
+	Schema     string            `json:"schema"`
+	SchemaType string            `json:"schemaType"` // AVRO (default), PROTOBUF or JSON
+	References []schemaReference `json:"references"`
+}
+
+type schemaReference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// SchemaRegistry fetches schemas from a Confluent-compatible schema registry
+// and caches them for the lifetime of the pipeline. Schemas are immutable
+// per ID, so the cache never needs invalidation.
+type SchemaRegistry struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+
+	mu        sync.Mutex
+	byID      map[int]*registrySchema
+	bySubject map[string]*registrySchema
+}
+
+// NewSchemaRegistry creates a registry client. username may be empty.
+func NewSchemaRegistry(baseURL, username, password string) *SchemaRegistry {
+	return &SchemaRegistry{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		username:  username,
+		password:  password,
+		client:    &http.Client{Timeout: 15 * time.Second},
+		byID:      make(map[int]*registrySchema),
+		bySubject: make(map[string]*registrySchema),
+	}
+}
+
+// SchemaByID returns the schema registered under id.
+func (r *SchemaRegistry) SchemaByID(ctx context.Context, id int) (*registrySchema, error) {
+	r.mu.Lock()
+	s, ok := r.byID[id]
+	r.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	s, err := r.fetch(ctx, fmt.Sprintf("/schemas/ids/%d", id))
+	if err != nil {
+		return nil, fmt.Errorf("fetch schema %d: %w", id, err)
+	}
+	r.mu.Lock()
+	r.byID[id] = s
+	r.mu.Unlock()
+	return s, nil
+}
+
+// SchemaBySubject returns a specific version of a subject. It is used to
+// resolve schema references.
+func (r *SchemaRegistry) SchemaBySubject(ctx context.Context, subject string, version int) (*registrySchema, error) {
+	key := fmt.Sprintf("%s/%d", subject, version)
+	r.mu.Lock()
+	s, ok := r.bySubject[key]
+	r.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	s, err := r.fetch(ctx, fmt.Sprintf("/subjects/%s/versions/%d", url.PathEscape(subject), version))
+	if err != nil {
+		return nil, fmt.Errorf("fetch subject %s version %d: %w", subject, version, err)
+	}
+	r.mu.Lock()
+	r.bySubject[key] = s
+	r.mu.Unlock()
+	return s, nil
+}
+
+// registryError is a failure to get a schema from the registry, as opposed
+// to a message that cannot be decoded. The message itself may be fine, so
+// sources retry it instead of giving up on it.
+type registryError struct{ err error }
+
+func (e *registryError) Error() string { return e.err.Error() }
+func (e *registryError) Unwrap() error { return e.err }
+
+// fetch requests a schema. Every failure except an unknown schema, which no
+// retry can fix, is returned as a *registryError.
+func (r *SchemaRegistry) fetch(ctx context.Context, path string) (*registrySchema, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, &registryError{err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, &registryError{err}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("registry returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &registryError{fmt.Errorf("registry returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))}
+	}
+
+	var s registrySchema
+	if err := json.Unmarshal(body, &s); err != nil {
+		return nil, &registryError{fmt.Errorf("decode registry response: %w", err)}
+	}
+	return &s, nil
+}
+
+// splitConfluentFrame strips the Confluent wire-format header (magic byte 0
+// followed by a big-endian 4-byte schema ID) from a message value.
+func splitConfluentFrame(value []byte) (int, []byte, error) {
+	if len(value) < 5 || value[0] != 0 {
+		return 0, nil, fmt.Errorf("message is not in Confluent wire format")
+	}
+	return int(binary.BigEndian.Uint32(value[1:5])), value[5:], nil
+}
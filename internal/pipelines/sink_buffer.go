@@ -0,0 +1,103 @@
+package pipelines
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// defaultFlushInterval bounds how long records wait in a sink buffer when
+// only size thresholds are configured.
+const defaultFlushInterval = 5 * time.Second
+
+// sinkBuffer accumulates records for one sink across source batches and
+// releases them when a row, byte or age threshold is reached. It tracks the
+// sequence numbers of the source batches it holds so the runner can delay
+// their checkpoints until the records are written.
+type sinkBuffer struct {
+	maxRows  int
+	maxBytes int
+	maxAge   time.Duration
+
+	records  []Record
+	types    map[string]string
+	sourceTS time.Time
+	size     int
+	since    time.Time
+	firstSeq uint64
+	lastSeq  uint64
+	firstPos string
+	lastPos  string
+}
+
+// newSinkBuffer returns the buffer configured by flush_rows, flush_bytes and
+// flush_interval_ms, or nil when none is set and every batch is written
+// straight through.
+func newSinkBuffer(cfg ConnectorConfig) *sinkBuffer {
+	rows := intField(cfg.Fields, "flush_rows", 0)
+	bytes := intField(cfg.Fields, "flush_bytes", 0)
+	interval := time.Duration(intField(cfg.Fields, "flush_interval_ms", 0)) * time.Millisecond
+	if rows <= 0 && bytes <= 0 && interval <= 0 {
+		return nil
+	}
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	return &sinkBuffer{maxRows: rows, maxBytes: bytes, maxAge: interval}
+}
+
+// add appends the records of source batch seq. Records are encoded here so
+// the byte threshold reflects the INSERT payload and the sink need not
+// encode them again.
+func (b *sinkBuffer) add(seq uint64, batch Batch) {
+	if len(batch.Records) == 0 {
+		return
+	}
+	if len(b.records) == 0 {
+		b.since = time.Now()
+		b.firstSeq = seq
+		b.firstPos = batch.Position
+		b.sourceTS = batch.SourceTS
+	}
+	b.lastSeq = seq
+	b.lastPos = batch.Position
+	for _, rec := range batch.Records {
+		if len(rec.RawJSON) == 0 {
+			if raw, err := json.Marshal(rec.Data); err == nil {
+				rec.RawJSON = raw
+			}
+		}
+		b.size += len(rec.RawJSON) + 1
+		b.records = append(b.records, rec)
+	}
+	for k, v := range batch.ColumnTypes {
+		if b.types == nil {
+			b.types = make(map[string]string, len(batch.ColumnTypes))
+		}
+		if _, ok := b.types[k]; !ok {
+			b.types[k] = v
+		}
+	}
+}
+
+// full reports whether a size threshold has been reached.
+func (b *sinkBuffer) full() bool {
+	return (b.maxRows > 0 && len(b.records) >= b.maxRows) || (b.maxBytes > 0 && b.size >= b.maxBytes)
+}
+
+// due reports whether the oldest buffered record has waited long enough.
+func (b *sinkBuffer) due() bool {
+	return len(b.records) > 0 && time.Since(b.since) >= b.maxAge
+}
+
+// take empties the buffer, returning its records as one batch along with
+// the range of source batches they came from. Source batches are never split
+// across writes, so the positions of the first and last identify the batch.
+func (b *sinkBuffer) take() (Batch, uint64, uint64) {
+	batch := Batch{Records: b.records, SourceTS: b.sourceTS, ColumnTypes: b.types, Position: b.firstPos}
+	if b.lastPos != b.firstPos {
+		batch.Position += ".." + b.lastPos
+	}
+	first, last := b.firstSeq, b.lastSeq
+	*b = sinkBuffer{maxRows: b.maxRows, maxBytes: b.maxBytes, maxAge: b.maxAge}
+	return batch, first, last
+}
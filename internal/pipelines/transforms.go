@@ -0,0 +1,489 @@
+package pipelines
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RenameTransform renames fields on every record. Every rename reads the
+// original record, so swaps (a:b, b:a) and chains (a:b, b:c) do not depend
+// on order; when two mappings share a target the later one wins.
+//
+// Config: mappings — "old:new" pairs separated by newlines or commas, or a
+// JSON object of {old: new}.
+type RenameTransform struct {
+	mappings [][2]string
+}
+
+func (t *RenameTransform) Type() string { return "transform_rename" }
+
+// Validate parses the rename mappings.
+func (t *RenameTransform) Validate(cfg ConnectorConfig) error {
+	pairs, err := pairsField(cfg.Fields, "mappings", ":")
+	if err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return fmt.Errorf("mappings is required")
+	}
+	t.mappings = pairs
+	return nil
+}
+
+// Apply renames fields on a copy of each record.
+func (t *RenameTransform) Apply(_ context.Context, _ ConnectorConfig, batch Batch) (Batch, error) {
+	values := make([]interface{}, len(t.mappings))
+	present := make([]bool, len(t.mappings))
+	return mapRecords(batch, func(data map[string]interface{}) (map[string]interface{}, error) {
+		for i, m := range t.mappings {
+			values[i], present[i] = data[m[0]]
+		}
+		for i, m := range t.mappings {
+			if present[i] {
+				delete(data, m[0])
+			}
+		}
+		for i, m := range t.mappings {
+			if present[i] {
+				data[m[1]] = values[i]
+			}
+		}
+		return data, nil
+	})
+}
+
+// DropTransform removes fields from records, or keeps only the listed fields.
+//
+// Config: fields — comma-separated field names; mode — "drop" (default) or "keep".
+type DropTransform struct {
+	fields map[string]bool
+	keep   bool
+}
+
+func (t *DropTransform) Type() string { return "transform_drop" }
+
+// Validate parses the field list and mode.
+func (t *DropTransform) Validate(cfg ConnectorConfig) error {
+	fields := listField(cfg.Fields, "fields")
+	if len(fields) == 0 {
+		return fmt.Errorf("fields is required")
+	}
+	mode := strings.ToLower(stringField(cfg.Fields, "mode", "drop"))
+	if mode != "drop" && mode != "keep" {
+		return fmt.Errorf("mode must be 'drop' or 'keep'")
+	}
+	t.keep = mode == "keep"
+	t.fields = make(map[string]bool, len(fields))
+	for _, f := range fields {
+		t.fields[f] = true
+	}
+	return nil
+}
+
+// Apply drops (or keeps) the configured fields.
+func (t *DropTransform) Apply(_ context.Context, _ ConnectorConfig, batch Batch) (Batch, error) {
+	return mapRecords(batch, func(data map[string]interface{}) (map[string]interface{}, error) {
+		for k := range data {
+			if t.fields[k] != t.keep {
+				delete(data, k)
+			}
+		}
+		return data, nil
+	})
+}
+
+// CastTransform converts field values to a target type.
+//
+// Config: casts — "field:type" pairs where type is one of string, int, float,
+// bool, json or timestamp; on_error — "fail" (default) or "null".
+type CastTransform struct {
+	casts      [][2]string
+	nullOnFail bool
+}
+
+func (t *CastTransform) Type() string { return "transform_cast" }
+
+// Validate parses the cast list.
+func (t *CastTransform) Validate(cfg ConnectorConfig) error {
+	pairs, err := pairsField(cfg.Fields, "casts", ":")
+	if err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return fmt.Errorf("casts is required")
+	}
+	for i, p := range pairs {
+		typ := strings.ToLower(p[1])
+		switch typ {
+		case "string", "int", "float", "bool", "json", "timestamp":
+		default:
+			return fmt.Errorf("unsupported cast type %q for field %s", p[1], p[0])
+		}
+		pairs[i][1] = typ
+	}
+	t.casts = pairs
+
+	switch onErr := strings.ToLower(stringField(cfg.Fields, "on_error", "fail")); onErr {
+	case "fail":
+	case "null":
+		t.nullOnFail = true
+	default:
+		return fmt.Errorf("on_error must be 'fail' or 'null'")
+	}
+	return nil
+}
+
+// Apply casts each configured field.
+func (t *CastTransform) Apply(_ context.Context, _ ConnectorConfig, batch Batch) (Batch, error) {
+	return mapRecords(batch, func(data map[string]interface{}) (map[string]interface{}, error) {
+		for _, c := range t.casts {
+			v, ok := data[c[0]]
+			if !ok || v == nil {
+				continue
+			}
+			cast, err := castValue(v, c[1])
+			if err != nil {
+				if !t.nullOnFail {
+					return nil, fmt.Errorf("cast %s to %s: %w", c[0], c[1], err)
+				}
+				cast = nil
+			}
+			data[c[0]] = cast
+		}
+		return data, nil
+	})
+}
+
+// FilterTransform keeps only records for which the expression is true.
+//
+// Config: expression — see Expr for the supported grammar.
+type FilterTransform struct {
+	expr *Expr
+}
+
+func (t *FilterTransform) Type() string { return "transform_filter" }
+
+// Validate compiles the filter expression.
+func (t *FilterTransform) Validate(cfg ConnectorConfig) error {
+	src := strings.TrimSpace(stringField(cfg.Fields, "expression", ""))
+	if src == "" {
+		return fmt.Errorf("expression is required")
+	}
+	expr, err := CompileExpr(src)
+	if err != nil {
+		return fmt.Errorf("invalid expression: %w", err)
+	}
+	t.expr = expr
+	return nil
+}
+
+// Apply drops records that do not match the expression. Kept records get
+// their own copy of the data, as with the other transforms, so stages after
+// the filter cannot change records seen by its sibling branches.
+func (t *FilterTransform) Apply(_ context.Context, _ ConnectorConfig, batch Batch) (Batch, error) {
+	kept := make([]Record, 0, len(batch.Records))
+	for i, rec := range batch.Records {
+		ok, err := t.expr.EvalBool(rec.Data)
+		if err != nil {
+			return Batch{}, fmt.Errorf("record %d: %w", i, err)
+		}
+		if ok {
+			data := make(map[string]interface{}, len(rec.Data))
+			for k, v := range rec.Data {
+				data[k] = v
+			}
+			kept = append(kept, Record{Data: data, RawJSON: rec.RawJSON})
+		}
+	}
+	return Batch{Records: kept, SourceTS: batch.SourceTS}, nil
+}
+
+// FlattenTransform flattens nested JSON objects into top-level columns.
+//
+// Config: separator — joins nested keys (default "_"); max_depth — 0 for
+// unlimited; fields — optional comma-separated list restricting which
+// top-level fields are flattened.
+type FlattenTransform struct {
+	separator string
+	maxDepth  int
+	fields    map[string]bool
+}
+
+func (t *FlattenTransform) Type() string { return "transform_flatten" }
+
+// Validate parses the flatten options.
+func (t *FlattenTransform) Validate(cfg ConnectorConfig) error {
+	t.separator = stringField(cfg.Fields, "separator", "_")
+	if t.separator == "" {
+		t.separator = "_"
+	}
+	t.maxDepth = intField(cfg.Fields, "max_depth", 0)
+	if t.maxDepth < 0 {
+		return fmt.Errorf("max_depth must be >= 0")
+	}
+	if fields := listField(cfg.Fields, "fields"); len(fields) > 0 {
+		t.fields = make(map[string]bool, len(fields))
+		for _, f := range fields {
+			t.fields[f] = true
+		}
+	}
+	return nil
+}
+
+// Apply flattens nested objects. JSON-encoded object strings are decoded first.
+func (t *FlattenTransform) Apply(_ context.Context, _ ConnectorConfig, batch Batch) (Batch, error) {
+	return mapRecords(batch, func(data map[string]interface{}) (map[string]interface{}, error) {
+		out := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			if t.fields != nil && !t.fields[k] {
+				out[k] = v
+				continue
+			}
+			if s, ok := v.(string); ok && strings.HasPrefix(strings.TrimSpace(s), "{") {
+				var nested map[string]interface{}
+				if err := json.Unmarshal([]byte(s), &nested); err == nil {
+					v = nested
+				}
+			}
+			t.flatten(out, k, v, 1)
+		}
+		return out, nil
+	})
+}
+
+func (t *FlattenTransform) flatten(out map[string]interface{}, prefix string, v interface{}, depth int) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) == 0 || (t.maxDepth > 0 && depth > t.maxDepth) {
+		out[prefix] = v
+		return
+	}
+	for k, nv := range m {
+		t.flatten(out, prefix+t.separator+k, nv, depth+1)
+	}
+}
+
+// ComputeTransform adds or overwrites columns from expressions.
+//
+// Config: columns — "name = expression" lines, evaluated top to bottom so
+// later columns can reference earlier ones.
+type ComputeTransform struct {
+	columns []computedColumn
+}
+
+type computedColumn struct {
+	name string
+	expr *Expr
+}
+
+func (t *ComputeTransform) Type() string { return "transform_compute" }
+
+// Validate compiles every column expression.
+func (t *ComputeTransform) Validate(cfg ConnectorConfig) error {
+	pairs, err := pairsField(cfg.Fields, "columns", "=")
+	if err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return fmt.Errorf("columns is required")
+	}
+	t.columns = t.columns[:0]
+	for _, p := range pairs {
+		expr, err := CompileExpr(p[1])
+		if err != nil {
+			return fmt.Errorf("column %s: invalid expression: %w", p[0], err)
+		}
+		t.columns = append(t.columns, computedColumn{name: p[0], expr: expr})
+	}
+	return nil
+}
+
+// Apply evaluates each column expression against the record.
+func (t *ComputeTransform) Apply(_ context.Context, _ ConnectorConfig, batch Batch) (Batch, error) {
+	return mapRecords(batch, func(data map[string]interface{}) (map[string]interface{}, error) {
+		for _, c := range t.columns {
+			v, err := c.expr.Eval(data)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.name, err)
+			}
+			data[c.name] = v
+		}
+		return data, nil
+	})
+}
+
+// ── Helpers ────────────────────────────────────────────────────────
+
+// mapRecords applies fn to a shallow copy of every record's data. RawJSON is
+// cleared so the sink re-encodes the transformed data.
+func mapRecords(batch Batch, fn func(map[string]interface{}) (map[string]interface{}, error)) (Batch, error) {
+	out := make([]Record, 0, len(batch.Records))
+	for i, rec := range batch.Records {
+		data := make(map[string]interface{}, len(rec.Data))
+		for k, v := range rec.Data {
+			data[k] = v
+		}
+		next, err := fn(data)
+		if err != nil {
+			return Batch{}, fmt.Errorf("record %d: %w", i, err)
+		}
+		out = append(out, Record{Data: next})
+	}
+	return Batch{Records: out, SourceTS: batch.SourceTS}, nil
+}
+
+// castValue converts v to the named type.
+func castValue(v interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case "string":
+		return toString(v), nil
+	case "int":
+		if s, ok := v.(string); ok {
+			n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err == nil {
+				return n, nil
+			}
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("cannot convert %v to int", v)
+		}
+		return int64(f), nil
+	case "float":
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("cannot convert %v to float", v)
+		}
+		return f, nil
+	case "bool":
+		switch t := v.(type) {
+		case bool:
+			return t, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(t))
+			if err != nil {
+				return nil, fmt.Errorf("cannot convert %q to bool", t)
+			}
+			return b, nil
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("cannot convert %v to bool", v)
+		}
+		return f != 0, nil
+	case "json":
+		if s, ok := v.(string); ok {
+			var parsed interface{}
+			if err := json.Unmarshal([]byte(s), &parsed); err != nil {
+				return nil, fmt.Errorf("invalid JSON: %w", err)
+			}
+			return parsed, nil
+		}
+		return v, nil
+	case "timestamp":
+		return castTimestamp(v)
+	}
+	return nil, fmt.Errorf("unsupported type %s", typ)
+}
+
+// castTimestamp normalises epoch numbers and common date strings into the
+// "YYYY-MM-DD hh:mm:ss" form ClickHouse DateTime columns accept.
+func castTimestamp(v interface{}) (interface{}, error) {
+	const chLayout = "2006-01-02 15:04:05"
+
+	if s, ok := v.(string); ok {
+		s = strings.TrimSpace(s)
+		for _, layout := range []string{time.RFC3339Nano, time.RFC3339, chLayout, "2006-01-02T15:04:05", "2006-01-02"} {
+			if ts, err := time.Parse(layout, s); err == nil {
+				return ts.UTC().Format(chLayout), nil
+			}
+		}
+	}
+
+	f, ok := toFloat(v)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %v to timestamp", v)
+	}
+	// Heuristic: values beyond year 2286 in seconds are milliseconds.
+	var ts time.Time
+	if f > 1e10 {
+		ts = time.UnixMilli(int64(f))
+	} else {
+		ts = time.Unix(int64(f), 0)
+	}
+	return ts.UTC().Format(chLayout), nil
+}
+
+// listField reads a comma/newline separated list, or a JSON array, from config.
+func listField(fields map[string]interface{}, key string) []string {
+	var raw []string
+	switch v := fields[key].(type) {
+	case string:
+		raw = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == '\n' })
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				raw = append(raw, s)
+			}
+		}
+	}
+
+	out := make([]string, 0, len(raw))
+	for _, s := range raw {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// pairsField reads "key<sep>value" pairs from a newline/comma separated string
+// or from a JSON object. Object keys are returned sorted for determinism.
+func pairsField(fields map[string]interface{}, key, sep string) ([][2]string, error) {
+	switch v := fields[key].(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([][2]string, 0, len(keys))
+		for _, k := range keys {
+			out = append(out, [2]string{k, toString(v[k])})
+		}
+		return out, nil
+	case string:
+		// Expressions may legitimately contain commas, so only split on
+		// newlines when the separator is "=".
+		splitter := func(r rune) bool { return r == '\n' || r == ',' }
+		if sep == "=" {
+			splitter = func(r rune) bool { return r == '\n' }
+		}
+		var out [][2]string
+		for _, line := range strings.FieldsFunc(v, splitter) {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			idx := strings.Index(line, sep)
+			if idx <= 0 {
+				return nil, fmt.Errorf("%s: expected \"name%svalue\", got %q", key, sep, line)
+			}
+			k := strings.TrimSpace(line[:idx])
+			val := strings.TrimSpace(line[idx+len(sep):])
+			if k == "" || val == "" {
+				return nil, fmt.Errorf("%s: expected \"name%svalue\", got %q", key, sep, line)
+			}
+			out = append(out, [2]string{k, val})
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%s must be a string or object", key)
+	}
+}
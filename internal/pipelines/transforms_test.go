@@ -0,0 +1,141 @@
+package pipelines
+
+import (
+	"context"
+	"testing"
+)
+
+func applyTransform(t *testing.T, nodeType string, fields map[string]interface{}, records ...map[string]interface{}) []Record {
+	t.Helper()
+	tr, err := NewTransform(nodeType)
+	if err != nil {
+		t.Fatalf("new transform: %v", err)
+	}
+	cfg := ConnectorConfig{NodeType: nodeType, Fields: fields}
+	if err := tr.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	batch := Batch{}
+	for _, r := range records {
+		batch.Records = append(batch.Records, Record{Data: r, RawJSON: []byte(`{}`)})
+	}
+	out, err := tr.Apply(context.Background(), cfg, batch)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	return out.Records
+}
+
+func TestRenameTransform(t *testing.T) {
+	in := map[string]interface{}{"userId": "u1", "ts": 1.0}
+	out := applyTransform(t, "transform_rename", map[string]interface{}{"mappings": "userId:user_id\nts:event_time"}, in)
+
+	if out[0].Data["user_id"] != "u1" || out[0].Data["event_time"] != 1.0 {
+		t.Fatalf("unexpected rename output: %+v", out[0].Data)
+	}
+	if _, ok := out[0].Data["userId"]; ok {
+		t.Fatalf("old field still present: %+v", out[0].Data)
+	}
+	if _, ok := in["user_id"]; ok {
+		t.Fatalf("transform mutated input record")
+	}
+	if out[0].RawJSON != nil {
+		t.Fatalf("expected RawJSON to be cleared")
+	}
+}
+
+func TestRenameTransform_SwapsAndChainsReadOriginalRecord(t *testing.T) {
+	out := applyTransform(t, "transform_rename", map[string]interface{}{"mappings": "a:b\nb:a\nx:y\ny:z"},
+		map[string]interface{}{"a": 1.0, "b": 2.0, "x": "x", "y": "y"})
+
+	d := out[0].Data
+	if d["a"] != 2.0 || d["b"] != 1.0 || d["y"] != "x" || d["z"] != "y" || len(d) != 4 {
+		t.Fatalf("unexpected rename output: %+v", d)
+	}
+}
+
+func TestDropTransform_KeepMode(t *testing.T) {
+	out := applyTransform(t, "transform_drop", map[string]interface{}{"fields": "a, b", "mode": "keep"},
+		map[string]interface{}{"a": 1.0, "b": 2.0, "c": 3.0})
+	if len(out[0].Data) != 2 || out[0].Data["c"] != nil {
+		t.Fatalf("unexpected keep output: %+v", out[0].Data)
+	}
+}
+
+func TestCastTransform(t *testing.T) {
+	out := applyTransform(t, "transform_cast", map[string]interface{}{"casts": "n:int, f:float, b:bool, ts:timestamp"},
+		map[string]interface{}{"n": "42", "f": "1.5", "b": "true", "ts": 1700000000.0})
+
+	d := out[0].Data
+	if d["n"] != int64(42) || d["f"] != 1.5 || d["b"] != true || d["ts"] != "2023-11-14 22:13:20" {
+		t.Fatalf("unexpected cast output: %+v", d)
+	}
+}
+
+func TestCastTransform_FailsWithoutNullOnError(t *testing.T) {
+	tr := &CastTransform{}
+	cfg := ConnectorConfig{Fields: map[string]interface{}{"casts": "n:int"}}
+	if err := tr.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	_, err := tr.Apply(context.Background(), cfg, Batch{Records: []Record{{Data: map[string]interface{}{"n": "abc"}}}})
+	if err == nil {
+		t.Fatalf("expected cast error")
+	}
+}
+
+func TestFilterTransform(t *testing.T) {
+	out := applyTransform(t, "transform_filter",
+		map[string]interface{}{"expression": "status == 'ok' and (amount > 10 or lower(country) = 'de')"},
+		map[string]interface{}{"status": "ok", "amount": 20.0, "country": "US"},
+		map[string]interface{}{"status": "ok", "amount": 5.0, "country": "DE"},
+		map[string]interface{}{"status": "ok", "amount": 5.0, "country": "US"},
+		map[string]interface{}{"status": "failed", "amount": 50.0, "country": "DE"},
+	)
+	if len(out) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(out))
+	}
+}
+
+func TestFilterTransform_CopiesKeptRecords(t *testing.T) {
+	in := map[string]interface{}{"n": 2.0}
+	out := applyTransform(t, "transform_filter", map[string]interface{}{"expression": "n > 1"}, in)
+
+	out[0].Data["n"] = 3.0
+	if in["n"] != 2.0 {
+		t.Fatalf("filter output shares data with its input: %+v", in)
+	}
+	if string(out[0].RawJSON) != `{}` {
+		t.Fatalf("expected RawJSON to be kept, got %q", out[0].RawJSON)
+	}
+}
+
+func TestFlattenTransform(t *testing.T) {
+	out := applyTransform(t, "transform_flatten", map[string]interface{}{"separator": "."},
+		map[string]interface{}{
+			"id":      1.0,
+			"user":    map[string]interface{}{"name": "a", "geo": map[string]interface{}{"country": "DE"}},
+			"payload": `{"k":"v"}`,
+		})
+	d := out[0].Data
+	if d["user.name"] != "a" || d["user.geo.country"] != "DE" || d["payload.k"] != "v" || d["id"] != 1.0 {
+		t.Fatalf("unexpected flatten output: %+v", d)
+	}
+}
+
+func TestComputeTransform(t *testing.T) {
+	out := applyTransform(t, "transform_compute",
+		map[string]interface{}{"columns": "total = price * qty\nlabel = concat(upper(sku), '-', total)"},
+		map[string]interface{}{"price": 2.5, "qty": 4.0, "sku": "ab"})
+	if out[0].Data["total"] != 10.0 || out[0].Data["label"] != "AB-10" {
+		t.Fatalf("unexpected compute output: %+v", out[0].Data)
+	}
+}
+
+func TestCompileExpr_Errors(t *testing.T) {
+	for _, src := range []string{"a ==", "unknown_fn(a)", "(a > 1", "'open"} {
+		if _, err := CompileExpr(src); err == nil {
+			t.Fatalf("%s: expected compile error", src)
+		}
+	}
+}
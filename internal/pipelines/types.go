@@ -2,6 +2,7 @@ package pipelines
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -16,12 +17,47 @@ type Record struct {
 type Batch struct {
 	Records  []Record
 	SourceTS time.Time
+
+	// Checkpoint holds source position entries (e.g. S3 object ETags or a
+	// database watermark) that the runner persists once the batch has been
+	// delivered. Sources resume from them via ConnectorConfig.Checkpoint.
+	Checkpoint map[string]string
+
+	// ColumnTypes maps field names to ClickHouse types when the source
+	// knows its schema (e.g. Avro or Protobuf). Sinks use it instead of
+	// inferring types when auto-creating tables.
+	ColumnTypes map[string]string
+
+	// SourceLag is the number of records still waiting at the source after
+	// this batch, keyed by partition (e.g. "topic/3" for Kafka).
+	SourceLag map[string]int64
+
+	// Position identifies the source range the batch was read from (e.g. a
+	// Kafka partition and offset range), so a replay of the same range has
+	// the same position. Sinks derive insert deduplication tokens from it.
+	// The runner numbers batches within the run when a source leaves it
+	// empty.
+	Position string
+
+	// Ack, when set, is called by the runner once the batch has been
+	// processed. delivered is true only if every record reached a sink or
+	// the dead-letter destination; sources use it to commit offsets.
+	Ack func(delivered bool)
+
+	// seq numbers source batches in arrival order. The runner uses it to
+	// hold checkpoints and acks until buffered sinks have written the
+	// batch's records.
+	seq uint64
 }
 
 // ConnectorConfig is the parsed config for a connector node.
 type ConnectorConfig struct {
 	NodeType string                 `json:"node_type"`
 	Fields   map[string]interface{} `json:"fields"`
+
+	// Checkpoint is the last committed source position, loaded by the runner
+	// before Start. Empty when the pipeline has never run or was reset.
+	Checkpoint map[string]string `json:"-"`
 }
 
 // SourceConnector is the interface all source connectors implement.
@@ -44,6 +80,19 @@ type SinkConnector interface {
 	Type() string
 }
 
+// TransformConnector rewrites batches between a source and its sinks.
+type TransformConnector interface {
+	// Validate checks and compiles the node configuration. It is called once
+	// before the pipeline starts; Apply relies on the compiled state.
+	Validate(cfg ConnectorConfig) error
+
+	// Apply returns the transformed batch. Returned records may be fewer than
+	// the input (filters) and must not share Data maps with the input.
+	Apply(ctx context.Context, cfg ConnectorConfig, batch Batch) (Batch, error)
+
+	Type() string
+}
+
 // Metrics tracks pipeline execution metrics (thread-safe via atomic).
 type Metrics struct {
 	RowsIngested  atomic.Int64
@@ -51,4 +100,61 @@ type Metrics struct {
 	BatchesSent   atomic.Int64
 	ErrorsCount   atomic.Int64
 	LastBatchAt   atomic.Value // time.Time
+
+	RowsDeadLettered atomic.Int64
+
+	lagMu     sync.Mutex
+	sourceLag map[string]int64
+
+	// End-to-end lag observed since the last history snapshot.
+	e2eSum   time.Duration
+	e2eMax   time.Duration
+	e2eCount int64
+}
+
+// ObserveLag records the delay between a batch being read and its records
+// being written.
+func (m *Metrics) ObserveLag(d time.Duration) {
+	m.lagMu.Lock()
+	defer m.lagMu.Unlock()
+	m.e2eSum += d
+	m.e2eCount++
+	if d > m.e2eMax {
+		m.e2eMax = d
+	}
+}
+
+// takeLag returns the average and maximum end-to-end lag observed since the
+// previous call and resets them.
+func (m *Metrics) takeLag() (avg, max time.Duration) {
+	m.lagMu.Lock()
+	defer m.lagMu.Unlock()
+	if m.e2eCount > 0 {
+		avg, max = m.e2eSum/time.Duration(m.e2eCount), m.e2eMax
+	}
+	m.e2eSum, m.e2eMax, m.e2eCount = 0, 0, 0
+	return avg, max
+}
+
+// SetSourceLag records the latest per-partition source lag.
+func (m *Metrics) SetSourceLag(lag map[string]int64) {
+	m.lagMu.Lock()
+	defer m.lagMu.Unlock()
+	if m.sourceLag == nil {
+		m.sourceLag = make(map[string]int64, len(lag))
+	}
+	for k, v := range lag {
+		m.sourceLag[k] = v
+	}
+}
+
+// SourceLag returns a copy of the per-partition source lag.
+func (m *Metrics) SourceLag() map[string]int64 {
+	m.lagMu.Lock()
+	defer m.lagMu.Unlock()
+	out := make(map[string]int64, len(m.sourceLag))
+	for k, v := range m.sourceLag {
+		out[k] = v
+	}
+	return out
 }
@@ -0,0 +1,247 @@
+package queryproc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Dashboard variable types.
+const (
+	VariableTypeCustom   = "custom"   // a fixed list of options
+	VariableTypeConstant = "constant" // a single value the viewer cannot change
+	VariableTypeQuery    = "query"    // options listed by a SQL query
+)
+
+// Variable is a dashboard-level template variable. Panel queries reference it
+// as $name or ${name}, unquoted: values are interpolated as quoted string
+// literals, comma-separated when several are selected, so multi-select
+// variables belong inside IN (...).
+type Variable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	// Query lists the options of a query variable from its first column. It
+	// may use time macros and any variable defined before this one.
+	Query   string   `json:"query"`
+	Options []string `json:"options"`
+	Value   string   `json:"value"`
+	Multi   bool     `json:"multi"`
+	Default []string `json:"default"`
+}
+
+// ResolvedVariable is a variable with its available options and the values in
+// effect.
+type ResolvedVariable struct {
+	Name    string   `json:"name"`
+	Label   string   `json:"label"`
+	Type    string   `json:"type"`
+	Multi   bool     `json:"multi"`
+	Options []string `json:"options"`
+	Values  []string `json:"values"`
+}
+
+// OptionsFunc runs the interpolated SQL of a query variable and returns its
+// options.
+type OptionsFunc func(query string) ([]string, error)
+
+var (
+	patVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	patVariableRef  = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+	literalEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+)
+
+// ValidateVariables checks variable definitions. Names must be unique
+// identifiers that do not clash with the $__ macros, and a query variable may
+// only depend on variables defined before it.
+func ValidateVariables(vars []Variable) error {
+	defined := map[string]bool{}
+	for i, v := range vars {
+		name := v.Name
+		if !patVariableName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("variable %d: name %q must be letters, digits and underscores and not start with __", i+1, name)
+		}
+		if defined[name] {
+			return fmt.Errorf("variable %s is defined more than once", name)
+		}
+		switch v.Type {
+		case VariableTypeCustom:
+			if len(v.Options) == 0 {
+				return fmt.Errorf("variable %s: custom variables need at least one option", name)
+			}
+			for _, d := range v.Default {
+				if !containsString(v.Options, d) {
+					return fmt.Errorf("variable %s: default %q is not one of its options", name, d)
+				}
+			}
+		case VariableTypeConstant:
+			if v.Multi {
+				return fmt.Errorf("variable %s: constant variables cannot be multi-select", name)
+			}
+		case VariableTypeQuery:
+			if strings.TrimSpace(v.Query) == "" {
+				return fmt.Errorf("variable %s: query is required", name)
+			}
+			for _, ref := range referencedVariables(v.Query) {
+				if ref == name {
+					return fmt.Errorf("variable %s: query cannot reference itself", name)
+				}
+				if !defined[ref] && definesVariable(vars[i+1:], ref) {
+					return fmt.Errorf("variable %s: query references $%s, which must be defined before it", name, ref)
+				}
+			}
+		default:
+			return fmt.Errorf("variable %s: type must be custom, constant or query", name)
+		}
+		defined[name] = true
+	}
+	return nil
+}
+
+// ResolveVariables works out the options and values of each variable in
+// order, so chained variables see the values of the ones before them.
+// Selected values outside a variable's options are dropped, falling back to
+// its default and then its first option. With a nil run, query variables are
+// not executed and their selected values are taken as given.
+func ResolveVariables(vars []Variable, selected map[string][]string, timeRange *TimeRange, run OptionsFunc) ([]ResolvedVariable, error) {
+	resolved := make([]ResolvedVariable, 0, len(vars))
+	for _, v := range vars {
+		rv := ResolvedVariable{Name: v.Name, Label: v.Label, Type: v.Type, Multi: v.Multi, Options: []string{}}
+		restrict := true
+		switch v.Type {
+		case VariableTypeConstant:
+			rv.Options = []string{v.Value}
+			rv.Values = []string{v.Value}
+			resolved = append(resolved, rv)
+			continue
+		case VariableTypeCustom:
+			rv.Options = v.Options
+		case VariableTypeQuery:
+			if run == nil {
+				restrict = false
+				break
+			}
+			out := ProcessQueryVariables(ProcessorOptions{Query: v.Query, TimeRange: timeRange, Variables: resolved})
+			if len(out.Errors) > 0 {
+				return nil, fmt.Errorf("variable %s: %s", v.Name, strings.Join(out.Errors, "; "))
+			}
+			options, err := run(out.Query)
+			if err != nil {
+				return nil, fmt.Errorf("variable %s: %w", v.Name, err)
+			}
+			rv.Options = options
+		}
+		rv.Values = pickValues(selected[v.Name], v.Default, rv.Options, v.Multi, restrict)
+		resolved = append(resolved, rv)
+	}
+	return resolved, nil
+}
+
+// UsesVariables reports whether a query references any of the given
+// variables.
+func UsesVariables(query string, vars []Variable) bool {
+	for _, ref := range referencedVariables(query) {
+		if definesVariable(vars, ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// pickValues chooses the values in effect for a variable.
+func pickValues(selected, defaults, options []string, multi, restrict bool) []string {
+	filter := func(in []string) []string {
+		out := []string{}
+		for _, s := range in {
+			if (!restrict || containsString(options, s)) && !containsString(out, s) {
+				out = append(out, s)
+			}
+		}
+		if !multi && len(out) > 1 {
+			out = out[:1]
+		}
+		return out
+	}
+	if values := filter(selected); len(values) > 0 {
+		return values
+	}
+	if values := filter(defaults); len(values) > 0 {
+		return values
+	}
+	if len(options) > 0 {
+		return []string{options[0]}
+	}
+	return []string{}
+}
+
+// interpolateVariables replaces references to the given variables with their
+// values as quoted literals. References to unknown names are left alone.
+func interpolateVariables(query string, vars []ResolvedVariable, interpolated map[string]any) (string, []string) {
+	byName := make(map[string]ResolvedVariable, len(vars))
+	for _, v := range vars {
+		byName[v.Name] = v
+	}
+	var errors []string
+	out := patVariableRef.ReplaceAllStringFunc(query, func(match string) string {
+		groups := patVariableRef.FindStringSubmatch(match)
+		name := groups[1]
+		if name == "" {
+			name = groups[2]
+		}
+		v, ok := byName[name]
+		if !ok {
+			return match
+		}
+		if len(v.Values) == 0 {
+			errors = append(errors, fmt.Sprintf("Variable $%s has no value selected", name))
+			return match
+		}
+		interpolated[name] = v.Values
+		return quoteLiterals(v.Values)
+	})
+	return out, errors
+}
+
+// quoteLiterals renders values as comma-separated ClickHouse string literals.
+func quoteLiterals(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + literalEscaper.Replace(v) + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// referencedVariables returns the non-macro variable names a query refers to.
+func referencedVariables(query string) []string {
+	var names []string
+	for _, groups := range patVariableRef.FindAllStringSubmatch(query, -1) {
+		name := groups[1]
+		if name == "" {
+			name = groups[2]
+		}
+		if !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// definesVariable reports whether vars include one called name.
+func definesVariable(vars []Variable, name string) bool {
+	for _, v := range vars {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package queryproc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcessQueryVariables_QuotesDashboardVariables(t *testing.T) {
+	out := ProcessQueryVariables(ProcessorOptions{
+		Query: "SELECT count() FROM t WHERE region IN ($region) AND env = ${env} AND x = $other",
+		Variables: []ResolvedVariable{
+			{Name: "region", Multi: true, Values: []string{"eu", "us'); DROP TABLE t; --"}},
+			{Name: "env", Values: []string{`prod\`}},
+		},
+	})
+	if len(out.Errors) > 0 {
+		t.Fatalf("unexpected errors: %+v", out.Errors)
+	}
+	want := `SELECT count() FROM t WHERE region IN ('eu', 'us\'); DROP TABLE t; --') AND env = 'prod\\' AND x = $other`
+	if out.Query != want {
+		t.Fatalf("got  %s\nwant %s", out.Query, want)
+	}
+}
+
+func TestResolveVariables_ChainsAndRestrictsToOptions(t *testing.T) {
+	vars := []Variable{
+		{Name: "region", Type: VariableTypeCustom, Options: []string{"eu", "us"}, Default: []string{"us"}},
+		{Name: "host", Type: VariableTypeQuery, Query: "SELECT DISTINCT host FROM hosts WHERE region = $region", Multi: true},
+	}
+	if err := ValidateVariables(vars); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	var ran []string
+	run := func(query string) ([]string, error) {
+		ran = append(ran, query)
+		return []string{"a", "b", "c"}, nil
+	}
+	resolved, err := ResolveVariables(vars, map[string][]string{
+		"region": {"apac"},
+		"host":   {"c", "z", "a"},
+	}, nil, run)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if got := strings.Join(resolved[0].Values, ","); got != "us" {
+		t.Fatalf("region should fall back to its default, got %s", got)
+	}
+	if len(ran) != 1 || ran[0] != "SELECT DISTINCT host FROM hosts WHERE region = 'us'" {
+		t.Fatalf("unexpected option query: %v", ran)
+	}
+	if got := strings.Join(resolved[1].Values, ","); got != "c,a" {
+		t.Fatalf("host values should be limited to its options, got %s", got)
+	}
+}
+
+func TestValidateVariables_RejectsForwardReferences(t *testing.T) {
+	err := ValidateVariables([]Variable{
+		{Name: "host", Type: VariableTypeQuery, Query: "SELECT host FROM hosts WHERE region = $region"},
+		{Name: "region", Type: VariableTypeCustom, Options: []string{"eu"}},
+	})
+	if err == nil {
+		t.Fatal("expected an error for a reference to a later variable")
+	}
+	if err := ValidateVariables([]Variable{{Name: "__x", Type: VariableTypeConstant}}); err == nil {
+		t.Fatal("expected an error for a name that clashes with macros")
+	}
+}
@@ -24,6 +24,8 @@ type ProcessorOptions struct {
 	TimeFieldUnit string // "ns", "us", "ms", "s" - defaults to "ms"
 	MaxDataPoints int    // defaults to 1000
 	Table         string
+	// Variables are dashboard variables, interpolated after the macros.
+	Variables []ResolvedVariable
 }
 
 // ProcessedResult contains the output of query variable interpolation.
@@ -183,6 +185,18 @@ func ProcessQueryVariables(opts ProcessorOptions) ProcessedResult {
 		errors = append(errors, "Time-range variables found but no time range was provided")
 	}
 
+	// 4. Handle dashboard variables last, so quoted values are never
+	// mistaken for macros.
+	if len(opts.Variables) > 0 {
+		values := map[string]any{}
+		var varErrors []string
+		processedQuery, varErrors = interpolateVariables(processedQuery, opts.Variables, values)
+		errors = append(errors, varErrors...)
+		if len(values) > 0 {
+			interpolatedVars["variables"] = values
+		}
+	}
+
 	return ProcessedResult{
 		Query:            processedQuery,
 		HasTimeVariables: HasTimeVariables(opts.Query),
@@ -1,106 +1,441 @@
 package scheduler
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
+
+	// Embed the IANA database so schedule timezones resolve on hosts
+	// without /usr/share/zoneinfo.
+	_ "time/tzdata"
 )
 
-// parseField parses a single cron field (e.g. "*/5", "1-15", "1,5,10", "*")
-// and returns a set of matching integer values within [min, max].
-func parseField(field string, min, max int) map[int]bool {
-	values := make(map[int]bool)
-	parts := strings.Split(field, ",")
+// searchYears bounds how far ahead the next fire time is searched. It covers
+// the longest gap of satisfiable expressions, such as "29 Feb on a Monday".
+const searchYears = 30
 
-	for _, part := range parts {
-		rangePart := part
-		step := 1
+// Cron is a parsed cron expression.
+//
+// The standard five fields (minute hour day-of-month month day-of-week) are
+// accepted, optionally preceded by a seconds field. Fields support lists,
+// ranges, steps ("*/5", "10-40/10", "5/15"), month and weekday names
+// ("JAN", "MON-FRI") and "?" as an alias of "*" in the day fields. The
+// day-of-month field also accepts "L" (last day) and "L-n" (n days before
+// it); the day-of-week field accepts "5L" (last Friday) and "1#2" (second
+// Monday). As in standard cron, when both day fields are restricted a day
+// matching either of them fires.
+type Cron struct {
+	second, minute, hour, dom, month, dow uint64
+
+	domAny, dowAny bool
+	lastDays       []int    // L and L-n, as days before the last day of the month
+	lastDow        uint8    // weekdays with the L modifier
+	nthDow         [7]uint8 // weekday -> bitset of occurrences (1-5) in the month
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+var weekdayNames = map[string]int{
+	"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+}
+
+// cronField describes the values one field accepts.
+type cronField struct {
+	name     string
+	min, max int
+	anyMax   int // upper bound of "*" and "n/step"; differs from max for weekday 7
+	names    map[string]int
+}
+
+var (
+	secondField = cronField{name: "second", min: 0, max: 59, anyMax: 59}
+	minuteField = cronField{name: "minute", min: 0, max: 59, anyMax: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23, anyMax: 23}
+	domField    = cronField{name: "day-of-month", min: 1, max: 31, anyMax: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, anyMax: 12, names: monthNames}
+	dowField    = cronField{name: "day-of-week", min: 0, max: 7, anyMax: 6, names: weekdayNames}
+)
+
+// ParseCron parses a cron expression or one of the @yearly, @monthly,
+// @weekly, @daily, @midnight and @hourly macros.
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") {
+		macro, ok := cronMacros[strings.ToLower(expr)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported macro %q", expr)
+		}
+		expr = macro
+	}
 
-		if idx := strings.Index(part, "/"); idx >= 0 {
-			rangePart = part[:idx]
-			s, err := strconv.Atoi(part[idx+1:])
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields, got %d", len(fields))
+	}
+
+	c := &Cron{}
+	var err error
+	if c.second, err = parseCronField(fields[0], secondField); err != nil {
+		return nil, err
+	}
+	if c.minute, err = parseCronField(fields[1], minuteField); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[2], hourField); err != nil {
+		return nil, err
+	}
+	if err := c.parseDom(fields[3]); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[4], monthField); err != nil {
+		return nil, err
+	}
+	if err := c.parseDow(fields[5]); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseDom parses the day-of-month field, pulling out L and L-n.
+func (c *Cron) parseDom(field string) error {
+	c.domAny = field == "*" || field == "?"
+	var rest []string
+	for _, part := range strings.Split(field, ",") {
+		upper := strings.ToUpper(part)
+		if upper == "L" {
+			c.lastDays = append(c.lastDays, 0)
+			continue
+		}
+		if strings.HasPrefix(upper, "L-") {
+			n, err := strconv.Atoi(upper[2:])
+			if err != nil || n < 1 || n > 30 {
+				return fmt.Errorf("day-of-month field: invalid value %q", part)
+			}
+			c.lastDays = append(c.lastDays, n)
+			continue
+		}
+		rest = append(rest, part)
+	}
+	if len(rest) == 0 {
+		return nil
+	}
+	bits, err := parseCronField(strings.Join(rest, ","), domField)
+	c.dom = bits
+	return err
+}
+
+// parseDow parses the day-of-week field, pulling out nL and d#n and folding
+// 7 onto Sunday.
+func (c *Cron) parseDow(field string) error {
+	c.dowAny = field == "*" || field == "?"
+	var rest []string
+	for _, part := range strings.Split(field, ",") {
+		upper := strings.ToUpper(part)
+		if day, nth, ok := strings.Cut(upper, "#"); ok {
+			wd, err := parseCronValue(day, dowField)
+			n, nerr := strconv.Atoi(nth)
+			if err != nil || nerr != nil || n < 1 || n > 5 {
+				return fmt.Errorf("day-of-week field: invalid value %q", part)
+			}
+			c.nthDow[wd%7] |= 1 << n
+			continue
+		}
+		if len(upper) > 1 && strings.HasSuffix(upper, "L") {
+			wd, err := parseCronValue(upper[:len(upper)-1], dowField)
+			if err != nil {
+				return fmt.Errorf("day-of-week field: invalid value %q", part)
+			}
+			c.lastDow |= 1 << (wd % 7)
+			continue
+		}
+		rest = append(rest, part)
+	}
+	if len(rest) == 0 {
+		return nil
+	}
+	bits, err := parseCronField(strings.Join(rest, ","), dowField)
+	if bits&(1<<7) != 0 {
+		bits = bits&^(1<<7) | 1
+	}
+	c.dow = bits
+	return err
+}
+
+// parseCronField parses a comma-separated list of values, ranges and steps
+// into a bitset.
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			s, err := strconv.Atoi(stepPart)
 			if err != nil || s <= 0 {
-				continue
+				return 0, fmt.Errorf("%s field: invalid step in %q", f.name, part)
 			}
 			step = s
 		}
 
+		var lo, hi int
 		switch {
-		case rangePart == "*":
-			// Every value from min to max, filtered by step.
-			for v := min; v <= max; v++ {
-				if (v-min)%step == 0 {
-					values[v] = true
-				}
-			}
-
+		case rangePart == "*" || (rangePart == "?" && (f.name == domField.name || f.name == dowField.name)):
+			lo, hi = f.min, f.anyMax
 		case strings.Contains(rangePart, "-"):
-			bounds := strings.SplitN(rangePart, "-", 2)
-			s, err1 := strconv.Atoi(bounds[0])
-			e, err2 := strconv.Atoi(bounds[1])
-			if err1 != nil || err2 != nil {
-				continue
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = parseCronValue(a, f); err != nil {
+				return 0, err
 			}
-			for v := s; v <= e; v++ {
-				if (v-s)%step == 0 {
-					values[v] = true
-				}
+			if hi, err = parseCronValue(b, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s field: range %q runs backwards", f.name, rangePart)
 			}
-
 		default:
-			num, err := strconv.Atoi(rangePart)
-			if err == nil {
-				values[num] = true
+			v, err := parseCronValue(rangePart, f)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if hasStep {
+				hi = f.anyMax
 			}
 		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
 	}
+	return bits, nil
+}
 
-	return values
+// parseCronValue parses a single number or name within the field's bounds.
+func parseCronValue(s string, f cronField) (int, error) {
+	if v, ok := f.names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s field: invalid value %q", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s field: %d is outside %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
 }
 
-// ComputeNextRun parses a standard 5-field cron expression (minute hour dom month dow)
-// and returns the next matching UTC time after `from`, iterating minute by minute
-// up to 1 year ahead. Returns nil if no match is found.
-func ComputeNextRun(cron string, from time.Time) *time.Time {
-	fields := strings.Fields(strings.TrimSpace(cron))
-	if len(fields) != 5 {
-		return nil
+// Next returns the first fire time strictly after from, with the expression
+// evaluated on the wall clock of loc.
+//
+// Across DST transitions, a wall-clock time skipped when clocks go forward
+// fires at the moment of the change, and a time repeated when clocks go back
+// fires once. Expressions that match every hour are the exception: they
+// follow elapsed time, skipping the missing hour and running through the
+// repeated one.
+func (c *Cron) Next(from time.Time, loc *time.Location) (time.Time, bool) {
+	from = from.In(loc)
+	everyHour := c.hour == 1<<24-1
+
+	// A time repeated after clocks go back can fire after from while its
+	// wall-clock reading is earlier, so start before from near a transition.
+	cur := wallClock(from)
+	_, off := from.Zone()
+	_, offBefore := from.Add(-3 * time.Hour).Zone()
+	_, offAfter := from.Add(3 * time.Hour).Zone()
+	if off != offBefore || off != offAfter {
+		cur = cur.Add(-3 * time.Hour)
 	}
 
-	minutes := parseField(fields[0], 0, 59)
-	hours := parseField(fields[1], 0, 23)
-	dom := parseField(fields[2], 1, 31)
-	months := parseField(fields[3], 1, 12)
-	dow := parseField(fields[4], 0, 6)
+	limit := from.Year() + searchYears
+	var best time.Time
+	found := false
+	for {
+		wall, ok := c.nextWall(cur, limit)
+		if !ok {
+			break
+		}
+		cur = wall
 
-	if len(minutes) == 0 || len(hours) == 0 || len(dom) == 0 || len(months) == 0 || len(dow) == 0 {
-		return nil
+		instants := wallInstants(wall, loc)
+		switch {
+		case len(instants) == 0 && everyHour:
+			continue
+		case len(instants) == 0:
+			instants = []time.Time{gapEnd(wall, loc)}
+		case !everyHour:
+			instants = instants[:1]
+		}
+
+		if found && !instants[0].Before(best) {
+			break
+		}
+		for _, t := range instants {
+			if t.After(from) && (!found || t.Before(best)) {
+				best, found = t, true
+			}
+		}
 	}
+	return best, found
+}
 
-	// Start from the next minute after `from`, truncated to the minute boundary.
-	next := from.UTC().Truncate(time.Minute).Add(time.Minute)
+// nextWall returns the first matching wall-clock time after t. Wall-clock
+// times are carried in UTC so the calendar arithmetic sees no DST shifts.
+func (c *Cron) nextWall(t time.Time, limit int) (time.Time, bool) {
+	t = t.Truncate(time.Second).Add(time.Second)
+	for t.Year() <= limit {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		case c.second&(1<<uint(t.Second())) == 0:
+			t = t.Add(time.Second)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
 
-	// 525600 minutes = 1 year
-	for i := 0; i < 525600; i++ {
-		m := next.Minute()
-		h := next.Hour()
-		d := next.Day()
-		mo := int(next.Month())
-		dw := int(next.Weekday()) // Sunday=0
+// dayMatches reports whether the day fields match the date of t.
+func (c *Cron) dayMatches(t time.Time) bool {
+	day, wd := t.Day(), int(t.Weekday())
+	last := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
 
-		if minutes[m] && hours[h] && dom[d] && months[mo] && dow[dw] {
-			result := next
-			return &result
+	domOK := c.dom&(1<<uint(day)) != 0
+	for _, n := range c.lastDays {
+		if day == last-n {
+			domOK = true
 		}
+	}
+	dowOK := c.dow&(1<<uint(wd)) != 0 ||
+		(c.lastDow&(1<<uint(wd)) != 0 && day+7 > last) ||
+		c.nthDow[wd]&(1<<uint((day-1)/7+1)) != 0
 
-		next = next.Add(time.Minute)
+	if c.domAny || c.dowAny {
+		return domOK && dowOK
 	}
+	return domOK || dowOK
+}
 
-	return nil
+// wallClock returns the wall-clock reading of t carried in UTC.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
 }
 
-// ValidateCron returns true if the cron expression is syntactically valid
-// and can produce at least one future run time.
-func ValidateCron(cron string) bool {
-	return ComputeNextRun(cron, time.Now()) != nil
+// wallInstants returns, in order, the instants at which loc's clocks read
+// wall: none inside a DST gap, two inside a repeated hour.
+func wallInstants(wall time.Time, loc *time.Location) []time.Time {
+	base := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+	var out []time.Time
+	for _, probe := range []time.Time{base.Add(-3 * time.Hour), base, base.Add(3 * time.Hour)} {
+		_, off := probe.Zone()
+		t := wall.Add(-time.Duration(off) * time.Second).In(loc)
+		if !wallClock(t).Equal(wall) {
+			continue
+		}
+		dup := false
+		for _, o := range out {
+			dup = dup || o.Equal(t)
+		}
+		if !dup {
+			out = append(out, t)
+		}
+	}
+	if len(out) == 2 && out[1].Before(out[0]) {
+		out[0], out[1] = out[1], out[0]
+	}
+	return out
+}
+
+// gapEnd returns the instant clocks jump past the DST gap containing wall.
+func gapEnd(wall time.Time, loc *time.Location) time.Time {
+	base := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+	start, end := base.ZoneBounds()
+	if wallClock(base).After(wall) {
+		return start
+	}
+	return end
+}
+
+// LoadTimezone resolves an IANA timezone name; an empty name means UTC.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+// NextRuns returns up to n fire times of the expression after from, in the
+// given timezone.
+func NextRuns(cron, timezone string, from time.Time, n int) ([]time.Time, error) {
+	c, err := ParseCron(cron)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := LoadTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
+	var runs []time.Time
+	for len(runs) < n {
+		next, ok := c.Next(from, loc)
+		if !ok {
+			break
+		}
+		runs = append(runs, next)
+		from = next
+	}
+	return runs, nil
+}
+
+// ComputeNextRun returns the next fire time of the expression after from,
+// evaluated in the given IANA timezone, as a UTC time. Returns nil if the
+// expression or timezone is invalid or never fires.
+func ComputeNextRun(cron, timezone string, from time.Time) *time.Time {
+	runs, err := NextRuns(cron, timezone, from, 1)
+	if err != nil || len(runs) == 0 {
+		return nil
+	}
+	next := runs[0].UTC()
+	return &next
+}
+
+// ValidateCron returns an error if the cron expression is malformed or
+// never fires.
+func ValidateCron(cron string) error {
+	runs, err := NextRuns(cron, "UTC", time.Now(), 1)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("expression never fires")
+	}
+	return nil
 }
@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func mustRuns(t *testing.T, cron, tz string, from time.Time, n int) []string {
+	t.Helper()
+	runs, err := NextRuns(cron, tz, from, n)
+	if err != nil {
+		t.Fatalf("NextRuns(%q): %v", cron, err)
+	}
+	out := make([]string, len(runs))
+	for i, r := range runs {
+		out[i] = r.UTC().Format(time.RFC3339)
+	}
+	return out
+}
+
+func assertRuns(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestNextRuns_ExtendedSyntax(t *testing.T) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	assertRuns(t, mustRuns(t, "0 0 * * 5L", "UTC", from, 1), "2026-10-30T00:00:00Z")
+	assertRuns(t, mustRuns(t, "0 0 ? * MON#2", "UTC", from, 1), "2026-10-12T00:00:00Z")
+	assertRuns(t, mustRuns(t, "0 0 L,L-1 FEB *", "UTC", from, 2), "2027-02-27T00:00:00Z", "2027-02-28T00:00:00Z")
+	assertRuns(t, mustRuns(t, "@monthly", "UTC", from, 1), "2026-11-01T00:00:00Z")
+	assertRuns(t, mustRuns(t, "*/20 * * * * *", "UTC", from, 3), "2026-10-01T00:00:20Z", "2026-10-01T00:00:40Z", "2026-10-01T00:01:00Z")
+	// Both day fields restricted: either matches.
+	assertRuns(t, mustRuns(t, "0 0 13 * FRI", "UTC", from, 2), "2026-10-02T00:00:00Z", "2026-10-09T00:00:00Z")
+	// Sunday as 7.
+	assertRuns(t, mustRuns(t, "0 0 * * 7", "UTC", from, 1), "2026-10-04T00:00:00Z")
+
+	for _, bad := range []string{"61 * * * *", "* * *", "0 0 * * 1#6", "0 0 * * FRI-MON", "@reboot", "0 0 30 2 *"} {
+		if err := ValidateCron(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestNextRuns_DaylightSaving(t *testing.T) {
+	const ny = "America/New_York"
+
+	// Business-day report keeps its local hour across the March change.
+	from := time.Date(2026, 3, 6, 15, 0, 0, 0, time.UTC)
+	assertRuns(t, mustRuns(t, "0 9 * * MON-FRI", ny, from, 1), "2026-03-09T13:00:00Z")
+
+	// 02:30 does not exist on 8 March; the run happens when clocks jump.
+	from = time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC)
+	assertRuns(t, mustRuns(t, "30 2 * * *", ny, from, 2), "2026-03-08T07:00:00Z", "2026-03-09T06:30:00Z")
+
+	// 01:30 happens twice on 1 November; a fixed-time job runs once.
+	from = time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC)
+	assertRuns(t, mustRuns(t, "30 1 * * *", ny, from, 2), "2026-11-01T05:30:00Z", "2026-11-02T06:30:00Z")
+
+	// An hourly job runs through both copies of the repeated hour.
+	assertRuns(t, mustRuns(t, "0 * * * *", ny, from, 3), "2026-11-01T05:00:00Z", "2026-11-01T06:00:00Z", "2026-11-01T07:00:00Z")
+}
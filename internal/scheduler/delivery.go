@@ -0,0 +1,488 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/caioricciuti/ch-ui/internal/alerts"
+	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/tunnel"
+)
+
+// Delivery target types.
+const (
+	DeliveryEmail   = "email"
+	DeliveryWebhook = "webhook"
+	DeliveryS3      = "s3"
+)
+
+// Delivery outcomes recorded on a schedule run.
+const (
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusPartial   = "partial"
+	DeliveryStatusFailed    = "failed"
+)
+
+const (
+	// maxEmailAttachmentBytes keeps attachments under common provider limits.
+	maxEmailAttachmentBytes = 20 << 20
+
+	defaultS3KeyTemplate = "ch-ui/schedules/{{schedule_name}}/{{date}}/{{run_id}}.{{ext}}"
+)
+
+// DeliveryTarget is one destination for a schedule's query result. Email and
+// S3 targets receive a file in Format (csv, xlsx or parquet); webhooks
+// receive the rows as JSON.
+type DeliveryTarget struct {
+	Type   string `json:"type"`
+	Format string `json:"format,omitempty"`
+
+	// Email: sent through an alert channel, the first active one when
+	// ChannelID is empty.
+	ChannelID  string   `json:"channel_id,omitempty"`
+	Recipients []string `json:"recipients,omitempty"`
+	Subject    string   `json:"subject,omitempty"`
+
+	// Webhook
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// S3-compatible storage. KeyTemplate accepts {{schedule_id}},
+	// {{schedule_name}}, {{run_id}}, {{date}}, {{time}}, {{timestamp}} and
+	// {{ext}}; dates are in the schedule's timezone.
+	Endpoint    string `json:"endpoint,omitempty"`
+	Bucket      string `json:"bucket,omitempty"`
+	Region      string `json:"region,omitempty"`
+	AccessKey   string `json:"access_key,omitempty"`
+	SecretKey   string `json:"secret_key,omitempty"`
+	UseSSL      *bool  `json:"use_ssl,omitempty"`
+	KeyTemplate string `json:"key_template,omitempty"`
+}
+
+// DeliveryReport is the outcome of delivering one run's result.
+type DeliveryReport struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Bytes  int64  `json:"artifact_bytes"`
+}
+
+// ValidateDeliveryTargets checks that every target is complete.
+func ValidateDeliveryTargets(targets []DeliveryTarget) error {
+	for i, t := range targets {
+		prefix := fmt.Sprintf("delivery target %d", i+1)
+		switch t.Format {
+		case "", FormatCSV, FormatXLSX, FormatParquet:
+		default:
+			return fmt.Errorf("%s: unsupported format %q", prefix, t.Format)
+		}
+		switch t.Type {
+		case DeliveryEmail:
+			if len(t.Recipients) == 0 {
+				return fmt.Errorf("%s: at least one recipient is required", prefix)
+			}
+		case DeliveryWebhook:
+			u, err := url.Parse(t.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("%s: a valid http(s) url is required", prefix)
+			}
+		case DeliveryS3:
+			if t.Endpoint == "" || t.Bucket == "" || t.AccessKey == "" || t.SecretKey == "" {
+				return fmt.Errorf("%s: endpoint, bucket, access_key and secret_key are required", prefix)
+			}
+		default:
+			return fmt.Errorf("%s: unsupported type %q", prefix, t.Type)
+		}
+	}
+	return nil
+}
+
+// EncryptDeliveryTargets serializes and encrypts targets for storage. An
+// empty list encrypts to the empty string.
+func EncryptDeliveryTargets(targets []DeliveryTarget, secret string) (string, error) {
+	if len(targets) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(targets)
+	if err != nil {
+		return "", err
+	}
+	return crypto.Encrypt(string(raw), secret)
+}
+
+// DecryptDeliveryTargets reverses EncryptDeliveryTargets.
+func DecryptDeliveryTargets(encrypted, secret string) ([]DeliveryTarget, error) {
+	if encrypted == "" {
+		return nil, nil
+	}
+	raw, err := crypto.Decrypt(encrypted, secret)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt delivery targets: %w", err)
+	}
+	var targets []DeliveryTarget
+	if err := json.Unmarshal([]byte(raw), &targets); err != nil {
+		return nil, fmt.Errorf("parse delivery targets: %w", err)
+	}
+	return targets, nil
+}
+
+// RedactDeliveryTargets blanks S3 secret keys and webhook header values so
+// targets can be returned to clients.
+func RedactDeliveryTargets(targets []DeliveryTarget) []DeliveryTarget {
+	out := make([]DeliveryTarget, len(targets))
+	for i, t := range targets {
+		t.SecretKey = ""
+		if len(t.Headers) > 0 {
+			headers := make(map[string]string, len(t.Headers))
+			for k := range t.Headers {
+				headers[k] = ""
+			}
+			t.Headers = headers
+		}
+		out[i] = t
+	}
+	return out
+}
+
+// MergeDeliverySecrets fills secrets left blank in next from the previous
+// target with the same destination, so clients can resubmit redacted
+// targets unchanged. Targets are matched by URL for webhooks and by
+// endpoint, bucket and access key for S3; a secret is never carried over to
+// a different destination, whatever the order of the list.
+func MergeDeliverySecrets(next, prev []DeliveryTarget) {
+	for i := range next {
+		key := next[i].destinationKey()
+		if key == "" {
+			continue
+		}
+		var match *DeliveryTarget
+		for j := range prev {
+			if prev[j].Type == next[i].Type && prev[j].destinationKey() == key {
+				match = &prev[j]
+				break
+			}
+		}
+		if match == nil {
+			continue
+		}
+		if next[i].SecretKey == "" {
+			next[i].SecretKey = match.SecretKey
+		}
+		for k, v := range next[i].Headers {
+			if v == "" {
+				next[i].Headers[k] = match.Headers[k]
+			}
+		}
+	}
+}
+
+// AddsEmailTargets reports whether next sends email through a channel or to
+// a recipient list that no email target in prev already uses. Changing only
+// the subject or format of an existing email target does not count.
+func AddsEmailTargets(next, prev []DeliveryTarget) bool {
+	existing := make(map[string]bool)
+	for _, t := range prev {
+		if t.Type == DeliveryEmail {
+			existing[t.emailKey()] = true
+		}
+	}
+	for _, t := range next {
+		if t.Type == DeliveryEmail && !existing[t.emailKey()] {
+			return true
+		}
+	}
+	return false
+}
+
+// emailKey identifies the channel and recipients of an email target,
+// ignoring recipient order and case.
+func (t DeliveryTarget) emailKey() string {
+	recipients := make([]string, len(t.Recipients))
+	for i, r := range t.Recipients {
+		recipients[i] = strings.ToLower(strings.TrimSpace(r))
+	}
+	sort.Strings(recipients)
+	return t.ChannelID + "\x00" + strings.Join(recipients, ",")
+}
+
+// destinationKey identifies where a target sends its secrets. It is empty
+// for target types that carry none.
+func (t DeliveryTarget) destinationKey() string {
+	switch t.Type {
+	case DeliveryWebhook:
+		return t.URL
+	case DeliveryS3:
+		return strings.Join([]string{t.Endpoint, t.Bucket, t.AccessKey}, "\x00")
+	}
+	return ""
+}
+
+// artifact is a result encoded in one format.
+type artifact struct {
+	data        []byte
+	contentType string
+	ext         string
+}
+
+// delivery carries the state of delivering one run's result.
+type delivery struct {
+	db        *database.DB
+	secret    string
+	schedule  database.Schedule
+	runID     string
+	result    *tunnel.QueryResult
+	rowCount  int
+	at        time.Time // run time in the schedule's timezone
+	artifacts map[string]*artifact
+	http      *http.Client
+}
+
+// DeliverResult sends a run's result to every delivery target of the
+// schedule and records the outcome on the run. It returns nil when the
+// schedule has no targets.
+func DeliverResult(ctx context.Context, db *database.DB, secret string, schedule database.Schedule, runID string, result *tunnel.QueryResult, rowCount int) *DeliveryReport {
+	if schedule.DeliveryEncrypted == "" {
+		return nil
+	}
+
+	report := &DeliveryReport{Status: DeliveryStatusDelivered}
+	targets, err := DecryptDeliveryTargets(schedule.DeliveryEncrypted, secret)
+	if err != nil {
+		report.Status = DeliveryStatusFailed
+		report.Error = err.Error()
+	} else if len(targets) == 0 {
+		return nil
+	}
+
+	loc, err := LoadTimezone(schedule.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	d := &delivery{
+		db:        db,
+		secret:    secret,
+		schedule:  schedule,
+		runID:     runID,
+		result:    result,
+		rowCount:  rowCount,
+		at:        time.Now().In(loc),
+		artifacts: make(map[string]*artifact),
+		http:      &http.Client{Timeout: 60 * time.Second},
+	}
+
+	var errs []string
+	for i, t := range targets {
+		n, err := d.deliver(ctx, t)
+		report.Bytes += n
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s target %d: %v", t.Type, i+1, err))
+			slog.Warn("Scheduled result delivery failed", "schedule", schedule.ID, "target", t.Type, "error", err)
+		}
+	}
+	if len(errs) > 0 {
+		report.Error = strings.Join(errs, "; ")
+		report.Status = DeliveryStatusPartial
+		if len(errs) == len(targets) {
+			report.Status = DeliveryStatusFailed
+		}
+	}
+
+	if runID != "" {
+		if err := db.UpdateScheduleRunDelivery(runID, report.Status, report.Error, report.Bytes); err != nil {
+			slog.Warn("Failed to record schedule delivery", "run", runID, "error", err)
+		}
+	}
+	return report
+}
+
+func (d *delivery) deliver(ctx context.Context, t DeliveryTarget) (int64, error) {
+	switch t.Type {
+	case DeliveryEmail:
+		return d.deliverEmail(ctx, t)
+	case DeliveryWebhook:
+		return d.deliverWebhook(ctx, t)
+	case DeliveryS3:
+		return d.deliverS3(ctx, t)
+	default:
+		return 0, fmt.Errorf("unsupported type %q", t.Type)
+	}
+}
+
+// artifact returns the result encoded in format, encoding it once per run.
+func (d *delivery) artifact(format string) (*artifact, error) {
+	if format == "" {
+		format = FormatCSV
+	}
+	if a, ok := d.artifacts[format]; ok {
+		return a, nil
+	}
+	data, contentType, ext, err := EncodeResult(d.result, format)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", format, err)
+	}
+	a := &artifact{data: data, contentType: contentType, ext: ext}
+	d.artifacts[format] = a
+	return a, nil
+}
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slugify(s string) string {
+	slug := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if slug == "" {
+		return "schedule"
+	}
+	return slug
+}
+
+func (d *delivery) fileName(ext string) string {
+	return fmt.Sprintf("%s_%s.%s", slugify(d.schedule.Name), d.at.Format("20060102_150405"), ext)
+}
+
+func (d *delivery) deliverEmail(ctx context.Context, t DeliveryTarget) (int64, error) {
+	a, err := d.artifact(t.Format)
+	if err != nil {
+		return 0, err
+	}
+	if len(a.data) > maxEmailAttachmentBytes {
+		return 0, fmt.Errorf("%s attachment is %d bytes, over the %d byte email limit", a.ext, len(a.data), maxEmailAttachmentBytes)
+	}
+
+	var channel *database.AlertChannel
+	if t.ChannelID != "" {
+		channel, err = d.db.GetAlertChannelByID(t.ChannelID)
+	} else {
+		channel, err = d.db.GetFirstActiveAlertChannel()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("load alert channel: %w", err)
+	}
+	if channel == nil {
+		return 0, fmt.Errorf("no email channel configured")
+	}
+	decrypted, err := crypto.Decrypt(channel.ConfigEncrypted, d.secret)
+	if err != nil {
+		return 0, fmt.Errorf("decrypt channel config: %w", err)
+	}
+	var channelConfig map[string]interface{}
+	if err := json.Unmarshal([]byte(decrypted), &channelConfig); err != nil {
+		return 0, fmt.Errorf("parse channel config: %w", err)
+	}
+
+	subject := t.Subject
+	if subject == "" {
+		subject = "Scheduled report: " + d.schedule.Name
+	}
+	body := fmt.Sprintf("Scheduled query \"%s\" ran at %s and returned %d rows.\n\nThe result is attached as %s.\n\n— CH-UI",
+		d.schedule.Name, d.at.Format("2006-01-02 15:04 MST"), d.rowCount, a.ext)
+
+	attachment := alerts.Attachment{Filename: d.fileName(a.ext), ContentType: a.contentType, Data: a.data}
+	if _, err := alerts.SendDirectWithAttachments(ctx, channel.ChannelType, channelConfig, t.Recipients, subject, body, []alerts.Attachment{attachment}); err != nil {
+		return 0, err
+	}
+	return int64(len(a.data)), nil
+}
+
+func (d *delivery) deliverWebhook(ctx context.Context, t DeliveryTarget) (int64, error) {
+	payload := map[string]interface{}{
+		"schedule_id":   d.schedule.ID,
+		"schedule_name": d.schedule.Name,
+		"run_id":        d.runID,
+		"row_count":     d.rowCount,
+		"generated_at":  d.at.Format(time.RFC3339),
+		"meta":          json.RawMessage("[]"),
+		"data":          json.RawMessage("[]"),
+	}
+	if d.result != nil && len(d.result.Meta) > 0 {
+		payload["meta"] = d.result.Meta
+	}
+	if d.result != nil && len(d.result.Data) > 0 {
+		payload["data"] = d.result.Data
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(raw))
+	if err != nil {
+		return 0, fmt.Errorf("webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("webhook send: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		// The response body is not echoed: it is stored on the run and shown
+		// to anyone who can see the schedule.
+		return 0, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return int64(len(raw)), nil
+}
+
+// renderKey fills the placeholders of an S3 key template.
+func (d *delivery) renderKey(tpl, ext string) string {
+	if tpl == "" {
+		tpl = defaultS3KeyTemplate
+	}
+	out := strings.NewReplacer(
+		"{{schedule_id}}", d.schedule.ID,
+		"{{schedule_name}}", slugify(d.schedule.Name),
+		"{{run_id}}", d.runID,
+		"{{date}}", d.at.Format("2006-01-02"),
+		"{{time}}", d.at.Format("150405"),
+		"{{timestamp}}", strconv.FormatInt(d.at.Unix(), 10),
+		"{{ext}}", ext,
+	).Replace(tpl)
+	return strings.TrimLeft(out, "/")
+}
+
+func (d *delivery) deliverS3(ctx context.Context, t DeliveryTarget) (int64, error) {
+	a, err := d.artifact(t.Format)
+	if err != nil {
+		return 0, err
+	}
+
+	region := t.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	useSSL := true
+	if t.UseSSL != nil {
+		useSSL = *t.UseSSL
+	}
+	client, err := minio.New(t.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(t.AccessKey, t.SecretKey, ""),
+		Secure: useSSL,
+		Region: region,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("create S3 client: %w", err)
+	}
+
+	key := d.renderKey(t.KeyTemplate, a.ext)
+	if _, err := client.PutObject(ctx, t.Bucket, key, bytes.NewReader(a.data), int64(len(a.data)),
+		minio.PutObjectOptions{ContentType: a.contentType}); err != nil {
+		return 0, fmt.Errorf("upload s3://%s/%s: %w", t.Bucket, key, err)
+	}
+	return int64(len(a.data)), nil
+}
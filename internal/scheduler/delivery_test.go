@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMergeDeliverySecretsMatchesByDestination(t *testing.T) {
+	prev := []DeliveryTarget{
+		{Type: DeliveryS3, Endpoint: "s3.example.com", Bucket: "reports", AccessKey: "AK1", SecretKey: "secret-1"},
+		{Type: DeliveryWebhook, URL: "https://a.example.com/hook", Headers: map[string]string{"Authorization": "Bearer a"}},
+	}
+	next := []DeliveryTarget{
+		{Type: DeliveryWebhook, URL: "https://b.example.com/hook", Headers: map[string]string{"Authorization": ""}},
+		{Type: DeliveryS3, Endpoint: "s3.example.com", Bucket: "other", AccessKey: "AK1"},
+		{Type: DeliveryWebhook, URL: "https://a.example.com/hook", Headers: map[string]string{"Authorization": ""}},
+		{Type: DeliveryS3, Endpoint: "s3.example.com", Bucket: "reports", AccessKey: "AK1"},
+	}
+	MergeDeliverySecrets(next, prev)
+
+	if next[0].Headers["Authorization"] != "" || next[1].SecretKey != "" {
+		t.Fatalf("secret carried to a different destination: %+v", next[:2])
+	}
+	if next[2].Headers["Authorization"] != "Bearer a" || next[3].SecretKey != "secret-1" {
+		t.Fatalf("secret not kept for the same destination after reorder: %+v", next[2:])
+	}
+}
+
+func TestAddsEmailTargets(t *testing.T) {
+	prev := []DeliveryTarget{{Type: DeliveryEmail, ChannelID: "ch1", Recipients: []string{"a@example.com", "b@example.com"}}}
+
+	same := []DeliveryTarget{{Type: DeliveryEmail, ChannelID: "ch1", Recipients: []string{"B@example.com", "a@example.com"}, Subject: "Daily"}}
+	if AddsEmailTargets(same, prev) {
+		t.Fatal("resubmitted email target reported as new")
+	}
+	for name, next := range map[string][]DeliveryTarget{
+		"channel":   {{Type: DeliveryEmail, ChannelID: "ch2", Recipients: []string{"a@example.com", "b@example.com"}}},
+		"recipient": {{Type: DeliveryEmail, ChannelID: "ch1", Recipients: []string{"a@example.com", "c@example.com"}}},
+	} {
+		if !AddsEmailTargets(next, prev) {
+			t.Errorf("%s change not reported", name)
+		}
+	}
+	if AddsEmailTargets([]DeliveryTarget{{Type: DeliveryWebhook, URL: "https://example.com"}}, nil) {
+		t.Fatal("webhook target reported as email")
+	}
+}
+
+func TestDeliverWebhookOmitsResponseBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal token abc123", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	d := &delivery{http: srv.Client()}
+	_, err := d.deliverWebhook(context.Background(), DeliveryTarget{Type: DeliveryWebhook, URL: srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "502") || strings.Contains(err.Error(), "abc123") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
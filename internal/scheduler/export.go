@@ -0,0 +1,308 @@
+package scheduler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/caioricciuti/ch-ui/internal/tunnel"
+)
+
+// Result export formats.
+const (
+	FormatCSV     = "csv"
+	FormatXLSX    = "xlsx"
+	FormatParquet = "parquet"
+)
+
+// maxXLSXRows is the row limit of an Excel worksheet, header included.
+const maxXLSXRows = 1048576
+
+// resultTable is a query result decoded from ClickHouse's JSON format.
+type resultTable struct {
+	columns []resultColumn
+	rows    [][]json.RawMessage
+}
+
+type resultColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// decodeResult reads the meta and data sections of a JSON-format result,
+// keeping cells in column order.
+func decodeResult(result *tunnel.QueryResult) (*resultTable, error) {
+	t := &resultTable{}
+	if result == nil {
+		return t, nil
+	}
+	if len(result.Meta) > 0 {
+		if err := json.Unmarshal(result.Meta, &t.columns); err != nil {
+			return nil, fmt.Errorf("decode result columns: %w", err)
+		}
+	}
+	if len(result.Data) == 0 {
+		return t, nil
+	}
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(result.Data, &objects); err != nil {
+		return nil, fmt.Errorf("decode result rows: %w", err)
+	}
+	t.rows = make([][]json.RawMessage, len(objects))
+	for i, obj := range objects {
+		row := make([]json.RawMessage, len(t.columns))
+		for j, col := range t.columns {
+			row[j] = obj[col.Name]
+		}
+		t.rows[i] = row
+	}
+	return t, nil
+}
+
+// cellText returns the text of a JSON cell; ok is false for null.
+func cellText(raw json.RawMessage) (text string, ok bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", false
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s, true
+		}
+	}
+	return string(raw), true
+}
+
+// baseType strips Nullable and LowCardinality wrappers from a ClickHouse type.
+func baseType(t string) string {
+	for {
+		switch {
+		case strings.HasPrefix(t, "Nullable(") && strings.HasSuffix(t, ")"):
+			t = t[len("Nullable(") : len(t)-1]
+		case strings.HasPrefix(t, "LowCardinality(") && strings.HasSuffix(t, ")"):
+			t = t[len("LowCardinality(") : len(t)-1]
+		default:
+			return t
+		}
+	}
+}
+
+func isNumericType(t string) bool {
+	t = baseType(t)
+	for _, prefix := range []string{"Int", "UInt", "Float", "Decimal"} {
+		if strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeResult renders a query result as csv, xlsx or parquet. It returns the
+// file contents, content type and file extension.
+func EncodeResult(result *tunnel.QueryResult, format string) ([]byte, string, string, error) {
+	t, err := decodeResult(result)
+	if err != nil {
+		return nil, "", "", err
+	}
+	switch strings.ToLower(format) {
+	case "", FormatCSV:
+		data, err := encodeCSV(t)
+		return data, "text/csv", FormatCSV, err
+	case FormatXLSX:
+		data, err := encodeXLSX(t)
+		return data, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", FormatXLSX, err
+	case FormatParquet:
+		data, err := encodeParquet(t)
+		return data, "application/vnd.apache.parquet", FormatParquet, err
+	default:
+		return nil, "", "", fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func encodeCSV(t *resultTable) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		header[i] = c.Name
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(t.columns))
+	for _, row := range t.rows {
+		for i, cell := range row {
+			record[i], _ = cellText(cell)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// XLSX package parts other than the worksheet, which are the same for every
+// single-sheet workbook.
+var xlsxStaticParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Result" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// encodeXLSX writes a single-sheet workbook with a header row. Cells of
+// numeric columns are stored as numbers, everything else as inline strings.
+func encodeXLSX(t *resultTable) ([]byte, error) {
+	if len(t.rows)+1 > maxXLSXRows {
+		return nil, fmt.Errorf("result has %d rows, more than an Excel sheet holds", len(t.rows))
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, p := range xlsxStaticParts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	var sb bytes.Buffer
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	inlineString := func(s string) {
+		sb.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		xml.EscapeText(&sb, []byte(s))
+		sb.WriteString(`</t></is></c>`)
+	}
+
+	sb.WriteString(`<row>`)
+	for _, c := range t.columns {
+		inlineString(c.Name)
+	}
+	sb.WriteString(`</row>`)
+
+	numeric := make([]bool, len(t.columns))
+	for i, c := range t.columns {
+		numeric[i] = isNumericType(c.Type)
+	}
+	for _, row := range t.rows {
+		sb.WriteString(`<row>`)
+		for i, cell := range row {
+			text, ok := cellText(cell)
+			switch {
+			case !ok:
+				sb.WriteString(`<c/>`)
+			case numeric[i]:
+				if _, err := strconv.ParseFloat(text, 64); err == nil {
+					sb.WriteString(`<c><v>` + text + `</v></c>`)
+				} else {
+					inlineString(text)
+				}
+			default:
+				inlineString(text)
+			}
+		}
+		sb.WriteString(`</row>`)
+		if sb.Len() > 1<<20 {
+			if _, err := sheet.Write(sb.Bytes()); err != nil {
+				return nil, err
+			}
+			sb.Reset()
+		}
+	}
+	sb.WriteString(`</sheetData></worksheet>`)
+	if _, err := sheet.Write(sb.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var parquetNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// parquetColumnSchema returns the parquet-go metadata tag for a column. All
+// columns are optional so NULLs survive regardless of the ClickHouse type.
+func parquetColumnSchema(name, chType string) string {
+	var typ string
+	switch baseType(chType) {
+	case "Int8", "Int16", "Int32", "UInt8", "UInt16":
+		typ = "type=INT32"
+	case "Int64", "UInt32":
+		typ = "type=INT64"
+	case "UInt64":
+		typ = "type=INT64, convertedtype=UINT_64"
+	case "Float32":
+		typ = "type=FLOAT"
+	case "Float64":
+		typ = "type=DOUBLE"
+	case "Bool":
+		typ = "type=BOOLEAN"
+	default:
+		typ = "type=BYTE_ARRAY, convertedtype=UTF8"
+	}
+	return fmt.Sprintf("name=%s, %s, repetitiontype=OPTIONAL", name, typ)
+}
+
+func encodeParquet(t *resultTable) ([]byte, error) {
+	if len(t.columns) == 0 {
+		return nil, fmt.Errorf("result has no columns")
+	}
+	// parquet-go parses column names out of tag strings, so they are
+	// reduced to identifier characters and de-duplicated.
+	md := make([]string, len(t.columns))
+	seen := make(map[string]int)
+	for i, c := range t.columns {
+		name := parquetNameSanitizer.ReplaceAllString(c.Name, "_")
+		if name == "" || (name[0] >= '0' && name[0] <= '9') {
+			name = "_" + name
+		}
+		seen[name]++
+		if n := seen[name]; n > 1 {
+			name = fmt.Sprintf("%s_%d", name, n)
+		}
+		md[i] = parquetColumnSchema(name, c.Type)
+	}
+
+	var buf bytes.Buffer
+	pw, err := writer.NewCSVWriterFromWriter(md, &buf, 1)
+	if err != nil {
+		return nil, fmt.Errorf("create parquet writer: %w", err)
+	}
+	for _, row := range t.rows {
+		rec := make([]*string, len(row))
+		for i, cell := range row {
+			if text, ok := cellText(cell); ok {
+				rec[i] = &text
+			}
+		}
+		if err := pw.WriteString(rec); err != nil {
+			return nil, fmt.Errorf("write parquet row: %w", err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return nil, fmt.Errorf("finish parquet file: %w", err)
+	}
+	return buf.Bytes(), nil
+}
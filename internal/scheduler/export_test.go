@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+
+	"github.com/caioricciuti/ch-ui/internal/tunnel"
+)
+
+func sampleResult() *tunnel.QueryResult {
+	return &tunnel.QueryResult{
+		Meta: json.RawMessage(`[{"name":"id","type":"UInt64"},{"name":"user name","type":"Nullable(String)"},{"name":"score","type":"Float64"}]`),
+		Data: json.RawMessage(`[{"id":"1","user name":"a, \"b\"","score":1.5},{"id":"2","user name":null,"score":2}]`),
+	}
+}
+
+func TestEncodeResult(t *testing.T) {
+	data, _, ext, err := EncodeResult(sampleResult(), FormatCSV)
+	if err != nil || ext != "csv" {
+		t.Fatalf("csv: %v", err)
+	}
+	if want := "id,user name,score\n1,\"a, \"\"b\"\"\",1.5\n2,,2\n"; string(data) != want {
+		t.Fatalf("csv: got %q", data)
+	}
+
+	data, _, _, err = EncodeResult(sampleResult(), FormatXLSX)
+	if err != nil {
+		t.Fatalf("xlsx: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("xlsx is not a zip: %v", err)
+	}
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			raw, _ := io.ReadAll(rc)
+			rc.Close()
+			sheet = string(raw)
+		}
+	}
+	if !strings.Contains(sheet, `<c><v>1.5</v></c>`) || !strings.Contains(sheet, `a, &#34;b&#34;`) {
+		t.Fatalf("unexpected sheet: %s", sheet)
+	}
+
+	data, _, _, err = EncodeResult(sampleResult(), FormatParquet)
+	if err != nil {
+		t.Fatalf("parquet: %v", err)
+	}
+	pr, err := reader.NewParquetReader(buffer.NewBufferFileFromBytes(data), nil, 1)
+	if err != nil {
+		t.Fatalf("read parquet: %v", err)
+	}
+	defer pr.ReadStop()
+	if n := pr.GetNumRows(); n != 2 {
+		t.Fatalf("parquet rows: got %d", n)
+	}
+}
+
+func TestRenderKey(t *testing.T) {
+	d := &delivery{runID: "r1"}
+	d.schedule.ID = "s1"
+	d.schedule.Name = "Daily Revenue (EU)"
+	got := d.renderKey("/reports/{{schedule_name}}/{{run_id}}.{{ext}}", "parquet")
+	if got != "reports/daily-revenue-eu/r1.parquet" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -8,7 +9,7 @@ import (
 	"time"
 
 	"github.com/caioricciuti/ch-ui/internal/alerts"
-	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/credentials"
 	"github.com/caioricciuti/ch-ui/internal/database"
 	"github.com/caioricciuti/ch-ui/internal/tunnel"
 )
@@ -16,14 +17,26 @@ import (
 const (
 	tickInterval  = 30 * time.Second
 	maxConcurrent = 3
+	// maxQueued caps the runs waiting behind a running schedule with the
+	// queue concurrency policy.
+	maxQueued = 10
 )
 
-// Runner executes due scheduled jobs on a 30-second tick interval.
+// Runner executes due scheduled jobs on a 30-second tick interval, and
+// schedules chained to other schedules, models or pipelines when those finish.
 type Runner struct {
 	db      *database.DB
 	gateway *tunnel.Gateway
 	secret  string
+	creds   *credentials.Resolver
 	stopCh  chan struct{}
+
+	// sem caps the queries running at once across all schedules.
+	sem chan struct{}
+
+	mu      sync.Mutex
+	active  map[string]int      // runs in progress per schedule
+	pending map[string][]string // queued triggers per schedule
 }
 
 // NewRunner creates a new schedule runner.
@@ -32,7 +45,11 @@ func NewRunner(db *database.DB, gw *tunnel.Gateway, secret string) *Runner {
 		db:      db,
 		gateway: gw,
 		secret:  secret,
+		creds:   credentials.NewResolver(db, secret),
 		stopCh:  make(chan struct{}),
+		sem:     make(chan struct{}, maxConcurrent),
+		active:  make(map[string]int),
+		pending: make(map[string][]string),
 	}
 }
 
@@ -60,7 +77,16 @@ func (r *Runner) Stop() {
 	close(r.stopCh)
 }
 
-// tick fetches due jobs from SQLite and executes them concurrently.
+func (r *Runner) stopped() bool {
+	select {
+	case <-r.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// tick fetches due jobs from SQLite and dispatches them.
 func (r *Runner) tick() {
 	schedules, err := r.db.GetEnabledSchedules()
 	if err != nil {
@@ -90,177 +116,387 @@ func (r *Runner) tick() {
 
 	slog.Info("Processing due scheduled jobs", "count", len(due))
 
-	sem := make(chan struct{}, maxConcurrent)
-	var wg sync.WaitGroup
-
-	for _, schedule := range due {
-		wg.Add(1)
-		sem <- struct{}{}
+	for _, s := range due {
+		// Runs finish after later ticks, so move the next run forward now
+		// to not dispatch the same occurrence twice.
+		if err := r.db.SetScheduleNextRun(s.ID, ComputeNextRun(s.Cron, s.Timezone, now)); err != nil {
+			slog.Error("Failed to advance schedule next run", "schedule", s.ID, "error", err)
+			continue
+		}
+		r.dispatch(s, "cron")
+	}
+}
 
-		go func(s database.Schedule) {
-			defer wg.Done()
-			defer func() { <-sem }()
-			r.runSchedule(s)
-		}(schedule)
+// Notify starts the schedules chained to a source that just finished.
+// sourceType is one of the TriggerSource constants and status the run status
+// the source finished with.
+func (r *Runner) Notify(sourceType, sourceID, status string) {
+	if r.stopped() {
+		return
+	}
+	outcome := triggerOutcome(sourceType, status)
+	if outcome == "" {
+		return
 	}
 
-	wg.Wait()
+	schedules, err := r.db.GetEnabledSchedules()
+	if err != nil {
+		slog.Error("Failed to load schedules for trigger", "source_type", sourceType, "source", sourceID, "error", err)
+		return
+	}
+	for _, s := range schedules {
+		for _, t := range s.Triggers {
+			if triggerMatches(t, sourceType, sourceID, outcome) {
+				slog.Info("Schedule triggered", "schedule", s.ID, "source_type", sourceType, "source", sourceID, "outcome", outcome)
+				r.dispatch(s, sourceType+":"+sourceID)
+				break
+			}
+		}
+	}
 }
 
-func (r *Runner) runSchedule(schedule database.Schedule) {
-	// Create a run record
-	runID, err := r.db.CreateScheduleRun(schedule.ID, "running")
-	if err != nil {
-		slog.Error("Failed to create schedule run", "error", err, "schedule", schedule.ID)
+// dispatch starts a run of the schedule in the background, applying its
+// concurrency policy when a run is already in progress.
+func (r *Runner) dispatch(schedule database.Schedule, trigger string) {
+	if r.stopped() {
+		return
 	}
 
-	start := time.Now()
-	status := "success"
-	var runError string
-	rowCount := 0
-	connectionID := ""
+	r.mu.Lock()
+	if r.active[schedule.ID] > 0 {
+		switch schedule.ConcurrencyPolicy {
+		case ConcurrencyAllow:
+		case ConcurrencyQueue:
+			if len(r.pending[schedule.ID]) >= maxQueued {
+				r.mu.Unlock()
+				r.recordSkipped(schedule, trigger, "run queue is full")
+				return
+			}
+			r.pending[schedule.ID] = append(r.pending[schedule.ID], trigger)
+			r.mu.Unlock()
+			slog.Info("Scheduled job queued behind running job", "schedule", schedule.ID, "trigger", trigger)
+			return
+		default:
+			r.mu.Unlock()
+			r.recordSkipped(schedule, trigger, "previous run still in progress")
+			return
+		}
+	}
+	r.active[schedule.ID]++
+	r.mu.Unlock()
 
-	defer func() {
-		elapsed := int(time.Since(start).Milliseconds())
+	r.start(schedule, trigger)
+}
 
-		// Update run record
-		if runID != "" {
-			r.db.UpdateScheduleRun(runID, status, rowCount, elapsed, runError)
-		}
+// start runs the schedule in the background. The caller has already counted
+// the run in r.active.
+func (r *Runner) start(schedule database.Schedule, trigger string) {
+	go func() {
+		r.execute(schedule, trigger)
+		r.finish(schedule.ID)
+	}()
+}
 
-		// Update schedule status
-		var nextRun *time.Time
-		if schedule.Enabled {
-			nextRun = ComputeNextRun(schedule.Cron, time.Now().UTC())
+// finish marks a run of the schedule as done and starts the next queued run.
+// The finished run's slot passes straight to the queued run, so a tick in
+// between still sees the schedule as active and queues behind it.
+func (r *Runner) finish(scheduleID string) {
+	r.mu.Lock()
+	if r.active[scheduleID] > 1 || len(r.pending[scheduleID]) == 0 {
+		r.active[scheduleID]--
+		if r.active[scheduleID] <= 0 {
+			delete(r.active, scheduleID)
 		}
-		r.db.UpdateScheduleStatus(schedule.ID, status, runError, nextRun)
+		r.mu.Unlock()
+		return
+	}
+	trigger := r.pending[scheduleID][0]
+	r.pending[scheduleID] = r.pending[scheduleID][1:]
+	if len(r.pending[scheduleID]) == 0 {
+		delete(r.pending, scheduleID)
+	}
+	r.mu.Unlock()
 
-		// Audit log
-		details := fmt.Sprintf("schedule=%s status=%s elapsed=%dms", schedule.Name, status, elapsed)
-		r.db.CreateAuditLog(database.AuditLogParams{
-			Action:       "schedule.run",
-			ConnectionID: schedule.ConnectionID,
-			Details:      &details,
-		})
+	// Run the queued occurrence with the schedule's current settings. When
+	// it can no longer run, the slot is released to the next one in line.
+	schedule, err := r.db.GetScheduleByID(scheduleID)
+	if err != nil || schedule == nil || !schedule.Enabled || r.stopped() {
+		r.finish(scheduleID)
+		return
+	}
+	r.start(*schedule, trigger)
+}
 
-		slog.Info("Scheduled job completed",
+// recordSkipped stores a skipped run so the history shows why a due run did
+// not happen.
+func (r *Runner) recordSkipped(schedule database.Schedule, trigger, reason string) {
+	slog.Info("Scheduled job skipped", "schedule", schedule.ID, "trigger", trigger, "reason", reason)
+	runID, err := r.db.CreateScheduleRun(schedule.ID, "skipped", trigger, 1)
+	if err != nil {
+		slog.Error("Failed to create schedule run", "error", err, "schedule", schedule.ID)
+		return
+	}
+	r.db.UpdateScheduleRun(runID, "skipped", 0, 0, reason)
+}
+
+// attemptResult is the outcome of one attempt of a scheduled run.
+type attemptResult struct {
+	runID        string
+	status       string
+	runError     string
+	rowCount     int
+	elapsed      int
+	connectionID string
+}
+
+// execute runs a schedule, retrying failed attempts with exponential backoff,
+// then records the final outcome and starts chained schedules.
+func (r *Runner) execute(schedule database.Schedule, trigger string) {
+	attempts := 1 + schedule.MaxRetries
+	var res attemptResult
+	for attempt := 1; ; attempt++ {
+		res = r.runAttempt(schedule, trigger, attempt)
+		if res.status != "error" || attempt >= attempts {
+			break
+		}
+
+		delay := retryDelay(schedule.RetryBackoffSeconds, attempt)
+		slog.Info("Scheduled job failed, retrying",
 			"schedule", schedule.ID,
-			"name", schedule.Name,
-			"status", status,
-			"elapsed_ms", elapsed,
+			"attempt", attempt,
+			"retry_in", delay,
+			"error", res.runError,
 		)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.stopCh:
+			timer.Stop()
+			r.complete(schedule, res)
+			return
+		}
+	}
+	r.complete(schedule, res)
+	r.Notify(TriggerSourceSchedule, schedule.ID, res.status)
+}
 
-		if status == "error" {
-			fingerprint := fmt.Sprintf("schedule:%s:error", schedule.ID)
+// complete updates the schedule with the final outcome of a run and raises
+// alerts for failed or slow runs.
+func (r *Runner) complete(schedule database.Schedule, res attemptResult) {
+	status, runError, elapsed := res.status, res.runError, res.elapsed
+	runID, rowCount, connectionID := res.runID, res.rowCount, res.connectionID
+
+	// Update schedule status. Chained-only schedules have no cron and keep
+	// no next run.
+	var nextRun *time.Time
+	if schedule.Enabled {
+		nextRun = ComputeNextRun(schedule.Cron, schedule.Timezone, time.Now().UTC())
+	}
+	r.db.UpdateScheduleStatus(schedule.ID, status, runError, nextRun)
+
+	// Audit log
+	details := fmt.Sprintf("schedule=%s status=%s elapsed=%dms", schedule.Name, status, elapsed)
+	r.db.CreateAuditLog(database.AuditLogParams{
+		Action:       "schedule.run",
+		ConnectionID: schedule.ConnectionID,
+		Details:      &details,
+	})
+
+	slog.Info("Scheduled job completed",
+		"schedule", schedule.ID,
+		"name", schedule.Name,
+		"status", status,
+		"elapsed_ms", elapsed,
+	)
+
+	if status == "error" {
+		fingerprint := fmt.Sprintf("schedule:%s:error", schedule.ID)
+		payload := map[string]interface{}{
+			"schedule_id":   schedule.ID,
+			"schedule_name": schedule.Name,
+			"run_id":        runID,
+			"elapsed_ms":    elapsed,
+			"error":         runError,
+			"row_count":     rowCount,
+		}
+		connPtr := nullableConnectionID(connectionID)
+		if _, alertErr := r.db.CreateAlertEvent(
+			connPtr,
+			alerts.EventTypeScheduleFailed,
+			alerts.SeverityError,
+			fmt.Sprintf("Scheduled query failed: %s", schedule.Name),
+			runError,
+			payload,
+			fingerprint,
+			runID,
+		); alertErr != nil {
+			slog.Warn("Failed to create schedule failure alert event", "schedule", schedule.ID, "error", alertErr)
+		}
+	} else if status == "success" {
+		r.resolveAlert(fmt.Sprintf("schedule:%s:error", schedule.ID), "Scheduled query succeeded", runID)
+		threshold := int(float64(maxInt(schedule.TimeoutMs, 60000)) * 0.8)
+		if threshold < 5000 {
+			threshold = 5000
+		}
+		if elapsed >= threshold {
+			fingerprint := fmt.Sprintf("schedule:%s:slow", schedule.ID)
 			payload := map[string]interface{}{
-				"schedule_id":   schedule.ID,
-				"schedule_name": schedule.Name,
-				"run_id":        runID,
-				"elapsed_ms":    elapsed,
-				"error":         runError,
-				"row_count":     rowCount,
+				"schedule_id":       schedule.ID,
+				"schedule_name":     schedule.Name,
+				"run_id":            runID,
+				"elapsed_ms":        elapsed,
+				"slow_threshold_ms": threshold,
+				"timeout_ms":        schedule.TimeoutMs,
+				"row_count":         rowCount,
 			}
 			connPtr := nullableConnectionID(connectionID)
 			if _, alertErr := r.db.CreateAlertEvent(
 				connPtr,
-				alerts.EventTypeScheduleFailed,
-				alerts.SeverityError,
-				fmt.Sprintf("Scheduled query failed: %s", schedule.Name),
-				runError,
+				alerts.EventTypeScheduleSlow,
+				alerts.SeverityWarn,
+				fmt.Sprintf("Scheduled query slow run: %s", schedule.Name),
+				fmt.Sprintf("Run took %dms (threshold %dms)", elapsed, threshold),
 				payload,
 				fingerprint,
 				runID,
 			); alertErr != nil {
-				slog.Warn("Failed to create schedule failure alert event", "schedule", schedule.ID, "error", alertErr)
-			}
-		} else if status == "success" {
-			threshold := int(float64(maxInt(schedule.TimeoutMs, 60000)) * 0.8)
-			if threshold < 5000 {
-				threshold = 5000
-			}
-			if elapsed >= threshold {
-				fingerprint := fmt.Sprintf("schedule:%s:slow", schedule.ID)
-				payload := map[string]interface{}{
-					"schedule_id":       schedule.ID,
-					"schedule_name":     schedule.Name,
-					"run_id":            runID,
-					"elapsed_ms":        elapsed,
-					"slow_threshold_ms": threshold,
-					"timeout_ms":        schedule.TimeoutMs,
-					"row_count":         rowCount,
-				}
-				connPtr := nullableConnectionID(connectionID)
-				if _, alertErr := r.db.CreateAlertEvent(
-					connPtr,
-					alerts.EventTypeScheduleSlow,
-					alerts.SeverityWarn,
-					fmt.Sprintf("Scheduled query slow run: %s", schedule.Name),
-					fmt.Sprintf("Run took %dms (threshold %dms)", elapsed, threshold),
-					payload,
-					fingerprint,
-					runID,
-				); alertErr != nil {
-					slog.Warn("Failed to create schedule slow alert event", "schedule", schedule.ID, "error", alertErr)
-				}
+				slog.Warn("Failed to create schedule slow alert event", "schedule", schedule.ID, "error", alertErr)
 			}
+		} else {
+			r.resolveAlert(fmt.Sprintf("schedule:%s:slow", schedule.ID), fmt.Sprintf("Run took %dms (threshold %dms)", elapsed, threshold), runID)
+		}
+	}
+}
+
+// resolveAlert records that the condition behind an alert fingerprint has
+// cleared, so channels that opened an incident for it can close it.
+func (r *Runner) resolveAlert(fingerprint, message, runID string) {
+	if _, err := r.db.ResolveAlertEvent(fingerprint, message, runID); err != nil {
+		slog.Warn("Failed to create alert resolution", "fingerprint", fingerprint, "error", err)
+	}
+}
+
+// runAttempt performs one attempt of a scheduled run and records it.
+func (r *Runner) runAttempt(schedule database.Schedule, trigger string, attempt int) (res attemptResult) {
+	select {
+	case r.sem <- struct{}{}:
+	case <-r.stopCh:
+		return attemptResult{status: "error", runError: "scheduler stopped"}
+	}
+	defer func() { <-r.sem }()
+
+	// Create a run record
+	runID, err := r.db.CreateScheduleRun(schedule.ID, "running", trigger, attempt)
+	if err != nil {
+		slog.Error("Failed to create schedule run", "error", err, "schedule", schedule.ID)
+	}
+
+	start := time.Now()
+	res = attemptResult{runID: runID, status: "success"}
+
+	defer func() {
+		res.elapsed = int(time.Since(start).Milliseconds())
+		if runID != "" {
+			r.db.UpdateScheduleRun(runID, res.status, res.rowCount, res.elapsed, res.runError)
 		}
 	}()
 
+	fail := func(msg string) attemptResult {
+		res.status = "error"
+		res.runError = msg
+		return res
+	}
+
 	// Fetch the saved query from SQLite
 	savedQuery, err := r.db.GetSavedQueryByID(schedule.SavedQueryID)
 	if err != nil {
-		status = "error"
-		runError = fmt.Sprintf("failed to fetch saved query: %v", err)
-		return
+		return fail(fmt.Sprintf("failed to fetch saved query: %v", err))
 	}
 	if savedQuery == nil {
-		status = "error"
-		runError = "saved query not found"
-		return
+		return fail("saved query not found")
 	}
 
 	// Determine connection ID
 	if schedule.ConnectionID != nil && *schedule.ConnectionID != "" {
-		connectionID = *schedule.ConnectionID
+		res.connectionID = *schedule.ConnectionID
 	} else if savedQuery.ConnectionID != nil && *savedQuery.ConnectionID != "" {
-		connectionID = *savedQuery.ConnectionID
+		res.connectionID = *savedQuery.ConnectionID
 	}
+	connectionID := res.connectionID
 
 	if connectionID == "" {
-		status = "error"
-		runError = "no connection ID configured for schedule or saved query"
-		return
+		return fail("no connection ID configured for schedule or saved query")
 	}
 
 	// Check that the tunnel is online
 	if !r.gateway.IsTunnelOnline(connectionID) {
-		status = "error"
-		runError = "tunnel not connected"
-		return
+		return fail("tunnel not connected")
 	}
 
-	// Find credentials from an active session for this connection
-	user, password, credErr := r.findCredentials(connectionID)
+	// Run as the schedule's service credential, or the connection default
+	credentialID := ""
+	if schedule.CredentialID != nil {
+		credentialID = *schedule.CredentialID
+	}
+	creds, credErr := r.creds.Resolve(connectionID, credentialID)
 	if credErr != nil {
-		status = "error"
-		runError = fmt.Sprintf("no credentials available: %v", credErr)
-		return
+		return fail(fmt.Sprintf("no credentials available: %v", credErr))
 	}
 
-	// Execute the query
 	timeout := time.Duration(schedule.TimeoutMs) * time.Millisecond
 	if timeout <= 0 {
 		timeout = 60 * time.Second
 	}
 
-	result, execErr := r.gateway.ExecuteQuery(connectionID, savedQuery.Query, user, password, timeout)
+	// Only run when the precondition query returns rows
+	if schedule.PreconditionQuery != "" {
+		check, checkErr := r.gateway.ExecuteQuery(connectionID, schedule.PreconditionQuery, creds.User, creds.Password, timeout)
+		if checkErr != nil {
+			return fail(fmt.Sprintf("precondition query failed: %v", checkErr))
+		}
+		if countRows(check) == 0 {
+			res.status = "skipped"
+			res.runError = "precondition query returned no rows"
+			return res
+		}
+	}
+
+	// Execute the query
+	result, execErr := r.gateway.ExecuteQuery(connectionID, savedQuery.Query, creds.User, creds.Password, timeout)
 	if execErr != nil {
-		status = "error"
-		runError = execErr.Error()
-		return
+		return fail(execErr.Error())
 	}
 
-	rowCount = countRows(result)
+	res.rowCount = countRows(result)
+
+	// Deliver the result to the schedule's targets
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	report := DeliverResult(ctx, r.db, r.secret, schedule, runID, result, res.rowCount)
+	if report != nil && report.Status != DeliveryStatusDelivered {
+		payload := map[string]interface{}{
+			"schedule_id":     schedule.ID,
+			"schedule_name":   schedule.Name,
+			"run_id":          runID,
+			"delivery_status": report.Status,
+			"error":           report.Error,
+		}
+		if _, alertErr := r.db.CreateAlertEvent(
+			nullableConnectionID(connectionID),
+			alerts.EventTypeScheduleDeliveryFailed,
+			alerts.SeverityError,
+			fmt.Sprintf("Scheduled result delivery failed: %s", schedule.Name),
+			report.Error,
+			payload,
+			fmt.Sprintf("schedule:%s:delivery", schedule.ID),
+			runID,
+		); alertErr != nil {
+			slog.Warn("Failed to create schedule delivery alert event", "schedule", schedule.ID, "error", alertErr)
+		}
+	} else if report != nil {
+		r.resolveAlert(fmt.Sprintf("schedule:%s:delivery", schedule.ID), "Scheduled result delivered", runID)
+	}
+	return res
 }
 
 func nullableConnectionID(connectionID string) *string {
@@ -278,24 +514,6 @@ func maxInt(a, b int) int {
 	return b
 }
 
-// findCredentials looks for active session credentials for a connection.
-func (r *Runner) findCredentials(connectionID string) (string, string, error) {
-	sessions, err := r.db.GetActiveSessionsByConnection(connectionID, 3)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to load sessions: %w", err)
-	}
-
-	for _, s := range sessions {
-		password, err := crypto.Decrypt(s.EncryptedPassword, r.secret)
-		if err != nil {
-			continue
-		}
-		return s.ClickhouseUser, password, nil
-	}
-
-	return "", "", fmt.Errorf("no active sessions with valid credentials for connection %s", connectionID)
-}
-
 // countRows counts rows in a query result.
 func countRows(result *tunnel.QueryResult) int {
 	if result == nil || len(result.Data) == 0 {
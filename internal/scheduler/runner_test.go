@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+func TestFinishHandsSlotToQueuedRun(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "scheduler.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	queryID, err := db.CreateSavedQuery(database.CreateSavedQueryParams{Name: "q", Query: "SELECT 1"})
+	if err != nil {
+		t.Fatalf("CreateSavedQuery: %v", err)
+	}
+	scheduleID, err := db.CreateSchedule("nightly", queryID, "", "0 * * * *", "UTC", "bob", 60000)
+	if err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+
+	r := NewRunner(db, nil, "")
+	// Fill the semaphore so the queued run blocks before querying.
+	for i := 0; i < maxConcurrent; i++ {
+		r.sem <- struct{}{}
+	}
+	schedule := database.Schedule{ID: scheduleID}
+	schedule.ConcurrencyPolicy = ConcurrencyQueue
+	r.active[scheduleID] = 1
+	r.pending[scheduleID] = []string{"cron"}
+
+	r.finish(scheduleID)
+	r.mu.Lock()
+	active, pending := r.active[scheduleID], len(r.pending[scheduleID])
+	r.mu.Unlock()
+	if active != 1 || pending != 0 {
+		t.Fatalf("queued run did not take over the slot: active=%d pending=%d", active, pending)
+	}
+
+	// A tick while the queued run is in progress queues behind it.
+	r.dispatch(schedule, "cron")
+	r.mu.Lock()
+	active, pending = r.active[scheduleID], len(r.pending[scheduleID])
+	r.mu.Unlock()
+	if active != 1 || pending != 1 {
+		t.Fatalf("overlapping run started: active=%d pending=%d", active, pending)
+	}
+
+	// Stopping ends the running attempt and drops the queue.
+	r.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mu.Lock()
+		active, pending = r.active[scheduleID], len(r.pending[scheduleID])
+		r.mu.Unlock()
+		if active == 0 && pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slot not released after stop: active=%d pending=%d", active, pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
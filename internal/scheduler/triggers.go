@@ -0,0 +1,224 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+// Sources a schedule can be chained to.
+const (
+	TriggerSourceSchedule = "schedule"
+	TriggerSourceModel    = "model"
+	TriggerSourcePipeline = "pipeline"
+)
+
+// Outcomes a trigger fires on.
+const (
+	TriggerOnSuccess = "success"
+	TriggerOnFailure = "failure"
+	TriggerOnAny     = "any"
+)
+
+// Concurrency policies for a schedule that is due while it is still running.
+const (
+	ConcurrencySkip  = "skip"  // drop the new run
+	ConcurrencyQueue = "queue" // start it when the current run finishes
+	ConcurrencyAllow = "allow" // run both at once
+)
+
+const (
+	maxRetries          = 10
+	defaultRetryBackoff = 60
+	maxRetryBackoff     = time.Hour
+)
+
+// NormalizeExecution fills in defaults and validates a schedule's execution
+// settings. It does not check that trigger sources exist; see
+// ValidateTriggers.
+func NormalizeExecution(e *database.ScheduleExecution) error {
+	if e.MaxRetries < 0 || e.MaxRetries > maxRetries {
+		return fmt.Errorf("max_retries must be between 0 and %d", maxRetries)
+	}
+	if e.RetryBackoffSeconds < 0 {
+		return fmt.Errorf("retry_backoff_seconds cannot be negative")
+	}
+	if e.RetryBackoffSeconds == 0 {
+		e.RetryBackoffSeconds = defaultRetryBackoff
+	}
+
+	e.ConcurrencyPolicy = strings.ToLower(strings.TrimSpace(e.ConcurrencyPolicy))
+	switch e.ConcurrencyPolicy {
+	case "":
+		e.ConcurrencyPolicy = ConcurrencySkip
+	case ConcurrencySkip, ConcurrencyQueue, ConcurrencyAllow:
+	default:
+		return fmt.Errorf("concurrency_policy must be %q, %q or %q", ConcurrencySkip, ConcurrencyQueue, ConcurrencyAllow)
+	}
+
+	e.PreconditionQuery = strings.TrimSpace(e.PreconditionQuery)
+
+	if e.Triggers == nil {
+		e.Triggers = []database.ScheduleTrigger{}
+	}
+	seen := make(map[database.ScheduleTrigger]bool, len(e.Triggers))
+	triggers := e.Triggers[:0]
+	for i, t := range e.Triggers {
+		t.SourceType = strings.ToLower(strings.TrimSpace(t.SourceType))
+		t.SourceID = strings.TrimSpace(t.SourceID)
+		t.On = strings.ToLower(strings.TrimSpace(t.On))
+		if t.On == "" {
+			t.On = TriggerOnSuccess
+		}
+		switch t.SourceType {
+		case TriggerSourceSchedule, TriggerSourceModel, TriggerSourcePipeline:
+		default:
+			return fmt.Errorf("trigger %d: source_type must be %q, %q or %q", i+1, TriggerSourceSchedule, TriggerSourceModel, TriggerSourcePipeline)
+		}
+		if t.SourceID == "" {
+			return fmt.Errorf("trigger %d: source_id is required", i+1)
+		}
+		switch t.On {
+		case TriggerOnSuccess, TriggerOnFailure, TriggerOnAny:
+		default:
+			return fmt.Errorf("trigger %d: on must be %q, %q or %q", i+1, TriggerOnSuccess, TriggerOnFailure, TriggerOnAny)
+		}
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		triggers = append(triggers, t)
+	}
+	e.Triggers = triggers
+	return nil
+}
+
+// ValidateTriggers checks that every trigger source exists and that chaining
+// scheduleID (empty for a new schedule) to them would not create a loop.
+func ValidateTriggers(db *database.DB, scheduleID string, triggers []database.ScheduleTrigger) error {
+	for _, t := range triggers {
+		var found bool
+		switch t.SourceType {
+		case TriggerSourceSchedule:
+			if t.SourceID == scheduleID {
+				return fmt.Errorf("a schedule cannot trigger itself")
+			}
+			s, err := db.GetScheduleByID(t.SourceID)
+			if err != nil {
+				return fmt.Errorf("load trigger schedule: %w", err)
+			}
+			found = s != nil
+		case TriggerSourceModel:
+			m, err := db.GetModelByID(t.SourceID)
+			if err != nil {
+				return fmt.Errorf("load trigger model: %w", err)
+			}
+			found = m != nil
+		case TriggerSourcePipeline:
+			p, err := db.GetPipelineByID(t.SourceID)
+			if err != nil {
+				return fmt.Errorf("load trigger pipeline: %w", err)
+			}
+			found = p != nil
+		}
+		if !found {
+			return fmt.Errorf("trigger source %s %s not found", t.SourceType, t.SourceID)
+		}
+	}
+
+	if scheduleID == "" {
+		return nil
+	}
+	all, err := db.GetSchedules()
+	if err != nil {
+		return fmt.Errorf("load schedules: %w", err)
+	}
+	if createsTriggerCycle(scheduleID, triggers, all) {
+		return fmt.Errorf("triggers would create a loop of schedules starting each other")
+	}
+	return nil
+}
+
+// createsTriggerCycle reports whether giving scheduleID the triggers lets it,
+// through a chain of schedule triggers, start itself again.
+func createsTriggerCycle(scheduleID string, triggers []database.ScheduleTrigger, all []database.Schedule) bool {
+	// downstream[a] lists the schedules started when schedule a finishes.
+	downstream := make(map[string][]string)
+	for _, s := range all {
+		if s.ID == scheduleID {
+			continue
+		}
+		for _, t := range s.Triggers {
+			if t.SourceType == TriggerSourceSchedule {
+				downstream[t.SourceID] = append(downstream[t.SourceID], s.ID)
+			}
+		}
+	}
+	for _, t := range triggers {
+		if t.SourceType == TriggerSourceSchedule {
+			downstream[t.SourceID] = append(downstream[t.SourceID], scheduleID)
+		}
+	}
+
+	visited := make(map[string]bool)
+	stack := append([]string(nil), downstream[scheduleID]...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == scheduleID {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		stack = append(stack, downstream[id]...)
+	}
+	return false
+}
+
+// triggerOutcome maps a finished run's status to the outcome triggers match
+// on. Runs that were skipped or stopped have no outcome and start nothing.
+func triggerOutcome(sourceType, status string) string {
+	switch status {
+	case "success":
+		return TriggerOnSuccess
+	case "error", "partial":
+		return TriggerOnFailure
+	case "skipped":
+		// A model is skipped when an upstream model failed.
+		if sourceType == TriggerSourceModel {
+			return TriggerOnFailure
+		}
+	}
+	return ""
+}
+
+// triggerMatches reports whether t fires for a source finishing with outcome.
+func triggerMatches(t database.ScheduleTrigger, sourceType, sourceID, outcome string) bool {
+	if t.SourceType != sourceType || t.SourceID != sourceID {
+		return false
+	}
+	return t.On == TriggerOnAny || t.On == outcome
+}
+
+// retryDelay is the wait before retry number attempt (1-based): the base
+// backoff doubled for every earlier retry, capped at an hour.
+func retryDelay(backoffSeconds, attempt int) time.Duration {
+	if backoffSeconds <= 0 {
+		backoffSeconds = defaultRetryBackoff
+	}
+	d := time.Duration(backoffSeconds) * time.Second
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= maxRetryBackoff {
+			return maxRetryBackoff
+		}
+	}
+	if d > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return d
+}
@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/database"
+)
+
+func TestNormalizeExecution(t *testing.T) {
+	e := database.ScheduleExecution{
+		Triggers: []database.ScheduleTrigger{
+			{SourceType: " Schedule ", SourceID: "a"},
+			{SourceType: "schedule", SourceID: "a", On: "success"},
+			{SourceType: "pipeline", SourceID: "p", On: "FAILURE"},
+		},
+	}
+	if err := NormalizeExecution(&e); err != nil {
+		t.Fatalf("NormalizeExecution: %v", err)
+	}
+	if e.ConcurrencyPolicy != ConcurrencySkip || e.RetryBackoffSeconds != defaultRetryBackoff {
+		t.Fatalf("defaults not applied: %+v", e)
+	}
+	if len(e.Triggers) != 2 || e.Triggers[0].On != TriggerOnSuccess || e.Triggers[1].On != TriggerOnFailure {
+		t.Fatalf("unexpected triggers: %+v", e.Triggers)
+	}
+
+	for _, bad := range []database.ScheduleExecution{
+		{MaxRetries: -1},
+		{MaxRetries: maxRetries + 1},
+		{ConcurrencyPolicy: "parallel"},
+		{Triggers: []database.ScheduleTrigger{{SourceType: "query", SourceID: "x"}}},
+		{Triggers: []database.ScheduleTrigger{{SourceType: "model"}}},
+		{Triggers: []database.ScheduleTrigger{{SourceType: "model", SourceID: "m", On: "done"}}},
+	} {
+		if err := NormalizeExecution(&bad); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestCreatesTriggerCycle(t *testing.T) {
+	after := func(id string) []database.ScheduleTrigger {
+		return []database.ScheduleTrigger{{SourceType: TriggerSourceSchedule, SourceID: id, On: TriggerOnAny}}
+	}
+	// b runs after a, c runs after b.
+	all := []database.Schedule{
+		{ID: "a"},
+		{ID: "b", ScheduleExecution: database.ScheduleExecution{Triggers: after("a")}},
+		{ID: "c", ScheduleExecution: database.ScheduleExecution{Triggers: after("b")}},
+	}
+
+	if !createsTriggerCycle("a", after("c"), all) {
+		t.Fatal("a after c closes the loop a -> b -> c -> a")
+	}
+	if createsTriggerCycle("c", after("a"), all) {
+		t.Fatal("c after a is not a loop")
+	}
+	model := []database.ScheduleTrigger{{SourceType: TriggerSourceModel, SourceID: "c", On: TriggerOnAny}}
+	if createsTriggerCycle("a", model, all) {
+		t.Fatal("model triggers never form schedule loops")
+	}
+}
+
+func TestTriggerMatching(t *testing.T) {
+	onFailure := database.ScheduleTrigger{SourceType: TriggerSourceModel, SourceID: "m", On: TriggerOnFailure}
+
+	if !triggerMatches(onFailure, TriggerSourceModel, "m", triggerOutcome(TriggerSourceModel, "skipped")) {
+		t.Fatal("a skipped model counts as a failure")
+	}
+	if triggerMatches(onFailure, TriggerSourceModel, "m", triggerOutcome(TriggerSourceModel, "success")) {
+		t.Fatal("success must not match a failure trigger")
+	}
+	if triggerOutcome(TriggerSourcePipeline, "stopped") != "" || triggerOutcome(TriggerSourceSchedule, "skipped") != "" {
+		t.Fatal("stopped pipelines and skipped schedules have no outcome")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	cases := []struct {
+		backoff, attempt int
+		want             time.Duration
+	}{
+		{30, 1, 30 * time.Second},
+		{30, 2, time.Minute},
+		{30, 3, 2 * time.Minute},
+		{0, 1, time.Minute},
+		{1800, 3, time.Hour},
+	}
+	for _, c := range cases {
+		if got := retryDelay(c.backoff, c.attempt); got != c.want {
+			t.Fatalf("retryDelay(%d, %d) = %v, want %v", c.backoff, c.attempt, got, c.want)
+		}
+	}
+}
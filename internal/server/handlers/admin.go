@@ -57,6 +57,15 @@ func (h *AdminHandler) Routes(r chi.Router) {
 	r.Post("/brain/skills", h.CreateBrainSkill)
 	r.Put("/brain/skills/{id}", h.UpdateBrainSkill)
 
+	// Service credentials for background jobs
+	r.Get("/service-credentials", h.ListServiceCredentials)
+	r.Post("/service-credentials", h.CreateServiceCredential)
+	r.Put("/service-credentials/{id}", h.UpdateServiceCredential)
+	r.Delete("/service-credentials/{id}", h.DeleteServiceCredential)
+	r.Post("/service-credentials/{id}/test", h.TestServiceCredential)
+	r.Get("/background-jobs/settings", h.GetBackgroundJobSettings)
+	r.Put("/background-jobs/settings", h.UpdateBackgroundJobSettings)
+
 	// Governance feature toggle
 	r.Get("/governance/settings", h.GetGovernanceSettings)
 	r.Put("/governance/settings", h.UpdateGovernanceSettings)
@@ -68,6 +77,7 @@ func (h *AdminHandler) Routes(r chi.Router) {
 		sub.Delete("/", h.DeleteGitHubIntegration)
 		sub.Post("/test", h.TestGitHubConnection)
 		sub.Post("/sync", h.TriggerGitHubSync)
+		sub.Post("/push", h.PushGitHubModels)
 		sub.Get("/logs", h.GetGitHubSyncLogs)
 	})
 }
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/server/middleware"
+)
+
+// ---------- Service credentials ----------
+
+// ListServiceCredentials returns the stored service credentials, optionally
+// filtered by ?connection_id=. Passwords are never returned.
+func (h *AdminHandler) ListServiceCredentials(w http.ResponseWriter, r *http.Request) {
+	creds, err := h.DB.GetServiceCredentials(strings.TrimSpace(r.URL.Query().Get("connection_id")))
+	if err != nil {
+		slog.Error("Failed to list service credentials", "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to list service credentials")
+		return
+	}
+	if creds == nil {
+		creds = []database.ServiceCredential{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"credentials": creds})
+}
+
+// CreateServiceCredential stores a new encrypted service credential.
+func (h *AdminHandler) CreateServiceCredential(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+
+	var body struct {
+		ConnectionID   string `json:"connection_id"`
+		Name           string `json:"name"`
+		ClickhouseUser string `json:"clickhouse_user"`
+		Password       string `json:"password"`
+		IsDefault      bool   `json:"is_default"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	name := strings.TrimSpace(body.Name)
+	user := strings.TrimSpace(body.ClickhouseUser)
+	if body.ConnectionID == "" || name == "" || user == "" {
+		writeError(w, http.StatusBadRequest, "connection_id, name and clickhouse_user are required")
+		return
+	}
+	conn, err := h.DB.GetConnectionByID(body.ConnectionID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load connection")
+		return
+	}
+	if conn == nil {
+		writeError(w, http.StatusNotFound, "Connection not found")
+		return
+	}
+
+	encrypted, err := crypto.Encrypt(body.Password, h.Config.AppSecretKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encrypt password")
+		return
+	}
+
+	actor := ""
+	if session != nil {
+		actor = session.ClickhouseUser
+	}
+	id, err := h.DB.CreateServiceCredential(body.ConnectionID, name, user, encrypted, body.IsDefault, actor)
+	if err != nil {
+		slog.Error("Failed to create service credential", "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to create service credential (names must be unique per connection)")
+		return
+	}
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:       "service_credential.create",
+		Username:     strPtr(actor),
+		ConnectionID: strPtr(body.ConnectionID),
+		Details:      strPtr(fmt.Sprintf("name=%s ch_user=%s default=%t", name, user, body.IsDefault)),
+		IPAddress:    strPtr(r.RemoteAddr),
+	})
+
+	cred, _ := h.DB.GetServiceCredentialByID(id)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"success": true, "credential": cred})
+}
+
+// UpdateServiceCredential changes a service credential. A blank password
+// keeps the stored one.
+func (h *AdminHandler) UpdateServiceCredential(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	id := chi.URLParam(r, "id")
+
+	existing, err := h.DB.GetServiceCredentialByID(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load service credential")
+		return
+	}
+	if existing == nil {
+		writeError(w, http.StatusNotFound, "Service credential not found")
+		return
+	}
+
+	var body struct {
+		Name           *string `json:"name"`
+		ClickhouseUser *string `json:"clickhouse_user"`
+		Password       string  `json:"password"`
+		IsDefault      *bool   `json:"is_default"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	name, user, isDefault := existing.Name, existing.ClickhouseUser, existing.IsDefault
+	if body.Name != nil {
+		name = strings.TrimSpace(*body.Name)
+	}
+	if body.ClickhouseUser != nil {
+		user = strings.TrimSpace(*body.ClickhouseUser)
+	}
+	if body.IsDefault != nil {
+		isDefault = *body.IsDefault
+	}
+	if name == "" || user == "" {
+		writeError(w, http.StatusBadRequest, "name and clickhouse_user cannot be empty")
+		return
+	}
+
+	encrypted := ""
+	if body.Password != "" {
+		encrypted, err = crypto.Encrypt(body.Password, h.Config.AppSecretKey)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to encrypt password")
+			return
+		}
+	}
+
+	if err := h.DB.UpdateServiceCredential(id, name, user, encrypted, isDefault); err != nil {
+		slog.Error("Failed to update service credential", "error", err, "id", id)
+		writeError(w, http.StatusInternalServerError, "Failed to update service credential")
+		return
+	}
+
+	actor := ""
+	if session != nil {
+		actor = session.ClickhouseUser
+	}
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:       "service_credential.update",
+		Username:     strPtr(actor),
+		ConnectionID: strPtr(existing.ConnectionID),
+		Details:      strPtr(fmt.Sprintf("name=%s ch_user=%s default=%t password_changed=%t", name, user, isDefault, encrypted != "")),
+		IPAddress:    strPtr(r.RemoteAddr),
+	})
+
+	cred, _ := h.DB.GetServiceCredentialByID(id)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "credential": cred})
+}
+
+// DeleteServiceCredential removes a service credential. Jobs assigned to it
+// go back to the connection default.
+func (h *AdminHandler) DeleteServiceCredential(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	id := chi.URLParam(r, "id")
+
+	existing, err := h.DB.GetServiceCredentialByID(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load service credential")
+		return
+	}
+	if existing == nil {
+		writeError(w, http.StatusNotFound, "Service credential not found")
+		return
+	}
+	if err := h.DB.DeleteServiceCredential(id); err != nil {
+		slog.Error("Failed to delete service credential", "error", err, "id", id)
+		writeError(w, http.StatusInternalServerError, "Failed to delete service credential")
+		return
+	}
+
+	actor := ""
+	if session != nil {
+		actor = session.ClickhouseUser
+	}
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:       "service_credential.delete",
+		Username:     strPtr(actor),
+		ConnectionID: strPtr(existing.ConnectionID),
+		Details:      strPtr(fmt.Sprintf("name=%s", existing.Name)),
+		IPAddress:    strPtr(r.RemoteAddr),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// TestServiceCredential checks that a stored credential can log in.
+func (h *AdminHandler) TestServiceCredential(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	cred, err := h.DB.GetServiceCredentialByID(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load service credential")
+		return
+	}
+	if cred == nil {
+		writeError(w, http.StatusNotFound, "Service credential not found")
+		return
+	}
+	if !h.Gateway.IsTunnelOnline(cred.ConnectionID) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": "Tunnel is not connected"})
+		return
+	}
+	password, err := crypto.Decrypt(cred.EncryptedPassword, h.Config.AppSecretKey)
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": "Stored password cannot be decrypted; set it again"})
+		return
+	}
+
+	result, err := h.Gateway.TestConnection(cred.ConnectionID, cred.ClickhouseUser, password, 15*time.Second)
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// ---------- Background job settings ----------
+
+// GetBackgroundJobSettings returns whether background jobs may borrow the
+// credentials of active user sessions.
+func (h *AdminHandler) GetBackgroundJobSettings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"session_fallback": h.DB.SessionCredentialFallbackEnabled(),
+	})
+}
+
+// UpdateBackgroundJobSettings toggles the session credential fallback.
+func (h *AdminHandler) UpdateBackgroundJobSettings(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+
+	var body struct {
+		SessionFallback *bool `json:"session_fallback"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if body.SessionFallback != nil {
+		if err := h.DB.SetSessionCredentialFallbackEnabled(*body.SessionFallback); err != nil {
+			slog.Error("Failed to save session fallback setting", "error", err)
+			writeError(w, http.StatusInternalServerError, "Failed to save setting")
+			return
+		}
+		actor := ""
+		if session != nil {
+			actor = session.ClickhouseUser
+		}
+		h.DB.CreateAuditLog(database.AuditLogParams{
+			Action:    "background_jobs.session_fallback",
+			Username:  strPtr(actor),
+			Details:   strPtr(fmt.Sprintf(`{"session_fallback":%t}`, *body.SessionFallback)),
+			IPAddress: strPtr(r.RemoteAddr),
+		})
+	}
+	h.GetBackgroundJobSettings(w, r)
+}
+
+// checkServiceCredential verifies that credentialID names a service
+// credential of connectionID. It returns a message for the client, or "" when
+// the ID is empty or valid.
+func checkServiceCredential(db *database.DB, credentialID, connectionID string) string {
+	if credentialID == "" {
+		return ""
+	}
+	cred, err := db.GetServiceCredentialByID(credentialID)
+	if err != nil {
+		return "Failed to load service credential"
+	}
+	if cred == nil {
+		return "Service credential not found"
+	}
+	if cred.ConnectionID != connectionID {
+		return "Service credential belongs to a different connection"
+	}
+	return ""
+}
+
+// authorizeCredentialAssignment checks that the caller may point a job at
+// credentialID. Service credentials are managed by admins, so assigning or
+// changing one needs the admin role; keeping the job's current credential or
+// clearing it to use the connection default does not. It returns the status
+// and message for the client, or 0 when the assignment is allowed.
+func authorizeCredentialAssignment(db *database.DB, r *http.Request, credentialID, currentID, connectionID string) (int, string) {
+	if credentialID == "" || credentialID == currentID {
+		return 0, ""
+	}
+	session := middleware.GetSession(r)
+	if session == nil {
+		return http.StatusUnauthorized, "Not authenticated"
+	}
+	isAdmin, err := db.IsUserRole(session.ClickhouseUser, "admin")
+	if err != nil {
+		return http.StatusInternalServerError, "Role check failed"
+	}
+	if !isAdmin {
+		return http.StatusForbidden, "Admin role required to assign a service credential"
+	}
+	if msg := checkServiceCredential(db, credentialID, connectionID); msg != "" {
+		return http.StatusBadRequest, msg
+	}
+	return 0, ""
+}
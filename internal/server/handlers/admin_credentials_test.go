@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/caioricciuti/ch-ui/internal/config"
+	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/server/middleware"
+)
+
+// newCredentialTestDB opens a database with one connection, a service
+// credential on it and "alice" as the only admin.
+func newCredentialTestDB(t *testing.T) (db *database.DB, connID, credID string) {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "credentials.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if connID, err = db.CreateConnection("local", "tok", true); err != nil {
+		t.Fatalf("CreateConnection: %v", err)
+	}
+	if credID, err = db.CreateServiceCredential(connID, "etl", "etl_user", "unused", false, "admin"); err != nil {
+		t.Fatalf("CreateServiceCredential: %v", err)
+	}
+	if err := db.SetUserRole("alice", "admin"); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	return db, connID, credID
+}
+
+// withRequest attaches the route id and a session for user to req.
+func withRequest(req *http.Request, id, connID, user string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	return req.WithContext(middleware.SetSession(ctx, &middleware.SessionInfo{ConnectionID: connID, ClickhouseUser: user}))
+}
+
+func TestScheduleCredentialAssignmentRequiresAdmin(t *testing.T) {
+	db, connID, credID := newCredentialTestDB(t)
+	queryID, err := db.CreateSavedQuery(database.CreateSavedQueryParams{Name: "q", Query: "SELECT 1", ConnectionID: connID})
+	if err != nil {
+		t.Fatalf("CreateSavedQuery: %v", err)
+	}
+	scheduleID, err := db.CreateSchedule("nightly", queryID, connID, "0 * * * *", "UTC", "bob", 60000)
+	if err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+
+	h := &SchedulesHandler{DB: db, Config: &config.Config{}}
+	update := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/schedules/"+scheduleID, bytes.NewBufferString(`{"credential_id":"`+credID+`"}`))
+		rr := httptest.NewRecorder()
+		h.Update(rr, withRequest(req, scheduleID, connID, user))
+		return rr
+	}
+
+	if rr := update("bob"); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-admin assignment: expected 403, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if s, _ := db.GetScheduleByID(scheduleID); s.CredentialID != nil {
+		t.Fatalf("credential was assigned by a non-admin: %v", *s.CredentialID)
+	}
+
+	if rr := update("alice"); rr.Code != http.StatusOK {
+		t.Fatalf("admin assignment: expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if s, _ := db.GetScheduleByID(scheduleID); s.CredentialID == nil || *s.CredentialID != credID {
+		t.Fatal("admin assignment was not saved")
+	}
+
+	// Resubmitting the credential already assigned is not a change.
+	if rr := update("bob"); rr.Code == http.StatusForbidden {
+		t.Fatalf("unchanged credential rejected for non-admin: %s", rr.Body.String())
+	}
+}
+
+func TestPipelineNodeCredentialRequiresAdmin(t *testing.T) {
+	db, connID, credID := newCredentialTestDB(t)
+	pipelineID, err := db.CreatePipeline("orders", "", connID, "bob")
+	if err != nil {
+		t.Fatalf("CreatePipeline: %v", err)
+	}
+
+	h := &PipelinesHandler{DB: db}
+	save := func(user string) *httptest.ResponseRecorder {
+		body := `{"nodes":[{"id":"sink-1","node_type":"sink_clickhouse","config":{"table":"orders","credential_id":"` + credID + `"}}],"edges":[]}`
+		req := httptest.NewRequest(http.MethodPut, "/api/pipelines/"+pipelineID+"/graph", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		h.SaveGraph(rr, withRequest(req, pipelineID, connID, user))
+		return rr
+	}
+
+	if rr := save("bob"); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-admin node credential: expected 403, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if nodes, _, _ := db.GetPipelineGraph(pipelineID); len(nodes) != 0 {
+		t.Fatalf("graph saved despite refusal: %+v", nodes)
+	}
+
+	if rr := save("alice"); rr.Code != http.StatusOK {
+		t.Fatalf("admin node credential: expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	// Resaving the graph with the credential already on the node is allowed.
+	if rr := save("bob"); rr.Code != http.StatusOK {
+		t.Fatalf("unchanged node credential: expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestScheduleEmailDeliveryRequiresAdmin(t *testing.T) {
+	db, connID, _ := newCredentialTestDB(t)
+	queryID, err := db.CreateSavedQuery(database.CreateSavedQueryParams{Name: "q", Query: "SELECT 1", ConnectionID: connID})
+	if err != nil {
+		t.Fatalf("CreateSavedQuery: %v", err)
+	}
+	scheduleID, err := db.CreateSchedule("nightly", queryID, connID, "0 * * * *", "UTC", "bob", 60000)
+	if err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+
+	h := &SchedulesHandler{DB: db, Config: &config.Config{AppSecretKey: "test-secret"}}
+	update := func(user, delivery string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/schedules/"+scheduleID, bytes.NewBufferString(`{"delivery":`+delivery+`}`))
+		rr := httptest.NewRecorder()
+		h.Update(rr, withRequest(req, scheduleID, connID, user))
+		return rr
+	}
+	email := `[{"type":"email","channel_id":"ch1","recipients":["ops@example.com"]}]`
+
+	if rr := update("bob", email); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-admin email delivery: expected 403, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := update("alice", email); rr.Code != http.StatusOK {
+		t.Fatalf("admin email delivery: expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	// Resubmitting the email target already on the schedule is not a change.
+	if rr := update("bob", email); rr.Code != http.StatusOK {
+		t.Fatalf("unchanged email delivery: expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := update("bob", `[{"type":"email","channel_id":"ch1","recipients":["me@example.com"]}]`); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-admin recipient change: expected 403, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 
@@ -40,26 +41,38 @@ func (h *AdminHandler) SaveGitHubIntegration(w http.ResponseWriter, r *http.Requ
 	session := middleware.GetSession(r)
 
 	var body struct {
-		Repo   string `json:"repo"`
-		Branch string `json:"branch"`
-		Path   string `json:"path"`
-		PAT    string `json:"pat"`
+		Provider string `json:"provider"`
+		URL      string `json:"url"`
+		Repo     string `json:"repo"`
+		Branch   string `json:"branch"`
+		Path     string `json:"path"`
+		PAT      string `json:"pat"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
+	provider, err := ghclient.NormalizeProvider(body.Provider)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	repo := strings.TrimSpace(body.Repo)
 	if repo == "" {
-		writeError(w, http.StatusBadRequest, "Repository is required (owner/repo)")
+		writeError(w, http.StatusBadRequest, "Repository is required")
 		return
 	}
-	parts := strings.SplitN(repo, "/", 2)
-	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
-		writeError(w, http.StatusBadRequest, "Repository must be in owner/repo format")
+	if err := ghclient.ValidateRepo(provider, repo); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if provider == ghclient.ProviderLocal {
+		if info, err := os.Stat(repo); err != nil || !info.IsDir() {
+			writeError(w, http.StatusBadRequest, "Directory not found on the server")
+			return
+		}
+	}
 
 	branch := strings.TrimSpace(body.Branch)
 	if branch == "" {
@@ -71,10 +84,12 @@ func (h *AdminHandler) SaveGitHubIntegration(w http.ResponseWriter, r *http.Requ
 	}
 
 	fields := map[string]string{
-		"repo":    repo,
-		"branch":  branch,
-		"path":    path,
-		"enabled": "true",
+		"provider": provider,
+		"url":      strings.TrimSpace(body.URL),
+		"repo":     repo,
+		"branch":   branch,
+		"path":     path,
+		"enabled":  "true",
 	}
 
 	pat := strings.TrimSpace(body.PAT)
@@ -100,7 +115,7 @@ func (h *AdminHandler) SaveGitHubIntegration(w http.ResponseWriter, r *http.Requ
 		Action:       "github.integration.save",
 		Username:     strPtr(username),
 		ConnectionID: strPtr(connID),
-		Details:      strPtr(fmt.Sprintf("repo=%s branch=%s path=%s", repo, branch, path)),
+		Details:      strPtr(fmt.Sprintf("provider=%s repo=%s branch=%s path=%s", provider, repo, branch, path)),
 		IPAddress:    strPtr(r.RemoteAddr),
 	})
 
@@ -140,32 +155,22 @@ func (h *AdminHandler) TestGitHubConnection(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	connID := chi.URLParam(r, "connectionId")
-	repo, branch, _, encryptedPAT, _, _ := h.DB.GetGitHubRawSettings(connID)
-	if repo == "" || encryptedPAT == "" {
-		writeError(w, http.StatusBadRequest, "GitHub integration not configured")
+	if h.GitHubSyncer == nil {
+		writeError(w, http.StatusInternalServerError, "GitHub syncer not initialized")
 		return
 	}
 
-	pat, err := crypto.Decrypt(encryptedPAT, h.Config.AppSecretKey)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to decrypt token")
+	connID := chi.URLParam(r, "connectionId")
+	if integration, _ := h.DB.GetGitHubIntegration(connID); integration == nil || !integration.Ready {
+		writeError(w, http.StatusBadRequest, "Model source not configured")
 		return
 	}
 
-	parts := strings.SplitN(repo, "/", 2)
-	client := ghclient.NewClient(pat)
-
-	if err := client.ValidateAccess(parts[0], parts[1]); err != nil {
+	if err := h.GitHubSyncer.TestConnection(connID); err != nil {
 		writeJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": err.Error()})
 		return
 	}
 
-	if _, err := client.GetBranchSHA(parts[0], parts[1], branch); err != nil {
-		writeJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": fmt.Sprintf("Branch %q not found", branch)})
-		return
-	}
-
 	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
 }
 
@@ -208,10 +213,87 @@ func (h *AdminHandler) TriggerGitHubSync(w http.ResponseWriter, r *http.Request)
 			"deleted":    result.Deleted,
 			"unchanged":  result.Unchanged,
 			"commit_sha": result.CommitSHA,
+			"conflicts":  nonNilStrings(result.Conflicts),
 		},
 	})
 }
 
+func (h *AdminHandler) PushGitHubModels(w http.ResponseWriter, r *http.Request) {
+	if !h.Config.IsPro() {
+		writeError(w, http.StatusPaymentRequired, "Pro license required")
+		return
+	}
+	if h.GitHubSyncer == nil {
+		writeError(w, http.StatusInternalServerError, "GitHub syncer not initialized")
+		return
+	}
+
+	var body struct {
+		ModelIDs []string `json:"model_ids"`
+		Branch   string   `json:"branch"`
+		Title    string   `json:"title"`
+		Body     string   `json:"body"`
+		Force    bool     `json:"force"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	}
+
+	connID := chi.URLParam(r, "connectionId")
+	session := middleware.GetSession(r)
+	triggeredBy := "admin"
+	if session != nil {
+		triggeredBy = session.ClickhouseUser
+	}
+
+	result, err := h.GitHubSyncer.PushConnection(connID, ghclient.PushOptions{
+		ModelIDs:    body.ModelIDs,
+		Branch:      body.Branch,
+		Title:       body.Title,
+		Body:        body.Body,
+		Force:       body.Force,
+		TriggeredBy: triggeredBy,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if result.PullRequestURL != "" {
+		h.DB.CreateAuditLog(database.AuditLogParams{
+			Action:       "github.push",
+			Username:     strPtr(triggeredBy),
+			ConnectionID: strPtr(connID),
+			Details:      strPtr(fmt.Sprintf("branch=%s pr=%d models=%s", result.Branch, result.PullRequestNumber, strings.Join(result.Pushed, ","))),
+			IPAddress:    strPtr(r.RemoteAddr),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"result": map[string]interface{}{
+			"branch":              result.Branch,
+			"commit_sha":          result.CommitSHA,
+			"pull_request_number": result.PullRequestNumber,
+			"pull_request_url":    result.PullRequestURL,
+			"pushed":              nonNilStrings(result.Pushed),
+			"unchanged":           result.Unchanged,
+			"behind":              nonNilStrings(result.Behind),
+			"conflicts":           nonNilStrings(result.Conflicts),
+		},
+	})
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
 func (h *AdminHandler) GetGitHubSyncLogs(w http.ResponseWriter, r *http.Request) {
 	connID := chi.URLParam(r, "connectionId")
 	limit := 20
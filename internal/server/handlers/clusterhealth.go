@@ -299,6 +299,11 @@ func (h *ClusterHealthHandler) UpdateSettings(w http.ResponseWriter, r *http.Req
 		return
 	}
 	in.ConnectionID = sess.ConnectionID
+	in.CredentialID = strings.TrimSpace(in.CredentialID)
+	if msg := checkServiceCredential(h.DB, in.CredentialID, in.ConnectionID); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
 	saved, err := h.Store.UpsertSettings(in)
 	if err != nil {
 		slog.Warn("Cluster health settings save failed", "error", err, "connection", sess.ConnectionID)
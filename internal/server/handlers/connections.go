@@ -224,6 +224,23 @@ func (h *ConnectionsHandler) TestConnection(w http.ResponseWriter, r *http.Reque
 	connJSON(w, http.StatusOK, result)
 }
 
+// ListServiceCredentials returns the service credentials of a connection so
+// jobs can be assigned one. Passwords are never included.
+// GET /{id}/service-credentials
+func (h *ConnectionsHandler) ListServiceCredentials(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	creds, err := h.DB.GetServiceCredentials(id)
+	if err != nil {
+		slog.Error("Failed to list service credentials", "error", err, "id", id)
+		connJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve service credentials"})
+		return
+	}
+	if creds == nil {
+		creds = []database.ServiceCredential{}
+	}
+	connJSON(w, http.StatusOK, creds)
+}
+
 // GetToken returns the tunnel token for a connection.
 // GET /{id}/token
 func (h *ConnectionsHandler) GetToken(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/caioricciuti/ch-ui/internal/crypto"
+	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/queryproc"
+	"github.com/caioricciuti/ch-ui/internal/server/middleware"
+)
+
+// maxVariableOptions caps how many options a query variable can list.
+const maxVariableOptions = 1000
+
+// variableOptionSettings bound the queries that list query variable options.
+var variableOptionSettings = map[string]string{
+	"max_result_rows":      fmt.Sprintf("%d", maxVariableOptions),
+	"result_overflow_mode": "break",
+}
+
+type resolveVariablesRequest struct {
+	TimeRange *queryproc.TimeRange `json:"time_range"`
+	Values    map[string][]string  `json:"values"`
+}
+
+// ResolveDashboardVariables lists the options and current values of a
+// dashboard's variables, running query variables as the signed-in user.
+func (h *DashboardsHandler) ResolveDashboardVariables(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	dashboard, err := h.DB.GetDashboardByID(chi.URLParam(r, "id"))
+	if err != nil || dashboard == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Dashboard not found"})
+		return
+	}
+
+	var body resolveVariablesRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON body"})
+		return
+	}
+
+	password, err := crypto.Decrypt(session.EncryptedPassword, h.Config.AppSecretKey)
+	if err != nil {
+		slog.Error("Failed to decrypt password", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to decrypt credentials"})
+		return
+	}
+
+	run := h.variableOptions(session.ConnectionID, session.ClickhouseUser, password, variableOptionSettings)
+	resolved, err := queryproc.ResolveVariables(dashboardVariables(dashboard), body.Values, body.TimeRange, run)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"variables": resolved})
+}
+
+// ResolvePublicVariables lists the options and current values of a shared
+// dashboard's variables, running query variables with the share's
+// credentials and read-only settings.
+func (h *DashboardsHandler) ResolvePublicVariables(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.authorizePublicQuery(w, r)
+	if !ok {
+		return
+	}
+
+	dashboard, err := h.DB.GetDashboardByID(share.DashboardID)
+	if err != nil || dashboard == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Dashboard not found"})
+		return
+	}
+
+	var body resolveVariablesRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON body"})
+		return
+	}
+
+	resolved, err := h.resolvePublicVariables(share, dashboard, "", body.Values, body.TimeRange)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"variables": resolved})
+}
+
+// resolvePublicVariables resolves a shared dashboard's variables, limiting
+// every selection to the options the share's credentials can list. Given a
+// panel query that uses no variables, it skips the option queries.
+func (h *DashboardsHandler) resolvePublicVariables(share *database.DashboardShare, dashboard *database.Dashboard, query string, values map[string][]string, timeRange *queryproc.TimeRange) ([]queryproc.ResolvedVariable, error) {
+	vars := dashboardVariables(dashboard)
+	if len(vars) == 0 || (query != "" && !queryproc.UsesVariables(query, vars)) {
+		return []queryproc.ResolvedVariable{}, nil
+	}
+
+	password, err := crypto.Decrypt(share.EncryptedPassword, h.Config.AppSecretKey)
+	if err != nil {
+		slog.Error("Failed to decrypt share credentials", "error", err)
+		return nil, fmt.Errorf("failed to process variables")
+	}
+
+	settings := make(map[string]string, len(publicQuerySettings)+len(variableOptionSettings))
+	for k, v := range variableOptionSettings {
+		settings[k] = v
+	}
+	for k, v := range publicQuerySettings {
+		settings[k] = v
+	}
+	return queryproc.ResolveVariables(vars, values, timeRange, h.variableOptions(share.ConnectionID, share.ClickhouseUser, password, settings))
+}
+
+// variableOptions returns an OptionsFunc that runs option queries through the
+// tunnel with the given credentials.
+func (h *DashboardsHandler) variableOptions(connectionID, user, password string, settings map[string]string) queryproc.OptionsFunc {
+	return func(query string) ([]string, error) {
+		if !isReadOnlyQuery(query) {
+			return nil, fmt.Errorf("option queries must be read-only")
+		}
+		result, err := h.Gateway.ExecuteQueryWithSettings(connectionID, query, user, password, settings, 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return firstColumnStrings(result.Meta, result.Data)
+	}
+}
+
+// dashboardVariables decodes a dashboard's variable definitions. Invalid JSON
+// yields no variables.
+func dashboardVariables(d *database.Dashboard) []queryproc.Variable {
+	var vars []queryproc.Variable
+	if len(d.Variables) > 0 {
+		_ = json.Unmarshal(d.Variables, &vars)
+	}
+	return vars
+}
+
+// firstColumnStrings returns the distinct non-null values of the first column
+// of a query result, as strings.
+func firstColumnStrings(meta, data json.RawMessage) ([]string, error) {
+	var columns []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(meta, &columns); err != nil || len(columns) == 0 {
+		return nil, fmt.Errorf("query returned no columns")
+	}
+	out := []string{}
+	if len(data) == 0 {
+		return out, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var rows []map[string]interface{}
+	if err := dec.Decode(&rows); err != nil {
+		return nil, fmt.Errorf("parse query result: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for _, row := range rows {
+		var s string
+		switch v := row[columns[0].Name].(type) {
+		case nil:
+			continue
+		case string:
+			s = v
+		case json.Number:
+			s = v.String()
+		default:
+			raw, _ := json.Marshal(v)
+			s = string(raw)
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+		if len(out) >= maxVariableOptions {
+			break
+		}
+	}
+	return out, nil
+}
@@ -38,6 +38,7 @@ func (h *DashboardsHandler) Routes() chi.Router {
 		r.Get("/", h.GetDashboard)
 		r.Put("/", h.UpdateDashboard)
 		r.Delete("/", h.DeleteDashboard)
+		r.Post("/variables/resolve", h.ResolveDashboardVariables)
 
 		// Panel CRUD
 		r.Post("/panels", h.CreatePanel)
@@ -59,6 +60,7 @@ func (h *DashboardsHandler) PublicRoutes() chi.Router {
 	r := chi.NewRouter()
 	r.Get("/{token}", h.GetPublicDashboard)
 	r.Post("/{token}/query", h.ExecutePublicQuery)
+	r.Post("/{token}/variables", h.ResolvePublicVariables)
 	return r
 }
 
@@ -189,8 +191,9 @@ func (h *DashboardsHandler) UpdateDashboard(w http.ResponseWriter, r *http.Reque
 	}
 
 	var body struct {
-		Name        *string `json:"name"`
-		Description *string `json:"description"`
+		Name        *string               `json:"name"`
+		Description *string               `json:"description"`
+		Variables   *[]queryproc.Variable `json:"variables"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON body"})
@@ -217,6 +220,20 @@ func (h *DashboardsHandler) UpdateDashboard(w http.ResponseWriter, r *http.Reque
 		description = strings.TrimSpace(*body.Description)
 		changed = true
 	}
+	var variablesJSON string
+	if body.Variables != nil {
+		vars := *body.Variables
+		if vars == nil {
+			vars = []queryproc.Variable{}
+		}
+		if err := queryproc.ValidateVariables(vars); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		raw, _ := json.Marshal(vars)
+		variablesJSON = string(raw)
+		changed = true
+	}
 
 	if !changed {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "No fields to update"})
@@ -228,6 +245,13 @@ func (h *DashboardsHandler) UpdateDashboard(w http.ResponseWriter, r *http.Reque
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update dashboard"})
 		return
 	}
+	if variablesJSON != "" {
+		if err := h.DB.UpdateDashboardVariables(id, variablesJSON); err != nil {
+			slog.Error("Failed to update dashboard variables", "error", err, "id", id)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update dashboard"})
+			return
+		}
+	}
 
 	h.DB.CreateAuditLog(database.AuditLogParams{
 		Action:   "dashboard.updated",
@@ -562,6 +586,8 @@ func (h *DashboardsHandler) ExecutePanelQuery(w http.ResponseWriter, r *http.Req
 		TimeFieldUnit string               `json:"time_field_unit"`
 		MaxDataPoints *int                 `json:"max_data_points"`
 		Table         string               `json:"table"`
+		DashboardID   string               `json:"dashboard_id"`
+		Variables     map[string][]string  `json:"variables"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON body"})
@@ -579,6 +605,22 @@ func (h *DashboardsHandler) ExecutePanelQuery(w http.ResponseWriter, r *http.Req
 		maxDataPoints = *body.MaxDataPoints
 	}
 
+	// Signed-in users can run any SQL anyway, so variable values are taken
+	// as selected rather than checked against their options.
+	var variables []queryproc.ResolvedVariable
+	if dashboardID := strings.TrimSpace(body.DashboardID); dashboardID != "" {
+		dashboard, err := h.DB.GetDashboardByID(dashboardID)
+		if err != nil || dashboard == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Dashboard not found"})
+			return
+		}
+		variables, err = queryproc.ResolveVariables(dashboardVariables(dashboard), body.Variables, body.TimeRange, nil)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
 	processed := queryproc.ProcessQueryVariables(queryproc.ProcessorOptions{
 		Query:         query,
 		TimeRange:     body.TimeRange,
@@ -586,6 +628,7 @@ func (h *DashboardsHandler) ExecutePanelQuery(w http.ResponseWriter, r *http.Req
 		TimeFieldUnit: strings.TrimSpace(body.TimeFieldUnit),
 		MaxDataPoints: maxDataPoints,
 		Table:         strings.TrimSpace(body.Table),
+		Variables:     variables,
 	})
 
 	if len(processed.Errors) > 0 {
@@ -918,6 +961,12 @@ func (h *DashboardsHandler) GetPublicDashboard(w http.ResponseWriter, r *http.Re
 	if panels == nil {
 		panels = []database.Panel{}
 	}
+	// Viewers run panels by ID and resolve variables through the API, so the
+	// stored SQL never needs to leave the server.
+	for i := range panels {
+		panels[i].Query = ""
+	}
+	dashboard.Variables = json.RawMessage("[]")
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"dashboard": dashboard,
@@ -925,40 +974,97 @@ func (h *DashboardsHandler) GetPublicDashboard(w http.ResponseWriter, r *http.Re
 	})
 }
 
-// ExecutePublicQuery executes a panel query via a share token.
-func (h *DashboardsHandler) ExecutePublicQuery(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	share, err := h.DB.GetDashboardShareByToken(token)
+// authorizePublicQuery checks a share token, its expiry and access, and the
+// share's rate limit before any query runs on its behalf. It writes the error
+// response itself and reports whether the caller may go on.
+func (h *DashboardsHandler) authorizePublicQuery(w http.ResponseWriter, r *http.Request) (*database.DashboardShare, bool) {
+	share, err := h.DB.GetDashboardShareByToken(chi.URLParam(r, "token"))
 	if err != nil || share == nil {
 		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Share not found"})
-		return
+		return nil, false
 	}
 
 	if share.ExpiresAt != nil {
 		exp, parseErr := time.Parse(time.RFC3339, *share.ExpiresAt)
 		if parseErr == nil && time.Now().UTC().After(exp) {
 			writeJSON(w, http.StatusGone, map[string]string{"error": "Share link has expired"})
-			return
+			return nil, false
 		}
 	}
 
 	if !h.validateShareAccess(share, r) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
+		return nil, false
+	}
+
+	if ok, retryAfter := publicShareLimiter.Allow(share.ID, time.Now()); !ok {
+		slog.Warn("Public dashboard query rate limited", "share", share.ID, "ip", getClientIP(r))
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())+1))
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "Too many queries for this share link, try again shortly"})
+		return nil, false
+	}
+	return share, true
+}
+
+// publicQuerySettings are forced on every query run through a share link so
+// it cannot write, whatever the stored panel SQL says. readonly=2 rather than 1
+// so ClickHouse still accepts max_execution_time alongside it.
+var publicQuerySettings = map[string]string{
+	"readonly":           "2",
+	"max_execution_time": "30",
+}
+
+// ExecutePublicQuery runs a stored panel query via a share token. Callers
+// reference the panel by ID; they cannot supply SQL of their own.
+func (h *DashboardsHandler) ExecutePublicQuery(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.authorizePublicQuery(w, r)
+	if !ok {
 		return
 	}
 
 	var body struct {
-		Query     string               `json:"query"`
+		PanelID   string               `json:"panel_id"`
 		TimeRange *queryproc.TimeRange `json:"time_range"`
+		Variables map[string][]string  `json:"variables"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON body"})
 		return
 	}
 
-	query := strings.TrimSpace(body.Query)
+	panelID := strings.TrimSpace(body.PanelID)
+	if panelID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "panel_id is required"})
+		return
+	}
+
+	panel, err := h.DB.GetPanelByID(panelID)
+	if err != nil || panel == nil || panel.DashboardID != share.DashboardID {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Panel not found"})
+		return
+	}
+	if panel.PanelType == "text" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Panel has no query"})
+		return
+	}
+
+	query := strings.TrimSpace(panel.Query)
 	if query == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Query is required"})
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Panel has no query"})
+		return
+	}
+
+	dashboard, err := h.DB.GetDashboardByID(share.DashboardID)
+	if err != nil || dashboard == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Dashboard not found"})
+		return
+	}
+	variables, err := h.resolvePublicVariables(share, dashboard, query, body.Variables, body.TimeRange)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
 		return
 	}
 
@@ -966,6 +1072,7 @@ func (h *DashboardsHandler) ExecutePublicQuery(w http.ResponseWriter, r *http.Re
 		Query:         query,
 		TimeRange:     body.TimeRange,
 		MaxDataPoints: 1000,
+		Variables:     variables,
 	})
 	if len(processed.Errors) > 0 {
 		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
@@ -980,6 +1087,10 @@ func (h *DashboardsHandler) ExecutePublicQuery(w http.ResponseWriter, r *http.Re
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Processed query is empty"})
 		return
 	}
+	if !isReadOnlyQuery(query) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Only read-only panel queries can be run from a share link"})
+		return
+	}
 
 	password, err := crypto.Decrypt(share.EncryptedPassword, h.Config.AppSecretKey)
 	if err != nil {
@@ -988,7 +1099,20 @@ func (h *DashboardsHandler) ExecutePublicQuery(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	result, qErr := h.Gateway.ExecuteQuery(share.ConnectionID, query, share.ClickhouseUser, password, 30*time.Second)
+	result, qErr := h.Gateway.ExecuteQueryWithSettings(share.ConnectionID, query, share.ClickhouseUser, password, publicQuerySettings, 30*time.Second)
+
+	details := fmt.Sprintf("share=%s dashboard=%s panel=%s", share.ID, share.DashboardID, panel.ID)
+	if qErr != nil {
+		details += " error=" + qErr.Error()
+	}
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:       "dashboard.public_query",
+		Username:     share.CreatedBy,
+		ConnectionID: strPtr(share.ConnectionID),
+		Details:      strPtr(details),
+		IPAddress:    strPtr(getClientIP(r)),
+	})
+
 	if qErr != nil {
 		writeJSON(w, http.StatusBadGateway, map[string]interface{}{
 			"success": false,
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/caioricciuti/ch-ui/internal/alerts"
 	"github.com/caioricciuti/ch-ui/internal/config"
 	"github.com/caioricciuti/ch-ui/internal/crypto"
 	"github.com/caioricciuti/ch-ui/internal/database"
@@ -22,11 +23,12 @@ import (
 
 // GovernanceHandler handles all governance-related HTTP endpoints.
 type GovernanceHandler struct {
-	DB      *database.DB
-	Gateway *tunnel.Gateway
-	Config  *config.Config
-	Store   *governance.Store
-	Syncer  *governance.Syncer
+	DB           *database.DB
+	Gateway      *tunnel.Gateway
+	Config       *config.Config
+	Store        *governance.Store
+	Syncer       *governance.Syncer
+	MetricAlerts *alerts.MetricEvaluator
 }
 
 // Routes returns a chi.Router with all governance routes mounted.
@@ -118,6 +120,21 @@ func (h *GovernanceHandler) Routes() chi.Router {
 		ar.Put("/rules/{id}", h.UpdateAlertRule)
 		ar.Delete("/rules/{id}", h.DeleteAlertRule)
 		ar.Get("/events", h.ListAlertEvents)
+		ar.Post("/events/{id}/acknowledge", h.AcknowledgeAlertEvent)
+		ar.Get("/silences", h.ListAlertSilences)
+		ar.Post("/silences", h.CreateAlertSilence)
+		ar.Post("/silences/{id}/expire", h.ExpireAlertSilence)
+		ar.Get("/maintenance-windows", h.ListAlertMaintenanceWindows)
+		ar.Post("/maintenance-windows", h.CreateAlertMaintenanceWindow)
+		ar.Put("/maintenance-windows/{id}", h.UpdateAlertMaintenanceWindow)
+		ar.Delete("/maintenance-windows/{id}", h.DeleteAlertMaintenanceWindow)
+		ar.Get("/metric-rules", h.ListAlertMetricRules)
+		// Metric rules run SQL as a service credential, so changing or
+		// previewing them is limited to admins.
+		ar.With(middleware.RequireAdmin(h.DB)).Post("/metric-rules", h.CreateAlertMetricRule)
+		ar.With(middleware.RequireAdmin(h.DB)).Post("/metric-rules/preview", h.PreviewAlertMetricRule)
+		ar.With(middleware.RequireAdmin(h.DB)).Put("/metric-rules/{id}", h.UpdateAlertMetricRule)
+		ar.With(middleware.RequireAdmin(h.DB)).Delete("/metric-rules/{id}", h.DeleteAlertMetricRule)
 	})
 
 	return r
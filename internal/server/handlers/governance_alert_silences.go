@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caioricciuti/ch-ui/internal/alerts"
+	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/server/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+type alertEventMatcherPayload struct {
+	EventType       *string           `json:"event_type"`
+	ConnectionID    *string           `json:"connection_id"`
+	Severities      []string          `json:"severities"`
+	PayloadMatchers map[string]string `json:"payload_matchers"`
+}
+
+// apply overlays the matcher fields present in the payload onto m.
+func (p alertEventMatcherPayload) apply(m *database.AlertEventMatcher) {
+	if p.EventType != nil {
+		m.EventType = strings.ToLower(strings.TrimSpace(*p.EventType))
+	}
+	if p.ConnectionID != nil {
+		m.ConnectionID = nil
+		if id := strings.TrimSpace(*p.ConnectionID); id != "" {
+			m.ConnectionID = &id
+		}
+	}
+	if p.Severities != nil {
+		m.Severities = make([]string, 0, len(p.Severities))
+		for _, s := range p.Severities {
+			if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+				m.Severities = append(m.Severities, s)
+			}
+		}
+	}
+	if p.PayloadMatchers != nil {
+		m.PayloadMatchers = make(map[string]string, len(p.PayloadMatchers))
+		for k, v := range p.PayloadMatchers {
+			m.PayloadMatchers[strings.TrimSpace(k)] = v
+		}
+	}
+}
+
+func (h *GovernanceHandler) validateEventMatcher(m database.AlertEventMatcher) error {
+	if m.EventType != "" && !isSupportedEventType(m.EventType) {
+		return fmt.Errorf("event_type must be policy.violation, schedule.failed, schedule.slow, schedule.delivery_failed, metric.threshold, or *")
+	}
+	if m.ConnectionID != nil {
+		conn, err := h.DB.GetConnectionByID(*m.ConnectionID)
+		if err != nil {
+			return fmt.Errorf("failed to load connection")
+		}
+		if conn == nil {
+			return fmt.Errorf("connection %s not found", *m.ConnectionID)
+		}
+	}
+	for _, s := range m.Severities {
+		if !isSupportedSeverity(s) {
+			return fmt.Errorf("severities must be info, warn, error, or critical")
+		}
+	}
+	for k := range m.PayloadMatchers {
+		if k == "" {
+			return fmt.Errorf("payload_matchers keys must not be empty")
+		}
+	}
+	return nil
+}
+
+// ── Silences ────────────────────────────────────────────────────────────────
+
+func (h *GovernanceHandler) ListAlertSilences(w http.ResponseWriter, r *http.Request) {
+	silences, err := h.DB.ListAlertSilences()
+	if err != nil {
+		slog.Error("Failed to list alert silences", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list silences"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"silences": silences})
+}
+
+func (h *GovernanceHandler) CreateAlertSilence(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	var body struct {
+		alertEventMatcherPayload
+		Comment         string `json:"comment"`
+		StartsAt        string `json:"starts_at"`
+		EndsAt          string `json:"ends_at"`
+		DurationMinutes int    `json:"duration_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	silence := database.AlertSilence{Comment: strings.TrimSpace(body.Comment)}
+	body.apply(&silence.AlertEventMatcher)
+	if silence.Comment == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "comment is required"})
+		return
+	}
+	if err := h.validateEventMatcher(silence.AlertEventMatcher); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().UTC()
+	startsAt := now
+	if raw := strings.TrimSpace(body.StartsAt); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "starts_at must be an RFC3339 timestamp"})
+			return
+		}
+		startsAt = t.UTC()
+	}
+	var endsAt time.Time
+	switch {
+	case strings.TrimSpace(body.EndsAt) != "":
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(body.EndsAt))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ends_at must be an RFC3339 timestamp"})
+			return
+		}
+		endsAt = t.UTC()
+	case body.DurationMinutes > 0:
+		endsAt = startsAt.Add(time.Duration(body.DurationMinutes) * time.Minute)
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ends_at or duration_minutes is required"})
+		return
+	}
+	if !endsAt.After(startsAt) || !endsAt.After(now) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ends_at must be after starts_at and in the future"})
+		return
+	}
+	silence.StartsAt = startsAt.Format(time.RFC3339)
+	silence.EndsAt = endsAt.Format(time.RFC3339)
+
+	id, err := h.DB.CreateAlertSilence(silence, session.ClickhouseUser)
+	if err != nil {
+		slog.Error("Failed to create alert silence", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create silence"})
+		return
+	}
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:    "alerts.silence.created",
+		Username:  strPtr(session.ClickhouseUser),
+		Details:   strPtr(fmt.Sprintf("%s (until %s)", silence.Comment, silence.EndsAt)),
+		IPAddress: strPtr(r.RemoteAddr),
+	})
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"id": id, "success": true})
+}
+
+func (h *GovernanceHandler) ExpireAlertSilence(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	existing, err := h.DB.GetAlertSilenceByID(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load silence"})
+		return
+	}
+	if existing == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Silence not found"})
+		return
+	}
+	if err := h.DB.ExpireAlertSilence(id); err != nil {
+		slog.Error("Failed to expire alert silence", "id", id, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to expire silence"})
+		return
+	}
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:    "alerts.silence.expired",
+		Username:  strPtr(session.ClickhouseUser),
+		Details:   strPtr(existing.Comment),
+		IPAddress: strPtr(r.RemoteAddr),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// ── Maintenance windows ─────────────────────────────────────────────────────
+
+type alertMaintenanceWindowPayload struct {
+	alertEventMatcherPayload
+	Name      *string `json:"name"`
+	Days      []int   `json:"days"`
+	StartTime *string `json:"start_time"`
+	EndTime   *string `json:"end_time"`
+	Timezone  *string `json:"timezone"`
+	Enabled   *bool   `json:"enabled"`
+}
+
+// apply overlays the fields present in the payload onto mw.
+func (p alertMaintenanceWindowPayload) apply(mw *database.AlertMaintenanceWindow) {
+	p.alertEventMatcherPayload.apply(&mw.AlertEventMatcher)
+	if p.Name != nil {
+		mw.Name = strings.TrimSpace(*p.Name)
+	}
+	if p.Days != nil {
+		mw.Days = p.Days
+	}
+	if p.StartTime != nil {
+		mw.StartTime = strings.TrimSpace(*p.StartTime)
+	}
+	if p.EndTime != nil {
+		mw.EndTime = strings.TrimSpace(*p.EndTime)
+	}
+	if p.Timezone != nil {
+		mw.Timezone = strings.TrimSpace(*p.Timezone)
+	}
+	if p.Enabled != nil {
+		mw.Enabled = *p.Enabled
+	}
+}
+
+func (h *GovernanceHandler) validateMaintenanceWindow(mw database.AlertMaintenanceWindow) error {
+	if mw.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(mw.Days) == 0 {
+		return fmt.Errorf("days must include at least one day")
+	}
+	for _, d := range mw.Days {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("days must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+	start, err := alerts.ParseClock(mw.StartTime)
+	if err != nil {
+		return fmt.Errorf("start_time: %w", err)
+	}
+	end, err := alerts.ParseClock(mw.EndTime)
+	if err != nil {
+		return fmt.Errorf("end_time: %w", err)
+	}
+	if start == end {
+		return fmt.Errorf("start_time and end_time must differ")
+	}
+	if _, err := time.LoadLocation(mw.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", mw.Timezone)
+	}
+	return h.validateEventMatcher(mw.AlertEventMatcher)
+}
+
+func (h *GovernanceHandler) ListAlertMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	windows, err := h.DB.ListAlertMaintenanceWindows()
+	if err != nil {
+		slog.Error("Failed to list alert maintenance windows", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list maintenance windows"})
+		return
+	}
+	now := time.Now()
+	type windowView struct {
+		database.AlertMaintenanceWindow
+		Active bool `json:"active"`
+	}
+	out := make([]windowView, 0, len(windows))
+	for _, mw := range windows {
+		out = append(out, windowView{AlertMaintenanceWindow: mw, Active: mw.Enabled && alerts.MaintenanceWindowActive(mw, now)})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"windows": out})
+}
+
+func (h *GovernanceHandler) CreateAlertMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	var body alertMaintenanceWindowPayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	mw := database.AlertMaintenanceWindow{Timezone: "UTC", Enabled: true}
+	body.apply(&mw)
+	if err := h.validateMaintenanceWindow(mw); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	id, err := h.DB.CreateAlertMaintenanceWindow(mw, session.ClickhouseUser)
+	if err != nil {
+		slog.Error("Failed to create alert maintenance window", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create maintenance window"})
+		return
+	}
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:    "alerts.maintenance_window.created",
+		Username:  strPtr(session.ClickhouseUser),
+		Details:   strPtr(mw.Name),
+		IPAddress: strPtr(r.RemoteAddr),
+	})
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"id": id, "success": true})
+}
+
+func (h *GovernanceHandler) UpdateAlertMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	existing, err := h.DB.GetAlertMaintenanceWindowByID(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load maintenance window"})
+		return
+	}
+	if existing == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Maintenance window not found"})
+		return
+	}
+
+	var body alertMaintenanceWindowPayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	mw := *existing
+	body.apply(&mw)
+	if err := h.validateMaintenanceWindow(mw); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.UpdateAlertMaintenanceWindow(mw); err != nil {
+		slog.Error("Failed to update alert maintenance window", "id", id, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update maintenance window"})
+		return
+	}
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:    "alerts.maintenance_window.updated",
+		Username:  strPtr(session.ClickhouseUser),
+		Details:   strPtr(mw.Name),
+		IPAddress: strPtr(r.RemoteAddr),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+func (h *GovernanceHandler) DeleteAlertMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	existing, err := h.DB.GetAlertMaintenanceWindowByID(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load maintenance window"})
+		return
+	}
+	if existing == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Maintenance window not found"})
+		return
+	}
+	if err := h.DB.DeleteAlertMaintenanceWindow(id); err != nil {
+		slog.Error("Failed to delete alert maintenance window", "id", id, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete maintenance window"})
+		return
+	}
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:    "alerts.maintenance_window.deleted",
+		Username:  strPtr(session.ClickhouseUser),
+		Details:   strPtr(existing.Name),
+		IPAddress: strPtr(r.RemoteAddr),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// ── Acknowledgements ────────────────────────────────────────────────────────
+
+// AcknowledgeAlertEvent stops retries and escalation for an alert until its
+// condition resolves.
+func (h *GovernanceHandler) AcknowledgeAlertEvent(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	ok, err := h.DB.AcknowledgeAlertEvent(id, session.ClickhouseUser)
+	if err != nil {
+		slog.Error("Failed to acknowledge alert event", "id", id, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to acknowledge alert event"})
+		return
+	}
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Alert event not found"})
+		return
+	}
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:    "alerts.event.acknowledged",
+		Username:  strPtr(session.ClickhouseUser),
+		Details:   strPtr(id),
+		IPAddress: strPtr(r.RemoteAddr),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -97,7 +98,7 @@ func (h *GovernanceHandler) CreateAlertChannel(w http.ResponseWriter, r *http.Re
 		return
 	}
 	if !isSupportedChannelType(channelType) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "channel_type must be smtp, resend, or brevo"})
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "channel_type must be smtp, resend, brevo, webhook, slack, teams, or pagerduty"})
 		return
 	}
 	if err := validateChannelConfig(channelType, body.Config, false); err != nil {
@@ -178,7 +179,7 @@ func (h *GovernanceHandler) UpdateAlertChannel(w http.ResponseWriter, r *http.Re
 		return
 	}
 	if !isSupportedChannelType(channelType) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "channel_type must be smtp, resend, or brevo"})
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "channel_type must be smtp, resend, brevo, webhook, slack, teams, or pagerduty"})
 		return
 	}
 
@@ -274,10 +275,13 @@ func (h *GovernanceHandler) TestAlertChannel(w http.ResponseWriter, r *http.Requ
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 		return
 	}
-	recipients, err := validateRecipients(body.Recipients)
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
-		return
+	var recipients []string
+	if alerts.RequiresRecipients(channel.ChannelType) {
+		recipients, err = validateRecipients(body.Recipients)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
 	}
 
 	decrypted, err := crypto.Decrypt(channel.ConfigEncrypted, h.Config.AppSecretKey)
@@ -364,7 +368,7 @@ func (h *GovernanceHandler) CreateAlertRule(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	if !isSupportedEventType(eventType) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "event_type must be policy.violation, schedule.failed, schedule.slow, or *"})
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "event_type must be policy.violation, schedule.failed, schedule.slow, schedule.delivery_failed, metric.threshold, or *"})
 		return
 	}
 	if !isSupportedSeverity(severityMin) {
@@ -481,7 +485,7 @@ func (h *GovernanceHandler) UpdateAlertRule(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	if !isSupportedEventType(eventType) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "event_type must be policy.violation, schedule.failed, schedule.slow, or *"})
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "event_type must be policy.violation, schedule.failed, schedule.slow, schedule.delivery_failed, metric.threshold, or *"})
 		return
 	}
 	if !isSupportedSeverity(severityMin) {
@@ -583,9 +587,12 @@ func (h *GovernanceHandler) validateRuleRoutes(payload []alertRuleRoutePayload)
 		if channel == nil {
 			return nil, fmt.Errorf("channel %s not found", channelID)
 		}
-		recipients, err := validateRecipients(item.Recipients)
-		if err != nil {
-			return nil, fmt.Errorf("route channel %s: %w", channelID, err)
+		recipients := []string{}
+		if alerts.RequiresRecipients(channel.ChannelType) || len(item.Recipients) > 0 {
+			recipients, err = validateRecipients(item.Recipients)
+			if err != nil {
+				return nil, fmt.Errorf("route channel %s: %w", channelID, err)
+			}
 		}
 		active := true
 		if item.IsActive != nil {
@@ -619,6 +626,9 @@ func (h *GovernanceHandler) validateRuleRoutes(payload []alertRuleRoutePayload)
 			if escalationChannel == nil {
 				return nil, fmt.Errorf("route channel %s: escalation channel %s not found", channelID, escID)
 			}
+			if alerts.RequiresRecipients(escalationChannel.ChannelType) && len(item.EscalationRecipients) == 0 && len(recipients) == 0 {
+				return nil, fmt.Errorf("route channel %s: escalation channel %s requires escalation_recipients", channelID, escID)
+			}
 			escalationChannelID = &escID
 		}
 		escalationRecipients := []string{}
@@ -666,6 +676,22 @@ func sanitizeChannelConfig(channelType string, cfg map[string]interface{}) (map[
 			hasSecret = strings.TrimSpace(fmt.Sprintf("%v", out["api_key"])) != ""
 			out["api_key"] = ""
 		}
+	case alerts.ChannelTypeWebhook:
+		if _, ok := out["secret"]; ok {
+			hasSecret = strings.TrimSpace(fmt.Sprintf("%v", out["secret"])) != ""
+			out["secret"] = ""
+		}
+	case alerts.ChannelTypeSlack, alerts.ChannelTypeTeams:
+		// The webhook URL itself is the credential.
+		if _, ok := out["webhook_url"]; ok {
+			hasSecret = strings.TrimSpace(fmt.Sprintf("%v", out["webhook_url"])) != ""
+			out["webhook_url"] = ""
+		}
+	case alerts.ChannelTypePagerDuty:
+		if _, ok := out["routing_key"]; ok {
+			hasSecret = strings.TrimSpace(fmt.Sprintf("%v", out["routing_key"])) != ""
+			out["routing_key"] = ""
+		}
 	}
 	return out, hasSecret
 }
@@ -700,12 +726,50 @@ func validateChannelConfig(channelType string, cfg map[string]interface{}, allow
 		if !allowEmptySecret && get("api_key") == "" {
 			return fmt.Errorf("%s config requires api_key", channelType)
 		}
+	case alerts.ChannelTypeWebhook:
+		if err := validateWebhookURL(get("url")); err != nil {
+			return fmt.Errorf("webhook config: %w", err)
+		}
+		if raw, ok := cfg["headers"]; ok && raw != nil {
+			if _, ok := raw.(map[string]interface{}); !ok {
+				return fmt.Errorf("webhook config headers must be an object")
+			}
+		}
+		if tpl := get("body_template"); tpl != "" {
+			sample := &alerts.Event{Type: alerts.EventTypeScheduleFailed, Severity: alerts.SeverityError, Title: "Sample", Message: "Sample"}
+			if _, err := alerts.RenderWebhookBody(tpl, sample); err != nil {
+				return err
+			}
+		}
+	case alerts.ChannelTypeSlack, alerts.ChannelTypeTeams:
+		if get("webhook_url") == "" {
+			if !allowEmptySecret {
+				return fmt.Errorf("%s config requires webhook_url", channelType)
+			}
+		} else if err := validateWebhookURL(get("webhook_url")); err != nil {
+			return fmt.Errorf("%s config: %w", channelType, err)
+		}
+	case alerts.ChannelTypePagerDuty:
+		if !allowEmptySecret && get("routing_key") == "" {
+			return fmt.Errorf("pagerduty config requires routing_key")
+		}
 	default:
 		return fmt.Errorf("unsupported channel type: %s", channelType)
 	}
 	return nil
 }
 
+func validateWebhookURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http(s) URL")
+	}
+	return nil
+}
+
 func validateRecipients(values []string) ([]string, error) {
 	if len(values) == 0 {
 		return nil, fmt.Errorf("at least one recipient is required")
@@ -729,7 +793,8 @@ func validateRecipients(values []string) ([]string, error) {
 
 func isSupportedChannelType(v string) bool {
 	switch strings.ToLower(strings.TrimSpace(v)) {
-	case alerts.ChannelTypeSMTP, alerts.ChannelTypeResend, alerts.ChannelTypeBrevo:
+	case alerts.ChannelTypeSMTP, alerts.ChannelTypeResend, alerts.ChannelTypeBrevo,
+		alerts.ChannelTypeWebhook, alerts.ChannelTypeSlack, alerts.ChannelTypeTeams, alerts.ChannelTypePagerDuty:
 		return true
 	default:
 		return false
@@ -738,7 +803,8 @@ func isSupportedChannelType(v string) bool {
 
 func isSupportedEventType(v string) bool {
 	switch strings.ToLower(strings.TrimSpace(v)) {
-	case "*", "any", alerts.EventTypePolicyViolation, alerts.EventTypeScheduleFailed, alerts.EventTypeScheduleSlow:
+	case "*", "any", alerts.EventTypePolicyViolation, alerts.EventTypeScheduleFailed, alerts.EventTypeScheduleSlow, alerts.EventTypeScheduleDeliveryFailed,
+		alerts.EventTypeMetricThreshold:
 		return true
 	default:
 		return false
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/caioricciuti/ch-ui/internal/alerts"
+	"github.com/caioricciuti/ch-ui/internal/database"
+	"github.com/caioricciuti/ch-ui/internal/server/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+type alertMetricRulePayload struct {
+	Name            *string  `json:"name"`
+	ConnectionID    *string  `json:"connection_id"`
+	CredentialID    *string  `json:"credential_id"`
+	Query           *string  `json:"query"`
+	Condition       *string  `json:"condition"`
+	Threshold       *float64 `json:"threshold"`
+	IntervalSeconds *int     `json:"interval_seconds"`
+	ForSeconds      *int     `json:"for_seconds"`
+	Severity        *string  `json:"severity"`
+	Enabled         *bool    `json:"enabled"`
+}
+
+// apply overlays the fields present in the payload onto rule.
+func (p alertMetricRulePayload) apply(rule *database.AlertMetricRule) {
+	if p.Name != nil {
+		rule.Name = strings.TrimSpace(*p.Name)
+	}
+	if p.ConnectionID != nil {
+		rule.ConnectionID = strings.TrimSpace(*p.ConnectionID)
+	}
+	if p.CredentialID != nil {
+		rule.CredentialID = nil
+		if id := strings.TrimSpace(*p.CredentialID); id != "" {
+			rule.CredentialID = &id
+		}
+	}
+	if p.Query != nil {
+		rule.Query = strings.TrimRight(strings.TrimSpace(*p.Query), "; \n\t")
+	}
+	if p.Condition != nil {
+		rule.Condition = strings.ToLower(strings.TrimSpace(*p.Condition))
+	}
+	if p.Threshold != nil {
+		rule.Threshold = *p.Threshold
+	}
+	if p.IntervalSeconds != nil {
+		rule.IntervalSeconds = *p.IntervalSeconds
+	}
+	if p.ForSeconds != nil {
+		rule.ForSeconds = *p.ForSeconds
+	}
+	if p.Severity != nil {
+		rule.Severity = strings.ToLower(strings.TrimSpace(*p.Severity))
+	}
+	if p.Enabled != nil {
+		rule.Enabled = *p.Enabled
+	}
+}
+
+func (h *GovernanceHandler) ListAlertMetricRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.DB.ListAlertMetricRules()
+	if err != nil {
+		slog.Error("Failed to list alert metric rules", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list metric alert rules"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"rules": rules})
+}
+
+func (h *GovernanceHandler) CreateAlertMetricRule(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	var body alertMetricRulePayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	rule := database.AlertMetricRule{
+		IntervalSeconds: 60,
+		Severity:        alerts.SeverityWarn,
+		Enabled:         true,
+	}
+	body.apply(&rule)
+	if err := h.validateMetricRule(rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	id, err := h.DB.CreateAlertMetricRule(rule, session.ClickhouseUser)
+	if err != nil {
+		slog.Error("Failed to create alert metric rule", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create metric alert rule"})
+		return
+	}
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:       "alerts.metric_rule.created",
+		Username:     strPtr(session.ClickhouseUser),
+		ConnectionID: strPtr(rule.ConnectionID),
+		Details:      strPtr(rule.Name),
+		IPAddress:    strPtr(r.RemoteAddr),
+	})
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"id": id, "success": true})
+}
+
+func (h *GovernanceHandler) UpdateAlertMetricRule(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	existing, err := h.DB.GetAlertMetricRuleByID(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load metric alert rule"})
+		return
+	}
+	if existing == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Metric alert rule not found"})
+		return
+	}
+
+	var body alertMetricRulePayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	rule := *existing
+	body.apply(&rule)
+	if err := h.validateMetricRule(rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.UpdateAlertMetricRule(rule); err != nil {
+		slog.Error("Failed to update alert metric rule", "id", id, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update metric alert rule"})
+		return
+	}
+	if !rule.Enabled {
+		h.resolveMetricRule(existing)
+	}
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:       "alerts.metric_rule.updated",
+		Username:     strPtr(session.ClickhouseUser),
+		ConnectionID: strPtr(rule.ConnectionID),
+		Details:      strPtr(rule.Name),
+		IPAddress:    strPtr(r.RemoteAddr),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+func (h *GovernanceHandler) DeleteAlertMetricRule(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	existing, err := h.DB.GetAlertMetricRuleByID(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load metric alert rule"})
+		return
+	}
+	if existing == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Metric alert rule not found"})
+		return
+	}
+	if err := h.DB.DeleteAlertMetricRule(id); err != nil {
+		slog.Error("Failed to delete alert metric rule", "id", id, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete metric alert rule"})
+		return
+	}
+	h.resolveMetricRule(existing)
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:       "alerts.metric_rule.deleted",
+		Username:     strPtr(session.ClickhouseUser),
+		ConnectionID: strPtr(existing.ConnectionID),
+		Details:      strPtr(existing.Name),
+		IPAddress:    strPtr(r.RemoteAddr),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// PreviewAlertMetricRule runs a rule's query once and reports the value and
+// whether it breaches the condition, without changing any rule state.
+func (h *GovernanceHandler) PreviewAlertMetricRule(w http.ResponseWriter, r *http.Request) {
+	var body alertMetricRulePayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	rule := database.AlertMetricRule{Name: "preview", IntervalSeconds: 60, Severity: alerts.SeverityWarn}
+	body.apply(&rule)
+	if err := h.validateMetricRule(rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if h.MetricAlerts == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Metric alert evaluator is not available"})
+		return
+	}
+
+	credentialID := ""
+	if rule.CredentialID != nil {
+		credentialID = *rule.CredentialID
+	}
+	value, err := h.MetricAlerts.QueryValue(rule.ConnectionID, credentialID, rule.Query)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"value":    value,
+		"breached": alerts.ConditionBreached(rule.Condition, rule.Threshold, value, nil),
+	})
+}
+
+// resolveMetricRule clears the alert of a firing rule that is being disabled
+// or deleted, since the evaluator will no longer resolve it.
+func (h *GovernanceHandler) resolveMetricRule(rule *database.AlertMetricRule) {
+	if rule.State != database.MetricRuleStateFiring {
+		return
+	}
+	if _, err := h.DB.ResolveAlertEvent(alerts.MetricRuleFingerprint(rule.ID), "Metric alert rule disabled", rule.ID); err != nil {
+		slog.Warn("Failed to resolve metric alert", "rule", rule.ID, "error", err)
+	}
+}
+
+func (h *GovernanceHandler) validateMetricRule(rule database.AlertMetricRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if rule.ConnectionID == "" {
+		return fmt.Errorf("connection_id is required")
+	}
+	conn, err := h.DB.GetConnectionByID(rule.ConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to load connection")
+	}
+	if conn == nil {
+		return fmt.Errorf("connection %s not found", rule.ConnectionID)
+	}
+	if rule.CredentialID != nil {
+		cred, err := h.DB.GetServiceCredentialByID(*rule.CredentialID)
+		if err != nil {
+			return fmt.Errorf("failed to load service credential")
+		}
+		if cred == nil || cred.ConnectionID != rule.ConnectionID {
+			return fmt.Errorf("service credential %s not found for this connection", *rule.CredentialID)
+		}
+	}
+	if rule.Query == "" {
+		return fmt.Errorf("query is required")
+	}
+	if !isReadOnlyQuery(rule.Query) {
+		return fmt.Errorf("query must be a read-only SELECT")
+	}
+	if !alerts.IsMetricCondition(rule.Condition) {
+		return fmt.Errorf("condition must be above, below, change_pct, or no_data")
+	}
+	if rule.IntervalSeconds < alerts.MinMetricIntervalSeconds || rule.IntervalSeconds > 86400 {
+		return fmt.Errorf("interval_seconds must be between %d and 86400", alerts.MinMetricIntervalSeconds)
+	}
+	if rule.ForSeconds < 0 || rule.ForSeconds > 86400 {
+		return fmt.Errorf("for_seconds must be between 0 and 86400")
+	}
+	if !isSupportedSeverity(rule.Severity) {
+		return fmt.Errorf("severity must be info, warn, error, or critical")
+	}
+	return nil
+}
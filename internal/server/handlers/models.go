@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -33,7 +34,10 @@ func (h *ModelsHandler) Routes() chi.Router {
 	r.Post("/", h.CreateModel)
 	r.Get("/dag", h.GetDAG)
 	r.Get("/validate", h.ValidateAll)
+	r.Get("/compile", h.Compile)
 	r.Post("/run", h.RunAll)
+	r.Get("/settings", h.GetSettings)
+	r.Put("/settings", h.UpdateSettings)
 	r.Get("/runs", h.ListRuns)
 	r.Get("/runs/{runId}", h.GetRun)
 	r.Get("/pipelines", h.ListPipelines)
@@ -48,6 +52,7 @@ func (h *ModelsHandler) Routes() chi.Router {
 		r.Put("/", h.UpdateModel)
 		r.Delete("/", h.DeleteModel)
 		r.Post("/run", h.RunSingle)
+		r.Post("/rollback", h.Rollback)
 	})
 
 	return r
@@ -89,6 +94,8 @@ func (h *ModelsHandler) CreateModel(w http.ResponseWriter, r *http.Request) {
 		SQLBody         string `json:"sql_body"`
 		TableEngine     string `json:"table_engine"`
 		OrderBy         string `json:"order_by"`
+		database.ModelOptions
+		Tests []database.ModelTest `json:"tests"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -105,13 +112,18 @@ func (h *ModelsHandler) CreateModel(w http.ResponseWriter, r *http.Request) {
 		body.TargetDatabase = "default"
 	}
 	if body.Materialization == "" {
-		body.Materialization = "view"
+		body.Materialization = models.MaterializationView
 	}
-	if body.Materialization != "view" && body.Materialization != "table" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "materialization must be 'view' or 'table'"})
+	if err := models.ValidateMaterialization(body.Materialization, body.ModelOptions); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	tests, err := models.NormalizeTests(body.Tests)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
-	if body.Materialization == "table" {
+	if models.UsesTableEngine(body.Materialization) {
 		if body.TableEngine == "" {
 			body.TableEngine = "MergeTree"
 		}
@@ -129,6 +141,18 @@ func (h *ModelsHandler) CreateModel(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to create model: %v", err)})
 		return
 	}
+	if body.ModelOptions != (database.ModelOptions{}) {
+		if err := h.DB.UpdateModelOptions(id, body.ModelOptions); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to save model options: %v", err)})
+			return
+		}
+	}
+	if len(tests) > 0 {
+		if err := h.DB.UpdateModelTests(id, tests); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to save model tests: %v", err)})
+			return
+		}
+	}
 
 	model, _ := h.DB.GetModelByID(id)
 	writeJSON(w, http.StatusCreated, map[string]interface{}{"model": model})
@@ -159,11 +183,6 @@ func (h *ModelsHandler) UpdateModel(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Model not found"})
 		return
 	}
-	if existing.Source == "github" {
-		writeJSON(w, http.StatusForbidden, map[string]string{"error": "This model is managed by GitHub — edit it in your repository and re-sync"})
-		return
-	}
-
 	var body struct {
 		Name            string `json:"name"`
 		Description     string `json:"description"`
@@ -172,6 +191,18 @@ func (h *ModelsHandler) UpdateModel(w http.ResponseWriter, r *http.Request) {
 		SQLBody         string `json:"sql_body"`
 		TableEngine     string `json:"table_engine"`
 		OrderBy         string `json:"order_by"`
+
+		// CredentialID assigns a service credential to build the model
+		// with; "" clears it.
+		CredentialID *string `json:"credential_id"`
+
+		PartitionBy *string `json:"partition_by"`
+		UniqueKey   *string `json:"unique_key"`
+		Layout      *string `json:"layout"`
+		Lifetime    *string `json:"lifetime"`
+
+		// Tests replaces the model's data tests when present.
+		Tests *[]database.ModelTest `json:"tests"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -194,10 +225,31 @@ func (h *ModelsHandler) UpdateModel(w http.ResponseWriter, r *http.Request) {
 	if body.Materialization == "" {
 		body.Materialization = existing.Materialization
 	}
-	if body.Materialization != "view" && body.Materialization != "table" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "materialization must be 'view' or 'table'"})
+	opts := existing.ModelOptions
+	for _, f := range []struct {
+		in  *string
+		out *string
+	}{
+		{body.PartitionBy, &opts.PartitionBy},
+		{body.UniqueKey, &opts.UniqueKey},
+		{body.Layout, &opts.Layout},
+		{body.Lifetime, &opts.Lifetime},
+	} {
+		if f.in != nil {
+			*f.out = strings.TrimSpace(*f.in)
+		}
+	}
+	if err := models.ValidateMaterialization(body.Materialization, opts); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	var tests []database.ModelTest
+	if body.Tests != nil {
+		if tests, err = models.NormalizeTests(*body.Tests); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
 	if body.TableEngine == "" {
 		body.TableEngine = existing.TableEngine
 	}
@@ -207,12 +259,40 @@ func (h *ModelsHandler) UpdateModel(w http.ResponseWriter, r *http.Request) {
 	if body.SQLBody == "" {
 		body.SQLBody = existing.SQLBody
 	}
+	if body.CredentialID != nil {
+		current := ""
+		if existing.CredentialID != nil {
+			current = *existing.CredentialID
+		}
+		if status, msg := authorizeCredentialAssignment(h.DB, r, strings.TrimSpace(*body.CredentialID), current, existing.ConnectionID); status != 0 {
+			writeJSON(w, status, map[string]string{"error": msg})
+			return
+		}
+	}
 
 	if err := h.DB.UpdateModel(id, body.Name, body.Description, body.TargetDatabase,
 		body.Materialization, body.SQLBody, body.TableEngine, body.OrderBy); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to update model: %v", err)})
 		return
 	}
+	if opts != existing.ModelOptions {
+		if err := h.DB.UpdateModelOptions(id, opts); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to update model options: %v", err)})
+			return
+		}
+	}
+	if body.Tests != nil {
+		if err := h.DB.UpdateModelTests(id, tests); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to update model tests: %v", err)})
+			return
+		}
+	}
+	if body.CredentialID != nil {
+		if err := h.DB.UpdateModelCredential(id, strings.TrimSpace(*body.CredentialID)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to update model credential: %v", err)})
+			return
+		}
+	}
 
 	model, _ := h.DB.GetModelByID(id)
 	writeJSON(w, http.StatusOK, map[string]interface{}{"model": model})
@@ -364,6 +444,29 @@ func (h *ModelsHandler) ValidateAll(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Compile returns the resolved SQL and DDL of every model without running
+// anything. With ?dry_run=true each query is also checked against ClickHouse
+// and diffed with the deployed objects.
+func (h *ModelsHandler) Compile(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	compiled, err := h.Runner.Compile(session.ConnectionID, dryRun)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"dry_run": dryRun,
+		"models":  compiled,
+	})
+}
+
 // RunAll triggers execution of all models.
 func (h *ModelsHandler) RunAll(w http.ResponseWriter, r *http.Request) {
 	session := middleware.GetSession(r)
@@ -381,6 +484,43 @@ func (h *ModelsHandler) RunAll(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]interface{}{"run_id": runID})
 }
 
+// GetSettings returns the model run settings of the current connection.
+func (h *ModelsHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"parallelism":     h.DB.GetModelParallelism(session.ConnectionID),
+		"max_parallelism": database.MaxModelParallelism,
+	})
+}
+
+// UpdateSettings changes the model run settings of the current connection.
+func (h *ModelsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	var body struct {
+		Parallelism int `json:"parallelism"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if err := h.DB.SetModelParallelism(session.ConnectionID, body.Parallelism); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	h.GetSettings(w, r)
+}
+
 // RunSingle triggers execution of a single model and its deps.
 func (h *ModelsHandler) RunSingle(w http.ResponseWriter, r *http.Request) {
 	session := middleware.GetSession(r)
@@ -399,6 +539,23 @@ func (h *ModelsHandler) RunSingle(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]interface{}{"run_id": runID})
 }
 
+// Rollback swaps a table model back to its previous build.
+func (h *ModelsHandler) Rollback(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := h.Runner.Rollback(session.ConnectionID, id); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
 // ListRuns returns recent model runs.
 func (h *ModelsHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
 	session := middleware.GetSession(r)
@@ -616,13 +773,13 @@ func (h *ModelsHandler) UpsertSchedule(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "cron expression is required"})
 		return
 	}
-	if !scheduler.ValidateCron(body.Cron) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cron expression"})
+	if err := scheduler.ValidateCron(body.Cron); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid cron expression: %v", err)})
 		return
 	}
 
 	var nextRunAt string
-	if next := scheduler.ComputeNextRun(body.Cron, time.Now().UTC()); next != nil {
+	if next := scheduler.ComputeNextRun(body.Cron, "UTC", time.Now().UTC()); next != nil {
 		nextRunAt = next.Format(time.RFC3339)
 	}
 
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -47,6 +48,11 @@ func (h *PipelinesHandler) Routes() chi.Router {
 		r.Get("/status", h.GetStatus)
 		r.Get("/runs", h.ListRuns)
 		r.Get("/runs/{runId}/logs", h.GetRunLogs)
+		r.Get("/metrics", h.GetMetrics)
+
+		// Source checkpoints
+		r.Get("/checkpoint", h.GetCheckpoint)
+		r.Delete("/checkpoint", h.ResetCheckpoint)
 	})
 
 	return r
@@ -121,6 +127,7 @@ func (h *PipelinesHandler) CreatePipeline(w http.ResponseWriter, r *http.Request
 		Name         string `json:"name"`
 		Description  string `json:"description"`
 		ConnectionID string `json:"connection_id"`
+		CredentialID string `json:"credential_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON body"})
@@ -138,6 +145,11 @@ func (h *PipelinesHandler) CreatePipeline(w http.ResponseWriter, r *http.Request
 		// Use the session's connection ID as default
 		connectionID = session.ConnectionID
 	}
+	credentialID := strings.TrimSpace(body.CredentialID)
+	if status, msg := authorizeCredentialAssignment(h.DB, r, credentialID, "", connectionID); status != 0 {
+		writeJSON(w, status, map[string]string{"error": msg})
+		return
+	}
 
 	id, err := h.DB.CreatePipeline(name, strings.TrimSpace(body.Description), connectionID, session.ClickhouseUser)
 	if err != nil {
@@ -145,6 +157,11 @@ func (h *PipelinesHandler) CreatePipeline(w http.ResponseWriter, r *http.Request
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create pipeline"})
 		return
 	}
+	if credentialID != "" {
+		if err := h.DB.UpdatePipelineCredential(id, credentialID); err != nil {
+			slog.Error("Failed to save pipeline service credential", "error", err, "id", id)
+		}
+	}
 
 	h.DB.CreateAuditLog(database.AuditLogParams{
 		Action:   "pipeline.created",
@@ -156,7 +173,7 @@ func (h *PipelinesHandler) CreatePipeline(w http.ResponseWriter, r *http.Request
 	writeJSON(w, http.StatusCreated, map[string]interface{}{"pipeline": pipeline})
 }
 
-// UpdatePipeline updates a pipeline's name and description.
+// UpdatePipeline updates a pipeline's name, description and service credential.
 func (h *PipelinesHandler) UpdatePipeline(w http.ResponseWriter, r *http.Request) {
 	session := middleware.GetSession(r)
 	if session == nil {
@@ -169,6 +186,9 @@ func (h *PipelinesHandler) UpdatePipeline(w http.ResponseWriter, r *http.Request
 	var body struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
+
+		// CredentialID assigns a service credential; "" clears it.
+		CredentialID *string `json:"credential_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON body"})
@@ -181,11 +201,34 @@ func (h *PipelinesHandler) UpdatePipeline(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if body.CredentialID != nil {
+		existing, err := h.DB.GetPipelineByID(id)
+		if err != nil || existing == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Pipeline not found"})
+			return
+		}
+		current := ""
+		if existing.CredentialID != nil {
+			current = *existing.CredentialID
+		}
+		if status, msg := authorizeCredentialAssignment(h.DB, r, strings.TrimSpace(*body.CredentialID), current, existing.ConnectionID); status != 0 {
+			writeJSON(w, status, map[string]string{"error": msg})
+			return
+		}
+	}
+
 	if err := h.DB.UpdatePipeline(id, name, strings.TrimSpace(body.Description)); err != nil {
 		slog.Error("Failed to update pipeline", "error", err, "id", id)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update pipeline"})
 		return
 	}
+	if body.CredentialID != nil {
+		if err := h.DB.UpdatePipelineCredential(id, strings.TrimSpace(*body.CredentialID)); err != nil {
+			slog.Error("Failed to update pipeline service credential", "error", err, "id", id)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update pipeline"})
+			return
+		}
+	}
 
 	pipeline, _ := h.DB.GetPipelineByID(id)
 	writeJSON(w, http.StatusOK, map[string]interface{}{"pipeline": pipeline})
@@ -252,6 +295,21 @@ func (h *PipelinesHandler) SaveGraph(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pipeline, err := h.DB.GetPipelineByID(id)
+	if err != nil {
+		slog.Error("Failed to get pipeline", "error", err, "id", id)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to get pipeline"})
+		return
+	}
+	if pipeline == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Pipeline not found"})
+		return
+	}
+	if status, msg := h.authorizeNodeCredentials(r, pipeline, body.Nodes); status != 0 {
+		writeJSON(w, status, map[string]string{"error": msg})
+		return
+	}
+
 	// Convert to database types
 	var nodes []database.PipelineNode
 	for _, n := range body.Nodes {
@@ -294,6 +352,37 @@ func (h *PipelinesHandler) SaveGraph(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"success": "true"})
 }
 
+// authorizeNodeCredentials applies the service credential rules of the
+// pipeline itself to the credential_id a sink or dead-letter node may carry,
+// since the runner writes as that credential. A node keeps whatever
+// credential it was last saved with.
+func (h *PipelinesHandler) authorizeNodeCredentials(r *http.Request, pipeline *database.Pipeline, nodes []graphNode) (int, string) {
+	saved, _, err := h.DB.GetPipelineGraph(pipeline.ID)
+	if err != nil {
+		slog.Error("Failed to get pipeline graph", "error", err, "pipeline", pipeline.ID)
+		return http.StatusInternalServerError, "Failed to get pipeline graph"
+	}
+	current := make(map[string]string, len(saved))
+	for _, n := range saved {
+		var cfg map[string]interface{}
+		if json.Unmarshal([]byte(n.ConfigEncrypted), &cfg) == nil {
+			current[n.ID], _ = cfg["credential_id"].(string)
+		}
+	}
+
+	for _, n := range nodes {
+		credentialID, _ := n.Config["credential_id"].(string)
+		connectionID, _ := n.Config["connection_id"].(string)
+		if connectionID == "" {
+			connectionID = pipeline.ConnectionID
+		}
+		if status, msg := authorizeCredentialAssignment(h.DB, r, credentialID, current[n.ID], connectionID); status != 0 {
+			return status, msg
+		}
+	}
+	return 0, ""
+}
+
 // StartPipeline starts a pipeline (placeholder for Phase 3).
 func (h *PipelinesHandler) StartPipeline(w http.ResponseWriter, r *http.Request) {
 	session := middleware.GetSession(r)
@@ -388,6 +477,8 @@ func (h *PipelinesHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 		resp["bytes_ingested"] = metrics.BytesIngested.Load()
 		resp["batches_sent"] = metrics.BatchesSent.Load()
 		resp["errors_count"] = metrics.ErrorsCount.Load()
+		resp["rows_dead_lettered"] = metrics.RowsDeadLettered.Load()
+		resp["source_lag"] = metrics.SourceLag()
 	}
 
 	writeJSON(w, http.StatusOK, resp)
@@ -447,6 +538,102 @@ func (h *PipelinesHandler) GetRunLogs(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]interface{}{"logs": logs})
 }
 
+// GetMetrics returns the per-minute metrics history of a pipeline between
+// from and to (RFC 3339, default the last 24 hours), optionally for one run.
+func (h *PipelinesHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	q := r.URL.Query()
+
+	to := time.Now().UTC()
+	if v := q.Get("to"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid 'to' timestamp, expected RFC 3339"})
+			return
+		}
+		to = parsed
+	}
+	from := to.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid 'from' timestamp, expected RFC 3339"})
+			return
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "'from' must be before 'to'"})
+		return
+	}
+
+	points, err := h.DB.GetPipelineMetrics(id, q.Get("run_id"), from, to)
+	if err != nil {
+		slog.Error("Failed to get pipeline metrics", "error", err, "pipeline", id)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to get metrics"})
+		return
+	}
+	if points == nil {
+		points = []database.PipelineMetricSnapshot{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"points": points})
+}
+
+// GetCheckpoint returns the committed source checkpoint entries for a pipeline.
+func (h *PipelinesHandler) GetCheckpoint(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	checkpoints, err := h.DB.GetPipelineCheckpoints(id)
+	if err != nil {
+		slog.Error("Failed to get pipeline checkpoint", "error", err, "pipeline", id)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to get checkpoint"})
+		return
+	}
+	if checkpoints == nil {
+		checkpoints = []database.PipelineCheckpoint{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"checkpoints": checkpoints})
+}
+
+// ResetCheckpoint clears a stopped pipeline's checkpoint so the next start
+// re-reads its source from the beginning (backfill).
+func (h *PipelinesHandler) ResetCheckpoint(w http.ResponseWriter, r *http.Request) {
+	session := middleware.GetSession(r)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Not authenticated"})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+
+	pipeline, err := h.DB.GetPipelineByID(id)
+	if err != nil || pipeline == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Pipeline not found"})
+		return
+	}
+	if pipeline.Status == "running" || pipeline.Status == "starting" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Cannot reset the checkpoint of a running pipeline. Stop it first."})
+		return
+	}
+
+	removed, err := h.DB.DeletePipelineCheckpoints(id)
+	if err != nil {
+		slog.Error("Failed to reset pipeline checkpoint", "error", err, "pipeline", id)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to reset checkpoint"})
+		return
+	}
+
+	h.DB.CreateAuditLog(database.AuditLogParams{
+		Action:   "pipeline.checkpoint_reset",
+		Username: &session.ClickhouseUser,
+		Details:  &pipeline.Name,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "removed": removed})
+}
+
 // ── Graph request types ────────────────────────────────────────────
 
 type graphNode struct {
@@ -21,14 +21,16 @@ import (
 
 // SchedulesHandler handles scheduled job CRUD and execution.
 type SchedulesHandler struct {
-	DB      *database.DB
-	Gateway *tunnel.Gateway
-	Config  *config.Config
+	DB        *database.DB
+	Gateway   *tunnel.Gateway
+	Config    *config.Config
+	Scheduler *scheduler.Runner
 }
 
 // Routes registers schedule routes on the given router.
 func (h *SchedulesHandler) Routes(r chi.Router) {
 	r.Get("/", h.List)
+	r.Get("/preview", h.Preview)
 	r.Get("/{id}", h.Get)
 	r.Post("/", h.Create)
 	r.Put("/{id}", h.Update)
@@ -46,11 +48,68 @@ func (h *SchedulesHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if schedules == nil {
-		schedules = []database.Schedule{}
+	out := make([]scheduleResponse, 0, len(schedules))
+	for _, s := range schedules {
+		out = append(out, h.scheduleResponse(s))
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{"schedules": schedules})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"schedules": out})
+}
+
+// scheduleResponse is a schedule with its delivery targets, secrets blanked.
+type scheduleResponse struct {
+	database.Schedule
+	Delivery []scheduler.DeliveryTarget `json:"delivery"`
+}
+
+func (h *SchedulesHandler) scheduleResponse(s database.Schedule) scheduleResponse {
+	targets, err := scheduler.DecryptDeliveryTargets(s.DeliveryEncrypted, h.Config.AppSecretKey)
+	if err != nil {
+		slog.Warn("Failed to read schedule delivery targets", "schedule", s.ID, "error", err)
+	}
+	return scheduleResponse{Schedule: s, Delivery: scheduler.RedactDeliveryTargets(targets)}
+}
+
+// Preview returns the next fire times of a cron expression in a timezone,
+// without saving anything.
+func (h *SchedulesHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cronExpr := strings.TrimSpace(q.Get("cron"))
+	if cronExpr == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Cron expression is required"})
+		return
+	}
+	timezone := strings.TrimSpace(q.Get("timezone"))
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	count := 5
+	if v := q.Get("count"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			count = parsed
+		}
+	}
+	if count > 50 {
+		count = 50
+	}
+
+	runs, err := scheduler.NextRuns(cronExpr, timezone, time.Now(), count)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	nextRuns := make([]string, 0, len(runs))
+	for _, t := range runs {
+		nextRuns = append(nextRuns, t.Format(time.RFC3339))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"cron":      cronExpr,
+		"timezone":  timezone,
+		"next_runs": nextRuns,
+	})
 }
 
 // Get returns a single scheduled job by ID.
@@ -72,7 +131,7 @@ func (h *SchedulesHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, schedule)
+	writeJSON(w, http.StatusOK, h.scheduleResponse(*schedule))
 }
 
 // Create creates a new scheduled job.
@@ -90,6 +149,10 @@ func (h *SchedulesHandler) Create(w http.ResponseWriter, r *http.Request) {
 		ConnectionID string `json:"connection_id"`
 		Timezone     string `json:"timezone"`
 		TimeoutMs    *int   `json:"timeout_ms"`
+		CredentialID string `json:"credential_id"`
+
+		Delivery []scheduler.DeliveryTarget `json:"delivery"`
+		database.ScheduleExecution
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
@@ -103,12 +166,22 @@ func (h *SchedulesHandler) Create(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Name is required"})
 		return
 	}
-	if cronExpr == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Cron expression is required"})
+	if err := scheduler.NormalizeExecution(&body.ScheduleExecution); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
-	if !scheduler.ValidateCron(cronExpr) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid cron expression"})
+	if cronExpr == "" && len(body.Triggers) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Cron expression or at least one trigger is required"})
+		return
+	}
+	if cronExpr != "" {
+		if err := scheduler.ValidateCron(cronExpr); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid cron expression: %v", err)})
+			return
+		}
+	}
+	if err := scheduler.ValidateTriggers(h.DB, "", body.Triggers); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
 	if savedQueryID == "" {
@@ -132,12 +205,31 @@ func (h *SchedulesHandler) Create(w http.ResponseWriter, r *http.Request) {
 	if timezone == "" {
 		timezone = "UTC"
 	}
+	if _, err := scheduler.LoadTimezone(timezone); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid timezone: %v", err)})
+		return
+	}
 
 	timeoutMs := 60000
 	if body.TimeoutMs != nil && *body.TimeoutMs > 0 {
 		timeoutMs = *body.TimeoutMs
 	}
 
+	if err := scheduler.ValidateDeliveryTargets(body.Delivery); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if status, msg := authorizeEmailDelivery(h.DB, r, body.Delivery, nil); status != 0 {
+		writeJSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	delivery, err := scheduler.EncryptDeliveryTargets(body.Delivery, h.Config.AppSecretKey)
+	if err != nil {
+		slog.Error("Failed to encrypt schedule delivery targets", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to save delivery targets"})
+		return
+	}
+
 	connectionID := strings.TrimSpace(body.ConnectionID)
 	if connectionID == "" {
 		if savedQuery.ConnectionID != nil {
@@ -147,6 +239,11 @@ func (h *SchedulesHandler) Create(w http.ResponseWriter, r *http.Request) {
 			connectionID = session.ConnectionID
 		}
 	}
+	credentialID := strings.TrimSpace(body.CredentialID)
+	if status, msg := authorizeCredentialAssignment(h.DB, r, credentialID, "", connectionID); status != 0 {
+		writeJSON(w, status, map[string]string{"error": msg})
+		return
+	}
 
 	id, err := h.DB.CreateSchedule(name, savedQueryID, connectionID, cronExpr, timezone, session.ClickhouseUser, timeoutMs)
 	if err != nil {
@@ -156,10 +253,23 @@ func (h *SchedulesHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set next run time
-	next := scheduler.ComputeNextRun(cronExpr, time.Now().UTC())
+	next := scheduler.ComputeNextRun(cronExpr, timezone, time.Now().UTC())
 	if next != nil {
 		h.DB.UpdateScheduleStatus(id, "", "", next)
 	}
+	if delivery != "" {
+		if err := h.DB.UpdateScheduleDelivery(id, delivery); err != nil {
+			slog.Error("Failed to save schedule delivery targets", "error", err, "id", id)
+		}
+	}
+	if credentialID != "" {
+		if err := h.DB.UpdateScheduleCredential(id, credentialID); err != nil {
+			slog.Error("Failed to save schedule service credential", "error", err, "id", id)
+		}
+	}
+	if err := h.DB.UpdateScheduleExecution(id, body.ScheduleExecution); err != nil {
+		slog.Error("Failed to save schedule execution settings", "error", err, "id", id)
+	}
 
 	h.DB.CreateAuditLog(database.AuditLogParams{
 		Action:   "schedule.created",
@@ -173,7 +283,7 @@ func (h *SchedulesHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, schedule)
+	writeJSON(w, http.StatusCreated, h.scheduleResponse(*schedule))
 }
 
 // Update updates an existing scheduled job.
@@ -207,6 +317,17 @@ func (h *SchedulesHandler) Update(w http.ResponseWriter, r *http.Request) {
 		Timezone  *string `json:"timezone"`
 		Enabled   *bool   `json:"enabled"`
 		TimeoutMs *int    `json:"timeout_ms"`
+
+		// CredentialID assigns a service credential; "" clears it.
+		CredentialID *string `json:"credential_id"`
+
+		Delivery *[]scheduler.DeliveryTarget `json:"delivery"`
+
+		Triggers            *[]database.ScheduleTrigger `json:"triggers"`
+		MaxRetries          *int                        `json:"max_retries"`
+		RetryBackoffSeconds *int                        `json:"retry_backoff_seconds"`
+		ConcurrencyPolicy   *string                     `json:"concurrency_policy"`
+		PreconditionQuery   *string                     `json:"precondition_query"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
@@ -231,9 +352,11 @@ func (h *SchedulesHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 	if body.Cron != nil {
 		c := strings.TrimSpace(*body.Cron)
-		if c == "" || !scheduler.ValidateCron(c) {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid cron expression"})
-			return
+		if c != "" {
+			if err := scheduler.ValidateCron(c); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid cron expression: %v", err)})
+				return
+			}
 		}
 		cron = c
 		changed = true
@@ -243,6 +366,10 @@ func (h *SchedulesHandler) Update(w http.ResponseWriter, r *http.Request) {
 		if tz == "" {
 			tz = "UTC"
 		}
+		if _, err := scheduler.LoadTimezone(tz); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid timezone: %v", err)})
+			return
+		}
 		timezone = tz
 		changed = true
 	}
@@ -258,6 +385,87 @@ func (h *SchedulesHandler) Update(w http.ResponseWriter, r *http.Request) {
 		timeoutMs = *body.TimeoutMs
 		changed = true
 	}
+	delivery := existing.DeliveryEncrypted
+	if body.Delivery != nil {
+		targets := *body.Delivery
+		previous, err := scheduler.DecryptDeliveryTargets(existing.DeliveryEncrypted, h.Config.AppSecretKey)
+		if err != nil {
+			slog.Warn("Failed to read existing schedule delivery targets", "schedule", id, "error", err)
+		}
+		scheduler.MergeDeliverySecrets(targets, previous)
+		if err := scheduler.ValidateDeliveryTargets(targets); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if status, msg := authorizeEmailDelivery(h.DB, r, targets, previous); status != 0 {
+			writeJSON(w, status, map[string]string{"error": msg})
+			return
+		}
+		if delivery, err = scheduler.EncryptDeliveryTargets(targets, h.Config.AppSecretKey); err != nil {
+			slog.Error("Failed to encrypt schedule delivery targets", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to save delivery targets"})
+			return
+		}
+		changed = true
+	}
+	previousCredentialID := ""
+	if existing.CredentialID != nil {
+		previousCredentialID = *existing.CredentialID
+	}
+	credentialID := previousCredentialID
+	if body.CredentialID != nil {
+		connectionID := ""
+		if existing.ConnectionID != nil {
+			connectionID = *existing.ConnectionID
+		}
+		c := strings.TrimSpace(*body.CredentialID)
+		if status, msg := authorizeCredentialAssignment(h.DB, r, c, previousCredentialID, connectionID); status != 0 {
+			writeJSON(w, status, map[string]string{"error": msg})
+			return
+		}
+		credentialID = c
+		changed = true
+	}
+
+	execution := existing.ScheduleExecution
+	executionChanged := false
+	if body.Triggers != nil {
+		execution.Triggers = *body.Triggers
+		executionChanged = true
+	}
+	if body.MaxRetries != nil {
+		execution.MaxRetries = *body.MaxRetries
+		executionChanged = true
+	}
+	if body.RetryBackoffSeconds != nil {
+		execution.RetryBackoffSeconds = *body.RetryBackoffSeconds
+		executionChanged = true
+	}
+	if body.ConcurrencyPolicy != nil {
+		execution.ConcurrencyPolicy = *body.ConcurrencyPolicy
+		executionChanged = true
+	}
+	if body.PreconditionQuery != nil {
+		execution.PreconditionQuery = *body.PreconditionQuery
+		executionChanged = true
+	}
+	if executionChanged {
+		if err := scheduler.NormalizeExecution(&execution); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if body.Triggers != nil {
+			if err := scheduler.ValidateTriggers(h.DB, id, execution.Triggers); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		changed = true
+	}
+	if cron == "" && len(execution.Triggers) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Cron expression or at least one trigger is required"})
+		return
+	}
 
 	if !changed {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "No valid fields to update"})
@@ -269,10 +477,31 @@ func (h *SchedulesHandler) Update(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update schedule"})
 		return
 	}
+	if delivery != existing.DeliveryEncrypted {
+		if err := h.DB.UpdateScheduleDelivery(id, delivery); err != nil {
+			slog.Error("Failed to update schedule delivery targets", "error", err, "id", id)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update delivery targets"})
+			return
+		}
+	}
+	if credentialID != previousCredentialID {
+		if err := h.DB.UpdateScheduleCredential(id, credentialID); err != nil {
+			slog.Error("Failed to update schedule service credential", "error", err, "id", id)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update service credential"})
+			return
+		}
+	}
+	if executionChanged {
+		if err := h.DB.UpdateScheduleExecution(id, execution); err != nil {
+			slog.Error("Failed to update schedule execution settings", "error", err, "id", id)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update execution settings"})
+			return
+		}
+	}
 
 	// Recompute next run
 	if enabled {
-		next := scheduler.ComputeNextRun(cron, time.Now().UTC())
+		next := scheduler.ComputeNextRun(cron, timezone, time.Now().UTC())
 		h.DB.UpdateScheduleStatus(id, "", "", next)
 	} else {
 		h.DB.UpdateScheduleStatus(id, "", "", nil)
@@ -439,7 +668,7 @@ func (h *SchedulesHandler) ManualRun(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create a run record
-	runID, err := h.DB.CreateScheduleRun(id, "running")
+	runID, err := h.DB.CreateScheduleRun(id, "running", "manual", 1)
 	if err != nil {
 		slog.Error("Failed to create schedule run", "error", err, "schedule", id)
 	}
@@ -464,10 +693,16 @@ func (h *SchedulesHandler) ManualRun(w http.ResponseWriter, r *http.Request) {
 		h.DB.UpdateScheduleRun(runID, status, rowCount, int(elapsed), runErr)
 	}
 
+	// Deliver the result to the schedule's targets
+	var delivery *scheduler.DeliveryReport
+	if execErr == nil {
+		delivery = scheduler.DeliverResult(r.Context(), h.DB, h.Config.AppSecretKey, *schedule, runID, result, rowCount)
+	}
+
 	// Update schedule status
 	var nextRun *time.Time
 	if schedule.Enabled {
-		nextRun = scheduler.ComputeNextRun(schedule.Cron, time.Now().UTC())
+		nextRun = scheduler.ComputeNextRun(schedule.Cron, schedule.Timezone, time.Now().UTC())
 	}
 	h.DB.UpdateScheduleStatus(id, status, runErr, nextRun)
 
@@ -477,6 +712,11 @@ func (h *SchedulesHandler) ManualRun(w http.ResponseWriter, r *http.Request) {
 		Details:  strPtr(fmt.Sprintf("status=%s elapsed=%dms", status, elapsed)),
 	})
 
+	// Start the schedules chained to this one
+	if h.Scheduler != nil {
+		go h.Scheduler.Notify(scheduler.TriggerSourceSchedule, id, status)
+	}
+
 	if execErr != nil {
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"success": false,
@@ -489,9 +729,32 @@ func (h *SchedulesHandler) ManualRun(w http.ResponseWriter, r *http.Request) {
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"run_id":  runID,
-		"status":  "success",
-		"elapsed": elapsed,
+		"success":  true,
+		"run_id":   runID,
+		"status":   "success",
+		"elapsed":  elapsed,
+		"delivery": delivery,
 	})
 }
+
+// authorizeEmailDelivery checks that the caller may send a schedule's result
+// by email. Email goes out through admin-configured alert channels to any
+// address, so adding a channel or recipient list requires the admin role;
+// targets already on the schedule (previous) can be resubmitted by anyone.
+func authorizeEmailDelivery(db *database.DB, r *http.Request, targets, previous []scheduler.DeliveryTarget) (int, string) {
+	if !scheduler.AddsEmailTargets(targets, previous) {
+		return 0, ""
+	}
+	session := middleware.GetSession(r)
+	if session == nil {
+		return http.StatusUnauthorized, "Not authenticated"
+	}
+	isAdmin, err := db.IsUserRole(session.ClickhouseUser, "admin")
+	if err != nil {
+		return http.StatusInternalServerError, "Role check failed"
+	}
+	if !isAdmin {
+		return http.StatusForbidden, "Admin role required to add email delivery"
+	}
+	return 0, ""
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// publicShareQueryLimit is how many panel queries one share link may run
+	// per publicShareQueryWindow, across all of its viewers.
+	publicShareQueryLimit  = 120
+	publicShareQueryWindow = time.Minute
+)
+
+// publicShareLimiter is shared by every DashboardsHandler so the limit holds
+// per share rather than per handler instance.
+var publicShareLimiter = newShareRateLimiter(publicShareQueryLimit, publicShareQueryWindow)
+
+// shareRateLimiter is an in-memory fixed-window limiter keyed by share ID.
+type shareRateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*shareWindow
+}
+
+type shareWindow struct {
+	start time.Time
+	count int
+}
+
+func newShareRateLimiter(limit int, window time.Duration) *shareRateLimiter {
+	return &shareRateLimiter{limit: limit, window: window, windows: make(map[string]*shareWindow)}
+}
+
+// Allow records a request for key and reports whether it is within the
+// limit. When it is not, it also returns how long until the window resets.
+func (l *shareRateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		if len(l.windows) > 10000 {
+			l.prune(now)
+		}
+		l.windows[key] = &shareWindow{start: now, count: 1}
+		return true, 0
+	}
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// prune drops expired windows. The caller holds l.mu.
+func (l *shareRateLimiter) prune(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShareRateLimiterFixedWindow(t *testing.T) {
+	l := newShareRateLimiter(2, time.Minute)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a", now); !ok {
+			t.Fatalf("request %d should be allowed", i+1)
+		}
+	}
+	ok, retry := l.Allow("a", now.Add(10*time.Second))
+	if ok {
+		t.Fatal("third request in the window should be limited")
+	}
+	if retry != 50*time.Second {
+		t.Fatalf("expected 50s until reset, got %s", retry)
+	}
+	if ok, _ := l.Allow("b", now); !ok {
+		t.Fatal("other shares should have their own window")
+	}
+	if ok, _ := l.Allow("a", now.Add(time.Minute)); !ok {
+		t.Fatal("a new window should allow requests again")
+	}
+}
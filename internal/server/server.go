@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -38,6 +39,7 @@ type Server struct {
 	githubSyncer   *ghclient.Syncer
 	guardrails     *governance.GuardrailService
 	alerts         *alerts.Dispatcher
+	metricAlerts   *alerts.MetricEvaluator
 	router         chi.Router
 	http           *http.Server
 	frontendFS     fs.FS
@@ -53,10 +55,18 @@ func New(cfg *config.Config, db *database.DB, frontendFS fs.FS) *Server {
 	modelRunner := models.NewRunner(db, gw, cfg.AppSecretKey)
 	modelScheduler := models.NewScheduler(db, modelRunner)
 
+	// Start schedules chained to model builds and pipeline runs
+	modelRunner.OnModelComplete(func(modelID, status string) {
+		sched.Notify(scheduler.TriggerSourceModel, modelID, status)
+	})
+	pipeRunner.OnRunComplete(func(pipelineID, status string) {
+		sched.Notify(scheduler.TriggerSourcePipeline, pipelineID, status)
+	})
+
 	govStore := governance.NewStore(db)
 	govSyncer := governance.NewSyncer(govStore, db, gw, cfg.AppSecretKey)
 	chHarvester := clusterhealth.NewHarvester(clusterhealth.NewStore(db), db, gw, cfg.AppSecretKey)
-	githubSyncer := ghclient.NewSyncer(db, cfg.AppSecretKey)
+	githubSyncer := ghclient.NewSyncer(db, cfg.AppSecretKey, filepath.Join(filepath.Dir(cfg.DatabasePath), "git-cache"))
 	alertDispatcher := alerts.NewDispatcher(db, cfg)
 
 	s := &Server{
@@ -72,6 +82,7 @@ func New(cfg *config.Config, db *database.DB, frontendFS fs.FS) *Server {
 		githubSyncer:   githubSyncer,
 		guardrails:     governance.NewGuardrailService(govStore, db),
 		alerts:         alertDispatcher,
+		metricAlerts:   alerts.NewMetricEvaluator(db, gw, cfg.AppSecretKey),
 		router:         r,
 		frontendFS:     frontendFS,
 	}
@@ -159,6 +170,7 @@ func (s *Server) setupRoutes() {
 				cr.Post("/{id}/test", connectionsHandler.TestConnection)
 				cr.Get("/{id}/token", connectionsHandler.GetToken)
 				cr.Post("/{id}/regenerate-token", connectionsHandler.RegenerateToken)
+				cr.Get("/{id}/service-credentials", connectionsHandler.ListServiceCredentials)
 			})
 
 			// Saved queries (community; parameterized run is Pro-gated inside Routes)
@@ -207,14 +219,15 @@ func (s *Server) setupRoutes() {
 				pro.Use(middleware.RequirePro(cfg))
 
 				// Scheduled jobs
-				schedulesHandler := &handlers.SchedulesHandler{DB: db, Gateway: gw, Config: cfg}
+				schedulesHandler := &handlers.SchedulesHandler{DB: db, Gateway: gw, Config: cfg, Scheduler: s.scheduler}
 				pro.Route("/schedules", schedulesHandler.Routes)
 
 				// Governance
 				govHandler := &handlers.GovernanceHandler{
 					DB: db, Gateway: gw, Config: cfg,
-					Store:  s.govSyncer.GetStore(),
-					Syncer: s.govSyncer,
+					Store:        s.govSyncer.GetStore(),
+					Syncer:       s.govSyncer,
+					MetricAlerts: s.metricAlerts,
 				}
 				pro.Mount("/governance", govHandler.Routes())
 
@@ -282,6 +295,10 @@ func (s *Server) Start() error {
 	} else {
 		slog.Info("Cluster health harvester disabled (requires Pro license)")
 	}
+	if s.cfg.IsPro() {
+		s.githubSyncer.StartBackground()
+		s.metricAlerts.StartBackground()
+	}
 	s.alerts.Start()
 
 	if s.cfg.IsPro() {
@@ -302,6 +319,8 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	s.modelScheduler.Stop()
 	s.govSyncer.Stop()
 	s.chHarvester.Stop()
+	s.githubSyncer.Stop()
+	s.metricAlerts.Stop()
 	s.alerts.Stop()
 	s.gateway.Stop()
 	return s.http.Shutdown(ctx)
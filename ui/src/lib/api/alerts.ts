@@ -1,5 +1,5 @@
 import { apiDel, apiGet, apiPost, apiPut } from './client'
-import type { AlertChannel, AlertEvent, AlertRule } from '../types/alerts'
+import type { AlertChannel, AlertChannelType, AlertEvent, AlertMaintenanceWindow, AlertMetricRule, AlertRule, AlertSilence } from '../types/alerts'
 
 const BASE = '/api/governance/alerts'
 
@@ -21,7 +21,7 @@ export async function adminListAlertChannels(): Promise<AlertChannel[]> {
 
 export async function adminCreateAlertChannel(payload: {
   name: string
-  channel_type: 'smtp' | 'resend' | 'brevo'
+  channel_type: AlertChannelType
   is_active: boolean
   config: Record<string, unknown>
 }): Promise<void> {
@@ -30,7 +30,7 @@ export async function adminCreateAlertChannel(payload: {
 
 export async function adminUpdateAlertChannel(id: string, payload: {
   name?: string
-  channel_type?: 'smtp' | 'resend' | 'brevo'
+  channel_type?: AlertChannelType
   is_active?: boolean
   config?: Record<string, unknown>
 }): Promise<void> {
@@ -42,7 +42,7 @@ export async function adminDeleteAlertChannel(id: string): Promise<void> {
 }
 
 export async function adminTestAlertChannel(id: string, payload: {
-  recipients: string[]
+  recipients?: string[]
   subject?: string
   message?: string
 }): Promise<{ provider_message_id?: string }> {
@@ -95,3 +95,92 @@ export async function adminListAlertEvents(params: { limit?: number; eventType?:
   const res = await apiGet<{ events: AlertEvent[] }>(url)
   return res.events ?? []
 }
+
+export type AlertMetricRulePayload = {
+  name?: string
+  connection_id?: string
+  credential_id?: string
+  query?: string
+  condition?: string
+  threshold?: number
+  interval_seconds?: number
+  for_seconds?: number
+  severity?: string
+  enabled?: boolean
+}
+
+export async function adminListAlertMetricRules(): Promise<AlertMetricRule[]> {
+  const res = await apiGet<{ rules: AlertMetricRule[] }>(`${BASE}/metric-rules`)
+  return res.rules ?? []
+}
+
+export async function adminCreateAlertMetricRule(payload: AlertMetricRulePayload): Promise<void> {
+  await apiPost(`${BASE}/metric-rules`, payload)
+}
+
+export async function adminUpdateAlertMetricRule(id: string, payload: AlertMetricRulePayload): Promise<void> {
+  await apiPut(`${BASE}/metric-rules/${encodeURIComponent(id)}`, payload)
+}
+
+export async function adminDeleteAlertMetricRule(id: string): Promise<void> {
+  await apiDel(`${BASE}/metric-rules/${encodeURIComponent(id)}`)
+}
+
+export async function adminPreviewAlertMetricRule(payload: AlertMetricRulePayload): Promise<{ value: number | null; breached: boolean }> {
+  return apiPost<{ value: number | null; breached: boolean }>(`${BASE}/metric-rules/preview`, payload)
+}
+
+export async function adminAcknowledgeAlertEvent(id: string): Promise<void> {
+  await apiPost(`${BASE}/events/${encodeURIComponent(id)}/acknowledge`, {})
+}
+
+export type AlertEventMatcherPayload = {
+  event_type?: string
+  connection_id?: string
+  severities?: string[]
+  payload_matchers?: Record<string, string>
+}
+
+export async function adminListAlertSilences(): Promise<AlertSilence[]> {
+  const res = await apiGet<{ silences: AlertSilence[] }>(`${BASE}/silences`)
+  return res.silences ?? []
+}
+
+export async function adminCreateAlertSilence(payload: AlertEventMatcherPayload & {
+  comment: string
+  starts_at?: string
+  ends_at?: string
+  duration_minutes?: number
+}): Promise<void> {
+  await apiPost(`${BASE}/silences`, payload)
+}
+
+export async function adminExpireAlertSilence(id: string): Promise<void> {
+  await apiPost(`${BASE}/silences/${encodeURIComponent(id)}/expire`, {})
+}
+
+export type AlertMaintenanceWindowPayload = AlertEventMatcherPayload & {
+  name?: string
+  days?: number[]
+  start_time?: string
+  end_time?: string
+  timezone?: string
+  enabled?: boolean
+}
+
+export async function adminListAlertMaintenanceWindows(): Promise<AlertMaintenanceWindow[]> {
+  const res = await apiGet<{ windows: AlertMaintenanceWindow[] }>(`${BASE}/maintenance-windows`)
+  return res.windows ?? []
+}
+
+export async function adminCreateAlertMaintenanceWindow(payload: AlertMaintenanceWindowPayload): Promise<void> {
+  await apiPost(`${BASE}/maintenance-windows`, payload)
+}
+
+export async function adminUpdateAlertMaintenanceWindow(id: string, payload: AlertMaintenanceWindowPayload): Promise<void> {
+  await apiPut(`${BASE}/maintenance-windows/${encodeURIComponent(id)}`, payload)
+}
+
+export async function adminDeleteAlertMaintenanceWindow(id: string): Promise<void> {
+  await apiDel(`${BASE}/maintenance-windows/${encodeURIComponent(id)}`)
+}
@@ -50,6 +50,7 @@ export interface ClusterHealthSettings {
   retention_days: number
   poll_interval_seconds: number
   long_query_threshold_seconds: number
+  credential_id: string
   updated_at: string
 }
 
@@ -0,0 +1,46 @@
+import { apiGet, apiPost, apiPut, apiDel } from './client'
+import type { ServiceCredential } from '../types/api'
+
+const BASE = '/api/admin/service-credentials'
+
+/** Credentials of a connection, readable by any user for job assignment. */
+export async function listConnectionCredentials(connectionId: string): Promise<ServiceCredential[]> {
+  const res = await apiGet<ServiceCredential[]>(`/api/connections/${encodeURIComponent(connectionId)}/service-credentials`)
+  return res ?? []
+}
+
+export async function adminListServiceCredentials(connectionId?: string): Promise<ServiceCredential[]> {
+  const qs = connectionId ? `?connection_id=${encodeURIComponent(connectionId)}` : ''
+  const res = await apiGet<{ credentials: ServiceCredential[] }>(`${BASE}${qs}`)
+  return res.credentials ?? []
+}
+
+export async function adminCreateServiceCredential(data: {
+  connection_id: string; name: string; clickhouse_user: string; password: string; is_default: boolean
+}): Promise<ServiceCredential> {
+  const res = await apiPost<{ credential: ServiceCredential }>(BASE, data)
+  return res.credential
+}
+
+export async function adminUpdateServiceCredential(id: string, data: {
+  name?: string; clickhouse_user?: string; password?: string; is_default?: boolean
+}): Promise<ServiceCredential> {
+  const res = await apiPut<{ credential: ServiceCredential }>(`${BASE}/${encodeURIComponent(id)}`, data)
+  return res.credential
+}
+
+export async function adminDeleteServiceCredential(id: string): Promise<void> {
+  await apiDel(`${BASE}/${encodeURIComponent(id)}`)
+}
+
+export async function adminTestServiceCredential(id: string): Promise<{ success: boolean; error?: string; version?: string }> {
+  return apiPost<{ success: boolean; error?: string; version?: string }>(`${BASE}/${encodeURIComponent(id)}/test`)
+}
+
+export async function adminGetBackgroundJobSettings(): Promise<{ session_fallback: boolean }> {
+  return apiGet<{ session_fallback: boolean }>('/api/admin/background-jobs/settings')
+}
+
+export async function adminUpdateBackgroundJobSettings(data: { session_fallback: boolean }): Promise<{ session_fallback: boolean }> {
+  return apiPut<{ session_fallback: boolean }>('/api/admin/background-jobs/settings', data)
+}
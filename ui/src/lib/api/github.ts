@@ -1,5 +1,5 @@
 import { apiGet, apiPost, apiPut, apiDel } from './client'
-import type { GitHubIntegration, GitHubSyncLog, GitHubSyncResult } from '../types/models'
+import type { GitHubIntegration, GitHubSyncLog, GitHubSyncResult, GitHubPushResult, ModelSourceProvider } from '../types/models'
 
 const BASE = '/api/admin/github'
 
@@ -9,7 +9,7 @@ export async function getGitHubIntegration(connectionId: string): Promise<GitHub
 }
 
 export async function saveGitHubIntegration(connectionId: string, data: {
-  repo: string; branch: string; path: string; pat?: string
+  provider: ModelSourceProvider; url?: string; repo: string; branch: string; path: string; pat?: string
 }): Promise<void> {
   await apiPut(`${BASE}/${encodeURIComponent(connectionId)}`, data)
 }
@@ -27,6 +27,13 @@ export async function triggerGitHubSync(connectionId: string): Promise<GitHubSyn
   return res.result
 }
 
+export async function pushGitHubModels(connectionId: string, data: {
+  model_ids?: string[]; branch?: string; title?: string; body?: string; force?: boolean
+} = {}): Promise<GitHubPushResult> {
+  const res = await apiPost<{ result: GitHubPushResult }>(`${BASE}/${encodeURIComponent(connectionId)}/push`, data)
+  return res.result
+}
+
 export async function getGitHubSyncLogs(connectionId: string, limit = 20): Promise<GitHubSyncLog[]> {
   const res = await apiGet<{ logs: GitHubSyncLog[] }>(`${BASE}/${encodeURIComponent(connectionId)}/logs?limit=${limit}`)
   return res.logs ?? []
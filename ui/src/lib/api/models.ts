@@ -1,5 +1,5 @@
 import { apiGet, apiPost, apiPut, apiDel } from './client'
-import type { Model, ModelRun, ModelRunResult, ModelDAG, ValidationResult, ModelSchedule, Pipeline } from '../types/models'
+import type { Model, ModelRun, ModelRunResult, ModelDAG, ValidationResult, ModelSchedule, ModelSettings, CompiledModel, Pipeline } from '../types/models'
 
 const BASE = '/api/models'
 
@@ -43,6 +43,18 @@ export function runAllModels() {
   return apiPost<{ run_id: string }>(`${BASE}/run`)
 }
 
+export function compileModels(dryRun = false) {
+  return apiGet<{ dry_run: boolean; models: CompiledModel[] }>(`${BASE}/compile${dryRun ? '?dry_run=true' : ''}`)
+}
+
+export function getModelSettings() {
+  return apiGet<ModelSettings>(`${BASE}/settings`)
+}
+
+export function updateModelSettings(data: { parallelism: number }) {
+  return apiPut<ModelSettings>(`${BASE}/settings`, data)
+}
+
 export function runSingleModel(id: string) {
   return apiPost<{ run_id: string }>(`${BASE}/${id}/run`)
 }
@@ -59,6 +71,10 @@ export function listPipelines() {
   return apiGet<{ pipelines: Pipeline[] }>(`${BASE}/pipelines`)
 }
 
+export function rollbackModel(id: string) {
+  return apiPost<{ success: boolean }>(`${BASE}/${id}/rollback`)
+}
+
 export function runPipeline(anchorId: string) {
   return apiPost<{ run_id: string }>(`${BASE}/pipelines/${anchorId}/run`)
 }
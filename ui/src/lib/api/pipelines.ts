@@ -1,5 +1,5 @@
 import { apiGet, apiPost, apiPut, apiDel } from './client'
-import type { Pipeline, PipelineGraph, PipelineRun, PipelineRunLog } from '../types/pipelines'
+import type { Pipeline, PipelineCheckpoint, PipelineGraph, PipelineMetricPoint, PipelineRun, PipelineRunLog } from '../types/pipelines'
 
 const BASE = '/api/pipelines'
 
@@ -15,7 +15,7 @@ export function getPipeline(id: string) {
   return apiGet<{ pipeline: Pipeline; graph: PipelineGraph }>(`${BASE}/${id}`)
 }
 
-export function updatePipeline(id: string, data: { name: string; description?: string }) {
+export function updatePipeline(id: string, data: { name: string; description?: string; credential_id?: string }) {
   return apiPut<{ pipeline: Pipeline }>(`${BASE}/${id}`, data)
 }
 
@@ -48,6 +48,8 @@ export function getPipelineStatus(id: string) {
     bytes_ingested?: number
     batches_sent?: number
     errors_count?: number
+    rows_dead_lettered?: number
+    source_lag?: Record<string, number>
   }>(`${BASE}/${id}/status`)
 }
 
@@ -58,3 +60,20 @@ export function listRuns(id: string, limit = 20, offset = 0) {
 export function getRunLogs(id: string, runId: string, limit = 200) {
   return apiGet<{ logs: PipelineRunLog[] }>(`${BASE}/${id}/runs/${runId}/logs?limit=${limit}`)
 }
+
+export function getMetrics(id: string, opts: { runId?: string; from?: string; to?: string } = {}) {
+  const params = new URLSearchParams()
+  if (opts.runId) params.set('run_id', opts.runId)
+  if (opts.from) params.set('from', opts.from)
+  if (opts.to) params.set('to', opts.to)
+  const qs = params.toString()
+  return apiGet<{ points: PipelineMetricPoint[] }>(`${BASE}/${id}/metrics${qs ? `?${qs}` : ''}`)
+}
+
+export function getCheckpoint(id: string) {
+  return apiGet<{ checkpoints: PipelineCheckpoint[] }>(`${BASE}/${id}/checkpoint`)
+}
+
+export function resetCheckpoint(id: string) {
+  return apiDel(`${BASE}/${id}/checkpoint`)
+}
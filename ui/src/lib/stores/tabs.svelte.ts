@@ -1,6 +1,6 @@
 import type { ColumnMeta, QueryStats } from '../types/query'
 import type { ColumnFilter, ResultSort } from '../utils/result-filters'
-import type { ModelEditState } from '../types/models'
+import type { ModelEditState, ModelTest } from '../types/models'
 import { createUUID } from '../utils/uuid'
 import { pushTabRouteForTab } from './router.svelte'
 
@@ -870,7 +870,11 @@ function modelEditEqual(a: ModelEditState, b: ModelEditState): boolean {
     a.materialization === b.materialization &&
     a.sqlBody === b.sqlBody &&
     a.tableEngine === b.tableEngine &&
-    a.orderBy === b.orderBy
+    a.orderBy === b.orderBy &&
+    (a.partitionBy ?? '') === (b.partitionBy ?? '') &&
+    (a.uniqueKey ?? '') === (b.uniqueKey ?? '') &&
+    JSON.stringify(a.tests ?? []) === JSON.stringify(b.tests ?? []) &&
+    (a.credentialId ?? '') === (b.credentialId ?? '')
 }
 
 interface ModelTabInput {
@@ -882,6 +886,10 @@ interface ModelTabInput {
   sql_body: string
   table_engine: string
   order_by: string
+  partition_by?: string
+  unique_key?: string
+  tests?: ModelTest[]
+  credential_id?: string | null
   status: string
   last_error: string | null
 }
@@ -901,6 +909,10 @@ export function openModelTab(model: ModelTabInput, targetGroupId?: string): void
     sqlBody: model.sql_body,
     tableEngine: model.table_engine,
     orderBy: model.order_by,
+    partitionBy: model.partition_by ?? '',
+    uniqueKey: model.unique_key ?? '',
+    tests: model.tests ?? [],
+    credentialId: model.credential_id ?? '',
   }
 
   const tab: ModelTab = {
@@ -1,6 +1,8 @@
-export type AlertChannelType = 'smtp' | 'resend' | 'brevo'
+export type AlertChannelType = 'smtp' | 'resend' | 'brevo' | 'webhook' | 'slack' | 'teams' | 'pagerduty'
 export type AlertSeverity = 'info' | 'warn' | 'error' | 'critical'
-export type AlertEventType = 'policy.violation' | 'schedule.failed' | 'schedule.slow' | '*'
+export type AlertEventType = 'policy.violation' | 'schedule.failed' | 'schedule.slow' | 'schedule.delivery_failed' | 'metric.threshold' | '*'
+export type AlertMetricCondition = 'above' | 'below' | 'change_pct' | 'no_data'
+export type AlertMetricRuleState = 'ok' | 'pending' | 'firing'
 
 export interface AlertChannel {
   id: string
@@ -60,6 +62,63 @@ export interface AlertEvent {
   fingerprint?: string | null
   source_ref?: string | null
   status: string
+  resolves: boolean
   created_at: string
   processed_at?: string | null
+  suppressed_by?: string | null
+  acknowledged_by?: string | null
+  acknowledged_at?: string | null
+}
+
+export interface AlertMetricRule {
+  id: string
+  name: string
+  connection_id: string
+  credential_id?: string | null
+  query: string
+  condition: AlertMetricCondition
+  threshold: number
+  interval_seconds: number
+  for_seconds: number
+  severity: AlertSeverity
+  enabled: boolean
+  state: AlertMetricRuleState
+  pending_since?: string | null
+  last_value?: number | null
+  last_error?: string | null
+  last_evaluated_at?: string | null
+  next_evaluation_at?: string | null
+  created_by?: string | null
+  created_at: string
+  updated_at: string
+}
+
+export interface AlertEventMatcher {
+  event_type: AlertEventType | string
+  connection_id?: string | null
+  severities: AlertSeverity[]
+  payload_matchers: Record<string, string>
+}
+
+export interface AlertSilence extends AlertEventMatcher {
+  id: string
+  comment: string
+  starts_at: string
+  ends_at: string
+  created_by?: string | null
+  created_at: string
+}
+
+export interface AlertMaintenanceWindow extends AlertEventMatcher {
+  id: string
+  name: string
+  days: number[]
+  start_time: string
+  end_time: string
+  timezone: string
+  enabled: boolean
+  active: boolean
+  created_by?: string | null
+  created_at: string
+  updated_at: string
 }
@@ -70,6 +70,29 @@ export interface Dashboard {
   created_by: string
   created_at: string
   updated_at: string
+  variables?: DashboardVariable[]
+}
+
+/** Dashboard template variable, referenced in panel queries as $name */
+export interface DashboardVariable {
+  name: string
+  label: string
+  type: 'custom' | 'constant' | 'query'
+  query: string
+  options: string[]
+  value: string
+  multi: boolean
+  default: string[]
+}
+
+/** Dashboard variable with its available options and selected values */
+export interface ResolvedDashboardVariable {
+  name: string
+  label: string
+  type: DashboardVariable['type']
+  multi: boolean
+  options: string[]
+  values: string[]
 }
 
 /** Dashboard panel */
@@ -107,6 +130,38 @@ export interface Schedule {
   created_by: string
   created_at: string
   updated_at: string
+  credential_id: string | null
+  delivery: DeliveryTarget[]
+  triggers: ScheduleTrigger[]
+  max_retries: number
+  retry_backoff_seconds: number
+  concurrency_policy: 'skip' | 'queue' | 'allow'
+  precondition_query: string
+}
+
+/** Starts a schedule when another schedule, model or pipeline finishes */
+export interface ScheduleTrigger {
+  source_type: 'schedule' | 'model' | 'pipeline'
+  source_id: string
+  on: 'success' | 'failure' | 'any'
+}
+
+/** Destination a scheduled query's result is sent to after each run */
+export interface DeliveryTarget {
+  type: 'email' | 'webhook' | 's3'
+  format?: 'csv' | 'xlsx' | 'parquet'
+  channel_id?: string
+  recipients?: string[]
+  subject?: string
+  url?: string
+  headers?: Record<string, string>
+  endpoint?: string
+  bucket?: string
+  region?: string
+  access_key?: string
+  secret_key?: string
+  use_ssl?: boolean
+  key_template?: string
 }
 
 /** Schedule execution run */
@@ -119,6 +174,11 @@ export interface ScheduleRun {
   rows_affected: number
   elapsed_ms: number
   error: string | null
+  delivery_status: string | null
+  delivery_error: string | null
+  artifact_bytes: number
+  triggered_by: string | null
+  attempt: number
 }
 
 export interface StatThreshold {
@@ -169,3 +229,16 @@ export interface AdminStats {
   login_count: number
   query_count: number
 }
+
+/** ClickHouse login that background jobs run as (password never returned) */
+export interface ServiceCredential {
+  id: string
+  connection_id: string
+  name: string
+  clickhouse_user: string
+  is_default: boolean
+  created_by: string | null
+  last_used_at: string | null
+  created_at: string
+  updated_at: string
+}
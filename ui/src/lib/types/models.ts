@@ -1,7 +1,29 @@
-export type Materialization = 'view' | 'table'
+export type Materialization = 'view' | 'table' | 'incremental' | 'materialized_view' | 'dictionary'
 export type ModelStatus = 'draft' | 'success' | 'error'
 export type RunStatus = 'running' | 'success' | 'partial' | 'error'
 export type ResultStatus = 'pending' | 'running' | 'success' | 'error' | 'skipped'
+export type ModelTestType = 'not_null' | 'unique' | 'accepted_values' | 'relationships' | 'row_count' | 'sql'
+
+export interface ModelTest {
+  type: ModelTestType
+  column?: string
+  values?: string[]
+  to?: string
+  field?: string
+  min_rows?: number
+  max_rows?: number
+  sql?: string
+  severity: 'error' | 'warn'
+}
+
+export interface ModelTestResult {
+  name: string
+  type: ModelTestType
+  severity: 'error' | 'warn'
+  status: 'pass' | 'fail' | 'error'
+  failures: number
+  message?: string
+}
 
 export interface Model {
   id: string
@@ -13,6 +35,11 @@ export interface Model {
   sql_body: string
   table_engine: string
   order_by: string
+  partition_by: string
+  unique_key: string
+  layout: string
+  lifetime: string
+  tests: ModelTest[]
   status: ModelStatus
   last_error: string | null
   last_run_at: string | null
@@ -20,16 +47,22 @@ export interface Model {
   source: 'manual' | 'github'
   created_at: string
   updated_at: string
+  credential_id: string | null
 }
 
+export type ModelSourceProvider = 'github' | 'gitlab' | 'git' | 'local'
+
 export interface GitHubIntegration {
   enabled: boolean
+  provider: ModelSourceProvider
+  url: string
   repo: string
   branch: string
   path: string
   has_pat: boolean
   has_webhook_secret: boolean
   last_sync_sha: string
+  ready: boolean
 }
 
 export interface GitHubSyncLog {
@@ -54,6 +87,42 @@ export interface GitHubSyncResult {
   deleted: number
   unchanged: number
   commit_sha: string
+  conflicts: string[]
+}
+
+export interface GitHubPushResult {
+  branch: string
+  commit_sha: string
+  pull_request_number: number
+  pull_request_url: string
+  pushed: string[]
+  unchanged: number
+  behind: string[]
+  conflicts: string[]
+}
+
+export interface ColumnChange {
+  column: string
+  change: 'added' | 'removed' | 'type_changed'
+  old_type?: string
+  new_type?: string
+}
+
+export interface CompiledModel {
+  model_id: string
+  model_name: string
+  materialization: Materialization
+  resolved_sql: string
+  ddl: string[]
+  error?: string
+  columns?: { name: string; type: string }[]
+  deployed: boolean
+  schema_diff?: ColumnChange[]
+}
+
+export interface ModelSettings {
+  parallelism: number
+  max_parallelism: number
 }
 
 export interface ModelRun {
@@ -82,6 +151,7 @@ export interface ModelRunResult {
   started_at: string | null
   finished_at: string | null
   created_at: string
+  tests: ModelTestResult[]
 }
 
 export interface DAGNode {
@@ -146,4 +216,8 @@ export interface ModelEditState {
   sqlBody: string
   tableEngine: string
   orderBy: string
+  partitionBy: string
+  uniqueKey: string
+  tests: ModelTest[]
+  credentialId: string
 }